@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service/ws"
+)
+
+// prefix of the messages sent by simulated users, followed by the nanoseconds since the run started when sent
+const messagePrefix = "loadtest "
+
+// api calls the REST api of the server under test
+type api struct {
+	url    string
+	client *http.Client
+}
+
+// createUser signs up a user with a name unique to the run
+func (a *api) createUser(ctx context.Context, name string) (uuid.UUID, error) {
+	var user model.User
+	err := a.do(ctx, http.MethodPost, "/api/users", &model.CreateUserReq{Username: name}, http.StatusCreated, &user)
+	return user.ID, err
+}
+
+// createRoom creates a room on behalf of the creator, who becomes a member
+func (a *api) createRoom(ctx context.Context, name string, creatorID uuid.UUID) (uuid.UUID, error) {
+	var room model.Room
+	err := a.do(ctx, http.MethodPost, "/api/rooms", &model.CreateRoomReq{Name: name, UserID: creatorID}, http.StatusCreated, &room)
+	return room.ID, err
+}
+
+// join adds the user to the room as a member
+func (a *api) join(ctx context.Context, roomID, userID uuid.UUID) error {
+	return a.do(ctx, http.MethodPost, fmt.Sprintf("/api/rooms/%s/members", roomID), &model.CreateRoomMemberReq{UserID: userID}, http.StatusCreated, nil)
+}
+
+// activeMembers counts the users connected to the room
+func (a *api) activeMembers(ctx context.Context, roomID uuid.UUID) (int, error) {
+	var users []model.User
+	err := a.do(ctx, http.MethodGet, fmt.Sprintf("/api/rooms/%s/members/active", roomID), nil, http.StatusOK, &users)
+	// rooms without connected users are reported as not found
+	if statusErr, ok := err.(*statusError); ok && statusErr.status == http.StatusNotFound {
+		return 0, nil
+	}
+	return len(users), err
+}
+
+// statusError is a response of the api with an unexpected status
+type statusError struct {
+	method, path string
+	status       int
+	message      string
+}
+
+func (e *statusError) Error() string {
+	msg := fmt.Sprintf("%s %s returned %d: %s", e.method, e.path, e.status, e.message)
+	if e.status == http.StatusTooManyRequests {
+		msg += " (run the server with HTTP_RATE_LIMIT=0)"
+	}
+	return msg
+}
+
+// do calls the api, decoding the response into out when it has the wanted status
+func (a *api) do(ctx context.Context, method, path string, body any, status int, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&apiErr)
+		return &statusError{method: method, path: path, status: res.StatusCode, message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// user is a simulated user connected to one room. The counters are updated while the run goes on, while latencies
+// are read once the connection is closed
+type user struct {
+	id   uuid.UUID
+	room *room
+	conn *websocket.Conn
+
+	// messages written to the socket, and those the server rejected
+	sent     atomic.Int64
+	rejected atomic.Int64
+	// messages of other users received, along with their delivery latency
+	delivered atomic.Int64
+	latencies []time.Duration
+	// set when the server closed the connection while the run was going on
+	disconnected bool
+	// closed once the connection is closed
+	done chan struct{}
+}
+
+// room is a room of the run along with the users assigned to it
+type room struct {
+	id        uuid.UUID
+	users     []*user
+	connected atomic.Int64
+}
+
+// dial connects the user to their room
+func (u *user) dial(ctx context.Context, serverURL string) error {
+	wsURL := "ws" + strings.TrimPrefix(serverURL, "http") + "/ws/" + u.id.String() + "?" + url.Values{"roomId": {u.room.id.String()}}.Encode()
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, res, err := dialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		if res != nil {
+			return fmt.Errorf("websocket handshake returned %d", res.StatusCode)
+		}
+		return err
+	}
+	u.conn = conn
+	u.done = make(chan struct{})
+	u.room.connected.Add(1)
+	return nil
+}
+
+// read records the messages received until the connection is closed. Connections closed by the server before the run
+// stopped are counted as disconnects
+func (u *user) read(start time.Time, stopping *atomic.Bool) {
+	defer close(u.done)
+	for {
+		_, data, err := u.conn.ReadMessage()
+		if err != nil {
+			u.disconnected = !stopping.Load()
+			return
+		}
+		received := time.Since(start)
+		if stopping.Load() {
+			continue
+		}
+
+		// room messages are written on their own while other frames carry their type
+		var frame ws.Frame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			continue
+		}
+		if frame.Type == ws.FrameError {
+			u.rejected.Add(1)
+			continue
+		}
+		if frame.Type != "" {
+			continue
+		}
+		var message model.Message
+		if err := json.Unmarshal(data, &message); err != nil || !strings.HasPrefix(message.Content, messagePrefix) {
+			continue
+		}
+		sentAt, err := strconv.ParseInt(strings.TrimPrefix(message.Content, messagePrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		u.delivered.Add(1)
+		u.latencies = append(u.latencies, received-time.Duration(sentAt))
+	}
+}
+
+// send writes messages at the rate until the context is done, starting after a random share of the interval so that
+// users do not send in lockstep
+func (u *user) send(ctx context.Context, start time.Time, interval, offset time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-time.After(offset):
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		content := messagePrefix + strconv.FormatInt(int64(time.Since(start)), 10)
+		u.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := u.conn.WriteMessage(websocket.TextMessage, []byte(content)); err != nil {
+			// connections closed by the server are already counted as disconnects
+			if errors.Is(err, websocket.ErrCloseSent) || isClosed(u.done) {
+				return nil
+			}
+			return err
+		}
+		u.sent.Add(1)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeAll closes the connections as clients leaving their room would, closing those not acknowledged before the
+// deadline. Readers stop counting messages once the run is stopping, so deliveries still queued are not waited for
+func closeAll(users []*user, deadline time.Time) {
+	for _, u := range users {
+		if u.conn != nil {
+			u.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		}
+	}
+	for _, u := range users {
+		if u.conn == nil {
+			continue
+		}
+		select {
+		case <-u.done:
+		case <-time.After(time.Until(deadline)):
+		}
+		u.conn.Close()
+		<-u.done
+	}
+}
+
+func isClosed(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
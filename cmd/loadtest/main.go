@@ -0,0 +1,312 @@
+// Command loadtest measures how many concurrent websocket clients and messages per second a chat server handles. It
+// signs up simulated users spread across rooms, connects each of them to their room and has them send messages at a
+// fixed rate, then reports the delivery latency and drop rate of the messages.
+//
+// Without -url it runs against an in-process server over in-memory storage, configured from the env like the chat
+// server. A server started separately must have its rate limits disabled, or raised enough for the load
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/e2e"
+)
+
+// options of a run, set from the flags
+type options struct {
+	url         string
+	users       int
+	rooms       int
+	rate        float64
+	duration    time.Duration
+	drain       time.Duration
+	concurrency int
+	format      string
+	out         string
+}
+
+// progress is logged to stderr, away from the report and the logs of an in-process server
+var logger = log.New(os.Stderr, "", log.LstdFlags)
+
+func main() {
+	opts := &options{}
+	flag.StringVar(&opts.url, "url", "", "base url of the server under test, such as http://127.0.0.1:8000. an in-process server is started when empty")
+	flag.IntVar(&opts.users, "users", 100, "number of simulated users, each holding one websocket connection")
+	flag.IntVar(&opts.rooms, "rooms", 10, "number of rooms the users are spread across")
+	flag.Float64Var(&opts.rate, "rate", 1, "messages sent per second by each user. 0 only holds the connections open")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "how long users send messages")
+	flag.DurationVar(&opts.drain, "drain", 5*time.Second, "how long to wait for messages still in flight once users stop sending")
+	flag.IntVar(&opts.concurrency, "concurrency", 50, "number of api requests and websocket handshakes made at once during setup")
+	flag.StringVar(&opts.format, "format", "text", "report format: text or json")
+	flag.StringVar(&opts.out, "out", "", "file the report is written to instead of stdout")
+	flag.Parse()
+
+	if err := opts.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if opts.url == "" {
+		godotenv.Load()
+		cfg, err := config.New()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		// the server's own logs would drown the progress of the run
+		log.SetOutput(io.Discard)
+		h, err := e2e.Start(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer h.Close()
+		opts.url = h.Server.URL
+		logger.Printf("started in-process server at %s\n", opts.url)
+	}
+
+	// stop sending early on interrupt, still reporting on the messages sent so far
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := run(ctx, opts)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	out := os.Stdout
+	if opts.out != "" {
+		if out, err = os.Create(opts.out); err != nil {
+			logger.Fatal(err)
+		}
+		defer out.Close()
+	}
+	if err := report.write(out, opts.format); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func (o *options) validate() error {
+	switch {
+	case o.users < 1 || o.rooms < 1:
+		return errors.New("at least one user and one room are required")
+	case o.rooms > o.users:
+		return errors.New("every room needs a user to create it, so there cannot be more rooms than users")
+	case o.rate < 0:
+		return errors.New("rate cannot be negative")
+	case o.duration <= 0 || o.drain < 0:
+		return errors.New("duration must be positive and drain cannot be negative")
+	case o.concurrency < 1:
+		return errors.New("concurrency must be at least 1")
+	case o.format != "text" && o.format != "json":
+		return fmt.Errorf("unknown report format %q", o.format)
+	}
+	return nil
+}
+
+// run sets up the users and rooms, connects the users and has them send messages for the duration of the run
+func run(ctx context.Context, opts *options) (*Report, error) {
+	a := &api{
+		url:    strings.TrimRight(opts.url, "/"),
+		client: &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: opts.concurrency}},
+	}
+	rooms, users, err := setup(ctx, a, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// latencies are measured against the same clock by senders and receivers
+	start := time.Now()
+	var stopping atomic.Bool
+	connectTimes := make([]time.Duration, len(users))
+	var failures atomic.Int64
+	parallel(opts.concurrency, len(users), func(i int) error {
+		dialed := time.Now()
+		if err := users[i].dial(ctx, a.url); err != nil {
+			// the first failure explains the others
+			if failures.Add(1) == 1 {
+				logger.Printf("failed to connect: %v\n", err)
+			}
+			return nil
+		}
+		connectTimes[i] = time.Since(dialed)
+		go users[i].read(start, &stopping)
+		return nil
+	})
+	connected := len(users) - int(failures.Load())
+	logger.Printf("connected %d of %d users in %v\n", connected, len(users), time.Since(start).Round(time.Millisecond))
+	if connected == 0 {
+		return nil, errors.New("no user could connect")
+	}
+	times := connectTimes[:0]
+	for i, u := range users {
+		if u.conn != nil {
+			times = append(times, connectTimes[i])
+		}
+	}
+
+	// messages sent before every receiver is registered with the hub would be counted as dropped
+	if err := waitRegistered(ctx, a, rooms); err != nil {
+		return nil, err
+	}
+
+	logger.Printf("sending %g messages/s per user for %v\n", opts.rate, opts.duration)
+	sendCtx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+	if opts.rate > 0 {
+		interval := time.Duration(float64(time.Second) / opts.rate)
+		var wg sync.WaitGroup
+		var sendFailures atomic.Int64
+		for _, u := range users {
+			if u.conn == nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := u.send(sendCtx, start, interval, rand.N(interval)); err != nil && sendFailures.Add(1) == 1 {
+					logger.Printf("failed to send: %v\n", err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	<-sendCtx.Done()
+
+	// wait for the messages in flight, stopping early once all of them arrived
+	drain(opts.drain, users)
+	stopping.Store(true)
+	closeAll(users, time.Now().Add(time.Second))
+
+	return newReport(opts, users, times), nil
+}
+
+// setup creates the users and rooms, assigning users to rooms in turn. Each room is created by its first user and
+// joined by the others
+func setup(ctx context.Context, a *api, opts *options) ([]*room, []*user, error) {
+	// names are unique to the run so that runs against the same server do not collide
+	run := uuid.NewString()[:8]
+	logger.Printf("creating %d users in %d rooms\n", opts.users, opts.rooms)
+
+	rooms := make([]*room, opts.rooms)
+	for i := range rooms {
+		rooms[i] = &room{}
+	}
+	users := make([]*user, opts.users)
+	for i := range users {
+		users[i] = &user{room: rooms[i%opts.rooms]}
+		users[i].room.users = append(users[i].room.users, users[i])
+	}
+
+	err := parallel(opts.concurrency, len(users), func(i int) (err error) {
+		users[i].id, err = a.createUser(ctx, fmt.Sprintf("loadtest-%s-user-%d", run, i))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = parallel(opts.concurrency, len(rooms), func(i int) (err error) {
+		rooms[i].id, err = a.createRoom(ctx, fmt.Sprintf("loadtest-%s-room-%d", run, i), rooms[i].users[0].id)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = parallel(opts.concurrency, len(users), func(i int) error {
+		if users[i] == users[i].room.users[0] {
+			return nil
+		}
+		return a.join(ctx, users[i].room.id, users[i].id)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return rooms, users, nil
+}
+
+// waitRegistered waits until every room reports all of its connected users as active
+func waitRegistered(ctx context.Context, a *api, rooms []*room) error {
+	deadline := time.Now().Add(30 * time.Second)
+	for _, r := range rooms {
+		for {
+			active, err := a.activeMembers(ctx, r.id)
+			if err != nil {
+				return err
+			}
+			if int64(active) >= r.connected.Load() {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("room %s has %d of %d users active after 30s", r.id, active, r.connected.Load())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// drain waits up to the timeout for every expected message to be delivered
+func drain(timeout time.Duration, users []*user) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var expected, delivered int64
+		for _, u := range users {
+			if u.conn == nil {
+				continue
+			}
+			expected += (u.sent.Load() - u.rejected.Load()) * (u.room.connected.Load() - 1)
+			delivered += u.delivered.Load()
+		}
+		if delivered >= expected {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// parallel calls fn for each index from 0 to n with at most limit calls running at once, returning the first error.
+// Indexes not yet started when an error occurs are skipped
+func parallel(limit, n int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		failed   atomic.Bool
+	)
+	sem := make(chan struct{}, limit)
+	for i := range n {
+		if failed.Load() {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				once.Do(func() { firstErr = err })
+				failed.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// Report summarizes a run
+type Report struct {
+	Users           int     `json:"users"`
+	Rooms           int     `json:"rooms"`
+	Connected       int     `json:"connected"`
+	ConnectFailures int     `json:"connectFailures"`
+	DurationSec     float64 `json:"durationSec"`
+	// messages sent per second by each user
+	Rate float64 `json:"rate"`
+
+	// time taken by websocket handshakes
+	Connect Latency `json:"connect"`
+
+	// messages written by users, and those the server rejected, such as when rate limited
+	Sent     int64 `json:"sent"`
+	Rejected int64 `json:"rejected"`
+	// deliveries expected for the accepted messages, one per other user connected to the room, and those received
+	Expected  int64   `json:"expected"`
+	Delivered int64   `json:"delivered"`
+	Dropped   int64   `json:"dropped"`
+	DropRate  float64 `json:"dropRate"`
+	// accepted messages and deliveries per second over the run
+	SentPerSec      float64 `json:"sentPerSec"`
+	DeliveredPerSec float64 `json:"deliveredPerSec"`
+	// connections closed by the server during the run, such as slow consumers
+	Disconnects int `json:"disconnects"`
+
+	// time from a message being sent to it being received by another user
+	Latency Latency `json:"latency"`
+}
+
+// Latency is the distribution of a set of durations, in milliseconds
+type Latency struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	Max   float64 `json:"max"`
+}
+
+// newLatency computes the distribution of the durations, sorting them in place
+func newLatency(durations []time.Duration) Latency {
+	if len(durations) == 0 {
+		return Latency{}
+	}
+	slices.Sort(durations)
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	// nearest rank percentile
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(durations)))) - 1
+		return ms(durations[max(rank, 0)])
+	}
+	return Latency{
+		Count: len(durations),
+		Mean:  ms(total / time.Duration(len(durations))),
+		P50:   percentile(0.5),
+		P90:   percentile(0.9),
+		P99:   percentile(0.99),
+		P999:  percentile(0.999),
+		Max:   ms(durations[len(durations)-1]),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newReport summarizes the run of the users once their connections are closed
+func newReport(opts *options, users []*user, connectTimes []time.Duration) *Report {
+	report := &Report{
+		Users:       len(users),
+		Rooms:       opts.rooms,
+		DurationSec: opts.duration.Seconds(),
+		Rate:        opts.rate,
+		Connect:     newLatency(connectTimes),
+	}
+
+	var latencies []time.Duration
+	for _, u := range users {
+		if u.conn == nil {
+			report.ConnectFailures++
+			continue
+		}
+		report.Connected++
+		sent, rejected := u.sent.Load(), u.rejected.Load()
+		report.Sent += sent
+		report.Rejected += rejected
+		report.Expected += (sent - rejected) * (u.room.connected.Load() - 1)
+		report.Delivered += u.delivered.Load()
+		if u.disconnected {
+			report.Disconnects++
+		}
+		latencies = append(latencies, u.latencies...)
+	}
+	report.Latency = newLatency(latencies)
+
+	report.Dropped = max(report.Expected-report.Delivered, 0)
+	if report.Expected > 0 {
+		report.DropRate = float64(report.Dropped) / float64(report.Expected)
+	}
+	if report.DurationSec > 0 {
+		report.SentPerSec = float64(report.Sent-report.Rejected) / report.DurationSec
+		report.DeliveredPerSec = float64(report.Delivered) / report.DurationSec
+	}
+	return report
+}
+
+// write writes the report as JSON or as text
+func (r *Report) write(w io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	_, err := fmt.Fprintf(w, `users        %d in %d rooms, %d connected, %d failed
+connect      %s
+duration     %.1fs at %g messages/s per user
+sent         %d, %d rejected, %.1f/s
+delivered    %d of %d expected, %.1f/s
+dropped      %d (%.2f%%)
+disconnects  %d
+latency      %s
+`,
+		r.Users, r.Rooms, r.Connected, r.ConnectFailures,
+		r.Connect,
+		r.DurationSec, r.Rate,
+		r.Sent, r.Rejected, r.SentPerSec,
+		r.Delivered, r.Expected, r.DeliveredPerSec,
+		r.Dropped, r.DropRate*100,
+		r.Disconnects,
+		r.Latency)
+	return err
+}
+
+func (l Latency) String() string {
+	if l.Count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("mean %.2fms  p50 %.2fms  p90 %.2fms  p99 %.2fms  p99.9 %.2fms  max %.2fms", l.Mean, l.P50, l.P90, l.P99, l.P999, l.Max)
+}
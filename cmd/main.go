@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -13,11 +15,11 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/mrshabel/chat/internal/config"
 	"github.com/mrshabel/chat/internal/database"
-	"github.com/mrshabel/chat/internal/handler"
+	"github.com/mrshabel/chat/internal/logging"
 	"github.com/mrshabel/chat/internal/repository"
-	"github.com/mrshabel/chat/internal/router"
-	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/server"
 	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 var addr = flag.String("addr", "127.0.0.1:8000", "HTTP service address")
@@ -29,54 +31,116 @@ func main() {
 	// load configs
 	cfg, err := config.New()
 	if err != nil {
-		log.Fatal(err)
+		fatal("invalid config", err)
 	}
-
-	// initialize db
-	db, err := database.New(cfg)
-	if err != nil {
-		log.Fatal(err)
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat))
+
+	// initialize storage, keeping all data in memory when there is no database
+	var (
+		db    *database.DB
+		repos *repository.Repositories
+	)
+	if cfg.DbDriver == config.DriverMemory {
+		slog.Warn("storing data in memory, it is lost when the server stops")
+		repos = repository.NewMemoryRepositories()
+	} else {
+		if db, err = database.New(cfg); err != nil {
+			fatal("failed to connect to database", err)
+		}
+		if cfg.DbDriver == config.DriverSQLite {
+			repos = repository.NewSQLiteRepositories(db.DB)
+		} else {
+			repos = repository.NewPGRepositories(db.DB)
+		}
 	}
 
-	// initialize repositories, services
-	userRepo := repository.NewUserRepository(db.DB)
-	roomRepo := repository.NewRoomRepository(db.DB)
-	messageRepo := repository.NewMessageRepository(db.DB)
-
-	userService := service.NewUserService(userRepo)
-	roomService := service.NewRoomService(roomRepo)
-	messageService := service.NewMessageService(messageRepo)
-
-	// start ws hub
-	hub := ws.NewHub(roomService, messageService)
-	go hub.Run()
-
-	// create handlers
+	// run the migrate subcommand instead of the server when requested
+	if flag.Arg(0) == "migrate" {
+		if db == nil {
+			exit(errors.New("migrations require a database, set DB_DRIVER to postgres or sqlite"))
+		}
+		if err := runMigrate(context.Background(), db, flag.Args()[1:]); err != nil {
+			exit(err)
+		}
+		return
+	}
+	if db != nil && cfg.DbAutoMigrate {
+		if err := migrateUp(db); err != nil {
+			fatal("failed to migrate database", err)
+		}
+	}
 
-	roomHandler := handler.NewRoomHandler(hub, roomService, userService, messageService)
-	userHandler := handler.NewUserHandler(userService)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// register all routes
-	r := router.RegisterRoutes(roomHandler, userHandler)
+	// start the hub and register all routes, relaying hub events between server instances through the broker
+	srv, err := server.New(ctx, cfg, repos, newBroker(cfg, db, repos))
+	if err != nil {
+		fatal("failed to start hub", err)
+	}
+	// expose the connection pool stats along with the server's metrics
+	if db != nil {
+		srv.Metrics.MustRegister(collectors.NewDBStatsCollector(db.DB, cfg.DbDriver))
+	}
 
 	// http server
-	server := &http.Server{
-		Handler: r,
+	httpServer := &http.Server{
+		Handler: srv.Handler,
 		Addr:    *addr,
 	}
+	// shutting down does not cancel running requests, so stop the hub as soon as it starts for event streams to be
+	// closed with a reason rather than holding the shutdown up
+	httpServer.RegisterOnShutdown(cancel)
 
 	// start server in background
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("failed to start server: %v\n", err)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("failed to start server", err)
 		}
 	}()
-	log.Println("server started successfully")
+	slog.Info("server started", "addr", *addr)
+
+	if err := cleanup(httpServer); err != nil {
+		fatal("failed to shut down server", err)
+	}
+	slog.Info("server shutdown complete")
+}
+
+// fatal logs the error that stopped the server and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// exit prints the error of a subcommand, such as its usage, and exits
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// migrateUp applies all pending migrations before the server starts
+func migrateUp(db *database.DB) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background(), 0)
+	for _, migration := range applied {
+		slog.Info("applied migration", "version", migration.Version, "name", migration.Name)
+	}
+	return err
+}
 
-	if err := cleanup(server); err != nil {
-		log.Fatal(err)
+// newBroker creates the hub broker selected in the config
+func newBroker(cfg *config.Config, db *database.DB, repos *repository.Repositories) ws.Broker {
+	switch cfg.Broker {
+	case config.BrokerMemory:
+		return ws.NewMemoryBroker()
+	case config.BrokerRedis:
+		return ws.NewRedisBroker(cfg.RedisAddr)
+	default:
+		return ws.NewPGBroker(db.DB, database.ConnString(cfg), repos.Messages)
 	}
-	log.Println("server shutdown complete")
 }
 
 func cleanup(server *http.Server) error {
@@ -84,13 +148,13 @@ func cleanup(server *http.Server) error {
 	defer stop()
 
 	<-ctx.Done()
-	log.Println("shutdown signal received")
+	slog.Info("shutdown signal received")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		return fmt.Errorf("failed to shutdown server: %w", err)
+		return err
 	}
 	return nil
 }
@@ -1,38 +1,240 @@
 package config
 
 import (
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+)
+
+// supported slow consumer policies
+const (
+	OverflowDropOldest = "drop-oldest"
+	OverflowDropNewest = "drop-newest"
+	OverflowDisconnect = "disconnect"
+)
+
+// supported storage drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// supported log levels and formats
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// supported hub brokers
+const (
+	BrokerMemory   = "memory"
+	BrokerPostgres = "postgres"
+	BrokerRedis    = "redis"
 )
 
 type Config struct {
+	// storage backing the repositories. the sqlite driver stores data in the file at DbPath, for local development and
+	// single instance deployments, and the memory driver keeps all data in process memory, for tests
+	DbDriver   string
+	DbPath     string
 	Db         string
 	DbPassword string
 	DbUsername string
 	DbPort     string
 	DbHost     string
-	Port       int
+	// pending migrations are applied when the server starts unless disabled, in which case they are applied with the
+	// migrate subcommand
+	DbAutoMigrate bool
+	Port          int
+
+	// broker used to relay hub events between server instances
+	Broker    string
+	RedisAddr string
+
+	// per client send queue size and the policy applied when it is full
+	ClientQueueSize    int
+	ClientOverflow     string
+	ClientMaxOverflows int
+
+	// client messages are persisted in batches of up to MessageBatchSize messages, waiting at most
+	// MessageBatchWindowMs milliseconds for a batch to fill up
+	MessageBatchSize     int
+	MessageBatchWindowMs int
+
+	// failed webhook deliveries are attempted up to WebhookMaxAttempts times, waiting WebhookRetryDelayMs
+	// milliseconds before the first retry and doubling the delay after every subsequent one
+	WebhookMaxAttempts  int
+	WebhookRetryDelayMs int
+
+	// token bucket limits, as the average number allowed per minute along with the largest burst. a rate of 0
+	// disables the limit. api requests are limited per client ip, and messages per user and per room
+	HTTPRateLimit        int
+	HTTPRateBurst        int
+	MessageRateLimit     int
+	MessageRateBurst     int
+	RoomMessageRateLimit int
+	RoomMessageRateBurst int
+	// proxies in front of the server. requests they forward are attributed to the client ip in the X-Forwarded-For
+	// header, which is ignored when sent by anyone else
+	TrustedProxies []netip.Prefix
+
+	// token operators present to read the audit log of all rooms. the global audit log is disabled when empty
+	OperatorToken string
+
+	// minimum level of logged records, and whether they are written as text or json
+	LogLevel  string
+	LogFormat string
 }
 
 // New returns a config object from the env and a non-nil error if validation errors occurred
 func New() (*Config, error) {
 	// database configs
+	dbDriver := getEnv("DB_DRIVER", DriverPostgres)
+	switch dbDriver {
+	case DriverPostgres, DriverSQLite, DriverMemory:
+	default:
+		return nil, fmt.Errorf("invalid DB_DRIVER %q, expected one of postgres, sqlite or memory", dbDriver)
+	}
+	dbPath := getEnv("DB_PATH", "chat.db")
 	db := getEnv("DB_DATABASE", "chat")
 	dbPassword := getEnv("DB_PASSWORD", "postgres")
 	dbUsername := getEnv("DB_USERNAME", "postgres")
 	dbPort := getEnv("DB_PORT", "5432")
 	dbHost := getEnv("DB_HOST", "localhost")
+	dbAutoMigrate := getEnvBool("DB_AUTO_MIGRATE", true)
 
 	// server configs
 	port := getEnvInt("PORT", 8000)
 
+	// hub configs
+	// the postgres broker needs a postgres database, so other servers relay events in memory by default
+	defaultBroker := BrokerPostgres
+	if dbDriver != DriverPostgres {
+		defaultBroker = BrokerMemory
+	}
+	broker := getEnv("BROKER", defaultBroker)
+	switch broker {
+	case BrokerMemory, BrokerPostgres, BrokerRedis:
+	default:
+		return nil, fmt.Errorf("invalid BROKER %q, expected one of memory, postgres or redis", broker)
+	}
+	if broker == BrokerPostgres && dbDriver != DriverPostgres {
+		return nil, fmt.Errorf("BROKER postgres requires DB_DRIVER postgres")
+	}
+	redisAddr := getEnv("REDIS_ADDR", "localhost:6379")
+
+	// client configs
+	clientQueueSize := getEnvInt("CLIENT_QUEUE_SIZE", 64)
+	if clientQueueSize < 1 {
+		return nil, fmt.Errorf("CLIENT_QUEUE_SIZE must be at least 1")
+	}
+	clientOverflow := getEnv("CLIENT_OVERFLOW_POLICY", OverflowDisconnect)
+	switch clientOverflow {
+	case OverflowDropOldest, OverflowDropNewest, OverflowDisconnect:
+	default:
+		return nil, fmt.Errorf("invalid CLIENT_OVERFLOW_POLICY %q, expected one of drop-oldest, drop-newest or disconnect", clientOverflow)
+	}
+	clientMaxOverflows := getEnvInt("CLIENT_MAX_OVERFLOWS", 10)
+	if clientMaxOverflows < 1 {
+		return nil, fmt.Errorf("CLIENT_MAX_OVERFLOWS must be at least 1")
+	}
+
+	// message persistence configs
+	messageBatchSize := getEnvInt("MESSAGE_BATCH_SIZE", 100)
+	if messageBatchSize < 1 || messageBatchSize > 1000 {
+		return nil, fmt.Errorf("MESSAGE_BATCH_SIZE must be between 1 and 1000")
+	}
+	messageBatchWindowMs := getEnvInt("MESSAGE_BATCH_WINDOW_MS", 10)
+	if messageBatchWindowMs < 0 {
+		return nil, fmt.Errorf("MESSAGE_BATCH_WINDOW_MS cannot be negative")
+	}
+
+	// webhook configs
+	webhookMaxAttempts := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	if webhookMaxAttempts < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	webhookRetryDelayMs := getEnvInt("WEBHOOK_RETRY_DELAY_MS", 1000)
+	if webhookRetryDelayMs < 0 {
+		return nil, fmt.Errorf("WEBHOOK_RETRY_DELAY_MS cannot be negative")
+	}
+
+	// rate limit configs
+	httpRateLimit := getEnvInt("HTTP_RATE_LIMIT", 300)
+	httpRateBurst := getEnvInt("HTTP_RATE_BURST", 60)
+	messageRateLimit := getEnvInt("MESSAGE_RATE_LIMIT", 60)
+	messageRateBurst := getEnvInt("MESSAGE_RATE_BURST", 10)
+	roomMessageRateLimit := getEnvInt("ROOM_MESSAGE_RATE_LIMIT", 3000)
+	roomMessageRateBurst := getEnvInt("ROOM_MESSAGE_RATE_BURST", 200)
+	if httpRateLimit < 0 || httpRateBurst < 0 || messageRateLimit < 0 || messageRateBurst < 0 ||
+		roomMessageRateLimit < 0 || roomMessageRateBurst < 0 {
+		return nil, fmt.Errorf("rate limits and bursts cannot be negative")
+	}
+	trustedProxies, err := parsePrefixes(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// operator configs
+	operatorToken := getEnv("OPERATOR_TOKEN", "")
+
+	// logging configs
+	logLevel := getEnv("LOG_LEVEL", LogLevelInfo)
+	switch logLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q, expected one of debug, info, warn or error", logLevel)
+	}
+	logFormat := getEnv("LOG_FORMAT", LogFormatText)
+	switch logFormat {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q, expected text or json", logFormat)
+	}
+
 	return &Config{
-		Db:         db,
-		DbPassword: dbPassword,
-		DbUsername: dbUsername,
-		DbPort:     dbPort,
-		DbHost:     dbHost,
-		Port:       port,
+		DbDriver:      dbDriver,
+		DbPath:        dbPath,
+		Db:            db,
+		DbPassword:    dbPassword,
+		DbUsername:    dbUsername,
+		DbPort:        dbPort,
+		DbHost:        dbHost,
+		DbAutoMigrate: dbAutoMigrate,
+		Port:          port,
+		Broker:        broker,
+		RedisAddr:     redisAddr,
+
+		ClientQueueSize:    clientQueueSize,
+		ClientOverflow:     clientOverflow,
+		ClientMaxOverflows: clientMaxOverflows,
+
+		MessageBatchSize:     messageBatchSize,
+		MessageBatchWindowMs: messageBatchWindowMs,
+
+		WebhookMaxAttempts:  webhookMaxAttempts,
+		WebhookRetryDelayMs: webhookRetryDelayMs,
+
+		HTTPRateLimit:        httpRateLimit,
+		HTTPRateBurst:        httpRateBurst,
+		MessageRateLimit:     messageRateLimit,
+		MessageRateBurst:     messageRateBurst,
+		RoomMessageRateLimit: roomMessageRateLimit,
+		RoomMessageRateBurst: roomMessageRateBurst,
+		TrustedProxies:       trustedProxies,
+
+		OperatorToken: operatorToken,
+
+		LogLevel:  logLevel,
+		LogFormat: logFormat,
 	}, nil
 }
 
@@ -44,6 +246,39 @@ func getEnv(key string, fallback string) string {
 	return val
 }
 
+// parsePrefixes parses a comma separated list of ip addresses and cidr ranges, addresses being single address ranges
+func parsePrefixes(val string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an ip address nor a cidr range", item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	boolVal, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+	return boolVal
+}
+
 func getEnvInt(key string, fallback int) int {
 	val := os.Getenv(key)
 	if val == "" {
@@ -3,16 +3,19 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/mrshabel/chat/internal/config"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
+	_ "modernc.org/sqlite"
 )
 
 type DB struct {
 	*sql.DB
+	// driver the database was opened with, one of the config drivers
+	Driver string
 }
 
 var (
@@ -24,8 +27,18 @@ func New(cfg *config.Config) (*DB, error) {
 	if dbInstance != nil {
 		return dbInstance, nil
 	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.DbUsername, cfg.DbPassword, cfg.DbHost, cfg.DbPort, cfg.Db)
-	db, err := sql.Open("pgx", connStr)
+	var (
+		db  *sql.DB
+		err error
+	)
+	switch cfg.DbDriver {
+	case config.DriverPostgres:
+		db, err = sql.Open("pgx", ConnString(cfg))
+	case config.DriverSQLite:
+		db, err = sql.Open("sqlite", SQLiteConnString(cfg))
+	default:
+		return nil, fmt.Errorf("driver %q has no database", cfg.DbDriver)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -33,17 +46,29 @@ func New(cfg *config.Config) (*DB, error) {
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	log.Println("database connected successfully")
+	slog.Info("database connected", "driver", cfg.DbDriver)
 
-	// run simple migration
-	if err = migrate(db); err != nil {
-		log.Println("failed to perform db migration", err)
+	// setup connection pool. sqlite allows a single writer at a time, so its statements share one connection rather
+	// than waiting on each other's locks
+	if cfg.DbDriver == config.DriverSQLite {
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(30)
 	}
-
-	// setup connection pool
-	db.SetMaxOpenConns(30)
 	dbInstance = &DB{
-		db,
+		DB:     db,
+		Driver: cfg.DbDriver,
 	}
 	return dbInstance, nil
 }
+
+// SQLiteConnString composes the sqlite data source name from the config. Foreign keys are enforced like in postgres,
+// and times are written in a format read back as times
+func SQLiteConnString(cfg *config.Config) string {
+	return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_time_format=sqlite", cfg.DbPath)
+}
+
+// ConnString composes the postgres connection url from the config
+func ConnString(cfg *config.Config) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.DbUsername, cfg.DbPassword, cfg.DbHost, cfg.DbPort, cfg.Db)
+}
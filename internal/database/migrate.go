@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mrshabel/chat/internal/config"
+)
+
+// migrations of each driver are kept in a directory named after it, named {version}_{name}.up.sql and
+// {version}_{name}.down.sql, and applied in version order. the up migrations create their objects only if they do not
+// exist, so that databases created before versioning was introduced adopt them
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// key of the advisory lock held while migrating, so that concurrently starting instances migrate one at a time
+const migrationLockID = 0x63686174
+
+// dialect holds the statements the migrations of a driver differ in
+type dialect struct {
+	// creates the table recording the applied versions
+	createTable string
+	// take and release the migration lock, empty when the driver has none
+	lock, unlock string
+}
+
+var dialects = map[string]*dialect{
+	config.DriverPostgres: {
+		createTable: `
+            CREATE TABLE IF NOT EXISTS schema_migrations(
+                version INT PRIMARY KEY,
+                name VARCHAR(100) NOT NULL,
+                applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+            )
+        `,
+		lock:   fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockID),
+		unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockID),
+	},
+	// sqlite databases are served by a single instance, so there is no lock to take
+	config.DriverSQLite: {
+		createTable: `
+            CREATE TABLE IF NOT EXISTS schema_migrations(
+                version INTEGER PRIMARY KEY,
+                name VARCHAR(100) NOT NULL,
+                applied_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+            )
+        `,
+	},
+}
+
+// Migration is a versioned schema change along with the statements reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration along with when it was applied, nil when it is pending
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back the embedded migrations of the database driver, recording the applied versions in
+// schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    *dialect
+	migrations []*Migration
+}
+
+func NewMigrator(db *DB) (*Migrator, error) {
+	dialect, ok := dialects[db.Driver]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for driver %q", db.Driver)
+	}
+	migrations, err := loadMigrations(migrationFiles, "migrations/"+db.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db.DB, dialect: dialect, migrations: migrations}, nil
+}
+
+// loadMigrations reads the migrations in the directory, sorted by version. Every version needs both an up and a down
+// migration
+func loadMigrations(files fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.Glob(files, dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, path := range entries {
+		name := path[len(dir)+1:]
+		match := migrationFilePattern.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, _ := strconv.Atoi(match[1])
+		contents, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down migration", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies up to steps pending migrations in version order, or all of them when steps is 0. The applied
+// migrations are returned
+func (m *Migrator) Up(ctx context.Context, steps int) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			if err := run(ctx, conn, migration, migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				migration.Version, migration.Name); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back up to steps applied migrations, newest first. The rolled back migrations are returned
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if err := run(ctx, conn, migration, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`,
+				migration.Version); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists all migrations in version order along with when they were applied
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var statuses []*MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			status := &MigrationStatus{Migration: migration}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs the operation while holding the migration lock, along with the applied versions and when they were
+// applied. Session level advisory locks are held by a single connection, which the operation must use
+func (m *Migrator) locked(ctx context.Context, op func(conn *sql.Conn, versions map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		// the lock is released even when the operation was cancelled
+		defer conn.ExecContext(context.WithoutCancel(ctx), m.dialect.unlock)
+	}
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return err
+		}
+		versions[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	return op(conn, versions)
+}
+
+// run executes the migration statements along with the update of schema_migrations in a transaction
+func run(ctx context.Context, conn *sql.Conn, migration *Migration, statements, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,3 +1,6 @@
+-- trigram matching for room and user search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 -- create users
 CREATE TABLE IF NOT EXISTS users(
 	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -43,4 +46,8 @@ CREATE TABLE IF NOT EXISTS messages(
 );
 
 -- index to access room messages in descending order
-CREATE INDEX IF NOT EXISTS idx_messages_room_created_at ON messages(room_id, created_at DESC)
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_messages_room_created_at ON messages(room_id, created_at DESC);
+
+-- trigram indexes for room name and username search
+CREATE INDEX IF NOT EXISTS idx_rooms_name_trgm ON rooms USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
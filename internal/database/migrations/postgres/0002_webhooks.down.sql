@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outgoing_webhooks;
+DROP TABLE IF EXISTS incoming_webhooks;
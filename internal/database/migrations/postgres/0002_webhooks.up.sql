@@ -0,0 +1,25 @@
+-- create incoming webhooks, which post messages into a room under their name
+CREATE TABLE IF NOT EXISTS incoming_webhooks(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	-- sha-256 digest of the secret token. the token itself is only shown when the webhook is created
+	token_hash BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_incoming_webhooks_room_id ON incoming_webhooks(room_id);
+
+-- create outgoing webhooks, which receive the messages of a room
+CREATE TABLE IF NOT EXISTS outgoing_webhooks(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	-- key used to sign deliveries
+	secret VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_webhooks_room_id ON outgoing_webhooks(room_id);
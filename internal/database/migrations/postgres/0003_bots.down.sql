@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS bot_api_key_rooms;
+DROP TABLE IF EXISTS bot_api_keys;
+
+-- bots are left behind as human users
+ALTER TABLE users DROP COLUMN IF EXISTS kind;
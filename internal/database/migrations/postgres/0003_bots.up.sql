@@ -0,0 +1,21 @@
+-- user kind: human or bot
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kind VARCHAR(10) NOT NULL CHECK(kind IN ('human', 'bot')) DEFAULT 'human';
+
+-- create bot api keys, each scoped to a set of rooms
+CREATE TABLE IF NOT EXISTS bot_api_keys(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	bot_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	-- sha-256 digest of the key. the key itself is only shown when it is created
+	key_hash BYTEA UNIQUE NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_api_keys_bot_id ON bot_api_keys(bot_id);
+
+CREATE TABLE IF NOT EXISTS bot_api_key_rooms(
+	key_id UUID NOT NULL REFERENCES bot_api_keys(id) ON DELETE CASCADE,
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+
+	PRIMARY KEY(key_id, room_id)
+);
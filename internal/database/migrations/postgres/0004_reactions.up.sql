@@ -0,0 +1,9 @@
+-- create message reactions
+CREATE TABLE IF NOT EXISTS message_reactions(
+	message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	emoji VARCHAR(32) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+	PRIMARY KEY(message_id, user_id, emoji)
+);
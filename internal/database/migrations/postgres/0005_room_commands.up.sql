@@ -0,0 +1,17 @@
+-- room topic, set with the /topic command
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS topic VARCHAR(250) NOT NULL DEFAULT '';
+
+-- create custom room commands, each handled by either a bot or an outgoing webhook
+CREATE TABLE IF NOT EXISTS room_commands(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	name VARCHAR(32) NOT NULL,
+	description VARCHAR(200) NOT NULL DEFAULT '',
+	bot_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	webhook_id UUID REFERENCES outgoing_webhooks(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+	UNIQUE(room_id, name),
+	CHECK((bot_id IS NULL) <> (webhook_id IS NULL))
+);
@@ -0,0 +1,2 @@
+ALTER TABLE rooms DROP COLUMN IF EXISTS slow_mode_seconds;
+DROP TABLE IF EXISTS room_sanctions;
@@ -0,0 +1,21 @@
+-- create room sanctions. sanctions are never deleted so that they record who applied and lifted them
+CREATE TABLE IF NOT EXISTS room_sanctions(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind VARCHAR(10) NOT NULL CHECK(kind IN ('ban', 'mute', 'timeout')),
+	reason VARCHAR(500) NOT NULL DEFAULT '',
+	issued_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	-- sanctions without an expiry last until they are lifted
+	expires_at TIMESTAMPTZ,
+	revoked_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_sanctions_room_id ON room_sanctions(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_room_sanctions_active ON room_sanctions(room_id, user_id) WHERE revoked_at IS NULL;
+
+-- minimum number of seconds between messages of a user in the room, 0 when slow mode is off
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS slow_mode_seconds INT NOT NULL DEFAULT 0 CHECK(slow_mode_seconds >= 0);
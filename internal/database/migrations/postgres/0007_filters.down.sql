@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS flagged_messages;
+DROP TABLE IF EXISTS room_filters;
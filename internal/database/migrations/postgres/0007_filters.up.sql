@@ -0,0 +1,32 @@
+-- create content filter settings of rooms. messages of rooms without settings are not filtered
+CREATE TABLE IF NOT EXISTS room_filters(
+	room_id UUID PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+	blocked_words TEXT[] NOT NULL DEFAULT '{}',
+	word_action VARCHAR(10) NOT NULL DEFAULT 'mask' CHECK(word_action IN ('mask', 'reject', 'flag')),
+	-- links to other domains are subject to the link action, unless it is allow
+	allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+	link_action VARCHAR(10) NOT NULL DEFAULT 'allow' CHECK(link_action IN ('allow', 'reject', 'flag')),
+	spam_action VARCHAR(10) NOT NULL DEFAULT 'allow' CHECK(spam_action IN ('allow', 'reject', 'flag')),
+	updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- create messages held back by the content filters until a room admin reviews them
+CREATE TABLE IF NOT EXISTS flagged_messages(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	sender_username VARCHAR(100) NOT NULL,
+	content TEXT NOT NULL,
+	reasons TEXT[] NOT NULL DEFAULT '{}',
+	status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'approved', 'rejected')),
+	reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	reviewed_at TIMESTAMPTZ,
+	-- message sent once the flagged message was approved
+	message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_flagged_messages_room_id ON flagged_messages(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_flagged_messages_pending ON flagged_messages(room_id, created_at) WHERE status = 'pending';
@@ -0,0 +1,25 @@
+-- create reports of abusive messages. the reported message is copied so that reports outlive it
+CREATE TABLE IF NOT EXISTS message_reports(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	message_id UUID REFERENCES messages(id) ON DELETE SET NULL,
+	sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	sender_username VARCHAR(100) NOT NULL,
+	content TEXT NOT NULL,
+	reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	category VARCHAR(20) NOT NULL CHECK(category IN ('spam', 'harassment', 'hate', 'sexual', 'violence', 'other')),
+	details VARCHAR(500) NOT NULL DEFAULT '',
+	status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'resolved', 'dismissed')),
+	-- actions taken when the report was resolved
+	message_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	sanction_id UUID REFERENCES room_sanctions(id) ON DELETE SET NULL,
+	resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	resolved_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+	UNIQUE(message_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reports_room_id ON message_reports(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_message_reports_open ON message_reports(room_id, created_at) WHERE status = 'open';
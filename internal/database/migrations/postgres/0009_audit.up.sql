@@ -0,0 +1,15 @@
+-- create the audit log of mutating operations. events outlive their actors, rooms and targets
+CREATE TABLE IF NOT EXISTS audit_events(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	room_id UUID,
+	action VARCHAR(50) NOT NULL,
+	target_id UUID NOT NULL,
+	before JSONB,
+	after JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_room_id ON audit_events(room_id, created_at DESC) WHERE room_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id, created_at DESC);
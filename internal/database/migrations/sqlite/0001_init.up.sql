@@ -0,0 +1,46 @@
+-- ids are random version 4 uuids stored as text, and timestamps utc text with a fixed number of fractional digits
+-- so that they compare in time order
+CREATE TABLE IF NOT EXISTS users(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	username VARCHAR(100) UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS rooms(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	name VARCHAR(255) NOT NULL,
+	creator_id TEXT NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS room_members(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id),
+	user_id TEXT NOT NULL REFERENCES users(id),
+	-- role: admin or member
+	role VARCHAR(10) NOT NULL CHECK(role IN ('admin', 'member')) DEFAULT 'member',
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+
+	UNIQUE(room_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS messages(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id),
+	-- remove sender info when message is deleted
+	sender_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+	sender_username VARCHAR(100) NOT NULL,
+	content TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+-- index to access room messages in descending order
+CREATE INDEX IF NOT EXISTS idx_messages_room_created_at ON messages(room_id, created_at DESC);
+
+-- case insensitive indexes for prefix matches of room name and username search
+CREATE INDEX IF NOT EXISTS idx_rooms_name ON rooms(name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(username COLLATE NOCASE);
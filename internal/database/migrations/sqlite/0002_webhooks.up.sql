@@ -0,0 +1,25 @@
+-- create incoming webhooks, which post messages into a room under their name
+CREATE TABLE IF NOT EXISTS incoming_webhooks(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	-- sha-256 digest of the secret token. the token itself is only shown when the webhook is created
+	token_hash BLOB NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_incoming_webhooks_room_id ON incoming_webhooks(room_id);
+
+-- create outgoing webhooks, which receive the messages of a room
+CREATE TABLE IF NOT EXISTS outgoing_webhooks(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	-- key used to sign deliveries
+	secret VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_webhooks_room_id ON outgoing_webhooks(room_id);
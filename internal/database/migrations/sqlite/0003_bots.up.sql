@@ -0,0 +1,21 @@
+-- user kind: human or bot
+ALTER TABLE users ADD COLUMN kind VARCHAR(10) NOT NULL CHECK(kind IN ('human', 'bot')) DEFAULT 'human';
+
+-- create bot api keys, each scoped to a set of rooms
+CREATE TABLE IF NOT EXISTS bot_api_keys(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	bot_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	-- sha-256 digest of the key. the key itself is only shown when it is created
+	key_hash BLOB UNIQUE NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_bot_api_keys_bot_id ON bot_api_keys(bot_id);
+
+CREATE TABLE IF NOT EXISTS bot_api_key_rooms(
+	key_id TEXT NOT NULL REFERENCES bot_api_keys(id) ON DELETE CASCADE,
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+
+	PRIMARY KEY(key_id, room_id)
+);
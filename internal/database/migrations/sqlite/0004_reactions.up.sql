@@ -0,0 +1,9 @@
+-- create message reactions
+CREATE TABLE IF NOT EXISTS message_reactions(
+	message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	emoji VARCHAR(32) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+
+	PRIMARY KEY(message_id, user_id, emoji)
+);
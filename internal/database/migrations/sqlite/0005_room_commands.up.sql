@@ -0,0 +1,17 @@
+-- room topic, set with the /topic command
+ALTER TABLE rooms ADD COLUMN topic VARCHAR(250) NOT NULL DEFAULT '';
+
+-- create custom room commands, each handled by either a bot or an outgoing webhook
+CREATE TABLE IF NOT EXISTS room_commands(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	name VARCHAR(32) NOT NULL,
+	description VARCHAR(200) NOT NULL DEFAULT '',
+	bot_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	webhook_id TEXT REFERENCES outgoing_webhooks(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+
+	UNIQUE(room_id, name),
+	CHECK((bot_id IS NULL) <> (webhook_id IS NULL))
+);
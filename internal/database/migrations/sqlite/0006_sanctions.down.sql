@@ -0,0 +1,2 @@
+ALTER TABLE rooms DROP COLUMN slow_mode_seconds;
+DROP TABLE IF EXISTS room_sanctions;
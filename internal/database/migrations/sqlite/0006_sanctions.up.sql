@@ -0,0 +1,21 @@
+-- create room sanctions. sanctions are never deleted so that they record who applied and lifted them
+CREATE TABLE IF NOT EXISTS room_sanctions(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind VARCHAR(10) NOT NULL CHECK(kind IN ('ban', 'mute', 'timeout')),
+	reason VARCHAR(500) NOT NULL DEFAULT '',
+	issued_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	-- sanctions without an expiry last until they are lifted
+	expires_at TIMESTAMP,
+	revoked_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_sanctions_room_id ON room_sanctions(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_room_sanctions_active ON room_sanctions(room_id, user_id) WHERE revoked_at IS NULL;
+
+-- minimum number of seconds between messages of a user in the room, 0 when slow mode is off
+ALTER TABLE rooms ADD COLUMN slow_mode_seconds INT NOT NULL DEFAULT 0 CHECK(slow_mode_seconds >= 0);
@@ -0,0 +1,33 @@
+-- create content filter settings of rooms. messages of rooms without settings are not filtered. lists are stored as
+-- json arrays
+CREATE TABLE IF NOT EXISTS room_filters(
+	room_id TEXT PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+	blocked_words TEXT NOT NULL DEFAULT '[]',
+	word_action VARCHAR(10) NOT NULL DEFAULT 'mask' CHECK(word_action IN ('mask', 'reject', 'flag')),
+	-- links to other domains are subject to the link action, unless it is allow
+	allowed_domains TEXT NOT NULL DEFAULT '[]',
+	link_action VARCHAR(10) NOT NULL DEFAULT 'allow' CHECK(link_action IN ('allow', 'reject', 'flag')),
+	spam_action VARCHAR(10) NOT NULL DEFAULT 'allow' CHECK(spam_action IN ('allow', 'reject', 'flag')),
+	updated_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+-- create messages held back by the content filters until a room admin reviews them
+CREATE TABLE IF NOT EXISTS flagged_messages(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	sender_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+	sender_username VARCHAR(100) NOT NULL,
+	content TEXT NOT NULL,
+	reasons TEXT NOT NULL DEFAULT '[]',
+	status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'approved', 'rejected')),
+	reviewed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	reviewed_at TIMESTAMP,
+	-- message sent once the flagged message was approved
+	message_id TEXT REFERENCES messages(id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_flagged_messages_room_id ON flagged_messages(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_flagged_messages_pending ON flagged_messages(room_id, created_at) WHERE status = 'pending';
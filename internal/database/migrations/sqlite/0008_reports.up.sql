@@ -0,0 +1,25 @@
+-- create reports of abusive messages. the reported message is copied so that reports outlive it
+CREATE TABLE IF NOT EXISTS message_reports(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+	message_id TEXT REFERENCES messages(id) ON DELETE SET NULL,
+	sender_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+	sender_username VARCHAR(100) NOT NULL,
+	content TEXT NOT NULL,
+	reporter_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	category VARCHAR(20) NOT NULL CHECK(category IN ('spam', 'harassment', 'hate', 'sexual', 'violence', 'other')),
+	details VARCHAR(500) NOT NULL DEFAULT '',
+	status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'resolved', 'dismissed')),
+	-- actions taken when the report was resolved
+	message_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	sanction_id TEXT REFERENCES room_sanctions(id) ON DELETE SET NULL,
+	resolved_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	resolved_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+	updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')),
+
+	UNIQUE(message_id, reporter_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_reports_room_id ON message_reports(room_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_message_reports_open ON message_reports(room_id, created_at) WHERE status = 'open';
@@ -0,0 +1,16 @@
+-- create the audit log of mutating operations. events outlive their actors, rooms and targets. states are stored as
+-- json text
+CREATE TABLE IF NOT EXISTS audit_events(
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	actor_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+	room_id TEXT,
+	action VARCHAR(50) NOT NULL,
+	target_id TEXT NOT NULL,
+	before TEXT,
+	after TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_room_id ON audit_events(room_id, created_at DESC) WHERE room_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id, created_at DESC);
@@ -0,0 +1,165 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service/ws"
+)
+
+// Conn is a websocket connection of a user to a room, reading frames in the background
+type Conn struct {
+	User   *model.User
+	RoomID uuid.UUID
+	conn   *websocket.Conn
+	frames chan *ws.Frame
+	// closed once the connection is closed, after which err tells why
+	done chan struct{}
+	err  error
+}
+
+// Dial connects the user to the room, waiting until the hub has registered the connection
+func (h *Harness) Dial(ctx context.Context, user *model.User, roomID uuid.UUID) (*Conn, error) {
+	return h.dial(ctx, user, roomID, url.Values{})
+}
+
+// Resume reconnects the user to the room, asking for the messages sent since the last one it received
+func (h *Harness) Resume(ctx context.Context, user *model.User, roomID, lastMessageID uuid.UUID) (*Conn, error) {
+	return h.dial(ctx, user, roomID, url.Values{"lastEventId": {lastMessageID.String()}})
+}
+
+func (h *Harness) dial(ctx context.Context, user *model.User, roomID uuid.UUID, query url.Values) (*Conn, error) {
+	query.Set("roomId", roomID.String())
+	wsURL := "ws" + strings.TrimPrefix(h.Server.URL, "http") + "/ws/" + user.ID.String() + "?" + query.Encode()
+	conn, res, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		if res != nil {
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			json.NewDecoder(res.Body).Decode(&apiErr)
+			return nil, &APIError{Method: http.MethodGet, Path: "/ws/" + user.ID.String(), Status: res.StatusCode, Message: apiErr.Message}
+		}
+		return nil, err
+	}
+
+	c := &Conn{User: user, RoomID: roomID, conn: conn, frames: make(chan *ws.Frame, 1024), done: make(chan struct{})}
+	go c.read()
+	if err := h.WaitActive(ctx, roomID, user.ID, true); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// read queues the frames received until the connection is closed
+func (c *Conn) read() {
+	defer close(c.done)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		// room messages are written on their own while other frames carry their type
+		var frame ws.Frame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.err = fmt.Errorf("invalid frame %q: %w", data, err)
+			return
+		}
+		if frame.Type == "" {
+			frame = ws.Frame{Type: ws.FrameMessage, Message: new(model.Message)}
+			if err := json.Unmarshal(data, frame.Message); err != nil {
+				c.err = fmt.Errorf("invalid message %q: %w", data, err)
+				return
+			}
+		}
+		c.frames <- &frame
+	}
+}
+
+// Send sends a message to the room
+func (c *Conn) Send(content string) error {
+	c.conn.SetWriteDeadline(time.Now().Add(waitTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(content))
+}
+
+// Next waits for the next frame
+func (c *Conn) Next() (*ws.Frame, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-c.done:
+		// frames received before the connection closed are still delivered
+		select {
+		case frame := <-c.frames:
+			return frame, nil
+		default:
+		}
+		return nil, fmt.Errorf("%s: connection closed: %w", c.User.Username, c.err)
+	case <-time.After(waitTimeout):
+		return nil, fmt.Errorf("%s: no frame received within %v", c.User.Username, waitTimeout)
+	}
+}
+
+// NextMessage waits for the next frame, which must be a room message
+func (c *Conn) NextMessage() (*model.Message, error) {
+	frame, err := c.Next()
+	if err != nil {
+		return nil, err
+	}
+	if frame.Type != ws.FrameMessage {
+		return nil, fmt.Errorf("%s: received a %s frame, want a message", c.User.Username, frame.Type)
+	}
+	return frame.Message, nil
+}
+
+// ExpectMessages waits for room messages with the given contents, in order
+func (c *Conn) ExpectMessages(contents ...string) ([]*model.Message, error) {
+	messages := make([]*model.Message, 0, len(contents))
+	for _, content := range contents {
+		message, err := c.NextMessage()
+		if err != nil {
+			return nil, err
+		}
+		if message.Content != content || message.RoomID != c.RoomID {
+			return nil, fmt.Errorf("%s: received %q in room %s, want %q in room %s", c.User.Username, message.Content, message.RoomID, content, c.RoomID)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// ExpectClosed waits for the server to close the connection, returning the close frame it sent
+func (c *Conn) ExpectClosed() (*websocket.CloseError, error) {
+	for {
+		select {
+		case <-c.frames:
+			// frames sent before closing are not of interest
+		case <-c.done:
+			var closeErr *websocket.CloseError
+			if !errors.As(c.err, &closeErr) {
+				return nil, fmt.Errorf("%s: connection closed without a close frame: %w", c.User.Username, c.err)
+			}
+			return closeErr, nil
+		case <-time.After(waitTimeout):
+			return nil, fmt.Errorf("%s: connection still open after %v", c.User.Username, waitTimeout)
+		}
+	}
+}
+
+// Close closes the connection as a client leaving the room would
+func (c *Conn) Close() {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.conn.Close()
+	<-c.done
+}
@@ -0,0 +1,286 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// TestEndToEnd drives the flows the server is expected to support against a single server. Each flow creates its own
+// users and rooms, so they run in parallel
+func TestEndToEnd(t *testing.T) {
+	h := start(t)
+	scenarios := []struct {
+		name string
+		run  func(t *testing.T, ctx context.Context, h *Harness)
+	}{
+		{"history replay", historyReplay},
+		{"broadcast delivery", broadcastDelivery},
+		{"sender exclusion", senderExclusion},
+		{"client disconnect", clientDisconnect},
+		{"session replacement", sessionReplacement},
+		{"server disconnect", serverDisconnect},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			t.Parallel()
+			scenario.run(t, t.Context(), h)
+		})
+	}
+}
+
+// start boots a server with the settings of the env, shutting it down once the test and its subtests are done
+func start(t *testing.T) *Harness {
+	t.Helper()
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := Start(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// setupRoom creates a room owned by the first of the named users, with all of them as members
+func setupRoom(t *testing.T, ctx context.Context, h *Harness, names ...string) (*model.Room, []*model.User) {
+	t.Helper()
+	users := make([]*model.User, 0, len(names))
+	for _, name := range names {
+		user, err := h.CreateUser(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	room, err := h.CreateRoom(ctx, "room", users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the creator is added as an admin
+	for _, user := range users[1:] {
+		if err := h.Join(ctx, room.ID, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return room, users
+}
+
+// dial connects the user to the room, closing the connection once the test is done
+func dial(t *testing.T, ctx context.Context, h *Harness, user *model.User, roomID uuid.UUID) *Conn {
+	t.Helper()
+	conn, err := h.Dial(ctx, user, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// send sends a message over the connection
+func send(t *testing.T, conn *Conn, content string) {
+	t.Helper()
+	if err := conn.Send(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectMessages waits for room messages with the given contents on the connection, in order
+func expectMessages(t *testing.T, conn *Conn, contents ...string) []*model.Message {
+	t.Helper()
+	messages, err := conn.ExpectMessages(contents...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+// historyReplay checks that a joining client first receives the messages sent before it connected, oldest first
+func historyReplay(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob")
+	alice, bob := users[0], users[1]
+
+	contents := []string{"first", "second", "third"}
+	for _, content := range contents {
+		if _, err := h.Post(ctx, room.ID, alice.ID, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectMessages(t, dial(t, ctx, h, bob, room.ID), contents...)
+}
+
+// broadcastDelivery checks that a message sent over a websocket reaches every other member connected to the room
+// and is stored in its history
+func broadcastDelivery(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob", "carol")
+	conns := make([]*Conn, 0, len(users))
+	for _, user := range users {
+		conns = append(conns, dial(t, ctx, h, user, room.ID))
+	}
+
+	send(t, conns[0], "hello everyone")
+	var sent *model.Message
+	for _, conn := range conns[1:] {
+		messages := expectMessages(t, conn, "hello everyone")
+		if messages[0].SenderID != users[0].ID {
+			t.Fatalf("%s: message sent by %s, want %s", conn.User.Username, messages[0].SenderID, users[0].ID)
+		}
+		sent = messages[0]
+	}
+
+	// messages are delivered once stored
+	history, err := h.Messages(ctx, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(history, func(message *model.Message) bool { return message.ID == sent.ID }) {
+		t.Fatalf("message %s missing from the room history", sent.ID)
+	}
+}
+
+// senderExclusion checks that clients do not receive their own messages back
+func senderExclusion(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob")
+	alice := dial(t, ctx, h, users[0], room.ID)
+	bob := dial(t, ctx, h, users[1], room.ID)
+
+	// messages of a room are delivered in the order they were sent, so had alice's message been echoed back it
+	// would arrive before bob's reply
+	send(t, alice, "from alice")
+	expectMessages(t, bob, "from alice")
+	send(t, bob, "from bob")
+	expectMessages(t, alice, "from bob")
+}
+
+// clientDisconnect checks that a client leaving the room is no longer active while the others keep receiving
+// messages, and that on reconnecting it receives only the messages it missed
+func clientDisconnect(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob", "carol")
+	alice := dial(t, ctx, h, users[0], room.ID)
+	bob := dial(t, ctx, h, users[1], room.ID)
+	carol := dial(t, ctx, h, users[2], room.ID)
+
+	send(t, alice, "before")
+	expectMessages(t, bob, "before")
+	received := expectMessages(t, carol, "before")
+
+	carol.Close()
+	if err := h.WaitActive(ctx, room.ID, carol.User.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	send(t, alice, "while away")
+	expectMessages(t, bob, "while away")
+
+	carol, err := h.Resume(ctx, carol.User, room.ID, received[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(carol.Close)
+	// a live message following the missed one shows nothing else was replayed
+	send(t, alice, "after")
+	expectMessages(t, carol, "while away", "after")
+}
+
+// sessionReplacement checks that a user connecting again has their previous connection closed
+func sessionReplacement(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob")
+	alice := dial(t, ctx, h, users[0], room.ID)
+	first := dial(t, ctx, h, users[1], room.ID)
+	second := dial(t, ctx, h, users[1], room.ID)
+
+	expectClose(t, first, websocket.CloseNormalClosure, "connection replaced by a new session")
+	// the new session stays in the room
+	send(t, alice, "still there?")
+	expectMessages(t, second, "still there?")
+}
+
+// serverDisconnect checks that a banned member is disconnected and cannot join again, and that joining a room that
+// does not exist is refused
+func serverDisconnect(t *testing.T, ctx context.Context, h *Harness) {
+	room, users := setupRoom(t, ctx, h, "alice", "bob")
+	admin, bob := users[0], users[1]
+	conn := dial(t, ctx, h, bob, room.ID)
+
+	if err := h.Ban(ctx, room.ID, admin.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, conn, websocket.ClosePolicyViolation, "banned from the room")
+	if err := h.WaitActive(ctx, room.ID, bob.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("banned user joining", func(t *testing.T) {
+		expectRefused(t, http.StatusForbidden)(h.Dial(ctx, bob, room.ID))
+	})
+	t.Run("joining unknown room", func(t *testing.T) {
+		expectRefused(t, http.StatusNotFound)(h.Dial(ctx, admin, uuid.New()))
+	})
+}
+
+// expectClose waits for the server to close the connection with the code and reason
+func expectClose(t *testing.T, conn *Conn, code int, reason string) {
+	t.Helper()
+	closeErr, err := conn.ExpectClosed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closeErr.Code != code || closeErr.Text != reason {
+		t.Fatalf("%s: closed with %d %q, want %d %q", conn.User.Username, closeErr.Code, closeErr.Text, code, reason)
+	}
+}
+
+// expectRefused checks that a websocket handshake was refused by the api with the status
+func expectRefused(t *testing.T, status int) func(conn *Conn, err error) {
+	return func(conn *Conn, err error) {
+		t.Helper()
+		if err == nil {
+			conn.Close()
+			t.Fatalf("connection accepted, want it refused with %d", status)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != status {
+			t.Fatalf("handshake failed with %v, want status %d", err, status)
+		}
+	}
+}
+
+// TestShutdownClosesConnections checks that a graceful shutdown closes the event streams and websockets of the
+// server, telling their clients why, rather than waiting on the streams until it times out
+func TestShutdownClosesConnections(t *testing.T) {
+	h := start(t)
+	ctx := t.Context()
+	room, users := setupRoom(t, ctx, h, "alice", "bob")
+	stream, err := h.Stream(ctx, users[0], room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stream.Close)
+	conn := dial(t, ctx, h, users[1], room.ID)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, waitTimeout)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- h.Shutdown(shutdownCtx) }()
+
+	code, reason, err := stream.ExpectClosed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != websocket.CloseGoingAway || reason != "server shutting down" {
+		t.Fatalf("stream closed with %d %q, want %d %q", code, reason, websocket.CloseGoingAway, "server shutting down")
+	}
+	expectClose(t, conn, websocket.CloseGoingAway, "server shutting down")
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+}
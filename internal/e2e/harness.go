@@ -0,0 +1,187 @@
+// Package e2e exercises the chat server end to end. A harness boots the full router and hub on an httptest server over
+// in-memory storage, and the package's tests drive it through the REST api and websocket clients as real users would
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+	"github.com/mrshabel/chat/internal/server"
+	"github.com/mrshabel/chat/internal/service/ws"
+)
+
+// time waited for the server to deliver a frame or reach an expected state
+const waitTimeout = 5 * time.Second
+
+// Harness is an in-process chat server along with helpers to call its api
+type Harness struct {
+	Server *httptest.Server
+	Hub    *ws.Hub
+	cancel context.CancelFunc
+}
+
+// Start boots the chat server over in-memory repositories and broker with the settings of the config. Rate limits are
+// disabled so that tests sending messages back to back are not throttled
+func Start(cfg *config.Config) (*Harness, error) {
+	settings := *cfg
+	cfg = &settings
+	cfg.DbDriver, cfg.Broker = config.DriverMemory, config.BrokerMemory
+	cfg.HTTPRateLimit, cfg.MessageRateLimit, cfg.RoomMessageRateLimit = 0, 0, 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, err := server.New(ctx, cfg, repository.NewMemoryRepositories(), ws.NewMemoryBroker())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// like the server binary, the hub stops when a graceful shutdown starts
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.Config.RegisterOnShutdown(cancel)
+	ts.Start()
+	return &Harness{Server: ts, Hub: srv.Hub, cancel: cancel}, nil
+}
+
+// Shutdown gracefully shuts the server down, waiting for running requests such as event streams to end
+func (h *Harness) Shutdown(ctx context.Context) error {
+	return h.Server.Config.Shutdown(ctx)
+}
+
+// Close shuts the server down, closing all connections
+func (h *Harness) Close() {
+	h.Server.CloseClientConnections()
+	h.Server.Close()
+	h.cancel()
+}
+
+// CreateUser signs a user up with a name unique to the run, starting with the given name
+func (h *Harness) CreateUser(ctx context.Context, name string) (*model.User, error) {
+	var user model.User
+	err := h.do(ctx, http.MethodPost, "/api/users", &model.CreateUserReq{Username: uniqueName(name)}, http.StatusCreated, &user)
+	return &user, err
+}
+
+// CreateRoom creates a room with a name unique to the run on behalf of the creator, who becomes its admin
+func (h *Harness) CreateRoom(ctx context.Context, name string, creatorID uuid.UUID) (*model.Room, error) {
+	var room model.Room
+	err := h.do(ctx, http.MethodPost, "/api/rooms", &model.CreateRoomReq{Name: uniqueName(name), UserID: creatorID}, http.StatusCreated, &room)
+	return &room, err
+}
+
+// Join adds the user to the room as a member
+func (h *Harness) Join(ctx context.Context, roomID, userID uuid.UUID) error {
+	return h.do(ctx, http.MethodPost, fmt.Sprintf("/api/rooms/%s/members", roomID), &model.CreateRoomMemberReq{UserID: userID}, http.StatusCreated, nil)
+}
+
+// Post sends a message to the room through the REST api
+func (h *Harness) Post(ctx context.Context, roomID, userID uuid.UUID, content string) (*model.Message, error) {
+	var message model.Message
+	err := h.do(ctx, http.MethodPost, fmt.Sprintf("/api/rooms/%s/messages", roomID), &model.CreateMessageReq{UserID: userID, Content: content}, http.StatusCreated, &message)
+	return &message, err
+}
+
+// Messages retrieves the most recent messages of the room, newest first
+func (h *Harness) Messages(ctx context.Context, roomID uuid.UUID) ([]*model.Message, error) {
+	var messages []*model.Message
+	err := h.do(ctx, http.MethodGet, fmt.Sprintf("/api/rooms/%s/messages?limit=50", roomID), nil, http.StatusOK, &messages)
+	return messages, err
+}
+
+// Ban bans the user from the room on behalf of one of its admins
+func (h *Harness) Ban(ctx context.Context, roomID, adminID, userID uuid.UUID) error {
+	req := &model.CreateSanctionReq{ActorID: adminID, UserID: userID, Kind: model.SanctionBan, Reason: "e2e"}
+	return h.do(ctx, http.MethodPost, fmt.Sprintf("/api/rooms/%s/sanctions", roomID), req, http.StatusCreated, nil)
+}
+
+// ActiveMembers retrieves the users connected to the room
+func (h *Harness) ActiveMembers(ctx context.Context, roomID uuid.UUID) ([]model.User, error) {
+	var users []model.User
+	err := h.do(ctx, http.MethodGet, fmt.Sprintf("/api/rooms/%s/members/active", roomID), nil, http.StatusOK, &users)
+	// rooms without connected users are reported as not found
+	if apiErr, ok := err.(*APIError); ok && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	return users, err
+}
+
+// WaitActive waits until the user is connected to the room, or no longer connected when active is false
+func (h *Harness) WaitActive(ctx context.Context, roomID, userID uuid.UUID, active bool) error {
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		users, err := h.ActiveMembers(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		found := slices.ContainsFunc(users, func(user model.User) bool { return user.ID == userID })
+		if found == active {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if active {
+				return fmt.Errorf("user %s did not connect to room %s within %v", userID, roomID, waitTimeout)
+			}
+			return fmt.Errorf("user %s is still connected to room %s after %v", userID, roomID, waitTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// APIError is a response of the api with an unexpected status
+type APIError struct {
+	Method, Path string
+	Status       int
+	Message      string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s returned %d: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// do calls the api, decoding the response into out when it has the wanted status
+func (h *Harness) do(ctx context.Context, method, path string, body any, status int, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.Server.URL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := h.Server.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&apiErr)
+		return &APIError{Method: method, Path: path, Status: res.StatusCode, Message: apiErr.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// uniqueName suffixes the name so that tests never collide on unique names
+func uniqueName(name string) string {
+	return name + "-" + uuid.NewString()[:8]
+}
@@ -0,0 +1,118 @@
+package e2e
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// Stream is a server-sent event stream of a user's room, reading events in the background
+type Stream struct {
+	User   *model.User
+	RoomID uuid.UUID
+	res    *http.Response
+	events chan *StreamEvent
+	// closed once the stream ends, after which err tells why
+	done chan struct{}
+	err  error
+}
+
+// StreamEvent is a named event of a stream along with its data
+type StreamEvent struct {
+	Name string
+	Data string
+}
+
+// Stream opens an event stream of the room for the user, waiting until the hub has registered it
+func (h *Harness) Stream(ctx context.Context, user *model.User, roomID uuid.UUID) (*Stream, error) {
+	path := fmt.Sprintf("/api/rooms/%s/events?userId=%s", roomID, user.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.Server.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.Server.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&apiErr)
+		return nil, &APIError{Method: http.MethodGet, Path: path, Status: res.StatusCode, Message: apiErr.Message}
+	}
+
+	s := &Stream{User: user, RoomID: roomID, res: res, events: make(chan *StreamEvent, 1024), done: make(chan struct{})}
+	go s.read()
+	if err := h.WaitActive(ctx, roomID, user.ID, true); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// read queues the named events received until the stream ends. comments and retry hints are skipped
+func (s *Stream) read() {
+	defer close(s.done)
+	scanner := bufio.NewScanner(s.res.Body)
+	evt := new(StreamEvent)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if evt.Name != "" {
+				s.events <- evt
+			}
+			evt = new(StreamEvent)
+		case strings.HasPrefix(line, "event: "):
+			evt.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			evt.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	s.err = scanner.Err()
+}
+
+// ExpectClosed waits for the server to close the stream, returning the code and reason of its close event
+func (s *Stream) ExpectClosed() (int, string, error) {
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case evt := <-s.events:
+			// events sent before closing are not of interest
+			if evt.Name != "close" {
+				continue
+			}
+			var closed struct {
+				Code   int    `json:"code"`
+				Reason string `json:"reason"`
+			}
+			if err := json.Unmarshal([]byte(evt.Data), &closed); err != nil {
+				return 0, "", fmt.Errorf("%s: invalid close event %q: %w", s.User.Username, evt.Data, err)
+			}
+			return closed.Code, closed.Reason, nil
+		case <-s.done:
+			// events received before the stream ended are still delivered
+			if len(s.events) > 0 {
+				continue
+			}
+			return 0, "", fmt.Errorf("%s: stream ended without a close event: %v", s.User.Username, s.err)
+		case <-timeout:
+			return 0, "", fmt.Errorf("%s: stream still open after %v", s.User.Username, waitTimeout)
+		}
+	}
+}
+
+// Close ends the stream as a client leaving the room would
+func (s *Stream) Close() {
+	s.res.Body.Close()
+	<-s.done
+}
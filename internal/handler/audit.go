@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+	// token operators present to read the global audit log, which is disabled when empty
+	operatorToken string
+}
+
+func NewAuditHandler(service *service.AuditService, operatorToken string) *AuditHandler {
+	return &AuditHandler{service: service, operatorToken: operatorToken}
+}
+
+// GetRoomAudit lists the audit events of the room for a room admin, newest first
+func (h *AuditHandler) GetRoomAudit(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+	q, ok := auditQuery(w, r)
+	if !ok {
+		return
+	}
+	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	events, err := h.service.GetByRoomID(r.Context(), roomID, actorID, q, limit, skip)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can view the audit log", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get audit log", err)
+		return
+	}
+
+	util.WriteJSON(w, events, http.StatusOK)
+}
+
+// GetAudit lists the audit events of all rooms and users for an operator presenting the operator token, newest first
+func (h *AuditHandler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Operator-Token")
+	if h.operatorToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.operatorToken)) != 1 {
+		util.WriteError(w, "Invalid operator token", http.StatusUnauthorized)
+		return
+	}
+	q, ok := auditQuery(w, r)
+	if !ok {
+		return
+	}
+	if roomID := util.GetQueryStr(r, "roomId"); roomID != "" {
+		id, err := util.GetQueryUUID(r, "roomId")
+		if err != nil {
+			util.WriteError(w, "Invalid room ID", http.StatusUnprocessableEntity)
+			return
+		}
+		q.RoomID = &id
+	}
+	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	events, err := h.service.GetAll(r.Context(), q, limit, skip)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to get audit log", err)
+		return
+	}
+
+	util.WriteJSON(w, events, http.StatusOK)
+}
+
+// auditQuery parses the filters of the audit log from the query params, writing the error response when they are
+// invalid. Events are filtered by the user who performed them, the action and the time range
+func auditQuery(w http.ResponseWriter, r *http.Request) (*model.AuditQuery, bool) {
+	q := &model.AuditQuery{Action: util.GetQueryStr(r, "action")}
+	if util.GetQueryStr(r, "performedBy") != "" {
+		id, err := util.GetQueryUUID(r, "performedBy")
+		if err != nil {
+			util.WriteError(w, "Invalid performedBy user ID", http.StatusUnprocessableEntity)
+			return nil, false
+		}
+		q.ActorID = &id
+	}
+	var err error
+	if q.Since, err = util.GetQueryTime(r, "since"); err != nil {
+		util.WriteError(w, "Invalid since, expected an RFC 3339 timestamp", http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	if q.Until, err = util.GetQueryTime(r, "until"); err != nil {
+		util.WriteError(w, "Invalid until, expected an RFC 3339 timestamp", http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	if err := q.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return q, true
+}
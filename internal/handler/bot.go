@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type BotHandler struct {
+	Hub             *ws.Hub
+	service         *service.BotService
+	messageService  *service.MessageService
+	reactionService *service.ReactionService
+	sanctionService *service.SanctionService
+}
+
+func NewBotHandler(hub *ws.Hub, service *service.BotService, messageService *service.MessageService, reactionService *service.ReactionService, sanctionService *service.SanctionService) *BotHandler {
+	return &BotHandler{
+		Hub:             hub,
+		service:         service,
+		messageService:  messageService,
+		reactionService: reactionService,
+		sanctionService: sanctionService,
+	}
+}
+
+func (h *BotHandler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateUserReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	bot, err := h.service.Create(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrUserAlreadyExist) {
+			util.WriteError(w, "Username already taken", http.StatusConflict)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to create bot", err)
+		return
+	}
+
+	util.WriteJSON(w, bot, http.StatusCreated)
+}
+
+// CreateKey creates an api key for the bot scoped to the requested rooms on behalf of an admin of all of them,
+// returning the key once
+func (h *BotHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	botID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid bot ID", http.StatusBadRequest)
+		return
+	}
+	var req model.CreateAPIKeyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	key, err := h.service.CreateKey(r.Context(), botID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBotNotFound):
+			util.WriteError(w, "Bot not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrRoomNotFound):
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only admins of all the key's rooms can manage it", http.StatusForbidden)
+		default:
+			util.WriteServerError(w, r, "Failed to create API key", err)
+		}
+		return
+	}
+
+	util.WriteJSON(w, key, http.StatusCreated)
+}
+
+// GetKeys lists the keys of the bot that the actor is an admin of all the rooms of
+func (h *BotHandler) GetKeys(w http.ResponseWriter, r *http.Request) {
+	botID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid bot ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	keys, err := h.service.GetKeys(r.Context(), botID, actorID)
+	if err != nil {
+		if errors.Is(err, service.ErrBotNotFound) {
+			util.WriteError(w, "Bot not found", http.StatusNotFound)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get API keys", err)
+		return
+	}
+
+	util.WriteJSON(w, keys, http.StatusOK)
+}
+
+// DeleteKey revokes a key of the bot on behalf of an admin of all its rooms
+func (h *BotHandler) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	botID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid bot ID", http.StatusBadRequest)
+		return
+	}
+	keyID, err := util.GetParamUUID(r, "keyId")
+	if err != nil {
+		util.WriteError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.service.DeleteKey(r.Context(), botID, keyID, actorID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAPIKeyNotFound):
+			util.WriteError(w, "API key not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only admins of all the key's rooms can manage it", http.StatusForbidden)
+		default:
+			util.WriteServerError(w, r, "Failed to delete API key", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JoinRoom connects the bot to a room over a websocket, receiving the room's frames and sending messages
+func (h *BotHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetQueryUUID(r, "roomId")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusUnprocessableEntity)
+		return
+	}
+	key, ok := h.authorize(w, r, roomID)
+	if !ok {
+		return
+	}
+	sanctions, ok := checkSanctions(w, r, h.sanctionService, roomID, key.BotID, false)
+	if !ok {
+		return
+	}
+
+	// upgrade client http connection to websocket
+	conn, err := ws.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded with the reason
+		slog.WarnContext(r.Context(), "failed to upgrade connection", "error", err)
+		return
+	}
+
+	client := ws.NewClient(h.Hub, conn, key.Bot, roomID)
+	slog.DebugContext(r.Context(), "websocket connected", "conn_id", client.ConnID)
+	client.ResumeAfter, _ = util.GetQueryUUID(r, "lastEventId")
+	if mute := sanctions.Mute(); mute != nil {
+		client.Mute(mute.ExpiresAt)
+	}
+	client.Hub.Register <- client
+
+	// handle connection reads and writes
+	go client.WritePump()
+	client.ReadPump()
+}
+
+// StreamRoomEvents streams the room's frames to the bot as server-sent events
+func (h *BotHandler) StreamRoomEvents(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := h.authorize(w, r, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, key.BotID, false); !ok {
+		return
+	}
+
+	serveEventStream(w, r, h.Hub, key.Bot, roomID)
+}
+
+// SendMessage persists a message from the bot and delivers it to the room's live clients
+func (h *BotHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := h.authorize(w, r, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, key.BotID, true); !ok {
+		return
+	}
+	var req model.MessageContentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !checkMessageLimit(w, r, h.Hub, roomID, key.BotID) {
+		return
+	}
+	if runCommand(w, r, h.Hub, h.messageService, roomID, key.Bot, req.Content) {
+		return
+	}
+
+	sendMessage(w, r, h.Hub, h.messageService, &model.Message{
+		RoomID:         roomID,
+		SenderID:       key.Bot.ID,
+		SenderUsername: key.Bot.Username,
+		Content:        req.Content,
+	})
+}
+
+// AddReaction leaves the bot's reaction on a message of the room
+func (h *BotHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	messageID, err := util.GetParamUUID(r, "messageId")
+	if err != nil {
+		util.WriteError(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := h.authorize(w, r, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, key.BotID, true); !ok {
+		return
+	}
+	var req model.CreateReactionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.UserID = key.Bot.ID
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	addReaction(w, r, h.Hub, h.reactionService, roomID, messageID, key.Bot, &req)
+}
+
+// SendEphemeral shows a message from the bot to a single user connected to the room. The message is not stored
+func (h *BotHandler) SendEphemeral(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := h.authorize(w, r, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, key.BotID, true); !ok {
+		return
+	}
+	var req model.EphemeralMessageReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now().UTC()
+	message := &model.Message{
+		ID:             uuid.New(),
+		RoomID:         roomID,
+		SenderID:       key.Bot.ID,
+		SenderUsername: key.Bot.Username,
+		Content:        req.Content,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	h.Hub.SendEphemeral(req.UserID, message)
+	util.WriteJSON(w, message, http.StatusAccepted)
+}
+
+func (h *BotHandler) authorize(w http.ResponseWriter, r *http.Request, roomID uuid.UUID) (*model.APIKey, bool) {
+	return authorizeBot(w, r, h.service, roomID)
+}
+
+// authorizeBot authenticates the bot from its api key and verifies the key is scoped to the room, writing the error
+// response on failure. The key is read from the X-API-Key header or a bearer authorization header
+func authorizeBot(w http.ResponseWriter, r *http.Request, botService *service.BotService, roomID uuid.UUID) (*model.APIKey, bool) {
+	secret := r.Header.Get("X-API-Key")
+	if secret == "" {
+		secret, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if secret == "" {
+		util.WriteError(w, "API key is required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	key, err := botService.Authenticate(r.Context(), secret)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			util.WriteError(w, "Invalid API key", http.StatusUnauthorized)
+			return nil, false
+		}
+		util.WriteServerError(w, r, "Failed to authenticate", err)
+		return nil, false
+	}
+	if !key.Allows(roomID) {
+		util.WriteError(w, "API key is not allowed in this room", http.StatusForbidden)
+		return nil, false
+	}
+	return key, true
+}
@@ -0,0 +1,48 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// TestBotKeyManagementRequiresAdmin checks that only admins of all the rooms of a key can create, list and revoke it
+func TestBotKeyManagementRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	admin, member := s.createUser(t, "admin"), s.createUser(t, "member")
+	first, second := s.createRoom(t, admin, member), s.createRoom(t, member)
+	var bot model.User
+	s.call(t, http.MethodPost, "/api/bots", &model.CreateUserReq{Username: "bot-" + uuid.NewString()[:8]}, http.StatusCreated, &bot)
+
+	base := fmt.Sprintf("/api/bots/%s/keys", bot.ID)
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{RoomIDs: []uuid.UUID{first.ID}}, http.StatusUnprocessableEntity, nil)
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{ActorID: member.ID, RoomIDs: []uuid.UUID{first.ID}}, http.StatusForbidden, nil)
+	// the member administers the second room only
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{ActorID: member.ID, RoomIDs: []uuid.UUID{first.ID, second.ID}}, http.StatusForbidden, nil)
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{ActorID: admin.ID, RoomIDs: []uuid.UUID{uuid.New()}}, http.StatusNotFound, nil)
+	var key, other model.APIKey
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{ActorID: admin.ID, RoomIDs: []uuid.UUID{first.ID}}, http.StatusCreated, &key)
+	s.call(t, http.MethodPost, base, &model.CreateAPIKeyReq{ActorID: member.ID, RoomIDs: []uuid.UUID{second.ID}}, http.StatusCreated, &other)
+
+	s.call(t, http.MethodGet, base, nil, http.StatusUnprocessableEntity, nil)
+	for _, user := range []*model.User{admin, member} {
+		var keys []*model.APIKey
+		s.call(t, http.MethodGet, base+"?actorId="+user.ID.String(), nil, http.StatusOK, &keys)
+		want := key.ID
+		if user == member {
+			want = other.ID
+		}
+		if len(keys) != 1 || keys[0].ID != want {
+			t.Fatalf("listed %d keys for %s, want only the key of their room", len(keys), user.Username)
+		}
+	}
+
+	path := fmt.Sprintf("%s/%s", base, key.ID)
+	s.call(t, http.MethodDelete, path, nil, http.StatusUnprocessableEntity, nil)
+	s.call(t, http.MethodDelete, path+"?actorId="+member.ID.String(), nil, http.StatusForbidden, nil)
+	s.call(t, http.MethodDelete, path+"?actorId="+admin.ID.String(), nil, http.StatusNoContent, nil)
+	s.call(t, http.MethodDelete, path+"?actorId="+admin.ID.String(), nil, http.StatusNotFound, nil)
+}
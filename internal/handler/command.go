@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type CommandHandler struct {
+	Hub            *ws.Hub
+	service        *service.CommandService
+	webhookService *service.WebhookService
+	botService     *service.BotService
+}
+
+func NewCommandHandler(hub *ws.Hub, service *service.CommandService, webhookService *service.WebhookService, botService *service.BotService) *CommandHandler {
+	return &CommandHandler{
+		Hub:            hub,
+		service:        service,
+		webhookService: webhookService,
+		botService:     botService,
+	}
+}
+
+// GetCommands lists the custom commands of the room
+func (h *CommandHandler) GetCommands(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+
+	commands, err := h.service.GetByRoomID(r.Context(), roomID)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to get commands", err)
+		return
+	}
+
+	util.WriteJSON(w, commands, http.StatusOK)
+}
+
+// CreateBotCommand registers a command of the room handled by the authenticated bot. Invocations are sent to the bot's
+// connection as command frames
+func (h *CommandHandler) CreateBotCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := authorizeBot(w, r, h.botService, roomID)
+	if !ok {
+		return
+	}
+	req, ok := h.decodeCreateReq(w, r)
+	if !ok {
+		return
+	}
+
+	command, err := h.service.CreateForBot(r.Context(), roomID, key.BotID, req)
+	h.writeCreated(w, r, command, err)
+}
+
+func (h *CommandHandler) DeleteBotCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	key, ok := authorizeBot(w, r, h.botService, roomID)
+	if !ok {
+		return
+	}
+
+	err = h.service.DeleteForBot(r.Context(), roomID, key.BotID, mux.Vars(r)["name"])
+	h.writeDeleted(w, r, err)
+}
+
+// CreateWebhookCommand registers a command of the room handled by one of its outgoing webhooks. Invocations are posted
+// to the webhook, whose answer is shown to the invoking user
+func (h *CommandHandler) CreateWebhookCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, webhookID, ok := h.verifyWebhook(w, r)
+	if !ok {
+		return
+	}
+	req, ok := h.decodeCreateReq(w, r)
+	if !ok {
+		return
+	}
+
+	command, err := h.service.CreateForWebhook(r.Context(), roomID, webhookID, req)
+	h.writeCreated(w, r, command, err)
+}
+
+func (h *CommandHandler) DeleteWebhookCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, webhookID, ok := h.verifyWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.service.DeleteForWebhook(r.Context(), roomID, webhookID, mux.Vars(r)["name"])
+	h.writeDeleted(w, r, err)
+}
+
+// decodeCreateReq decodes and validates the command, rejecting the names of built-in commands
+func (h *CommandHandler) decodeCreateReq(w http.ResponseWriter, r *http.Request) (*model.CreateCommandReq, bool) {
+	var req model.CreateCommandReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	if h.Hub.Commands != nil && h.Hub.Commands.IsBuiltin(req.Name) {
+		util.WriteError(w, "Command name is reserved", http.StatusConflict)
+		return nil, false
+	}
+	return &req, true
+}
+
+func (h *CommandHandler) writeCreated(w http.ResponseWriter, r *http.Request, command *model.RoomCommand, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCommandAlreadyExist):
+			util.WriteError(w, "Command already exists in this room", http.StatusConflict)
+		case errors.Is(err, service.ErrRoomNotFound):
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to create command", err)
+		}
+		return
+	}
+	util.WriteJSON(w, command, http.StatusCreated)
+}
+
+func (h *CommandHandler) writeDeleted(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		if errors.Is(err, service.ErrCommandNotFound) {
+			util.WriteError(w, "Command not found", http.StatusNotFound)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to delete command", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyWebhook retrieves the room and outgoing webhook ids from the url and verifies that the webhook belongs to the
+// room, writing the error response on failure
+func (h *CommandHandler) verifyWebhook(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	webhookID, err := util.GetParamUUID(r, "webhookId")
+	if err != nil {
+		util.WriteError(w, "Invalid webhook ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if _, err := h.webhookService.GetOutgoingByID(r.Context(), roomID, webhookID); err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			util.WriteError(w, "Webhook not found", http.StatusNotFound)
+			return uuid.Nil, uuid.Nil, false
+		}
+		util.WriteServerError(w, r, "Failed to get webhook", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return roomID, webhookID, true
+}
+
+// runCommand runs the slash command of a message sent over the rest api, writing the response when the message was
+// a command. Messages sent by the command are created as the user's, with the command's reply returned to the user
+// alone, once the message went through the content filters. It reports whether the response was written
+func runCommand(w http.ResponseWriter, r *http.Request, hub *ws.Hub, messageService *service.MessageService, roomID uuid.UUID, user *model.User, content string) bool {
+	if hub.Commands == nil {
+		return false
+	}
+	result := hub.Commands.Execute(r.Context(), roomID, user, content)
+	if result == nil {
+		return false
+	}
+	if result.Broadcast == "" {
+		util.WriteJSON(w, &model.CommandResponse{Content: result.Reply}, http.StatusOK)
+		return true
+	}
+
+	if result.Reply != "" {
+		hub.SendEphemeral(user.ID, ws.NewNotice(roomID, result.Reply))
+	}
+	sendMessage(w, r, hub, messageService, &model.Message{
+		RoomID:         roomID,
+		SenderID:       user.ID,
+		SenderUsername: user.Username,
+		Content:        result.Broadcast,
+	})
+	return true
+}
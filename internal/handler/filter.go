@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type FilterHandler struct {
+	Hub     *ws.Hub
+	service *service.FilterService
+}
+
+func NewFilterHandler(hub *ws.Hub, service *service.FilterService) *FilterHandler {
+	return &FilterHandler{Hub: hub, service: service}
+}
+
+// GetFilters retrieves the content filter settings of the room for a room admin
+func (h *FilterHandler) GetFilters(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	filter, err := h.service.GetSettings(r.Context(), roomID, actorID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can view filters", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get filters", err)
+		return
+	}
+
+	util.WriteJSON(w, filter, http.StatusOK)
+}
+
+// UpdateFilters replaces the content filter settings of the room on behalf of a room admin, applying them on every
+// node
+func (h *FilterHandler) UpdateFilters(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	var req model.UpdateRoomFilterReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	filter, err := h.service.UpdateSettings(r.Context(), roomID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can update filters", http.StatusForbidden)
+		case errors.Is(err, service.ErrRoomNotFound):
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to update filters", err)
+		}
+		return
+	}
+
+	h.Hub.InvalidateFilters(roomID)
+	util.WriteJSON(w, filter, http.StatusOK)
+}
+
+// GetFlaggedMessages lists the messages of the room held back by the content filters for a room admin, oldest first.
+// Only pending messages are listed unless another status is requested
+func (h *FilterHandler) GetFlaggedMessages(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+	status := model.FlaggedStatus(util.GetQueryStr(r, "status"))
+	switch status {
+	case "":
+		status = model.FlaggedPending
+	case "all":
+		status = ""
+	case model.FlaggedPending, model.FlaggedApproved, model.FlaggedRejected:
+	default:
+		util.WriteError(w, "Invalid status, expected one of pending, approved, rejected or all", http.StatusUnprocessableEntity)
+		return
+	}
+	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	messages, err := h.service.GetFlagged(r.Context(), roomID, actorID, status, limit, skip)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can view flagged messages", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get flagged messages", err)
+		return
+	}
+
+	util.WriteJSON(w, messages, http.StatusOK)
+}
+
+// ReviewFlaggedMessage approves or rejects a flagged message on behalf of a room admin. Approved messages are
+// delivered to the room
+func (h *FilterHandler) ReviewFlaggedMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	flaggedID, err := util.GetParamUUID(r, "flaggedId")
+	if err != nil {
+		util.WriteError(w, "Invalid flagged message ID", http.StatusBadRequest)
+		return
+	}
+	var req model.ReviewFlaggedReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	flagged, message, err := h.service.Review(r.Context(), roomID, flaggedID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can review flagged messages", http.StatusForbidden)
+		case errors.Is(err, service.ErrFlaggedMessageNotFound):
+			util.WriteError(w, "Flagged message not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to review flagged message", err)
+		}
+		return
+	}
+
+	if message != nil {
+		h.Hub.SendPersisted(message)
+	}
+	util.WriteJSON(w, flagged, http.StatusOK)
+}
+
+// sendMessage runs the message through the content filters of its room, then persists and delivers it to the room's
+// live clients. Rejected messages get an unprocessable entity response, while flagged ones are accepted for review
+func sendMessage(w http.ResponseWriter, r *http.Request, hub *ws.Hub, messageService *service.MessageService, message *model.Message) {
+	verdict, err := hub.Filters.Apply(r.Context(), message)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to send message", err)
+		return
+	}
+	switch verdict.Action {
+	case model.FilterReject:
+		util.WriteError(w, "Message rejected: "+strings.Join(verdict.Reasons, ", "), http.StatusUnprocessableEntity)
+		return
+	case model.FilterFlag:
+		util.WriteJSON(w, verdict.Flagged, http.StatusAccepted)
+		return
+	}
+
+	message, err = messageService.Create(r.Context(), message)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to send message", err)
+		return
+	}
+	hub.SendPersisted(message)
+	util.WriteJSON(w, message, http.StatusCreated)
+}
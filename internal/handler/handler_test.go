@@ -0,0 +1,102 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+	"github.com/mrshabel/chat/internal/server"
+	"github.com/mrshabel/chat/internal/service/ws"
+)
+
+// testServer is the chat server over in-memory repositories and broker, served by an httptest server
+type testServer struct {
+	*httptest.Server
+}
+
+// newTestServer starts the server with the settings of the env and rate limits disabled, shutting it down once the
+// test is done
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DbDriver, cfg.Broker = config.DriverMemory, config.BrokerMemory
+	cfg.HTTPRateLimit, cfg.MessageRateLimit, cfg.RoomMessageRateLimit = 0, 0, 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, err := server.New(ctx, cfg, repository.NewMemoryRepositories(), ws.NewMemoryBroker())
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	return &testServer{Server: ts}
+}
+
+// call sends the body as json, failing the test unless the response has the status. A successful response is decoded
+// into out when given
+func (s *testServer) call(t *testing.T, method, path string, body any, status int, out any) {
+	t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(t.Context(), method, s.URL+path, reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != status {
+		data, _ := io.ReadAll(res.Body)
+		t.Fatalf("%s %s returned %d %s, want %d", method, path, res.StatusCode, bytes.TrimSpace(data), status)
+	}
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// createUser signs a user up with a unique name starting with the given one
+func (s *testServer) createUser(t *testing.T, name string) *model.User {
+	t.Helper()
+	var user model.User
+	s.call(t, http.MethodPost, "/api/users", &model.CreateUserReq{Username: name + "-" + uuid.NewString()[:8]}, http.StatusCreated, &user)
+	return &user
+}
+
+// createRoom creates a room on behalf of its creator, who becomes its admin, with the other users as members
+func (s *testServer) createRoom(t *testing.T, creator *model.User, members ...*model.User) *model.Room {
+	t.Helper()
+	var room model.Room
+	s.call(t, http.MethodPost, "/api/rooms", &model.CreateRoomReq{Name: "room-" + uuid.NewString()[:8], UserID: creator.ID}, http.StatusCreated, &room)
+	for _, member := range members {
+		s.call(t, http.MethodPost, fmt.Sprintf("/api/rooms/%s/members", room.ID), &model.CreateRoomMemberReq{UserID: member.ID}, http.StatusCreated, nil)
+	}
+	return &room
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type ReportHandler struct {
+	Hub     *ws.Hub
+	service *service.ReportService
+}
+
+func NewReportHandler(hub *ws.Hub, service *service.ReportService) *ReportHandler {
+	return &ReportHandler{Hub: hub, service: service}
+}
+
+// CreateReport reports a message as abusive on behalf of a member of its room, notifying the room's admins
+func (h *ReportHandler) CreateReport(w http.ResponseWriter, r *http.Request) {
+	messageID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+	var req model.CreateReportReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Details = strings.TrimSpace(req.Details)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	report, err := h.service.Create(r.Context(), messageID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			util.WriteError(w, "Message not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrNotRoomMember):
+			util.WriteError(w, "Only room members can report messages", http.StatusForbidden)
+		case errors.Is(err, service.ErrCannotReport):
+			util.WriteError(w, "You cannot report your own messages", http.StatusUnprocessableEntity)
+		case errors.Is(err, service.ErrAlreadyReported):
+			util.WriteError(w, "You already reported this message", http.StatusConflict)
+		default:
+			util.WriteServerError(w, r, "Failed to report message", err)
+		}
+		return
+	}
+
+	adminIDs, err := h.service.GetAdminIDs(r.Context(), report.RoomID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to notify admins of report", "report_id", report.ID, "error", err)
+	}
+	for _, adminID := range adminIDs {
+		h.Hub.SendReport(adminID, report)
+	}
+	util.WriteJSON(w, report, http.StatusCreated)
+}
+
+// GetReports lists the reports of the room for a room admin, oldest first. Only open reports are listed unless another
+// status is requested
+func (h *ReportHandler) GetReports(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+	status := model.ReportStatus(util.GetQueryStr(r, "status"))
+	switch status {
+	case "":
+		status = model.ReportOpen
+	case "all":
+		status = ""
+	case model.ReportOpen, model.ReportResolved, model.ReportDismissed:
+	default:
+		util.WriteError(w, "Invalid status, expected one of open, resolved, dismissed or all", http.StatusUnprocessableEntity)
+		return
+	}
+	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	reports, err := h.service.GetByRoomID(r.Context(), roomID, actorID, status, limit, skip)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can view reports", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get reports", err)
+		return
+	}
+
+	util.WriteJSON(w, reports, http.StatusOK)
+}
+
+// ResolveReport resolves or dismisses a report on behalf of a room admin, enforcing the sanction of the sender and the
+// deletion of the message on live connections
+func (h *ReportHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	reportID, err := util.GetParamUUID(r, "reportId")
+	if err != nil {
+		util.WriteError(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+	var req model.ResolveReportReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Sanction != nil {
+		req.Sanction.Reason = strings.TrimSpace(req.Sanction.Reason)
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	resolution, err := h.service.Resolve(r.Context(), roomID, reportID, &req)
+	// the sanction is in effect even when the reports could not be closed
+	if resolution != nil && resolution.Sanction != nil {
+		h.Hub.ApplySanction(resolution.Sanction)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can resolve reports", http.StatusForbidden)
+		case errors.Is(err, service.ErrReportNotFound):
+			util.WriteError(w, "Report not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrReportClosed):
+			util.WriteError(w, "Report is no longer open", http.StatusConflict)
+		case errors.Is(err, service.ErrCannotSanction):
+			util.WriteError(w, "The sender cannot be sanctioned", http.StatusConflict)
+		default:
+			util.WriteServerError(w, r, "Failed to resolve report", err)
+		}
+		return
+	}
+
+	if resolution.DeletedMessageID != nil {
+		h.Hub.DeleteMessage(roomID, *resolution.DeletedMessageID)
+	}
+	util.WriteJSON(w, resolution, http.StatusOK)
+}
@@ -3,9 +3,11 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/mrshabel/chat/internal/model"
 	"github.com/mrshabel/chat/internal/service"
 	"github.com/mrshabel/chat/internal/service/ws"
@@ -13,18 +15,22 @@ import (
 )
 
 type RoomHandler struct {
-	Hub            *ws.Hub
-	service        *service.RoomService
-	userService    *service.UserService
-	messageService *service.MessageService
+	Hub             *ws.Hub
+	service         *service.RoomService
+	userService     *service.UserService
+	messageService  *service.MessageService
+	reactionService *service.ReactionService
+	sanctionService *service.SanctionService
 }
 
-func NewRoomHandler(hub *ws.Hub, service *service.RoomService, userService *service.UserService, messageService *service.MessageService) *RoomHandler {
+func NewRoomHandler(hub *ws.Hub, service *service.RoomService, userService *service.UserService, messageService *service.MessageService, reactionService *service.ReactionService, sanctionService *service.SanctionService) *RoomHandler {
 	return &RoomHandler{
-		Hub:            hub,
-		service:        service,
-		userService:    userService,
-		messageService: messageService,
+		Hub:             hub,
+		service:         service,
+		userService:     userService,
+		messageService:  messageService,
+		reactionService: reactionService,
+		sanctionService: sanctionService,
 	}
 }
 
@@ -40,52 +46,29 @@ func (h *RoomHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// retrieve user details
-	user, err := h.userService.GetByID(r.Context(), userID)
-	if err != nil {
-		if errors.Is(err, service.ErrUserNotFound) {
-			util.WriteError(w, "User account not found", http.StatusNotFound)
-			return
-		}
-		util.WriteError(w, "Failed to join room", http.StatusInternalServerError)
+	user, ok := h.verifyJoin(w, r, userID, roomID)
+	if !ok {
 		return
 	}
-
-	// verify that room exists. the in-memory room will be created only when it exists in the db
-	room, err := h.service.GetByID(r.Context(), roomID)
-	if err != nil {
-		if errors.Is(err, service.ErrRoomNotFound) {
-			util.WriteError(w, "Room not found", http.StatusNotFound)
-			return
-		}
-		util.WriteError(w, "Failed to join room", http.StatusInternalServerError)
+	sanctions, ok := checkSanctions(w, r, h.sanctionService, roomID, userID, false)
+	if !ok {
 		return
 	}
-	if inMemRoom := h.Hub.GetRoom(roomID); inMemRoom == nil {
-		h.Hub.Rooms[roomID.String()] = &ws.Room{
-			Clients:  make(map[string]*ws.Client),
-			ID:       roomID,
-			Name:     room.Name,
-			Messages: make([]*model.Message, 0, ws.MaxMessageLimit),
-		}
-	}
 
 	// upgrade client http connection to websocket
 	conn, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("failed to upgrade connection %v\n", err)
-		util.WriteError(w, "Failed to join room", http.StatusInternalServerError)
+		// the upgrader has already responded with the reason
+		slog.WarnContext(r.Context(), "failed to upgrade connection", "error", err)
 		return
 	}
 
-	// register client
-	client := &ws.Client{
-		ID:       user.ID,
-		RoomID:   roomID,
-		Username: user.Username,
-		Hub:      h.Hub,
-		Conn:     conn,
-		Inbox:    make(chan *model.Message),
+	// register client, resuming from the last message it received if known
+	client := ws.NewClient(h.Hub, conn, user, roomID)
+	slog.DebugContext(r.Context(), "websocket connected", "conn_id", client.ConnID)
+	client.ResumeAfter, _ = util.GetQueryUUID(r, "lastEventId")
+	if mute := sanctions.Mute(); mute != nil {
+		client.Mute(mute.ExpiresAt)
 	}
 	client.Hub.Register <- client
 
@@ -94,6 +77,153 @@ func (h *RoomHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
 	client.ReadPump()
 }
 
+// StreamRoomEvents streams the room's messages as server-sent events, as a fallback for clients that cannot use
+// websockets. Reconnecting clients receive the messages sent since the one identified by Last-Event-ID
+func (h *RoomHandler) StreamRoomEvents(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	userID, err := util.GetQueryUUID(r, "userId")
+	if err != nil {
+		util.WriteError(w, "User ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+	user, ok := h.verifyJoin(w, r, userID, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, userID, false); !ok {
+		return
+	}
+
+	serveEventStream(w, r, h.Hub, user, roomID)
+}
+
+// SendRoomMessage persists a message and delivers it to the room's live clients as if it had been sent over a socket
+func (h *RoomHandler) SendRoomMessage(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	var req model.CreateMessageReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	user, ok := h.verifyJoin(w, r, req.UserID, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, user.ID, true); !ok {
+		return
+	}
+
+	if !checkMessageLimit(w, r, h.Hub, roomID, user.ID) {
+		return
+	}
+	if runCommand(w, r, h.Hub, h.messageService, roomID, user, req.Content) {
+		return
+	}
+
+	sendMessage(w, r, h.Hub, h.messageService, &model.Message{
+		RoomID:         roomID,
+		SenderID:       user.ID,
+		SenderUsername: user.Username,
+		Content:        req.Content,
+	})
+}
+
+// AddReaction leaves the user's reaction on a message of the room
+func (h *RoomHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	messageID, err := util.GetParamUUID(r, "messageId")
+	if err != nil {
+		util.WriteError(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+	var req model.CreateReactionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	user, ok := h.verifyJoin(w, r, req.UserID, roomID)
+	if !ok {
+		return
+	}
+	if _, ok := checkSanctions(w, r, h.sanctionService, roomID, user.ID, true); !ok {
+		return
+	}
+
+	addReaction(w, r, h.Hub, h.reactionService, roomID, messageID, user, &req)
+}
+
+func (h *RoomHandler) GetReactions(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	messageID, err := util.GetParamUUID(r, "messageId")
+	if err != nil {
+		util.WriteError(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	reactions, err := h.reactionService.GetByMessageID(r.Context(), roomID, messageID)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to get reactions", err)
+		return
+	}
+
+	util.WriteJSON(w, reactions, http.StatusOK)
+}
+
+// verifyJoin retrieves the user and verifies that the room exists, writing the error response on failure. Bots are
+// turned away since they act through the bot api
+func (h *RoomHandler) verifyJoin(w http.ResponseWriter, r *http.Request, userID, roomID uuid.UUID) (*model.User, bool) {
+	// retrieve user details
+	user, err := h.userService.GetByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			util.WriteError(w, "User account not found", http.StatusNotFound)
+			return nil, false
+		}
+		util.WriteServerError(w, r, "Failed to join room", err)
+		return nil, false
+	}
+	if user.IsBot() {
+		util.WriteError(w, "Bots must authenticate with an API key", http.StatusForbidden)
+		return nil, false
+	}
+
+	// verify that room exists. the in-memory room will be started only when it exists in the db
+	if _, err := h.service.GetByID(r.Context(), roomID); err != nil {
+		if errors.Is(err, service.ErrRoomNotFound) {
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+			return nil, false
+		}
+		util.WriteServerError(w, r, "Failed to join room", err)
+		return nil, false
+	}
+	return user, true
+}
+
 func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 	var req model.CreateRoomReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -103,19 +233,10 @@ func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 
 	room, err := h.service.Create(r.Context(), &req)
 	if err != nil {
-		log.Println(err)
-		util.WriteError(w, "Failed to created room", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to create room", err)
 		return
 	}
 
-	// preload room
-	h.Hub.Rooms[room.ID.String()] = &ws.Room{
-		ID:       room.ID,
-		Name:     room.Name,
-		Clients:  make(map[string]*ws.Client),
-		Messages: make([]*model.Message, 0),
-	}
-
 	util.WriteJSON(w, room, http.StatusCreated)
 }
 
@@ -132,19 +253,38 @@ func (h *RoomHandler) GetRoomByID(w http.ResponseWriter, r *http.Request) {
 			util.WriteError(w, "Room not found", http.StatusNotFound)
 			return
 		}
-		util.WriteError(w, "Failed to retrieve room", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to retrieve room", err)
 		return
 	}
 
 	util.WriteJSON(w, room, http.StatusOK)
 }
 
+// GetAllRooms lists rooms by creation date, or searches them by name when a query or sort order is given
 func (h *RoomHandler) GetAllRooms(w http.ResponseWriter, r *http.Request) {
 	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	req := model.SearchRoomsReq{
+		Query: util.GetQueryStr(r, "q"),
+		Sort:  model.RoomSort(util.GetQueryStr(r, "sort")),
+	}
+	if req.Query != "" || req.Sort != "" {
+		if err := req.Validate(); err != nil {
+			util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		rooms, err := h.service.Search(r.Context(), &req, limit, skip)
+		if err != nil {
+			util.WriteServerError(w, r, "Failed to search rooms", err)
+			return
+		}
+		util.WriteJSON(w, rooms, http.StatusOK)
+		return
+	}
+
 	rooms, err := h.service.GetAll(r.Context(), limit, skip)
 	if err != nil {
-		log.Println(err)
-		util.WriteError(w, "Failed to retrieve rooms", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to retrieve rooms", err)
 		return
 	}
 
@@ -163,15 +303,52 @@ func (h *RoomHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	member, err := h.service.AddMember(r.Context(), roomID, req.UserID, string(model.Member))
+	// users join rooms themselves
+	member, err := h.service.AddMember(r.Context(), roomID, req.UserID, string(model.Member), req.UserID)
 	if err != nil {
-		log.Println(err)
-		util.WriteError(w, "Failed to add member", http.StatusInternalServerError)
+		if errors.Is(err, service.ErrAlreadyMember) {
+			util.WriteError(w, "User is already a member", http.StatusConflict)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to add member", err)
 		return
 	}
 	util.WriteJSON(w, member, http.StatusCreated)
 }
 
+// SetSlowMode sets the minimum interval between messages of each user in the room on behalf of a room admin
+func (h *RoomHandler) SetSlowMode(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	var req model.SetSlowModeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := h.service.SetSlowMode(r.Context(), roomID, &req); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can change slow mode", http.StatusForbidden)
+		case errors.Is(err, service.ErrRoomNotFound):
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to set slow mode", err)
+		}
+		return
+	}
+
+	h.Hub.SetSlowMode(roomID, req.Seconds)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *RoomHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
 	roomID, err := util.GetParamUUID(r, "id")
 	if err != nil {
@@ -182,7 +359,7 @@ func (h *RoomHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
 
 	members, err := h.service.GetAllMembers(r.Context(), roomID, limit, skip)
 	if err != nil {
-		util.WriteError(w, "Failed to retrieve room members", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to retrieve room members", err)
 		return
 	}
 
@@ -196,19 +373,15 @@ func (h *RoomHandler) GetActiveRoomMembers(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// verify that room exists with active members
-	room := h.Hub.GetRoom(id)
-	if room == nil {
-		util.WriteError(w, "Room not found or has inactive users", http.StatusNotFound)
+	// verify that room exists with active members on any node
+	users, err := h.Hub.ActiveMembers(r.Context(), id)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to retrieve active room members", err)
 		return
 	}
-
-	var users []model.User
-	for _, client := range room.Clients {
-		users = append(users, model.User{
-			ID:       client.ID,
-			Username: client.Username,
-		})
+	if len(users) == 0 {
+		util.WriteError(w, "Room not found or has inactive users", http.StatusNotFound)
+		return
 	}
 
 	util.WriteJSON(w, users, 200)
@@ -222,12 +395,67 @@ func (h *RoomHandler) GetAllRoomMessages(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	skip, limit := util.GetPaginationQuery(r, 1, 50)
+	// banned users cannot read the history
+	if userID, err := util.GetQueryUUID(r, "userId"); err == nil {
+		if _, ok := checkSanctions(w, r, h.sanctionService, roomID, userID, false); !ok {
+			return
+		}
+	}
 
 	messages, err := h.messageService.GetByRoomID(r.Context(), roomID, limit, skip)
 	if err != nil {
-		util.WriteError(w, "Failed to retrieve room messages", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to retrieve room messages", err)
 		return
 	}
 
 	util.WriteJSON(w, messages, http.StatusOK)
 }
+
+// serveEventStream streams the room's frames to the user as server-sent events until the request is done
+func serveEventStream(w http.ResponseWriter, r *http.Request, hub *ws.Hub, user *model.User, roomID uuid.UUID) {
+	// browsers send the last event id as a header on reconnect. the query parameter allows resuming a new stream
+	resumeAfter, err := uuid.Parse(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		resumeAfter, _ = util.GetQueryUUID(r, "lastEventId")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// disable response buffering by reverse proxies
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	client := ws.NewClient(hub, nil, user, roomID)
+	slog.DebugContext(r.Context(), "event stream connected", "conn_id", client.ConnID)
+	client.ResumeAfter = resumeAfter
+	client.Hub.Register <- client
+	client.StreamPump(r.Context(), w)
+}
+
+// checkMessageLimit verifies that a message can be sent to the room now, writing a too many requests response with
+// the time to wait when it cannot. It reports whether the message may be sent
+func checkMessageLimit(w http.ResponseWriter, r *http.Request, hub *ws.Hub, roomID, userID uuid.UUID) bool {
+	err := hub.Limiter.Check(r.Context(), roomID, userID)
+	if err == nil {
+		return true
+	}
+	util.WriteRateLimited(w, err.Error(), err.RetryAfter)
+	return false
+}
+
+// addReaction stores the user's reaction and fans it out to the room
+func addReaction(w http.ResponseWriter, r *http.Request, hub *ws.Hub, reactionService *service.ReactionService, roomID, messageID uuid.UUID, user *model.User, req *model.CreateReactionReq) {
+	reaction, err := reactionService.Create(r.Context(), roomID, messageID, user, req)
+	if err != nil {
+		if errors.Is(err, service.ErrMessageNotFound) {
+			util.WriteError(w, "Message not found", http.StatusNotFound)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to add reaction", err)
+		return
+	}
+
+	hub.SendReaction(reaction)
+	util.WriteJSON(w, reaction, http.StatusCreated)
+}
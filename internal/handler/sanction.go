@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type SanctionHandler struct {
+	Hub     *ws.Hub
+	service *service.SanctionService
+}
+
+func NewSanctionHandler(hub *ws.Hub, service *service.SanctionService) *SanctionHandler {
+	return &SanctionHandler{Hub: hub, service: service}
+}
+
+// CreateSanction bans, mutes or times out a user of the room on behalf of a room admin, enforcing it on the user's
+// live connections
+func (h *SanctionHandler) CreateSanction(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	var req model.CreateSanctionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	sanction, err := h.service.Create(r.Context(), roomID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can sanction users", http.StatusForbidden)
+		case errors.Is(err, service.ErrCannotSanction):
+			util.WriteError(w, "Room admins cannot be sanctioned", http.StatusConflict)
+		case errors.Is(err, service.ErrUserNotFound):
+			util.WriteError(w, "User not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to sanction user", err)
+		}
+		return
+	}
+
+	h.Hub.ApplySanction(sanction)
+	util.WriteJSON(w, sanction, http.StatusCreated)
+}
+
+// GetSanctions lists the sanctions of the room for a room admin, including lifted and expired ones unless active is set
+func (h *SanctionHandler) GetSanctions(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+	activeOnly := r.URL.Query().Get("active") == "true"
+	skip, limit := util.GetPaginationQuery(r, 1, 50)
+
+	sanctions, err := h.service.GetByRoomID(r.Context(), roomID, actorID, activeOnly, limit, skip)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can view sanctions", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get sanctions", err)
+		return
+	}
+
+	util.WriteJSON(w, sanctions, http.StatusOK)
+}
+
+// RevokeSanction lifts a sanction on behalf of a room admin
+func (h *SanctionHandler) RevokeSanction(w http.ResponseWriter, r *http.Request) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	sanctionID, err := util.GetParamUUID(r, "sanctionId")
+	if err != nil {
+		util.WriteError(w, "Invalid sanction ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	sanction, err := h.service.Revoke(r.Context(), roomID, sanctionID, actorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can lift sanctions", http.StatusForbidden)
+		case errors.Is(err, service.ErrSanctionNotFound):
+			util.WriteError(w, "Sanction not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to lift sanction", err)
+		}
+		return
+	}
+
+	h.Hub.ApplySanction(sanction)
+	util.WriteJSON(w, sanction, http.StatusOK)
+}
+
+// checkSanctions retrieves the user's sanctions in effect in the room, writing a forbidden response when the user is
+// banned, or muted and sending. It reports whether the request may proceed
+func checkSanctions(w http.ResponseWriter, r *http.Request, sanctionService *service.SanctionService, roomID, userID uuid.UUID, sending bool) (model.Sanctions, bool) {
+	sanctions, err := sanctionService.GetActive(r.Context(), roomID, userID)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to verify access to the room", err)
+		return nil, false
+	}
+	if sanctions.Ban() != nil {
+		util.WriteError(w, "You are banned from this room", http.StatusForbidden)
+		return nil, false
+	}
+	if sending && sanctions.Mute() != nil {
+		util.WriteError(w, "You are muted in this room", http.StatusForbidden)
+		return nil, false
+	}
+	return sanctions, true
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
 
 	"github.com/mrshabel/chat/internal/model"
@@ -29,12 +28,11 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.service.Create(r.Context(), &req)
 	if err != nil {
-		log.Println(err)
 		if errors.Is(err, service.ErrUserAlreadyExist) {
 			util.WriteError(w, "Username already taken", http.StatusConflict)
 			return
 		}
-		util.WriteError(w, "Failed to create user", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to create user", err)
 		return
 	}
 
@@ -54,9 +52,27 @@ func (h *UserHandler) GetByUserByID(w http.ResponseWriter, r *http.Request) {
 			util.WriteError(w, "User not found", http.StatusNotFound)
 			return
 		}
-		util.WriteError(w, "Failed to get user", http.StatusInternalServerError)
+		util.WriteServerError(w, r, "Failed to get user", err)
 		return
 	}
 
 	util.WriteJSON(w, user, http.StatusOK)
 }
+
+// SearchUsers looks users up by username prefix or similarity
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	req := model.SearchUsersReq{Query: util.GetQueryStr(r, "q")}
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	skip, limit := util.GetPaginationQuery(r, 1, 20)
+
+	users, err := h.service.Search(r.Context(), &req, limit, skip)
+	if err != nil {
+		util.WriteServerError(w, r, "Failed to search users", err)
+		return
+	}
+
+	util.WriteJSON(w, users, http.StatusOK)
+}
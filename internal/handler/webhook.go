@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+type WebhookHandler struct {
+	Hub            *ws.Hub
+	service        *service.WebhookService
+	roomService    *service.RoomService
+	messageService *service.MessageService
+}
+
+func NewWebhookHandler(hub *ws.Hub, service *service.WebhookService, roomService *service.RoomService, messageService *service.MessageService) *WebhookHandler {
+	return &WebhookHandler{
+		Hub:            hub,
+		service:        service,
+		roomService:    roomService,
+		messageService: messageService,
+	}
+}
+
+// CreateIncoming creates an incoming webhook for the room on behalf of a room admin, returning its token once
+func (h *WebhookHandler) CreateIncoming(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := h.verifyRoom(w, r)
+	if !ok {
+		return
+	}
+	var req model.CreateIncomingWebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	hook, err := h.service.CreateIncoming(r.Context(), roomID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can manage webhooks", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to create webhook", err)
+		return
+	}
+
+	util.WriteJSON(w, hook, http.StatusCreated)
+}
+
+// GetIncoming lists the incoming webhooks of the room for a room admin
+func (h *WebhookHandler) GetIncoming(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := h.verifyRoom(w, r)
+	if !ok {
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	hooks, err := h.service.GetIncomingByRoomID(r.Context(), roomID, actorID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can manage webhooks", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get webhooks", err)
+		return
+	}
+
+	util.WriteJSON(w, hooks, http.StatusOK)
+}
+
+// DeleteIncoming deletes an incoming webhook of the room on behalf of a room admin
+func (h *WebhookHandler) DeleteIncoming(w http.ResponseWriter, r *http.Request) {
+	h.delete(w, r, h.service.DeleteIncoming)
+}
+
+// CreateOutgoing creates an outgoing webhook for the room on behalf of a room admin, returning its signing secret once
+func (h *WebhookHandler) CreateOutgoing(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := h.verifyRoom(w, r)
+	if !ok {
+		return
+	}
+	var req model.CreateOutgoingWebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	hook, err := h.service.CreateOutgoing(r.Context(), roomID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can manage webhooks", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to create webhook", err)
+		return
+	}
+
+	util.WriteJSON(w, hook, http.StatusCreated)
+}
+
+// GetOutgoing lists the outgoing webhooks of the room for a room admin
+func (h *WebhookHandler) GetOutgoing(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := h.verifyRoom(w, r)
+	if !ok {
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	hooks, err := h.service.GetOutgoingByRoomID(r.Context(), roomID, actorID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomAdmin) {
+			util.WriteError(w, "Only room admins can manage webhooks", http.StatusForbidden)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to get webhooks", err)
+		return
+	}
+
+	util.WriteJSON(w, hooks, http.StatusOK)
+}
+
+// DeleteOutgoing deletes an outgoing webhook of the room on behalf of a room admin
+func (h *WebhookHandler) DeleteOutgoing(w http.ResponseWriter, r *http.Request) {
+	h.delete(w, r, h.service.DeleteOutgoing)
+}
+
+// PostMessage posts a message to the room of the incoming webhook identified by the url, under the webhook's name
+func (h *WebhookHandler) PostMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	hook, err := h.service.VerifyIncoming(r.Context(), id, mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) || errors.Is(err, service.ErrInvalidWebhookToken) {
+			util.WriteError(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		util.WriteServerError(w, r, "Failed to post message", err)
+		return
+	}
+
+	var req model.MessageContentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if err := req.Validate(); err != nil {
+		util.WriteError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !checkMessageLimit(w, r, h.Hub, hook.RoomID, uuid.Nil) {
+		return
+	}
+
+	// webhook messages have no sending user
+	sendMessage(w, r, h.Hub, h.messageService, &model.Message{
+		RoomID:         hook.RoomID,
+		SenderUsername: hook.Name,
+		Content:        req.Content,
+	})
+}
+
+// delete removes the webhook of the room identified by the url with the given operation, on behalf of the admin
+// identified by the query
+func (h *WebhookHandler) delete(w http.ResponseWriter, r *http.Request, op func(ctx context.Context, roomID, id, actorID uuid.UUID) error) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	id, err := util.GetParamUUID(r, "webhookId")
+	if err != nil {
+		util.WriteError(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	actorID, err := util.GetQueryUUID(r, "actorId")
+	if err != nil {
+		util.WriteError(w, "Actor ID is required", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := op(r.Context(), roomID, id, actorID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			util.WriteError(w, "Only room admins can manage webhooks", http.StatusForbidden)
+		case errors.Is(err, service.ErrWebhookNotFound):
+			util.WriteError(w, "Webhook not found", http.StatusNotFound)
+		default:
+			util.WriteServerError(w, r, "Failed to delete webhook", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyRoom retrieves the room id from the url and verifies that the room exists, writing the error response on
+// failure
+func (h *WebhookHandler) verifyRoom(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	roomID, err := util.GetParamUUID(r, "id")
+	if err != nil {
+		util.WriteError(w, "Invalid room ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	if _, err := h.roomService.GetByID(r.Context(), roomID); err != nil {
+		if errors.Is(err, service.ErrRoomNotFound) {
+			util.WriteError(w, "Room not found", http.StatusNotFound)
+			return uuid.Nil, false
+		}
+		util.WriteServerError(w, r, "Failed to get room", err)
+		return uuid.Nil, false
+	}
+	return roomID, true
+}
@@ -0,0 +1,74 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// TestWebhookManagementRequiresAdmin checks that only admins of a room can create, list and delete its webhooks
+func TestWebhookManagementRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	admin, member := s.createUser(t, "admin"), s.createUser(t, "member")
+	room := s.createRoom(t, admin, member)
+
+	for _, kind := range []string{"incoming", "outgoing"} {
+		t.Run(kind, func(t *testing.T) {
+			base := fmt.Sprintf("/api/rooms/%s/webhooks/%s", room.ID, kind)
+			create := func(actorID uuid.UUID) any {
+				if kind == "incoming" {
+					return &model.CreateIncomingWebhookReq{ActorID: actorID, Name: "ci"}
+				}
+				return &model.CreateOutgoingWebhookReq{ActorID: actorID, URL: "https://example.com/hook"}
+			}
+
+			s.call(t, http.MethodPost, base, create(uuid.Nil), http.StatusUnprocessableEntity, nil)
+			s.call(t, http.MethodPost, base, create(member.ID), http.StatusForbidden, nil)
+			s.call(t, http.MethodPost, fmt.Sprintf("/api/rooms/%s/webhooks/%s", uuid.New(), kind), create(admin.ID), http.StatusNotFound, nil)
+			var hook struct {
+				ID uuid.UUID `json:"id"`
+			}
+			s.call(t, http.MethodPost, base, create(admin.ID), http.StatusCreated, &hook)
+
+			s.call(t, http.MethodGet, base, nil, http.StatusUnprocessableEntity, nil)
+			s.call(t, http.MethodGet, base+"?actorId="+member.ID.String(), nil, http.StatusForbidden, nil)
+			var hooks []struct {
+				ID uuid.UUID `json:"id"`
+			}
+			s.call(t, http.MethodGet, base+"?actorId="+admin.ID.String(), nil, http.StatusOK, &hooks)
+			if len(hooks) != 1 || hooks[0].ID != hook.ID {
+				t.Fatalf("listed %d webhooks, want the created one", len(hooks))
+			}
+
+			path := fmt.Sprintf("%s/%s", base, hook.ID)
+			s.call(t, http.MethodDelete, path, nil, http.StatusUnprocessableEntity, nil)
+			s.call(t, http.MethodDelete, path+"?actorId="+member.ID.String(), nil, http.StatusForbidden, nil)
+			s.call(t, http.MethodDelete, path+"?actorId="+admin.ID.String(), nil, http.StatusNoContent, nil)
+			s.call(t, http.MethodDelete, path+"?actorId="+admin.ID.String(), nil, http.StatusNotFound, nil)
+		})
+	}
+}
+
+// TestIncomingWebhookPostsMessage checks that a message posted with the token of an incoming webhook is sent to its
+// room, and that other tokens are refused
+func TestIncomingWebhookPostsMessage(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createUser(t, "admin")
+	room := s.createRoom(t, admin)
+
+	var hook model.IncomingWebhook
+	s.call(t, http.MethodPost, fmt.Sprintf("/api/rooms/%s/webhooks/incoming", room.ID), &model.CreateIncomingWebhookReq{ActorID: admin.ID, Name: "ci"}, http.StatusCreated, &hook)
+	if hook.Token == "" {
+		t.Fatal("webhook created without its token")
+	}
+
+	s.call(t, http.MethodPost, fmt.Sprintf("/api/hooks/%s/%s", hook.ID, "wrong"), &model.MessageContentReq{Content: "build failed"}, http.StatusNotFound, nil)
+	var message model.Message
+	s.call(t, http.MethodPost, fmt.Sprintf("/api/hooks/%s/%s", hook.ID, hook.Token), &model.MessageContentReq{Content: "build passed"}, http.StatusCreated, &message)
+	if message.RoomID != room.ID || message.SenderUsername != "ci" || message.Content != "build passed" {
+		t.Fatalf("webhook posted %+v", message)
+	}
+}
@@ -0,0 +1,69 @@
+// Package logging creates the structured logger of the server and carries request ids through contexts, so that
+// records logged while serving a request can be correlated
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/mrshabel/chat/internal/config"
+)
+
+type requestIDKey struct{}
+
+// New creates a logger writing records at or above the level, as text or json. Records logged with a context
+// carrying a request id are tagged with it
+func New(w io.Writer, level, format string) *slog.Logger {
+	var lvl slog.Level
+	switch level {
+	case config.LogLevelDebug:
+		lvl = slog.LevelDebug
+	case config.LogLevelWarn:
+		lvl = slog.LevelWarn
+	case config.LogLevelError:
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	if format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(&contextHandler{handler})
+}
+
+// WithRequestID returns a copy of the context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id carried by the context, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request id carried by the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
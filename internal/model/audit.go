@@ -0,0 +1,65 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxAuditActionLength = 50
+
+// AuditAction is a mutating operation recorded in the audit log, named after its target
+type AuditAction string
+
+const (
+	AuditRoomCreate      AuditAction = "room.create"
+	AuditRoomSetTopic    AuditAction = "room.set_topic"
+	AuditRoomSetSlowMode AuditAction = "room.set_slow_mode"
+	AuditMemberAdd       AuditAction = "member.add"
+	AuditMemberRemove    AuditAction = "member.remove"
+	AuditUserCreate      AuditAction = "user.create"
+	AuditMessageDelete   AuditAction = "message.delete"
+	AuditSanctionCreate  AuditAction = "sanction.create"
+	AuditSanctionRevoke  AuditAction = "sanction.revoke"
+	AuditReportResolve   AuditAction = "report.resolve"
+	AuditFiltersUpdate   AuditAction = "filters.update"
+	AuditFlaggedReview   AuditAction = "flagged.review"
+)
+
+// AuditEvent records who performed a mutating operation on what, along with the target's state before and after it
+type AuditEvent struct {
+	ID uuid.UUID `json:"id"`
+	// nil when the actor was deleted
+	ActorID *uuid.UUID `json:"actorId"`
+	// room the operation concerns, if any
+	RoomID   *uuid.UUID  `json:"roomId"`
+	Action   AuditAction `json:"action"`
+	TargetID uuid.UUID   `json:"targetId"`
+	// state of the target, null when it did not exist before or after the operation
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// AuditQuery narrows down the audit events retrieved
+type AuditQuery struct {
+	RoomID *uuid.UUID
+	// user who performed the operations
+	ActorID *uuid.UUID
+	// action, or all actions on a kind of target such as "member"
+	Action string
+	Since  *time.Time
+	Until  *time.Time
+}
+
+func (q *AuditQuery) Validate() error {
+	if len(q.Action) > MaxAuditActionLength {
+		return fmt.Errorf("action cannot exceed %d characters", MaxAuditActionLength)
+	}
+	if q.Since != nil && q.Until != nil && q.Until.Before(*q.Since) {
+		return fmt.Errorf("until cannot be before since")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxAPIKeyRooms    = 100
+	MaxReactionLength = 32
+)
+
+// APIKey authenticates a bot for a specific set of rooms
+type APIKey struct {
+	ID      uuid.UUID   `json:"id"`
+	BotID   uuid.UUID   `json:"botId"`
+	RoomIDs []uuid.UUID `json:"roomIds"`
+	// secret key, only available when the key is created
+	Key       string    `json:"key,omitempty"`
+	KeyHash   []byte    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// the authenticated bot, set when the key is verified
+	Bot *User `json:"-"`
+}
+
+// Allows reports whether the key is scoped to the room
+func (k *APIKey) Allows(roomID uuid.UUID) bool {
+	return slices.Contains(k.RoomIDs, roomID)
+}
+
+type CreateAPIKeyReq struct {
+	// admin of every scoped room, creating the key
+	ActorID uuid.UUID   `json:"actorId"`
+	RoomIDs []uuid.UUID `json:"roomIds"`
+}
+
+func (r *CreateAPIKeyReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	if len(r.RoomIDs) == 0 {
+		return fmt.Errorf("at least one room id is required")
+	}
+	if len(r.RoomIDs) > MaxAPIKeyRooms {
+		return fmt.Errorf("api keys cannot be scoped to more than %d rooms", MaxAPIKeyRooms)
+	}
+	// drop duplicate rooms
+	slices.SortFunc(r.RoomIDs, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	r.RoomIDs = slices.Compact(r.RoomIDs)
+	if slices.Contains(r.RoomIDs, uuid.Nil) {
+		return fmt.Errorf("room ids cannot be empty")
+	}
+	return nil
+}
+
+// Reaction is an emoji left by a user on a message
+type Reaction struct {
+	MessageID uuid.UUID `json:"messageId"`
+	RoomID    uuid.UUID `json:"roomId"`
+	UserID    uuid.UUID `json:"userId"`
+	Username  string    `json:"username"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CreateReactionReq struct {
+	Emoji string `json:"emoji"`
+	// reacting user, taken from the api key for bots
+	UserID uuid.UUID `json:"userId"`
+}
+
+func (r *CreateReactionReq) Validate() error {
+	if r.UserID == uuid.Nil {
+		return fmt.Errorf("user id is required")
+	}
+	if r.Emoji == "" {
+		return fmt.Errorf("emoji is required")
+	}
+	if len(r.Emoji) > MaxReactionLength {
+		return fmt.Errorf("emoji cannot exceed %d bytes", MaxReactionLength)
+	}
+	if strings.ContainsFunc(r.Emoji, func(c rune) bool { return c == ' ' || c == '\t' || c == '\n' }) {
+		return fmt.Errorf("emoji cannot contain whitespace")
+	}
+	return nil
+}
+
+// EphemeralMessageReq is a message shown only to one user and never stored
+type EphemeralMessageReq struct {
+	UserID  uuid.UUID `json:"userId"`
+	Content string    `json:"content"`
+}
+
+func (r *EphemeralMessageReq) Validate() error {
+	if r.UserID == uuid.Nil {
+		return fmt.Errorf("user id is required")
+	}
+	if r.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	if len(r.Content) > MaxMessageContentLength {
+		return fmt.Errorf("content has exceeded its limit of %v characters", MaxMessageContentLength)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxCommandNameLength        = 32
+	MaxCommandDescriptionLength = 200
+)
+
+// command names are lower case words, optionally joined with dashes or underscores
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// RoomCommand is a custom slash command of a room, handled by either a bot or an outgoing webhook
+type RoomCommand struct {
+	ID          uuid.UUID  `json:"id"`
+	RoomID      uuid.UUID  `json:"roomId"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	BotID       *uuid.UUID `json:"botId,omitempty"`
+	WebhookID   *uuid.UUID `json:"webhookId,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+
+	// the handling webhook, loaded when the command is invoked
+	Webhook *OutgoingWebhook `json:"-"`
+}
+
+type CreateCommandReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (r *CreateCommandReq) Validate() error {
+	r.Name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.Name), "/"))
+	r.Description = strings.TrimSpace(r.Description)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(r.Name) > MaxCommandNameLength {
+		return fmt.Errorf("name cannot exceed %d characters", MaxCommandNameLength)
+	}
+	if !commandNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name can only contain letters, digits, dashes and underscores")
+	}
+	if len(r.Description) > MaxCommandDescriptionLength {
+		return fmt.Errorf("description cannot exceed %d characters", MaxCommandDescriptionLength)
+	}
+	return nil
+}
+
+// CommandInvocation is a custom command invoked by a user, delivered to the command's bot or webhook
+type CommandInvocation struct {
+	ID        uuid.UUID `json:"id"`
+	RoomID    uuid.UUID `json:"roomId"`
+	Command   string    `json:"command"`
+	Args      string    `json:"args"`
+	UserID    uuid.UUID `json:"userId"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CommandResponse is a webhook's reply to a command invocation, shown only to the invoking user
+type CommandResponse struct {
+	Content string `json:"content"`
+}
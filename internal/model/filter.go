@@ -0,0 +1,171 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxBlockedWords      = 200
+	MaxBlockedWordLength = 50
+	MaxAllowedDomains    = 100
+)
+
+// FilterAction is what is done with a message caught by a content filter
+type FilterAction string
+
+const (
+	// message goes through unchanged
+	FilterAllow FilterAction = "allow"
+	// offending parts of the message are masked before it goes through
+	FilterMask FilterAction = "mask"
+	// message is refused
+	FilterReject FilterAction = "reject"
+	// message is held back until a room admin reviews it
+	FilterFlag FilterAction = "flag"
+)
+
+// RoomFilter holds the content filter settings of a room
+type RoomFilter struct {
+	RoomID       uuid.UUID    `json:"roomId"`
+	BlockedWords []string     `json:"blockedWords"`
+	WordAction   FilterAction `json:"wordAction"`
+	// links to other domains are subject to the link action
+	AllowedDomains []string     `json:"allowedDomains"`
+	LinkAction     FilterAction `json:"linkAction"`
+	// applied to repeated messages and messages in capitals
+	SpamAction FilterAction `json:"spamAction"`
+	UpdatedBy  *uuid.UUID   `json:"updatedBy"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
+
+// DefaultRoomFilter returns the settings of a room which has not configured its filters, letting every message through
+func DefaultRoomFilter(roomID uuid.UUID) *RoomFilter {
+	return &RoomFilter{
+		RoomID:         roomID,
+		BlockedWords:   []string{},
+		WordAction:     FilterMask,
+		AllowedDomains: []string{},
+		LinkAction:     FilterAllow,
+		SpamAction:     FilterAllow,
+	}
+}
+
+type UpdateRoomFilterReq struct {
+	ActorID        uuid.UUID    `json:"actorId"`
+	BlockedWords   []string     `json:"blockedWords"`
+	WordAction     FilterAction `json:"wordAction"`
+	AllowedDomains []string     `json:"allowedDomains"`
+	LinkAction     FilterAction `json:"linkAction"`
+	SpamAction     FilterAction `json:"spamAction"`
+}
+
+// Validate normalizes the words and domains to lower case without duplicates, defaulting to masking blocked words and
+// letting links and spam through
+func (r *UpdateRoomFilterReq) Validate() error {
+	r.BlockedWords = normalizeList(r.BlockedWords)
+	if len(r.BlockedWords) > MaxBlockedWords {
+		return fmt.Errorf("cannot block more than %d words", MaxBlockedWords)
+	}
+	for _, word := range r.BlockedWords {
+		if len(word) > MaxBlockedWordLength {
+			return fmt.Errorf("blocked words cannot exceed %d characters", MaxBlockedWordLength)
+		}
+	}
+
+	r.AllowedDomains = normalizeList(r.AllowedDomains)
+	if len(r.AllowedDomains) > MaxAllowedDomains {
+		return fmt.Errorf("cannot allow more than %d domains", MaxAllowedDomains)
+	}
+	for i, domain := range r.AllowedDomains {
+		domain = strings.TrimPrefix(domain, "www.")
+		if strings.ContainsAny(domain, "/:@ ") || !strings.Contains(domain, ".") {
+			return fmt.Errorf("invalid domain %q", domain)
+		}
+		r.AllowedDomains[i] = domain
+	}
+
+	switch r.WordAction {
+	case "":
+		r.WordAction = FilterMask
+	case FilterMask, FilterReject, FilterFlag:
+	default:
+		return fmt.Errorf("invalid word action %q, expected one of mask, reject or flag", r.WordAction)
+	}
+	for _, action := range []*FilterAction{&r.LinkAction, &r.SpamAction} {
+		switch *action {
+		case "":
+			*action = FilterAllow
+		case FilterAllow, FilterReject, FilterFlag:
+		default:
+			return fmt.Errorf("invalid action %q, expected one of allow, reject or flag", *action)
+		}
+	}
+	return nil
+}
+
+// normalizeList trims and lower cases the values, dropping empty ones and duplicates
+func normalizeList(values []string) []string {
+	normalized := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		normalized = append(normalized, value)
+	}
+	return normalized
+}
+
+// FilterVerdict is the outcome of running a message through the content filters, whose content may have been masked
+type FilterVerdict struct {
+	// allow, reject or flag
+	Action FilterAction
+	// why the message was rejected or flagged
+	Reasons []string
+	// the queued message when flagged
+	Flagged *FlaggedMessage
+}
+
+// FlaggedStatus is the state of a flagged message in the review queue
+type FlaggedStatus string
+
+const (
+	FlaggedPending  FlaggedStatus = "pending"
+	FlaggedApproved FlaggedStatus = "approved"
+	FlaggedRejected FlaggedStatus = "rejected"
+)
+
+// FlaggedMessage is a message held back by the content filters until a room admin reviews it
+type FlaggedMessage struct {
+	ID             uuid.UUID     `json:"id"`
+	RoomID         uuid.UUID     `json:"roomId"`
+	SenderID       uuid.UUID     `json:"senderId"`
+	SenderUsername string        `json:"senderUsername"`
+	Content        string        `json:"content"`
+	Reasons        []string      `json:"reasons"`
+	Status         FlaggedStatus `json:"status"`
+	ReviewedBy     *uuid.UUID    `json:"reviewedBy"`
+	ReviewedAt     *time.Time    `json:"reviewedAt"`
+	// message sent once approved
+	MessageID *uuid.UUID `json:"messageId"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+type ReviewFlaggedReq struct {
+	ActorID uuid.UUID     `json:"actorId"`
+	Status  FlaggedStatus `json:"status"`
+}
+
+func (r *ReviewFlaggedReq) Validate() error {
+	if r.Status != FlaggedApproved && r.Status != FlaggedRejected {
+		return fmt.Errorf("invalid status %q, expected approved or rejected", r.Status)
+	}
+	return nil
+}
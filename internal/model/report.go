@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxReportDetailsLength = 500
+
+// ReportCategory is the kind of abuse a message is reported for
+type ReportCategory string
+
+const (
+	ReportSpam       ReportCategory = "spam"
+	ReportHarassment ReportCategory = "harassment"
+	ReportHate       ReportCategory = "hate"
+	ReportSexual     ReportCategory = "sexual"
+	ReportViolence   ReportCategory = "violence"
+	ReportOther      ReportCategory = "other"
+)
+
+// ReportStatus is the state of a report in the moderation queue
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportResolved  ReportStatus = "resolved"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Report is a message reported as abusive by a member of its room. The message is copied so that the report outlives it
+type Report struct {
+	ID     uuid.UUID `json:"id"`
+	RoomID uuid.UUID `json:"roomId"`
+	// nil once the message is deleted
+	MessageID      *uuid.UUID     `json:"messageId"`
+	SenderID       uuid.UUID      `json:"senderId"`
+	SenderUsername string         `json:"senderUsername"`
+	Content        string         `json:"content"`
+	ReporterID     uuid.UUID      `json:"reporterId"`
+	Category       ReportCategory `json:"category"`
+	Details        string         `json:"details"`
+	Status         ReportStatus   `json:"status"`
+	// actions taken when the report was resolved
+	MessageDeleted bool       `json:"messageDeleted"`
+	SanctionID     *uuid.UUID `json:"sanctionId"`
+	ResolvedBy     *uuid.UUID `json:"resolvedBy"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+type CreateReportReq struct {
+	UserID   uuid.UUID      `json:"userId"`
+	Category ReportCategory `json:"category"`
+	Details  string         `json:"details"`
+}
+
+func (r *CreateReportReq) Validate() error {
+	if r.UserID == uuid.Nil {
+		return fmt.Errorf("user id is required")
+	}
+	switch r.Category {
+	case ReportSpam, ReportHarassment, ReportHate, ReportSexual, ReportViolence, ReportOther:
+	default:
+		return fmt.Errorf("category must be one of spam, harassment, hate, sexual, violence or other")
+	}
+	if len(r.Details) > MaxReportDetailsLength {
+		return fmt.Errorf("details cannot exceed %d characters", MaxReportDetailsLength)
+	}
+	return nil
+}
+
+type ResolveReportReq struct {
+	// admin resolving the report
+	ActorID uuid.UUID    `json:"actorId"`
+	Status  ReportStatus `json:"status"`
+	// whether the reported message is deleted
+	DeleteMessage bool `json:"deleteMessage"`
+	// sanction applied to the sender of the message, on behalf of the actor
+	Sanction *CreateSanctionReq `json:"sanction"`
+}
+
+func (r *ResolveReportReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	switch r.Status {
+	case ReportResolved:
+	case ReportDismissed:
+		if r.DeleteMessage || r.Sanction != nil {
+			return fmt.Errorf("dismissed reports cannot delete the message or sanction its sender")
+		}
+	default:
+		return fmt.Errorf("status must be resolved or dismissed")
+	}
+	if r.Sanction != nil {
+		r.Sanction.ActorID = r.ActorID
+		return r.Sanction.validateTerms()
+	}
+	return nil
+}
+
+// ReportResolution is the outcome of resolving a report
+type ReportResolution struct {
+	// the report along with the other reports of the message closed with it
+	Reports  []*Report `json:"reports"`
+	Sanction *Sanction `json:"sanction,omitempty"`
+	// id of the message deleted as a result
+	DeletedMessageID *uuid.UUID `json:"deletedMessageId,omitempty"`
+}
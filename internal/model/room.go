@@ -9,6 +9,9 @@ import (
 
 const (
 	MaxMessageContentLength = 5000
+	MaxSearchQueryLength    = 100
+	MaxRoomTopicLength      = 250
+	MaxSlowModeSeconds      = 3600
 )
 
 // room member roles
@@ -20,11 +23,54 @@ const (
 )
 
 type Room struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	CreatorID uuid.UUID `json:"creatorId"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Topic string    `json:"topic"`
+	// minimum number of seconds between messages of a user, 0 when slow mode is off
+	SlowModeSeconds int       `json:"slowModeSeconds"`
+	CreatorID       uuid.UUID `json:"creatorId"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// RoomSummary is a room enriched with its membership and activity details
+type RoomSummary struct {
+	Room
+	MemberCount   int        `json:"memberCount"`
+	LastMessageAt *time.Time `json:"lastMessageAt"`
+}
+
+// room search sort orders
+type RoomSort string
+
+const (
+	RoomSortRelevance RoomSort = "relevance"
+	RoomSortMembers   RoomSort = "members"
+	RoomSortActivity  RoomSort = "activity"
+	RoomSortCreated   RoomSort = "created"
+)
+
+type SearchRoomsReq struct {
+	Query string
+	Sort  RoomSort
+}
+
+func (r *SearchRoomsReq) Validate() error {
+	if len(r.Query) > MaxSearchQueryLength {
+		return fmt.Errorf("search query cannot exceed %d characters", MaxSearchQueryLength)
+	}
+	switch r.Sort {
+	case "":
+		// rank by relevance only when there is something to rank against
+		r.Sort = RoomSortCreated
+		if r.Query != "" {
+			r.Sort = RoomSortRelevance
+		}
+	case RoomSortRelevance, RoomSortMembers, RoomSortActivity, RoomSortCreated:
+	default:
+		return fmt.Errorf("invalid sort %q, expected one of relevance, members, activity or created", r.Sort)
+	}
+	return nil
 }
 
 type CreateRoomReq struct {
@@ -42,6 +88,23 @@ func (r *CreateRoomReq) Validate() error {
 	return nil
 }
 
+type SetSlowModeReq struct {
+	// admin changing the setting
+	ActorID uuid.UUID `json:"actorId"`
+	// minimum number of seconds between messages of a user, 0 to turn slow mode off
+	Seconds int `json:"seconds"`
+}
+
+func (r *SetSlowModeReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	if r.Seconds < 0 || r.Seconds > MaxSlowModeSeconds {
+		return fmt.Errorf("seconds must be between 0 and %d", MaxSlowModeSeconds)
+	}
+	return nil
+}
+
 type RoomMember struct {
 	ID        uuid.UUID `json:"id"`
 	RoomID    uuid.UUID `json:"roomId"`
@@ -73,15 +136,34 @@ type Message struct {
 }
 
 type CreateMessageReq struct {
-	Content string `json:"content"`
+	Content string    `json:"content"`
+	UserID  uuid.UUID `json:"userId"`
 }
 
 func (m *CreateMessageReq) Validate() error {
+	if m.UserID == uuid.Nil {
+		return fmt.Errorf("user id is required")
+	}
 	if m.Content == "" {
-		return fmt.Errorf("room name is required")
+		return fmt.Errorf("content is required")
 	}
 	if len(m.Content) > MaxMessageContentLength {
 		return fmt.Errorf("content has exceeded its limit of %v characters", MaxMessageContentLength)
 	}
 	return nil
 }
+
+// MessageContentReq is a message posted on behalf of a sender known from the request, such as a webhook or bot
+type MessageContentReq struct {
+	Content string `json:"content"`
+}
+
+func (r *MessageContentReq) Validate() error {
+	if r.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	if len(r.Content) > MaxMessageContentLength {
+		return fmt.Errorf("content has exceeded its limit of %v characters", MaxMessageContentLength)
+	}
+	return nil
+}
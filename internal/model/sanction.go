@@ -0,0 +1,156 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxSanctionReasonLength = 500
+	// longest time a timeout can last
+	MaxTimeoutDuration = 7 * 24 * time.Hour
+)
+
+// SanctionKind is the measure taken against a user in a room
+type SanctionKind string
+
+const (
+	// user cannot join the room or read its history
+	SanctionBan SanctionKind = "ban"
+	// user can read the room but cannot send messages
+	SanctionMute SanctionKind = "mute"
+	// short-lived mute which always expires
+	SanctionTimeout SanctionKind = "timeout"
+)
+
+// silences reports whether the sanction stops the user from sending messages
+func (k SanctionKind) silences() bool {
+	return k == SanctionMute || k == SanctionTimeout
+}
+
+// Sanction is a ban, mute or timeout of a user in a room, along with who applied and lifted it
+type Sanction struct {
+	ID       uuid.UUID    `json:"id"`
+	RoomID   uuid.UUID    `json:"roomId"`
+	UserID   uuid.UUID    `json:"userId"`
+	Kind     SanctionKind `json:"kind"`
+	Reason   string       `json:"reason"`
+	IssuedBy *uuid.UUID   `json:"issuedBy"`
+	// nil when the sanction lasts until it is lifted
+	ExpiresAt *time.Time `json:"expiresAt"`
+	RevokedBy *uuid.UUID `json:"revokedBy,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Active reports whether the sanction is in effect at the given time
+func (s *Sanction) Active(now time.Time) bool {
+	return s.RevokedAt == nil && (s.ExpiresAt == nil || now.Before(*s.ExpiresAt))
+}
+
+// Silences reports whether the sanction stops the user from sending messages
+func (s *Sanction) Silences() bool {
+	return s.Kind.silences()
+}
+
+// Sanctions are the sanctions of a user in a room
+type Sanctions []*Sanction
+
+// Ban returns the active ban, if any
+func (s Sanctions) Ban() *Sanction {
+	return s.find(func(sanction *Sanction) bool { return sanction.Kind == SanctionBan })
+}
+
+// Mute returns the active mute or timeout, if any
+func (s Sanctions) Mute() *Sanction {
+	return s.find((*Sanction).Silences)
+}
+
+// find returns the longest lasting active sanction matching the predicate
+func (s Sanctions) find(match func(*Sanction) bool) *Sanction {
+	now := time.Now()
+	var found *Sanction
+	for _, sanction := range s {
+		if !sanction.Active(now) || !match(sanction) {
+			continue
+		}
+		if found == nil || sanction.ExpiresAt == nil || (found.ExpiresAt != nil && sanction.ExpiresAt.After(*found.ExpiresAt)) {
+			found = sanction
+		}
+	}
+	return found
+}
+
+type CreateSanctionReq struct {
+	// admin applying the sanction
+	ActorID uuid.UUID    `json:"actorId"`
+	UserID  uuid.UUID    `json:"userId"`
+	Kind    SanctionKind `json:"kind"`
+	Reason  string       `json:"reason"`
+	// how long the sanction lasts, such as "10m" or "24h". bans and mutes without one last until they are lifted
+	Duration string `json:"duration"`
+
+	// parsed duration
+	duration time.Duration
+}
+
+func (r *CreateSanctionReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	if r.UserID == uuid.Nil {
+		return fmt.Errorf("user id is required")
+	}
+	return r.validateTerms()
+}
+
+// validateTerms validates the kind, reason and duration of the sanction
+func (r *CreateSanctionReq) validateTerms() error {
+	switch r.Kind {
+	case SanctionBan, SanctionMute, SanctionTimeout:
+	default:
+		return fmt.Errorf("kind must be one of ban, mute or timeout")
+	}
+	if len(r.Reason) > MaxSanctionReasonLength {
+		return fmt.Errorf("reason cannot exceed %d characters", MaxSanctionReasonLength)
+	}
+
+	r.duration = 0
+	if r.Duration != "" {
+		duration, err := time.ParseDuration(r.Duration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("duration must be a positive duration such as 10m or 24h")
+		}
+		r.duration = duration
+	}
+	if r.Kind == SanctionTimeout {
+		if r.duration == 0 {
+			return fmt.Errorf("duration is required for timeouts")
+		}
+		if r.duration > MaxTimeoutDuration {
+			return fmt.Errorf("timeouts cannot exceed %s", MaxTimeoutDuration)
+		}
+	}
+	return nil
+}
+
+// ExpiresAt returns when a sanction applied at the given time expires, or nil when it does not
+func (r *CreateSanctionReq) ExpiresAt(now time.Time) *time.Time {
+	if r.duration == 0 {
+		return nil
+	}
+	expiresAt := now.Add(r.duration).UTC()
+	return &expiresAt
+}
+
+// Replaces returns the kinds of active sanctions that a new sanction of this kind lifts. A user has at most one
+// active ban and one active mute or timeout
+func (k SanctionKind) Replaces() []SanctionKind {
+	if k.silences() {
+		return []SanctionKind{SanctionMute, SanctionTimeout}
+	}
+	return []SanctionKind{k}
+}
@@ -11,9 +11,19 @@ const (
 	MaxUsernameLength = 50
 )
 
+// kinds of user accounts
+type UserKind string
+
+const (
+	UserKindHuman UserKind = "human"
+	// automation account, authenticated with api keys
+	UserKindBot UserKind = "bot"
+)
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
+	Kind      UserKind  `json:"kind"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -22,6 +32,11 @@ type CreateUserReq struct {
 	Username string `json:"username"`
 }
 
+// IsBot reports whether the user is a bot account
+func (u *User) IsBot() bool {
+	return u.Kind == UserKindBot
+}
+
 func (r *CreateUserReq) Validate() error {
 	if r.Username == "" {
 		return fmt.Errorf("username is required")
@@ -31,3 +46,14 @@ func (r *CreateUserReq) Validate() error {
 	}
 	return nil
 }
+
+type SearchUsersReq struct {
+	Query string
+}
+
+func (r *SearchUsersReq) Validate() error {
+	if len(r.Query) > MaxSearchQueryLength {
+		return fmt.Errorf("search query cannot exceed %d characters", MaxSearchQueryLength)
+	}
+	return nil
+}
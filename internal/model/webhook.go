@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxWebhookNameLength = MaxUsernameLength
+	MaxWebhookURLLength  = 2048
+)
+
+// event types delivered to outgoing webhooks
+const (
+	WebhookEventMessageCreated = "message.created"
+	WebhookEventCommandInvoked = "command.invoked"
+)
+
+// IncomingWebhook posts messages into a room under its name
+type IncomingWebhook struct {
+	ID     uuid.UUID `json:"id"`
+	RoomID uuid.UUID `json:"roomId"`
+	Name   string    `json:"name"`
+	// secret token, only available when the webhook is created
+	Token     string    `json:"token,omitempty"`
+	TokenHash []byte    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OutgoingWebhook receives the messages of a room as signed http requests
+type OutgoingWebhook struct {
+	ID     uuid.UUID `json:"id"`
+	RoomID uuid.UUID `json:"roomId"`
+	URL    string    `json:"url"`
+	// signing key, only shown when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookPayload is the body delivered to outgoing webhooks
+type WebhookPayload struct {
+	Event   string             `json:"event"`
+	Message *Message           `json:"message,omitempty"`
+	Command *CommandInvocation `json:"command,omitempty"`
+}
+
+type CreateIncomingWebhookReq struct {
+	// admin creating the webhook
+	ActorID uuid.UUID `json:"actorId"`
+	Name    string    `json:"name"`
+}
+
+func (r *CreateIncomingWebhookReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(r.Name) > MaxWebhookNameLength {
+		return fmt.Errorf("name cannot exceed %d characters", MaxWebhookNameLength)
+	}
+	return nil
+}
+
+type CreateOutgoingWebhookReq struct {
+	// admin creating the webhook
+	ActorID uuid.UUID `json:"actorId"`
+	URL     string    `json:"url"`
+}
+
+func (r *CreateOutgoingWebhookReq) Validate() error {
+	if r.ActorID == uuid.Nil {
+		return fmt.Errorf("actor id is required")
+	}
+	if r.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if len(r.URL) > MaxWebhookURLLength {
+		return fmt.Errorf("url cannot exceed %d characters", MaxWebhookURLLength)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https url")
+	}
+	return nil
+}
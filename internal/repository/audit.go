@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+type PGAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPGAuditRepository(db *sql.DB) *PGAuditRepository {
+	return &PGAuditRepository{db: db}
+}
+
+func (r *PGAuditRepository) Create(ctx context.Context, data *model.AuditEvent) error {
+	query := `
+        INSERT INTO audit_events (actor_id, room_id, action, target_id, before, after)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `
+	_, err := r.db.ExecContext(ctx, query, data.ActorID, data.RoomID, data.Action, data.TargetID, nullableJSON(data.Before), nullableJSON(data.After))
+	return err
+}
+
+// Query retrieves the audit events matching the query, newest first. Actions without a target match all actions on
+// that kind of target
+func (r *PGAuditRepository) Query(ctx context.Context, q *model.AuditQuery, limit, offset int) ([]*model.AuditEvent, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if q.RoomID != nil {
+		where("room_id = $%d", *q.RoomID)
+	}
+	if q.ActorID != nil {
+		where("actor_id = $%d", *q.ActorID)
+	}
+	if q.Action != "" {
+		if strings.Contains(q.Action, ".") {
+			where("action = $%d", q.Action)
+		} else {
+			where("action LIKE $%d", prefixPattern(q.Action+"."))
+		}
+	}
+	if q.Since != nil {
+		where("created_at >= $%d", *q.Since)
+	}
+	if q.Until != nil {
+		where("created_at < $%d", *q.Until)
+	}
+	filter := "TRUE"
+	if len(conditions) > 0 {
+		filter = strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`
+        SELECT id, actor_id, room_id, action, target_id, before, after, created_at
+        FROM audit_events
+        WHERE %s
+        ORDER BY created_at DESC
+        LIMIT $%d OFFSET $%d
+    `, filter, len(args)-1, len(args))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*model.AuditEvent
+	for rows.Next() {
+		var (
+			event           model.AuditEvent
+			actorID, roomID uuid.NullUUID
+			before, after   []byte
+		)
+		if err := rows.Scan(&event.ID, &actorID, &roomID, &event.Action, &event.TargetID, &before, &after, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.ActorID, event.RoomID = nullUUIDPtr(actorID), nullUUIDPtr(roomID)
+		event.Before, event.After = before, after
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// PGBotRepository stores bot api keys in Postgres
+type PGBotRepository struct {
+	db *sql.DB
+}
+
+func NewPGBotRepository(db *sql.DB) *PGBotRepository {
+	return &PGBotRepository{db: db}
+}
+
+// CreateKey stores the key along with its room scopes. ErrNotFound is returned when the bot or a room does not exist
+func (r *PGBotRepository) CreateKey(ctx context.Context, data *model.APIKey) (*model.APIKey, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO bot_api_keys (bot_id, key_hash)
+        VALUES ($1, $2)
+		RETURNING id, bot_id, key_hash, created_at, updated_at
+    `
+	var key model.APIKey
+	if err := tx.QueryRowContext(ctx, query, data.BotID, data.KeyHash).Scan(
+		&key.ID,
+		&key.BotID,
+		&key.KeyHash,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	); err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return nil, ErrAlreadyExist
+		case isForeignKeyViolation(err):
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	roomIDs := make([]string, len(data.RoomIDs))
+	for i, id := range data.RoomIDs {
+		roomIDs[i] = id.String()
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO bot_api_key_rooms (key_id, room_id) SELECT $1, unnest($2::uuid[])", key.ID, roomIDs); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	key.RoomIDs = data.RoomIDs
+	return &key, nil
+}
+
+// GetKeyByHash retrieves the key with the given digest along with its bot
+func (r *PGBotRepository) GetKeyByHash(ctx context.Context, hash []byte) (*model.APIKey, error) {
+	query := `
+        SELECT k.id, k.bot_id, k.key_hash, k.created_at, k.updated_at,
+            u.id, u.username, u.kind, u.created_at, u.updated_at
+        FROM bot_api_keys k
+        JOIN users u ON u.id = k.bot_id
+        WHERE k.key_hash = $1
+    `
+	key := model.APIKey{Bot: &model.User{}}
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(
+		&key.ID,
+		&key.BotID,
+		&key.KeyHash,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+		&key.Bot.ID,
+		&key.Bot.Username,
+		&key.Bot.Kind,
+		&key.Bot.CreatedAt,
+		&key.Bot.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key.RoomIDs, err = r.getKeyRooms(ctx, key.ID); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetKeysByBotID retrieves the keys of the bot without their digests
+func (r *PGBotRepository) GetKeysByBotID(ctx context.Context, botID uuid.UUID) ([]*model.APIKey, error) {
+	query := `
+        SELECT id, bot_id, created_at, updated_at
+        FROM bot_api_keys
+        WHERE bot_id = $1
+        ORDER BY created_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, botID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		var key model.APIKey
+		if err := rows.Scan(
+			&key.ID,
+			&key.BotID,
+			&key.CreatedAt,
+			&key.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if key.RoomIDs, err = r.getKeyRooms(ctx, key.ID); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (r *PGBotRepository) DeleteKey(ctx context.Context, botID, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM bot_api_keys WHERE id = $1 AND bot_id = $2", id, botID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PGBotRepository) getKeyRooms(ctx context.Context, keyID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT room_id FROM bot_api_key_rooms WHERE key_id = $1", keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roomIDs := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		roomIDs = append(roomIDs, id)
+	}
+	return roomIDs, rows.Err()
+}
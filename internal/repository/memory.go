@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryStore keeps all data in process memory, for tests and running without a database. It enforces the same
+// constraints as the postgres schema, such as unique usernames and references between rows. Data is lost when the
+// process exits
+type MemoryStore struct {
+	// guards all rows, so that operations spanning several of them are atomic like postgres transactions
+	mu sync.RWMutex
+
+	users     map[uuid.UUID]*model.User
+	usernames map[string]uuid.UUID
+
+	rooms     map[uuid.UUID]*model.Room
+	roomOrder []uuid.UUID
+	// members of each room in the order they joined
+	members map[uuid.UUID][]*model.RoomMember
+
+	messages map[uuid.UUID]*model.Message
+	// messages of each room in the order they were created
+	roomMessages map[uuid.UUID][]*model.Message
+	reactions    map[uuid.UUID][]*model.Reaction
+
+	incomingWebhooks []*model.IncomingWebhook
+	outgoingWebhooks []*model.OutgoingWebhook
+	apiKeys          []*model.APIKey
+	commands         []*model.RoomCommand
+	sanctions        []*model.Sanction
+	filters          map[uuid.UUID]*model.RoomFilter
+	flagged          []*model.FlaggedMessage
+	reports          []*model.Report
+	auditEvents      []*model.AuditEvent
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:        make(map[uuid.UUID]*model.User),
+		usernames:    make(map[string]uuid.UUID),
+		rooms:        make(map[uuid.UUID]*model.Room),
+		members:      make(map[uuid.UUID][]*model.RoomMember),
+		messages:     make(map[uuid.UUID]*model.Message),
+		roomMessages: make(map[uuid.UUID][]*model.Message),
+		reactions:    make(map[uuid.UUID][]*model.Reaction),
+		filters:      make(map[uuid.UUID]*model.RoomFilter),
+	}
+}
+
+// NewMemoryRepositories creates the repositories storing data in a new memory store
+func NewMemoryRepositories() *Repositories {
+	store := NewMemoryStore()
+	return &Repositories{
+		Users:     NewMemoryUserRepository(store),
+		Rooms:     NewMemoryRoomRepository(store),
+		Messages:  NewMemoryMessageRepository(store),
+		Webhooks:  NewMemoryWebhookRepository(store),
+		Bots:      NewMemoryBotRepository(store),
+		Reactions: NewMemoryReactionRepository(store),
+		Commands:  NewMemoryCommandRepository(store),
+		Sanctions: NewMemorySanctionRepository(store),
+		Filters:   NewMemoryFilterRepository(store),
+		Reports:   NewMemoryReportRepository(store),
+		Audit:     NewMemoryAuditRepository(store),
+	}
+}
+
+// member retrieves the membership of the user in the room, nil when there is none
+func (s *MemoryStore) member(roomID, userID uuid.UUID) *model.RoomMember {
+	for _, member := range s.members[roomID] {
+		if member.UserID == userID {
+			return member
+		}
+	}
+	return nil
+}
+
+// deleteMessage removes the message along with its reactions, clearing the references of flagged messages and
+// reports to it
+func (s *MemoryStore) deleteMessage(id uuid.UUID) bool {
+	message, ok := s.messages[id]
+	if !ok {
+		return false
+	}
+	delete(s.messages, id)
+	delete(s.reactions, id)
+	s.roomMessages[message.RoomID] = slices.DeleteFunc(s.roomMessages[message.RoomID], func(m *model.Message) bool {
+		return m.ID == id
+	})
+	for _, flagged := range s.flagged {
+		if flagged.MessageID != nil && *flagged.MessageID == id {
+			flagged.MessageID = nil
+		}
+	}
+	for _, report := range s.reports {
+		if report.MessageID != nil && *report.MessageID == id {
+			report.MessageID = nil
+		}
+	}
+	return true
+}
+
+// insertMessage stores a copy of the message, assigning its id and timestamps unless they are set
+func (s *MemoryStore) insertMessage(data *model.Message) (*model.Message, error) {
+	if _, ok := s.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	if data.SenderID != uuid.Nil {
+		if _, ok := s.users[data.SenderID]; !ok {
+			return nil, ErrNotFound
+		}
+	}
+	message := *data
+	if message.ID == uuid.Nil {
+		message.ID = uuid.New()
+	}
+	if _, ok := s.messages[message.ID]; ok {
+		return nil, ErrAlreadyExist
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+		message.UpdatedAt = message.CreatedAt
+	}
+	s.messages[message.ID] = &message
+	// messages of a room are kept in creation order, which batches written late may precede
+	roomMessages := s.roomMessages[message.RoomID]
+	i := sort.Search(len(roomMessages), func(i int) bool { return roomMessages[i].CreatedAt.After(message.CreatedAt) })
+	s.roomMessages[message.RoomID] = slices.Insert(roomMessages, i, &message)
+	return copyOf(&message), nil
+}
+
+// copyOf returns a shallow copy of the row, so that callers cannot change the stored one
+func copyOf[T any](row *T) *T {
+	c := *row
+	return &c
+}
+
+// page returns the rows within the limit and offset, nil when there are none
+func page[T any](rows []T, limit, offset int) []T {
+	if offset >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// newestFirst returns the rows in reverse insertion order
+func newestFirst[T any](rows []T) []T {
+	reversed := slices.Clone(rows)
+	slices.Reverse(reversed)
+	return reversed
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryAuditRepository stores the audit log of mutating operations in a memory store
+type MemoryAuditRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryAuditRepository(store *MemoryStore) *MemoryAuditRepository {
+	return &MemoryAuditRepository{store: store}
+}
+
+func (r *MemoryAuditRepository) Create(ctx context.Context, data *model.AuditEvent) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	event := copyOf(data)
+	event.ID, event.CreatedAt = uuid.New(), time.Now()
+	event.Before, event.After = slices.Clone(data.Before), slices.Clone(data.After)
+	r.store.auditEvents = append(r.store.auditEvents, event)
+	return nil
+}
+
+// Query retrieves the audit events matching the query, newest first. Actions without a target match all actions on
+// that kind of target
+func (r *MemoryAuditRepository) Query(ctx context.Context, q *model.AuditQuery, limit, offset int) ([]*model.AuditEvent, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var events []*model.AuditEvent
+	for _, event := range newestFirst(r.store.auditEvents) {
+		if auditMatches(event, q) {
+			events = append(events, event)
+		}
+	}
+	events = page(events, limit, offset)
+	for i, event := range events {
+		events[i] = copyOf(event)
+	}
+	return events, nil
+}
+
+func auditMatches(event *model.AuditEvent, q *model.AuditQuery) bool {
+	if q.RoomID != nil && (event.RoomID == nil || *event.RoomID != *q.RoomID) {
+		return false
+	}
+	if q.ActorID != nil && (event.ActorID == nil || *event.ActorID != *q.ActorID) {
+		return false
+	}
+	if q.Action != "" {
+		action := string(event.Action)
+		if strings.Contains(q.Action, ".") && action != q.Action {
+			return false
+		}
+		if !strings.Contains(q.Action, ".") && !strings.HasPrefix(action, q.Action+".") {
+			return false
+		}
+	}
+	if q.Since != nil && event.CreatedAt.Before(*q.Since) {
+		return false
+	}
+	return q.Until == nil || event.CreatedAt.Before(*q.Until)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryBotRepository stores bot api keys in a memory store
+type MemoryBotRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryBotRepository(store *MemoryStore) *MemoryBotRepository {
+	return &MemoryBotRepository{store: store}
+}
+
+// CreateKey stores the key along with its room scopes. ErrNotFound is returned when the bot or a room does not exist
+func (r *MemoryBotRepository) CreateKey(ctx context.Context, data *model.APIKey) (*model.APIKey, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[data.BotID]; !ok {
+		return nil, ErrNotFound
+	}
+	for _, id := range data.RoomIDs {
+		if _, ok := r.store.rooms[id]; !ok {
+			return nil, ErrNotFound
+		}
+	}
+	for _, key := range r.store.apiKeys {
+		if bytes.Equal(key.KeyHash, data.KeyHash) {
+			return nil, ErrAlreadyExist
+		}
+	}
+	now := time.Now()
+	key := &model.APIKey{
+		ID:        uuid.New(),
+		BotID:     data.BotID,
+		RoomIDs:   slices.Clone(data.RoomIDs),
+		KeyHash:   data.KeyHash,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.store.apiKeys = append(r.store.apiKeys, key)
+	return copyKey(key), nil
+}
+
+// GetKeyByHash retrieves the key with the given digest along with its bot
+func (r *MemoryBotRepository) GetKeyByHash(ctx context.Context, hash []byte) (*model.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, key := range r.store.apiKeys {
+		if bytes.Equal(key.KeyHash, hash) {
+			found := copyKey(key)
+			found.Bot = copyOf(r.store.users[key.BotID])
+			return found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetKeysByBotID retrieves the keys of the bot without their digests
+func (r *MemoryBotRepository) GetKeysByBotID(ctx context.Context, botID uuid.UUID) ([]*model.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var keys []*model.APIKey
+	for _, key := range r.store.apiKeys {
+		if key.BotID == botID {
+			key = copyKey(key)
+			key.KeyHash = nil
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryBotRepository) DeleteKey(ctx context.Context, botID, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := slices.IndexFunc(r.store.apiKeys, func(key *model.APIKey) bool { return key.ID == id && key.BotID == botID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.store.apiKeys = slices.Delete(r.store.apiKeys, i, i+1)
+	return nil
+}
+
+func copyKey(key *model.APIKey) *model.APIKey {
+	c := copyOf(key)
+	c.RoomIDs = slices.Clone(key.RoomIDs)
+	if c.RoomIDs == nil {
+		c.RoomIDs = make([]uuid.UUID, 0)
+	}
+	return c
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryCommandRepository stores the custom commands of rooms in a memory store
+type MemoryCommandRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryCommandRepository(store *MemoryStore) *MemoryCommandRepository {
+	return &MemoryCommandRepository{store: store}
+}
+
+// Create stores the command. ErrAlreadyExist is returned when the room has a command with the same name and
+// ErrNotFound when the room, bot or webhook does not exist
+func (r *MemoryCommandRepository) Create(ctx context.Context, data *model.RoomCommand) (*model.RoomCommand, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	if data.BotID != nil {
+		if _, ok := r.store.users[*data.BotID]; !ok {
+			return nil, ErrNotFound
+		}
+	}
+	if data.WebhookID != nil && r.store.outgoingWebhook(*data.WebhookID) == nil {
+		return nil, ErrNotFound
+	}
+	if r.store.command(data.RoomID, data.Name) != nil {
+		return nil, ErrAlreadyExist
+	}
+	now := time.Now()
+	command := &model.RoomCommand{
+		ID:          uuid.New(),
+		RoomID:      data.RoomID,
+		Name:        data.Name,
+		Description: data.Description,
+		BotID:       data.BotID,
+		WebhookID:   data.WebhookID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	r.store.commands = append(r.store.commands, command)
+	return copyOf(command), nil
+}
+
+// GetByName retrieves the command of the room along with its webhook, if any
+func (r *MemoryCommandRepository) GetByName(ctx context.Context, roomID uuid.UUID, name string) (*model.RoomCommand, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	command := r.store.command(roomID, name)
+	if command == nil {
+		return nil, ErrNotFound
+	}
+	command = copyOf(command)
+	if command.WebhookID != nil {
+		if hook := r.store.outgoingWebhook(*command.WebhookID); hook != nil {
+			command.Webhook = copyOf(hook)
+		}
+	}
+	return command, nil
+}
+
+// GetByRoomID retrieves the commands of the room sorted by name
+func (r *MemoryCommandRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.RoomCommand, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var commands []*model.RoomCommand
+	for _, command := range r.store.commands {
+		if command.RoomID == roomID {
+			commands = append(commands, copyOf(command))
+		}
+	}
+	slices.SortFunc(commands, func(a, b *model.RoomCommand) int { return strings.Compare(a.Name, b.Name) })
+	return commands, nil
+}
+
+func (r *MemoryCommandRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := slices.IndexFunc(r.store.commands, func(command *model.RoomCommand) bool { return command.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.store.commands = slices.Delete(r.store.commands, i, i+1)
+	return nil
+}
+
+// command retrieves the command of the room with the given name, nil when there is none
+func (s *MemoryStore) command(roomID uuid.UUID, name string) *model.RoomCommand {
+	for _, command := range s.commands {
+		if command.RoomID == roomID && command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryFilterRepository stores the content filter settings of rooms and the messages they flagged in a memory store
+type MemoryFilterRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryFilterRepository(store *MemoryStore) *MemoryFilterRepository {
+	return &MemoryFilterRepository{store: store}
+}
+
+// GetByRoomID retrieves the content filter settings of the room. ErrNotFound is returned when the room has none
+func (r *MemoryFilterRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID) (*model.RoomFilter, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	filter, ok := r.store.filters[roomID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyFilter(filter), nil
+}
+
+// Upsert replaces the content filter settings of the room. ErrNotFound is returned when the room does not exist
+func (r *MemoryFilterRepository) Upsert(ctx context.Context, data *model.RoomFilter) (*model.RoomFilter, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	filter := copyFilter(data)
+	filter.UpdatedAt = time.Now()
+	r.store.filters[data.RoomID] = filter
+	return copyFilter(filter), nil
+}
+
+// CreateFlagged queues the message for review
+func (r *MemoryFilterRepository) CreateFlagged(ctx context.Context, data *model.FlaggedMessage) (*model.FlaggedMessage, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	flagged := &model.FlaggedMessage{
+		ID:             uuid.New(),
+		RoomID:         data.RoomID,
+		SenderID:       data.SenderID,
+		SenderUsername: data.SenderUsername,
+		Content:        data.Content,
+		Reasons:        slices.Clone(data.Reasons),
+		Status:         model.FlaggedPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.store.flagged = append(r.store.flagged, flagged)
+	return copyFlagged(flagged), nil
+}
+
+// GetFlaggedByRoomID retrieves the flagged messages of the room, oldest first, optionally only those in the given status
+func (r *MemoryFilterRepository) GetFlaggedByRoomID(ctx context.Context, roomID uuid.UUID, status model.FlaggedStatus, limit, offset int) ([]*model.FlaggedMessage, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var messages []*model.FlaggedMessage
+	for _, flagged := range r.store.flagged {
+		if flagged.RoomID == roomID && (status == "" || flagged.Status == status) {
+			messages = append(messages, flagged)
+		}
+	}
+	messages = page(messages, limit, offset)
+	for i, flagged := range messages {
+		messages[i] = copyFlagged(flagged)
+	}
+	return messages, nil
+}
+
+// Reject marks the pending flagged message of the room as rejected on behalf of the actor. ErrNotFound is returned
+// when there is no such message or it was already reviewed
+func (r *MemoryFilterRepository) Reject(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	flagged := r.store.pendingFlagged(roomID, id)
+	if flagged == nil {
+		return nil, ErrNotFound
+	}
+	review(flagged, actorID, model.FlaggedRejected)
+	return copyFlagged(flagged), nil
+}
+
+// Approve marks the pending flagged message of the room as approved on behalf of the actor and sends it as a message
+// of the room. ErrNotFound is returned when there is no such message or it was already reviewed
+func (r *MemoryFilterRepository) Approve(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, *model.Message, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	flagged := r.store.pendingFlagged(roomID, id)
+	if flagged == nil {
+		return nil, nil, ErrNotFound
+	}
+	message, err := r.store.insertMessage(&model.Message{
+		RoomID:         flagged.RoomID,
+		SenderID:       flagged.SenderID,
+		SenderUsername: flagged.SenderUsername,
+		Content:        flagged.Content,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	review(flagged, actorID, model.FlaggedApproved)
+	flagged.MessageID = &message.ID
+	return copyFlagged(flagged), message, nil
+}
+
+// pendingFlagged retrieves the flagged message of the room awaiting review, nil when there is none
+func (s *MemoryStore) pendingFlagged(roomID, id uuid.UUID) *model.FlaggedMessage {
+	for _, flagged := range s.flagged {
+		if flagged.ID == id && flagged.RoomID == roomID && flagged.Status == model.FlaggedPending {
+			return flagged
+		}
+	}
+	return nil
+}
+
+func review(flagged *model.FlaggedMessage, actorID uuid.UUID, status model.FlaggedStatus) {
+	now := time.Now()
+	flagged.Status, flagged.ReviewedBy, flagged.ReviewedAt, flagged.UpdatedAt = status, &actorID, timePtr(now), now
+}
+
+func copyFilter(filter *model.RoomFilter) *model.RoomFilter {
+	c := copyOf(filter)
+	c.BlockedWords, c.AllowedDomains = cloneStrings(filter.BlockedWords), cloneStrings(filter.AllowedDomains)
+	return c
+}
+
+func copyFlagged(flagged *model.FlaggedMessage) *model.FlaggedMessage {
+	c := copyOf(flagged)
+	c.Reasons = cloneStrings(flagged.Reasons)
+	return c
+}
+
+// cloneStrings copies the list, mapping nil to an empty list like postgres arrays
+func cloneStrings(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return slices.Clone(list)
+}
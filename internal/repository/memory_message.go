@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryMessageRepository stores the messages of rooms in a memory store
+type MemoryMessageRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryMessageRepository(store *MemoryStore) *MemoryMessageRepository {
+	return &MemoryMessageRepository{store: store}
+}
+
+// Create returns ErrNotFound when the room or sender does not exist
+func (r *MemoryMessageRepository) Create(ctx context.Context, data *model.Message) (*model.Message, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// the id and timestamps are assigned on creation
+	return r.store.insertMessage(&model.Message{
+		RoomID:         data.RoomID,
+		SenderID:       data.SenderID,
+		SenderUsername: data.SenderUsername,
+		Content:        data.Content,
+	})
+}
+
+// CreateBatch stores all messages or none of them. The messages must have their ids and timestamps set and are
+// returned in the order given
+func (r *MemoryMessageRepository) CreateBatch(ctx context.Context, data []*model.Message) ([]*model.Message, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	messages := make([]*model.Message, 0, len(data))
+	for _, msg := range data {
+		message, err := r.store.insertMessage(msg)
+		if err != nil {
+			for _, inserted := range messages {
+				r.store.deleteMessage(inserted.ID)
+			}
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (r *MemoryMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	message, ok := r.store.messages[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyOf(message), nil
+}
+
+func (r *MemoryMessageRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return copyMessages(page(newestFirst(r.store.roomMessages[roomID]), limit, offset)), nil
+}
+
+// GetByRoomIDAfter retrieves the most recent messages of the room created after the given message, newest first
+func (r *MemoryMessageRepository) GetByRoomIDAfter(ctx context.Context, roomID, afterID uuid.UUID, limit int) ([]*model.Message, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	after, ok := r.store.messages[afterID]
+	if !ok || after.RoomID != roomID {
+		return nil, ErrNotFound
+	}
+	messages := r.store.roomMessages[roomID]
+	i := slices.IndexFunc(messages, func(m *model.Message) bool { return m.CreatedAt.After(after.CreatedAt) })
+	if i < 0 {
+		return nil, nil
+	}
+	return copyMessages(page(newestFirst(messages[i:]), limit, 0)), nil
+}
+
+func (r *MemoryMessageRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if !r.store.deleteMessage(id) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func copyMessages(messages []*model.Message) []*model.Message {
+	if len(messages) == 0 {
+		return nil
+	}
+	copies := make([]*model.Message, len(messages))
+	for i, message := range messages {
+		copies[i] = copyOf(message)
+	}
+	return copies
+}
+
+// MemoryReactionRepository stores the reactions left on messages in a memory store
+type MemoryReactionRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryReactionRepository(store *MemoryStore) *MemoryReactionRepository {
+	return &MemoryReactionRepository{store: store}
+}
+
+// Create stores the reaction, leaving it unchanged when the user already reacted with the same emoji. ErrNotFound is
+// returned when the message does not exist in the room
+func (r *MemoryReactionRepository) Create(ctx context.Context, data *model.Reaction) (*model.Reaction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	message, ok := r.store.messages[data.MessageID]
+	if !ok || message.RoomID != data.RoomID {
+		return nil, ErrNotFound
+	}
+	user, ok := r.store.users[data.UserID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for _, reaction := range r.store.reactions[data.MessageID] {
+		if reaction.UserID == data.UserID && reaction.Emoji == data.Emoji {
+			existing := *data
+			existing.CreatedAt = reaction.CreatedAt
+			return &existing, nil
+		}
+	}
+	reaction := &model.Reaction{
+		MessageID: data.MessageID,
+		RoomID:    data.RoomID,
+		UserID:    data.UserID,
+		Username:  user.Username,
+		Emoji:     data.Emoji,
+		CreatedAt: time.Now(),
+	}
+	r.store.reactions[data.MessageID] = append(r.store.reactions[data.MessageID], reaction)
+	created := *data
+	created.CreatedAt = reaction.CreatedAt
+	return &created, nil
+}
+
+// GetByMessageID retrieves the reactions on the message in the order they were left
+func (r *MemoryReactionRepository) GetByMessageID(ctx context.Context, roomID, messageID uuid.UUID) ([]*model.Reaction, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	message, ok := r.store.messages[messageID]
+	if !ok || message.RoomID != roomID {
+		return nil, nil
+	}
+	var reactions []*model.Reaction
+	for _, reaction := range r.store.reactions[messageID] {
+		reactions = append(reactions, copyOf(reaction))
+	}
+	return reactions, nil
+}
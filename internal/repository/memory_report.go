@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryReportRepository stores the reports of abusive messages in a memory store
+type MemoryReportRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryReportRepository(store *MemoryStore) *MemoryReportRepository {
+	return &MemoryReportRepository{store: store}
+}
+
+// Create stores the report. ErrAlreadyExist is returned when the reporter already reported the message, and
+// ErrNotFound when the message no longer exists
+func (r *MemoryReportRepository) Create(ctx context.Context, data *model.Report) (*model.Report, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[data.ReporterID]; !ok {
+		return nil, ErrNotFound
+	}
+	if data.MessageID != nil {
+		if _, ok := r.store.messages[*data.MessageID]; !ok {
+			return nil, ErrNotFound
+		}
+		for _, report := range r.store.reports {
+			if report.MessageID != nil && *report.MessageID == *data.MessageID && report.ReporterID == data.ReporterID {
+				return nil, ErrAlreadyExist
+			}
+		}
+	}
+	now := time.Now()
+	report := &model.Report{
+		ID:             uuid.New(),
+		RoomID:         data.RoomID,
+		MessageID:      data.MessageID,
+		SenderID:       data.SenderID,
+		SenderUsername: data.SenderUsername,
+		Content:        data.Content,
+		ReporterID:     data.ReporterID,
+		Category:       data.Category,
+		Details:        data.Details,
+		Status:         model.ReportOpen,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.store.reports = append(r.store.reports, report)
+	return copyOf(report), nil
+}
+
+func (r *MemoryReportRepository) GetByID(ctx context.Context, roomID, id uuid.UUID) (*model.Report, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, report := range r.store.reports {
+		if report.ID == id && report.RoomID == roomID {
+			return copyOf(report), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByRoomID retrieves the reports of the room, oldest first, optionally only those in the given status
+func (r *MemoryReportRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, status model.ReportStatus, limit, offset int) ([]*model.Report, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var reports []*model.Report
+	for _, report := range r.store.reports {
+		if report.RoomID == roomID && (status == "" || report.Status == status) {
+			reports = append(reports, report)
+		}
+	}
+	reports = page(reports, limit, offset)
+	for i, report := range reports {
+		reports[i] = copyOf(report)
+	}
+	return reports, nil
+}
+
+// Resolve closes the open report with the given outcome, along with the other open reports of the same message, and
+// deletes the message if requested. ErrNotFound is returned when the report is not open
+func (r *MemoryReportRepository) Resolve(ctx context.Context, report *model.Report, deleteMessage bool) ([]*model.Report, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var matched []*model.Report
+	resolved := false
+	for _, open := range r.store.reports {
+		if open.RoomID != report.RoomID || open.Status != model.ReportOpen {
+			continue
+		}
+		sameMessage := report.MessageID != nil && open.MessageID != nil && *open.MessageID == *report.MessageID
+		if open.ID == report.ID || sameMessage {
+			matched = append(matched, open)
+			resolved = resolved || open.ID == report.ID
+		}
+	}
+	if !resolved {
+		return nil, ErrNotFound
+	}
+
+	now := time.Now()
+	for _, closed := range matched {
+		closed.Status, closed.MessageDeleted, closed.SanctionID = report.Status, deleteMessage, report.SanctionID
+		closed.ResolvedBy, closed.ResolvedAt, closed.UpdatedAt = report.ResolvedBy, timePtr(now), now
+	}
+	// deleting the message clears the references of the reports to it
+	if deleteMessage && report.MessageID != nil {
+		r.store.deleteMessage(*report.MessageID)
+	}
+	reports := make([]*model.Report, len(matched))
+	for i, closed := range matched {
+		reports[i] = copyOf(closed)
+	}
+	return reports, nil
+}
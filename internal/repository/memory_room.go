@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryRoomRepository stores rooms and their members in a memory store
+type MemoryRoomRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryRoomRepository(store *MemoryStore) *MemoryRoomRepository {
+	return &MemoryRoomRepository{store: store}
+}
+
+// Create returns ErrNotFound when the creator does not exist
+func (r *MemoryRoomRepository) Create(ctx context.Context, data *model.Room) (*model.Room, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[data.CreatorID]; !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	room := &model.Room{ID: uuid.New(), Name: data.Name, CreatorID: data.CreatorID, CreatedAt: now, UpdatedAt: now}
+	r.store.rooms[room.ID] = room
+	r.store.roomOrder = append(r.store.roomOrder, room.ID)
+	return copyOf(room), nil
+}
+
+func (r *MemoryRoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	room, ok := r.store.rooms[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyOf(room), nil
+}
+
+func (r *MemoryRoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*model.Room, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.rooms(func(*model.Room) bool { return true }, limit, offset), nil
+}
+
+// Search retrieves rooms whose names start with or contain the query regardless of case. An empty query matches all
+// rooms
+func (r *MemoryRoomRepository) Search(ctx context.Context, req *model.SearchRoomsReq, limit, offset int) ([]*model.RoomSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	query := strings.ToLower(req.Query)
+	var rooms []*model.RoomSummary
+	for _, id := range newestFirst(r.store.roomOrder) {
+		room := r.store.rooms[id]
+		if !strings.Contains(strings.ToLower(room.Name), query) {
+			continue
+		}
+		summary := &model.RoomSummary{Room: *room, MemberCount: len(r.store.members[id])}
+		if messages := r.store.roomMessages[id]; len(messages) > 0 {
+			summary.LastMessageAt = timePtr(messages[len(messages)-1].CreatedAt)
+		}
+		rooms = append(rooms, summary)
+	}
+
+	// rooms are already sorted by creation, which breaks the ties of the other sorts
+	switch req.Sort {
+	case model.RoomSortRelevance:
+		slices.SortStableFunc(rooms, func(a, b *model.RoomSummary) int {
+			return compareBool(strings.HasPrefix(strings.ToLower(b.Name), query), strings.HasPrefix(strings.ToLower(a.Name), query))
+		})
+	case model.RoomSortMembers:
+		slices.SortStableFunc(rooms, func(a, b *model.RoomSummary) int { return b.MemberCount - a.MemberCount })
+	case model.RoomSortActivity:
+		slices.SortStableFunc(rooms, func(a, b *model.RoomSummary) int {
+			switch {
+			case a.LastMessageAt == nil || b.LastMessageAt == nil:
+				return compareBool(a.LastMessageAt == nil, b.LastMessageAt == nil)
+			default:
+				return b.LastMessageAt.Compare(*a.LastMessageAt)
+			}
+		})
+	}
+	return page(rooms, limit, offset), nil
+}
+
+func (r *MemoryRoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*model.Room, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.rooms(func(room *model.Room) bool { return r.store.member(room.ID, userID) != nil }, limit, offset), nil
+}
+
+// rooms retrieves the rooms matching the filter, newest first
+func (r *MemoryRoomRepository) rooms(match func(*model.Room) bool, limit, offset int) []*model.Room {
+	var rooms []*model.Room
+	for _, id := range newestFirst(r.store.roomOrder) {
+		if room := r.store.rooms[id]; match(room) {
+			rooms = append(rooms, copyOf(room))
+		}
+	}
+	return page(rooms, limit, offset)
+}
+
+// AddMember returns ErrAlreadyExist when the user is already a member, and ErrNotFound when the room or user does not
+// exist
+func (r *MemoryRoomRepository) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[roomID]; !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := r.store.users[userID]; !ok {
+		return nil, ErrNotFound
+	}
+	if r.store.member(roomID, userID) != nil {
+		return nil, ErrAlreadyExist
+	}
+	now := time.Now()
+	member := &model.RoomMember{ID: uuid.New(), RoomID: roomID, UserID: userID, Role: role, CreatedAt: now, UpdatedAt: now}
+	r.store.members[roomID] = append(r.store.members[roomID], member)
+	return copyOf(member), nil
+}
+
+func (r *MemoryRoomRepository) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	member := r.store.member(roomID, userID)
+	if member == nil {
+		return nil, ErrNotFound
+	}
+	return copyOf(member), nil
+}
+
+func (r *MemoryRoomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	members := r.store.members[roomID]
+	i := slices.IndexFunc(members, func(member *model.RoomMember) bool { return member.UserID == userID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.store.members[roomID] = slices.Delete(members, i, i+1)
+	return nil
+}
+
+func (r *MemoryRoomRepository) UpdateTopic(ctx context.Context, id uuid.UUID, topic string) error {
+	return r.update(id, func(room *model.Room) { room.Topic = topic })
+}
+
+func (r *MemoryRoomRepository) UpdateSlowMode(ctx context.Context, id uuid.UUID, seconds int) error {
+	return r.update(id, func(room *model.Room) { room.SlowModeSeconds = seconds })
+}
+
+// update applies the change to the room, returning ErrNotFound when the room does not exist
+func (r *MemoryRoomRepository) update(id uuid.UUID, change func(room *model.Room)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	room, ok := r.store.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(room)
+	room.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryRoomRepository) GetAllMembers(ctx context.Context, roomID string, limit, offset int) ([]*model.RoomMember, error) {
+	id, err := uuid.Parse(roomID)
+	if err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var members []*model.RoomMember
+	for _, member := range newestFirst(r.store.members[id]) {
+		members = append(members, copyOf(member))
+	}
+	return page(members, limit, offset), nil
+}
+
+// GetAdminIDs retrieves the ids of the room's admins
+func (r *MemoryRoomRepository) GetAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for _, member := range r.store.members[roomID] {
+		if model.RoomMemberRole(member.Role) == model.AdminRole {
+			ids = append(ids, member.UserID)
+		}
+	}
+	return ids, nil
+}
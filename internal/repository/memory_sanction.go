@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemorySanctionRepository stores the bans, mutes and timeouts of room members in a memory store
+type MemorySanctionRepository struct {
+	store *MemoryStore
+}
+
+func NewMemorySanctionRepository(store *MemoryStore) *MemorySanctionRepository {
+	return &MemorySanctionRepository{store: store}
+}
+
+// Create stores the sanction, lifting the user's active sanctions of the replaced kinds on behalf of its issuer.
+// ErrNotFound is returned when the room or user does not exist
+func (r *MemorySanctionRepository) Create(ctx context.Context, data *model.Sanction, replaces []model.SanctionKind) (*model.Sanction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := r.store.users[data.UserID]; !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	r.store.revokeActive(data.RoomID, data.UserID, replaces, data.IssuedBy, now)
+	sanction := &model.Sanction{
+		ID:        uuid.New(),
+		RoomID:    data.RoomID,
+		UserID:    data.UserID,
+		Kind:      data.Kind,
+		Reason:    data.Reason,
+		IssuedBy:  data.IssuedBy,
+		ExpiresAt: data.ExpiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.store.sanctions = append(r.store.sanctions, sanction)
+	return copyOf(sanction), nil
+}
+
+// GetActiveByUserID retrieves the sanctions of the user in effect in the room
+func (r *MemorySanctionRepository) GetActiveByUserID(ctx context.Context, roomID, userID uuid.UUID) (model.Sanctions, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	now := time.Now()
+	var sanctions model.Sanctions
+	for _, sanction := range r.store.sanctions {
+		if sanction.RoomID == roomID && sanction.UserID == userID && sanction.Active(now) {
+			sanctions = append(sanctions, copyOf(sanction))
+		}
+	}
+	return sanctions, nil
+}
+
+// GetByRoomID retrieves the sanctions of the room, newest first, optionally only those in effect
+func (r *MemorySanctionRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, activeOnly bool, limit, offset int) (model.Sanctions, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	now := time.Now()
+	var sanctions model.Sanctions
+	for _, sanction := range newestFirst(r.store.sanctions) {
+		if sanction.RoomID == roomID && (!activeOnly || sanction.Active(now)) {
+			sanctions = append(sanctions, sanction)
+		}
+	}
+	sanctions = page(sanctions, limit, offset)
+	for i, sanction := range sanctions {
+		sanctions[i] = copyOf(sanction)
+	}
+	return sanctions, nil
+}
+
+// Revoke lifts the sanction of the room on behalf of the actor. ErrNotFound is returned when there is no such
+// sanction or it was already lifted
+func (r *MemorySanctionRepository) Revoke(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.Sanction, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := slices.IndexFunc(r.store.sanctions, func(sanction *model.Sanction) bool {
+		return sanction.ID == id && sanction.RoomID == roomID && sanction.RevokedAt == nil
+	})
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	sanction := r.store.sanctions[i]
+	now := time.Now()
+	sanction.RevokedBy, sanction.RevokedAt, sanction.UpdatedAt = &actorID, timePtr(now), now
+	return copyOf(sanction), nil
+}
+
+// RevokeActive lifts the user's sanctions of the given kinds in effect in the room on behalf of the actor
+func (r *MemorySanctionRepository) RevokeActive(ctx context.Context, roomID, userID uuid.UUID, kinds []model.SanctionKind, actorID uuid.UUID) (model.Sanctions, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.revokeActive(roomID, userID, kinds, &actorID, time.Now()), nil
+}
+
+// revokeActive lifts the user's sanctions of the given kinds in effect in the room, returning copies of them
+func (s *MemoryStore) revokeActive(roomID, userID uuid.UUID, kinds []model.SanctionKind, actorID *uuid.UUID, now time.Time) model.Sanctions {
+	var revoked model.Sanctions
+	for _, sanction := range s.sanctions {
+		if sanction.RoomID != roomID || sanction.UserID != userID || !slices.Contains(kinds, sanction.Kind) || !sanction.Active(now) {
+			continue
+		}
+		sanction.RevokedBy, sanction.RevokedAt, sanction.UpdatedAt = actorID, timePtr(now), now
+		revoked = append(revoked, copyOf(sanction))
+	}
+	return revoked
+}
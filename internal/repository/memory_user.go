@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryUserRepository stores users in a memory store
+type MemoryUserRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryUserRepository(store *MemoryStore) *MemoryUserRepository {
+	return &MemoryUserRepository{store: store}
+}
+
+// Create returns ErrAlreadyExist when the username is taken
+func (r *MemoryUserRepository) Create(ctx context.Context, username string, kind model.UserKind) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.usernames[username]; ok {
+		return nil, ErrAlreadyExist
+	}
+	now := time.Now()
+	user := &model.User{ID: uuid.New(), Username: username, Kind: kind, CreatedAt: now, UpdatedAt: now}
+	r.store.users[user.ID] = user
+	r.store.usernames[username] = user.ID
+	return copyOf(user), nil
+}
+
+func (r *MemoryUserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	id, ok := r.store.usernames[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyOf(r.store.users[id]), nil
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyOf(user), nil
+}
+
+// Search retrieves users whose usernames start with or contain the query regardless of case, with prefix matches
+// ranked first
+func (r *MemoryUserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*model.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var users []*model.User
+	for _, user := range r.store.users {
+		if strings.Contains(strings.ToLower(user.Username), query) {
+			users = append(users, copyOf(user))
+		}
+	}
+	slices.SortFunc(users, func(a, b *model.User) int {
+		aPrefix, bPrefix := strings.HasPrefix(strings.ToLower(a.Username), query), strings.HasPrefix(strings.ToLower(b.Username), query)
+		if aPrefix != bPrefix {
+			if aPrefix {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Username, b.Username)
+	})
+	return page(users, limit, offset), nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MemoryWebhookRepository stores the incoming and outgoing webhooks of rooms in a memory store
+type MemoryWebhookRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryWebhookRepository(store *MemoryStore) *MemoryWebhookRepository {
+	return &MemoryWebhookRepository{store: store}
+}
+
+// CreateIncoming returns ErrNotFound when the room does not exist
+func (r *MemoryWebhookRepository) CreateIncoming(ctx context.Context, data *model.IncomingWebhook) (*model.IncomingWebhook, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	hook := &model.IncomingWebhook{ID: uuid.New(), RoomID: data.RoomID, Name: data.Name, TokenHash: data.TokenHash, CreatedAt: now, UpdatedAt: now}
+	r.store.incomingWebhooks = append(r.store.incomingWebhooks, hook)
+	return copyOf(hook), nil
+}
+
+func (r *MemoryWebhookRepository) GetIncomingByID(ctx context.Context, id uuid.UUID) (*model.IncomingWebhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, hook := range r.store.incomingWebhooks {
+		if hook.ID == id {
+			return copyOf(hook), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetIncomingByRoomID retrieves the incoming webhooks of the room without their token digests
+func (r *MemoryWebhookRepository) GetIncomingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.IncomingWebhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var hooks []*model.IncomingWebhook
+	for _, hook := range r.store.incomingWebhooks {
+		if hook.RoomID == roomID {
+			hook = copyOf(hook)
+			hook.TokenHash = nil
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (r *MemoryWebhookRepository) DeleteIncoming(ctx context.Context, roomID, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := slices.IndexFunc(r.store.incomingWebhooks, func(hook *model.IncomingWebhook) bool { return hook.ID == id && hook.RoomID == roomID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.store.incomingWebhooks = slices.Delete(r.store.incomingWebhooks, i, i+1)
+	return nil
+}
+
+// CreateOutgoing returns ErrNotFound when the room does not exist
+func (r *MemoryWebhookRepository) CreateOutgoing(ctx context.Context, data *model.OutgoingWebhook) (*model.OutgoingWebhook, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.rooms[data.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	hook := &model.OutgoingWebhook{ID: uuid.New(), RoomID: data.RoomID, URL: data.URL, Secret: data.Secret, CreatedAt: now, UpdatedAt: now}
+	r.store.outgoingWebhooks = append(r.store.outgoingWebhooks, hook)
+	return copyOf(hook), nil
+}
+
+// GetOutgoingByRoomID retrieves the outgoing webhooks of the room, including their secrets
+func (r *MemoryWebhookRepository) GetOutgoingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.OutgoingWebhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var hooks []*model.OutgoingWebhook
+	for _, hook := range r.store.outgoingWebhooks {
+		if hook.RoomID == roomID {
+			hooks = append(hooks, copyOf(hook))
+		}
+	}
+	return hooks, nil
+}
+
+func (r *MemoryWebhookRepository) GetOutgoingByID(ctx context.Context, roomID, id uuid.UUID) (*model.OutgoingWebhook, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	hook := r.store.outgoingWebhook(id)
+	if hook == nil || hook.RoomID != roomID {
+		return nil, ErrNotFound
+	}
+	return copyOf(hook), nil
+}
+
+// DeleteOutgoing deletes the webhook along with the commands it handles
+func (r *MemoryWebhookRepository) DeleteOutgoing(ctx context.Context, roomID, id uuid.UUID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := slices.IndexFunc(r.store.outgoingWebhooks, func(hook *model.OutgoingWebhook) bool { return hook.ID == id && hook.RoomID == roomID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.store.outgoingWebhooks = slices.Delete(r.store.outgoingWebhooks, i, i+1)
+	r.store.commands = slices.DeleteFunc(r.store.commands, func(command *model.RoomCommand) bool {
+		return command.WebhookID != nil && *command.WebhookID == id
+	})
+	return nil
+}
+
+// outgoingWebhook retrieves the outgoing webhook, nil when there is none
+func (s *MemoryStore) outgoingWebhook(id uuid.UUID) *model.OutgoingWebhook {
+	for _, hook := range s.outgoingWebhooks {
+		if hook.ID == id {
+			return hook
+		}
+	}
+	return nil
+}
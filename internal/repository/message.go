@@ -3,27 +3,30 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mrshabel/chat/internal/model"
 )
 
-type MessageRepository struct {
+type PGMessageRepository struct {
 	db *sql.DB
 }
 
-func NewMessageRepository(db *sql.DB) *MessageRepository {
-	return &MessageRepository{db: db}
+func NewPGMessageRepository(db *sql.DB) *PGMessageRepository {
+	return &PGMessageRepository{db: db}
 }
 
-func (r *MessageRepository) Create(ctx context.Context, data *model.Message) (*model.Message, error) {
+func (r *PGMessageRepository) Create(ctx context.Context, data *model.Message) (*model.Message, error) {
 	query := `
         INSERT INTO messages (room_id, sender_id, sender_username, content)
         VALUES ($1, $2, $3, $4)
 		RETURNING id, room_id, sender_id, sender_username, content, created_at, updated_at
     `
 	var message model.Message
-	if err := r.db.QueryRowContext(ctx, query, data.RoomID, data.SenderID, data.SenderUsername, data.Content).Scan(
+	if err := r.db.QueryRowContext(ctx, query, data.RoomID, nullableUUID(data.SenderID), data.SenderUsername, data.Content).Scan(
 		&message.ID,
 		&message.RoomID,
 		&message.SenderID,
@@ -36,7 +39,87 @@ func (r *MessageRepository) Create(ctx context.Context, data *model.Message) (*m
 	return &message, nil
 }
 
-func (r *MessageRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.Message, error) {
+// CreateBatch inserts all messages with a single statement. The messages must have their ids and timestamps set and
+// are returned in the order given
+func (r *PGMessageRepository) CreateBatch(ctx context.Context, data []*model.Message) ([]*model.Message, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	const columns = 7
+	values := make([]string, 0, len(data))
+	args := make([]any, 0, len(data)*columns)
+	for i, msg := range data {
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		args = append(args, msg.ID, msg.RoomID, nullableUUID(msg.SenderID), msg.SenderUsername, msg.Content, msg.CreatedAt, msg.UpdatedAt)
+	}
+	query := `
+        INSERT INTO messages (id, room_id, sender_id, sender_username, content, created_at, updated_at)
+        VALUES ` + strings.Join(values, ", ") + `
+		RETURNING id, room_id, sender_id, sender_username, content, created_at, updated_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// returned rows are matched by id since their order is not guaranteed
+	created := make(map[uuid.UUID]*model.Message, len(data))
+	for rows.Next() {
+		var msg model.Message
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.RoomID,
+			&msg.SenderID,
+			&msg.SenderUsername,
+			&msg.Content,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		created[msg.ID] = &msg
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*model.Message, len(data))
+	for i, msg := range data {
+		if messages[i] = created[msg.ID]; messages[i] == nil {
+			return nil, fmt.Errorf("message (%s) missing from batch insert result", msg.ID)
+		}
+	}
+	return messages, nil
+}
+
+func (r *PGMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error) {
+	query := `
+        SELECT id, room_id, sender_id, sender_username, content, created_at, updated_at
+        FROM messages
+        WHERE id = $1
+    `
+	var msg model.Message
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&msg.ID,
+		&msg.RoomID,
+		&msg.SenderID,
+		&msg.SenderUsername,
+		&msg.Content,
+		&msg.CreatedAt,
+		&msg.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (r *PGMessageRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.Message, error) {
 	query := `
         SELECT id, room_id, sender_id, sender_username, content, created_at, updated_at
         FROM messages 
@@ -72,7 +155,53 @@ func (r *MessageRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, l
 	return messages, nil
 }
 
-func (r *MessageRepository) Delete(ctx context.Context, id uuid.UUID) error {
+// GetByRoomIDAfter retrieves the most recent messages of the room created after the given message, newest first
+func (r *PGMessageRepository) GetByRoomIDAfter(ctx context.Context, roomID, afterID uuid.UUID, limit int) ([]*model.Message, error) {
+	var after time.Time
+	err := r.db.QueryRowContext(ctx, "SELECT created_at FROM messages WHERE id = $1 AND room_id = $2", afterID, roomID).Scan(&after)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT id, room_id, sender_id, sender_username, content, created_at, updated_at
+        FROM messages
+        WHERE room_id = $1 AND created_at > $2
+        ORDER BY created_at DESC
+        LIMIT $3
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*model.Message
+	for rows.Next() {
+		var msg model.Message
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.RoomID,
+			&msg.SenderID,
+			&msg.SenderUsername,
+			&msg.Content,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *PGMessageRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := "DELETE FROM messages WHERE id = $1"
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+type PGReactionRepository struct {
+	db *sql.DB
+}
+
+func NewPGReactionRepository(db *sql.DB) *PGReactionRepository {
+	return &PGReactionRepository{db: db}
+}
+
+// Create stores the reaction, leaving it unchanged when the user already reacted with the same emoji. ErrNotFound is
+// returned when the message does not exist in the room
+func (r *PGReactionRepository) Create(ctx context.Context, data *model.Reaction) (*model.Reaction, error) {
+	// the no-op update returns the existing reaction on conflict
+	query := `
+        INSERT INTO message_reactions (message_id, user_id, emoji)
+        SELECT id, $2, $3 FROM messages WHERE id = $1 AND room_id = $4
+        ON CONFLICT (message_id, user_id, emoji) DO UPDATE SET emoji = EXCLUDED.emoji
+		RETURNING created_at
+    `
+	reaction := *data
+	err := r.db.QueryRowContext(ctx, query, data.MessageID, data.UserID, data.Emoji, data.RoomID).Scan(&reaction.CreatedAt)
+	if err == sql.ErrNoRows || isForeignKeyViolation(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
+// GetByMessageID retrieves the reactions on the message in the order they were left
+func (r *PGReactionRepository) GetByMessageID(ctx context.Context, roomID, messageID uuid.UUID) ([]*model.Reaction, error) {
+	query := `
+        SELECT mr.message_id, m.room_id, mr.user_id, u.username, mr.emoji, mr.created_at
+        FROM message_reactions mr
+        JOIN messages m ON m.id = mr.message_id
+        JOIN users u ON u.id = mr.user_id
+        WHERE mr.message_id = $1 AND m.room_id = $2
+        ORDER BY mr.created_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, messageID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*model.Reaction
+	for rows.Next() {
+		var reaction model.Reaction
+		if err := rows.Scan(
+			&reaction.MessageID,
+			&reaction.RoomID,
+			&reaction.UserID,
+			&reaction.Username,
+			&reaction.Emoji,
+			&reaction.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, &reaction)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
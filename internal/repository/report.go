@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const reportColumns = "id, room_id, message_id, sender_id, sender_username, content, reporter_id, category, details, status, message_deleted, sanction_id, resolved_by, resolved_at, created_at, updated_at"
+
+type PGReportRepository struct {
+	db *sql.DB
+}
+
+func NewPGReportRepository(db *sql.DB) *PGReportRepository {
+	return &PGReportRepository{db: db}
+}
+
+// Create stores the report. ErrAlreadyExist is returned when the reporter already reported the message, and
+// ErrNotFound when the message no longer exists
+func (r *PGReportRepository) Create(ctx context.Context, data *model.Report) (*model.Report, error) {
+	query := `
+        INSERT INTO message_reports (room_id, message_id, sender_id, sender_username, content, reporter_id, category, details)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING ` + reportColumns
+	report, err := scanReport(r.db.QueryRowContext(ctx, query, data.RoomID, data.MessageID, nullableUUID(data.SenderID), data.SenderUsername, data.Content, data.ReporterID, data.Category, data.Details))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAlreadyExist
+		}
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *PGReportRepository) GetByID(ctx context.Context, roomID, id uuid.UUID) (*model.Report, error) {
+	query := "SELECT " + reportColumns + " FROM message_reports WHERE id = $1 AND room_id = $2"
+	report, err := scanReport(r.db.QueryRowContext(ctx, query, id, roomID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return report, err
+}
+
+// GetByRoomID retrieves the reports of the room, oldest first, optionally only those in the given status
+func (r *PGReportRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, status model.ReportStatus, limit, offset int) ([]*model.Report, error) {
+	query := `
+        SELECT ` + reportColumns + `
+        FROM message_reports
+        WHERE room_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY created_at ASC
+        LIMIT $3 OFFSET $4
+    `
+	return r.query(ctx, r.db, query, roomID, string(status), limit, offset)
+}
+
+// Resolve closes the open report with the given outcome, along with the other open reports of the same message, and
+// deletes the message if requested. ErrNotFound is returned when the report is not open
+func (r *PGReportRepository) Resolve(ctx context.Context, report *model.Report, deleteMessage bool) ([]*model.Report, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE message_reports
+        SET status = $4, message_deleted = $5, sanction_id = $6, resolved_by = $7, resolved_at = NOW(), updated_at = NOW()
+        WHERE room_id = $2 AND status = 'open' AND (id = $1 OR message_id = $3)
+		RETURNING ` + reportColumns
+	reports, err := r.query(ctx, tx, query, report.ID, report.RoomID, report.MessageID, report.Status, deleteMessage, report.SanctionID, report.ResolvedBy)
+	if err != nil {
+		return nil, err
+	}
+	// the report itself may have been resolved in the meantime along with another report of the message
+	resolved := false
+	for _, closed := range reports {
+		resolved = resolved || closed.ID == report.ID
+	}
+	if !resolved {
+		return nil, ErrNotFound
+	}
+
+	if deleteMessage && report.MessageID != nil {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE id = $1", report.MessageID); err != nil {
+			return nil, err
+		}
+		// deleting the message cleared the reference to it
+		for _, closed := range reports {
+			closed.MessageID = nil
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *PGReportRepository) query(ctx context.Context, db queryer, query string, args ...any) ([]*model.Report, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*model.Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func scanReport(row interface{ Scan(...any) error }) (*model.Report, error) {
+	var (
+		report                            model.Report
+		messageID, sanctionID, resolvedBy uuid.NullUUID
+		resolvedAt                        sql.NullTime
+	)
+	if err := row.Scan(
+		&report.ID,
+		&report.RoomID,
+		&messageID,
+		&report.SenderID,
+		&report.SenderUsername,
+		&report.Content,
+		&report.ReporterID,
+		&report.Category,
+		&report.Details,
+		&report.Status,
+		&report.MessageDeleted,
+		&sanctionID,
+		&resolvedBy,
+		&resolvedAt,
+		&report.CreatedAt,
+		&report.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	report.MessageID, report.SanctionID, report.ResolvedBy = nullUUIDPtr(messageID), nullUUIDPtr(sanctionID), nullUUIDPtr(resolvedBy)
+	report.ResolvedAt = nullTimePtr(resolvedAt)
+	return &report, nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// UserRepository stores users, both humans and bots
+type UserRepository interface {
+	// Create returns ErrAlreadyExist when the username is taken
+	Create(ctx context.Context, username string, kind model.UserKind) (*model.User, error)
+	GetByUsername(ctx context.Context, username string) (*model.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	// Search retrieves users whose usernames start with or are similar to the query, with prefix matches ranked first
+	Search(ctx context.Context, query string, limit, offset int) ([]*model.User, error)
+}
+
+// RoomRepository stores rooms and their members
+type RoomRepository interface {
+	// Create returns ErrNotFound when the creator does not exist
+	Create(ctx context.Context, data *model.Room) (*model.Room, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error)
+	// GetAll retrieves rooms, newest first
+	GetAll(ctx context.Context, limit, offset int) ([]*model.Room, error)
+	// Search retrieves rooms whose names start with or are similar to the query. An empty query matches all rooms
+	Search(ctx context.Context, req *model.SearchRoomsReq, limit, offset int) ([]*model.RoomSummary, error)
+	// GetAllByUserID retrieves the rooms the user is a member of, newest first
+	GetAllByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*model.Room, error)
+	// AddMember returns ErrAlreadyExist when the user is already a member, and ErrNotFound when the room or user does
+	// not exist
+	AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error)
+	GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error)
+	RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error
+	UpdateTopic(ctx context.Context, id uuid.UUID, topic string) error
+	UpdateSlowMode(ctx context.Context, id uuid.UUID, seconds int) error
+	// GetAllMembers retrieves the members of the room, newest first
+	GetAllMembers(ctx context.Context, roomID string, limit, offset int) ([]*model.RoomMember, error)
+	// GetAdminIDs retrieves the ids of the room's admins
+	GetAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// MessageRepository stores the messages of rooms
+type MessageRepository interface {
+	Create(ctx context.Context, data *model.Message) (*model.Message, error)
+	// CreateBatch stores all messages at once. The messages must have their ids and timestamps set and are returned in
+	// the order given
+	CreateBatch(ctx context.Context, data []*model.Message) ([]*model.Message, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error)
+	// GetByRoomID retrieves the messages of the room, newest first
+	GetByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.Message, error)
+	// GetByRoomIDAfter retrieves the most recent messages of the room created after the given message, newest first
+	GetByRoomIDAfter(ctx context.Context, roomID, afterID uuid.UUID, limit int) ([]*model.Message, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// WebhookRepository stores the incoming and outgoing webhooks of rooms
+type WebhookRepository interface {
+	// CreateIncoming returns ErrNotFound when the room does not exist
+	CreateIncoming(ctx context.Context, data *model.IncomingWebhook) (*model.IncomingWebhook, error)
+	GetIncomingByID(ctx context.Context, id uuid.UUID) (*model.IncomingWebhook, error)
+	// GetIncomingByRoomID retrieves the incoming webhooks of the room without their token digests
+	GetIncomingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.IncomingWebhook, error)
+	DeleteIncoming(ctx context.Context, roomID, id uuid.UUID) error
+	// CreateOutgoing returns ErrNotFound when the room does not exist
+	CreateOutgoing(ctx context.Context, data *model.OutgoingWebhook) (*model.OutgoingWebhook, error)
+	// GetOutgoingByRoomID retrieves the outgoing webhooks of the room, including their secrets
+	GetOutgoingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.OutgoingWebhook, error)
+	GetOutgoingByID(ctx context.Context, roomID, id uuid.UUID) (*model.OutgoingWebhook, error)
+	DeleteOutgoing(ctx context.Context, roomID, id uuid.UUID) error
+}
+
+// BotRepository stores the api keys of bots
+type BotRepository interface {
+	// CreateKey stores the key along with its room scopes. ErrAlreadyExist is returned when a key has the same digest,
+	// and ErrNotFound when the bot or a room does not exist
+	CreateKey(ctx context.Context, data *model.APIKey) (*model.APIKey, error)
+	// GetKeyByHash retrieves the key with the given digest along with its bot
+	GetKeyByHash(ctx context.Context, hash []byte) (*model.APIKey, error)
+	// GetKeysByBotID retrieves the keys of the bot without their digests
+	GetKeysByBotID(ctx context.Context, botID uuid.UUID) ([]*model.APIKey, error)
+	DeleteKey(ctx context.Context, botID, id uuid.UUID) error
+}
+
+// ReactionRepository stores the reactions left on messages
+type ReactionRepository interface {
+	// Create stores the reaction, leaving it unchanged when the user already reacted with the same emoji. ErrNotFound
+	// is returned when the message does not exist in the room or the user does not exist
+	Create(ctx context.Context, data *model.Reaction) (*model.Reaction, error)
+	// GetByMessageID retrieves the reactions on the message in the order they were left
+	GetByMessageID(ctx context.Context, roomID, messageID uuid.UUID) ([]*model.Reaction, error)
+}
+
+// CommandRepository stores the custom commands of rooms
+type CommandRepository interface {
+	// Create stores the command. ErrAlreadyExist is returned when the room has a command with the same name and
+	// ErrNotFound when the room, bot or webhook does not exist
+	Create(ctx context.Context, data *model.RoomCommand) (*model.RoomCommand, error)
+	// GetByName retrieves the command of the room along with its webhook, if any
+	GetByName(ctx context.Context, roomID uuid.UUID, name string) (*model.RoomCommand, error)
+	// GetByRoomID retrieves the commands of the room sorted by name
+	GetByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.RoomCommand, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// SanctionRepository stores the bans, mutes and timeouts of room members
+type SanctionRepository interface {
+	// Create stores the sanction, lifting the user's active sanctions of the replaced kinds on behalf of its issuer.
+	// ErrNotFound is returned when the room or user does not exist
+	Create(ctx context.Context, data *model.Sanction, replaces []model.SanctionKind) (*model.Sanction, error)
+	// GetActiveByUserID retrieves the sanctions of the user in effect in the room
+	GetActiveByUserID(ctx context.Context, roomID, userID uuid.UUID) (model.Sanctions, error)
+	// GetByRoomID retrieves the sanctions of the room, newest first, optionally only those in effect
+	GetByRoomID(ctx context.Context, roomID uuid.UUID, activeOnly bool, limit, offset int) (model.Sanctions, error)
+	// Revoke lifts the sanction of the room on behalf of the actor. ErrNotFound is returned when there is no such
+	// sanction or it was already lifted
+	Revoke(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.Sanction, error)
+	// RevokeActive lifts the user's sanctions of the given kinds in effect in the room on behalf of the actor
+	RevokeActive(ctx context.Context, roomID, userID uuid.UUID, kinds []model.SanctionKind, actorID uuid.UUID) (model.Sanctions, error)
+}
+
+// FilterRepository stores the content filter settings of rooms and the messages they flagged
+type FilterRepository interface {
+	// GetByRoomID retrieves the content filter settings of the room. ErrNotFound is returned when the room has none
+	GetByRoomID(ctx context.Context, roomID uuid.UUID) (*model.RoomFilter, error)
+	// Upsert replaces the content filter settings of the room. ErrNotFound is returned when the room does not exist
+	Upsert(ctx context.Context, data *model.RoomFilter) (*model.RoomFilter, error)
+	// CreateFlagged queues the message for review
+	CreateFlagged(ctx context.Context, data *model.FlaggedMessage) (*model.FlaggedMessage, error)
+	// GetFlaggedByRoomID retrieves the flagged messages of the room, oldest first, optionally only those in the given
+	// status
+	GetFlaggedByRoomID(ctx context.Context, roomID uuid.UUID, status model.FlaggedStatus, limit, offset int) ([]*model.FlaggedMessage, error)
+	// Reject marks the pending flagged message of the room as rejected on behalf of the actor. ErrNotFound is returned
+	// when there is no such message or it was already reviewed
+	Reject(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, error)
+	// Approve marks the pending flagged message of the room as approved on behalf of the actor and sends it as a
+	// message of the room. ErrNotFound is returned when there is no such message or it was already reviewed
+	Approve(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, *model.Message, error)
+}
+
+// ReportRepository stores the reports of abusive messages
+type ReportRepository interface {
+	// Create stores the report. ErrAlreadyExist is returned when the reporter already reported the message, and
+	// ErrNotFound when the message no longer exists
+	Create(ctx context.Context, data *model.Report) (*model.Report, error)
+	GetByID(ctx context.Context, roomID, id uuid.UUID) (*model.Report, error)
+	// GetByRoomID retrieves the reports of the room, oldest first, optionally only those in the given status
+	GetByRoomID(ctx context.Context, roomID uuid.UUID, status model.ReportStatus, limit, offset int) ([]*model.Report, error)
+	// Resolve closes the open report with the given outcome, along with the other open reports of the same message,
+	// and deletes the message if requested. ErrNotFound is returned when the report is not open
+	Resolve(ctx context.Context, report *model.Report, deleteMessage bool) ([]*model.Report, error)
+}
+
+// AuditRepository stores the audit log of mutating operations
+type AuditRepository interface {
+	Create(ctx context.Context, data *model.AuditEvent) error
+	// Query retrieves the audit events matching the query, newest first. Actions without a target match all actions
+	// on that kind of target
+	Query(ctx context.Context, q *model.AuditQuery, limit, offset int) ([]*model.AuditEvent, error)
+}
+
+// Repositories is the set of repositories backing the services, all stored in the same place
+type Repositories struct {
+	Users     UserRepository
+	Rooms     RoomRepository
+	Messages  MessageRepository
+	Webhooks  WebhookRepository
+	Bots      BotRepository
+	Reactions ReactionRepository
+	Commands  CommandRepository
+	Sanctions SanctionRepository
+	Filters   FilterRepository
+	Reports   ReportRepository
+	Audit     AuditRepository
+}
+
+// NewPGRepositories creates the repositories storing data in the postgres database
+func NewPGRepositories(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:     NewPGUserRepository(db),
+		Rooms:     NewPGRoomRepository(db),
+		Messages:  NewPGMessageRepository(db),
+		Webhooks:  NewPGWebhookRepository(db),
+		Bots:      NewPGBotRepository(db),
+		Reactions: NewPGReactionRepository(db),
+		Commands:  NewPGCommandRepository(db),
+		Sanctions: NewPGSanctionRepository(db),
+		Filters:   NewPGFilterRepository(db),
+		Reports:   NewPGReportRepository(db),
+		Audit:     NewPGAuditRepository(db),
+	}
+}
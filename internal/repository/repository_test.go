@@ -0,0 +1,1215 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/database"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// env var holding the url of a postgres database the postgres repositories are checked against, in a schema dropped
+// afterwards. The postgres checks are skipped when it is not set
+const postgresURLEnv = "TEST_POSTGRES_URL"
+
+// check is a check of the repository contracts, run against every backend
+type check struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, repos *repository.Repositories)
+}
+
+var checks = []check{
+	{"users", checkUsers},
+	{"rooms", checkRooms},
+	{"members", checkMembers},
+	{"messages", checkMessages},
+	{"reactions", checkReactions},
+	{"webhooks", checkWebhooks},
+	{"bots", checkBots},
+	{"commands", checkCommands},
+	{"sanctions", checkSanctions},
+	{"filters", checkFilters},
+	{"flagged messages", checkFlagged},
+	{"reports", checkReports},
+	{"audit", checkAudit},
+}
+
+// TestRepositories checks that every storage backend implements the repository contracts, so that they all behave
+// the same behind the services
+func TestRepositories(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) *repository.Repositories
+	}{
+		{config.DriverMemory, func(t *testing.T) *repository.Repositories { return repository.NewMemoryRepositories() }},
+		{config.DriverSQLite, openSQLite},
+		{config.DriverPostgres, openPostgres},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			repos := backend.open(t)
+			for _, check := range checks {
+				t.Run(check.name, func(t *testing.T) {
+					check.run(t, t.Context(), repos)
+				})
+			}
+		})
+	}
+}
+
+// openSQLite creates the sqlite repositories over a migrated database in a temporary file
+func openSQLite(t *testing.T) *repository.Repositories {
+	db, err := sql.Open("sqlite", database.SQLiteConnString(&config.Config{DbPath: filepath.Join(t.TempDir(), "chat.db")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// like the server, statements share a single connection
+	db.SetMaxOpenConns(1)
+	migrate(t, db, config.DriverSQLite)
+	return repository.NewSQLiteRepositories(db)
+}
+
+// openPostgres creates the postgres repositories over a migrated schema of their own, dropped once the test is done
+func openPostgres(t *testing.T) *repository.Repositories {
+	dbURL := os.Getenv(postgresURLEnv)
+	if dbURL == "" {
+		t.Skipf("%s is not set", postgresURLEnv)
+	}
+	admin, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "repotest_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// objects are created in the test schema, while extensions already installed in public stay visible
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema+",public")
+	u.RawQuery = query.Encode()
+	db, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closed before the schema is dropped, since cleanups run last in first out
+	t.Cleanup(func() { db.Close() })
+	migrate(t, db, config.DriverPostgres)
+	return repository.NewPGRepositories(db)
+}
+
+// migrate applies all migrations of the driver to the database
+func migrate(t *testing.T, db *sql.DB, driver string) {
+	t.Helper()
+	migrator, err := database.NewMigrator(&database.DB{DB: db, Driver: driver})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context(), 0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+}
+
+func checkUsers(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	user, err := repos.Users.Create(ctx, prefix+"_alice", model.UserKindHuman)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if user.ID == uuid.Nil || user.Username != prefix+"_alice" || user.Kind != model.UserKindHuman || user.CreatedAt.IsZero() {
+		t.Fatalf("create returned %+v", user)
+	}
+	if _, err := repos.Users.Create(ctx, prefix+"_alice", model.UserKindBot); !errors.Is(err, repository.ErrAlreadyExist) {
+		t.Errorf("create with a taken username returned %v, want ErrAlreadyExist", err)
+	}
+
+	got, err := repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	sameUser(t, got, user)
+	if got, err = repos.Users.GetByUsername(ctx, user.Username); err != nil {
+		t.Fatalf("get by username: %v", err)
+	}
+	sameUser(t, got, user)
+	if _, err := repos.Users.GetByID(ctx, uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by unknown id returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Users.GetByUsername(ctx, prefix+"_nobody"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by unknown username returned %v, want ErrNotFound", err)
+	}
+
+	bot, err := repos.Users.Create(ctx, prefix+"_bot", model.UserKindBot)
+	if err != nil {
+		t.Fatalf("create bot: %v", err)
+	}
+	if !bot.IsBot() {
+		t.Errorf("bot created with kind %q", bot.Kind)
+	}
+
+	users, err := repos.Users.Search(ctx, prefix, 10, 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if ids := userIDs(users); !slices.Contains(ids, user.ID) || !slices.Contains(ids, bot.ID) {
+		t.Errorf("search for %q returned %d users, missing the created ones", prefix, len(users))
+	}
+	if users, err = repos.Users.Search(ctx, prefix, 1, 1); err != nil {
+		t.Fatalf("search page: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("search with limit 1 and offset 1 returned %d users, want 1", len(users))
+	}
+}
+
+func checkRooms(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	creator := createUser(t, ctx, repos, prefix)
+	if _, err := repos.Rooms.Create(ctx, &model.Room{Name: prefix + "_orphan", CreatorID: uuid.New()}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create with an unknown creator returned %v, want ErrNotFound", err)
+	}
+
+	first, err := repos.Rooms.Create(ctx, &model.Room{Name: prefix + "_first", CreatorID: creator.ID})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if first.ID == uuid.Nil || first.Name != prefix+"_first" || first.CreatorID != creator.ID || first.Topic != "" || first.SlowModeSeconds != 0 {
+		t.Fatalf("create returned %+v", first)
+	}
+	second, err := repos.Rooms.Create(ctx, &model.Room{Name: prefix + "_second", CreatorID: creator.ID})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := repos.Rooms.GetByID(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	if got.ID != first.ID || got.Name != first.Name || !got.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("get by id returned %+v, want %+v", got, first)
+	}
+	if _, err := repos.Rooms.GetByID(ctx, uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by unknown id returned %v, want ErrNotFound", err)
+	}
+
+	// rooms created by other checks may come first
+	rooms, err := repos.Rooms.GetAll(ctx, 50, 0)
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+	ids := roomIDs(rooms)
+	if i, j := slices.Index(ids, second.ID), slices.Index(ids, first.ID); i < 0 || j < 0 || i > j {
+		t.Errorf("get all did not return the created rooms newest first")
+	}
+
+	if err := repos.Rooms.UpdateTopic(ctx, first.ID, "news"); err != nil {
+		t.Fatalf("update topic: %v", err)
+	}
+	if err := repos.Rooms.UpdateSlowMode(ctx, first.ID, 30); err != nil {
+		t.Fatalf("update slow mode: %v", err)
+	}
+	if got, err = repos.Rooms.GetByID(ctx, first.ID); err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	if got.Topic != "news" || got.SlowModeSeconds != 30 {
+		t.Errorf("room has topic %q and slow mode %d after updating them", got.Topic, got.SlowModeSeconds)
+	}
+	if err := repos.Rooms.UpdateTopic(ctx, uuid.New(), "news"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update topic of an unknown room returned %v, want ErrNotFound", err)
+	}
+	if err := repos.Rooms.UpdateSlowMode(ctx, uuid.New(), 30); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update slow mode of an unknown room returned %v, want ErrNotFound", err)
+	}
+
+	// similar names of other rooms may match as well
+	summaries, err := repos.Rooms.Search(ctx, &model.SearchRoomsReq{Query: prefix, Sort: model.RoomSortCreated}, 50, 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	found := findRooms(summaries, first.ID, second.ID)
+	if len(found) != 2 || found[0].ID != second.ID || found[1].ID != first.ID {
+		t.Fatalf("search for %q did not return the created rooms newest first", prefix)
+	}
+	if found[0].MemberCount != 0 || found[0].LastMessageAt != nil {
+		t.Errorf("search returned %d members and last message at %v for an empty room", found[0].MemberCount, found[0].LastMessageAt)
+	}
+}
+
+func checkMembers(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	admin := createUser(t, ctx, repos, prefix+"_admin")
+	user := createUser(t, ctx, repos, prefix+"_user")
+	room := createRoom(t, ctx, repos, prefix, admin.ID)
+
+	if _, err := repos.Rooms.AddMember(ctx, room.ID, admin.ID, string(model.AdminRole)); err != nil {
+		t.Fatalf("add admin: %v", err)
+	}
+	member, err := repos.Rooms.AddMember(ctx, room.ID, user.ID, string(model.Member))
+	if err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+	if member.RoomID != room.ID || member.UserID != user.ID || member.Role != string(model.Member) {
+		t.Errorf("add member returned %+v", member)
+	}
+	if _, err := repos.Rooms.AddMember(ctx, room.ID, user.ID, string(model.Member)); !errors.Is(err, repository.ErrAlreadyExist) {
+		t.Errorf("adding a member twice returned %v, want ErrAlreadyExist", err)
+	}
+	if _, err := repos.Rooms.AddMember(ctx, uuid.New(), user.ID, string(model.Member)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("adding a member to an unknown room returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Rooms.AddMember(ctx, room.ID, uuid.New(), string(model.Member)); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("adding an unknown user returned %v, want ErrNotFound", err)
+	}
+
+	got, err := repos.Rooms.GetMember(ctx, room.ID, user.ID)
+	if err != nil {
+		t.Fatalf("get member: %v", err)
+	}
+	if got.ID != member.ID || got.Role != member.Role {
+		t.Errorf("get member returned %+v, want %+v", got, member)
+	}
+	members, err := repos.Rooms.GetAllMembers(ctx, room.ID.String(), 10, 0)
+	if err != nil {
+		t.Fatalf("get all members: %v", err)
+	}
+	if len(members) != 2 || members[0].UserID != user.ID || members[1].UserID != admin.ID {
+		t.Errorf("get all members returned %d members, want the member then the admin", len(members))
+	}
+	adminIDs, err := repos.Rooms.GetAdminIDs(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("get admin ids: %v", err)
+	}
+	if len(adminIDs) != 1 || adminIDs[0] != admin.ID {
+		t.Errorf("get admin ids returned %v, want %v", adminIDs, []uuid.UUID{admin.ID})
+	}
+	rooms, err := repos.Rooms.GetAllByUserID(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("get all by user id: %v", err)
+	}
+	if len(rooms) != 1 || rooms[0].ID != room.ID {
+		t.Errorf("get all by user id returned %v, want %v", roomIDs(rooms), []uuid.UUID{room.ID})
+	}
+
+	if err := repos.Rooms.RemoveMember(ctx, room.ID, user.ID); err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	if err := repos.Rooms.RemoveMember(ctx, room.ID, user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("removing a member twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Rooms.GetMember(ctx, room.ID, user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get removed member returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkMessages(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	sender := createUser(t, ctx, repos, prefix)
+	room := createRoom(t, ctx, repos, prefix, sender.ID)
+
+	// messages created back to back must keep their order even when their timestamps tie
+	var created []*model.Message
+	for i := range 3 {
+		created = append(created, createMessage(t, ctx, repos, room.ID, sender, fmt.Sprintf("message %d", i)))
+	}
+	if first := created[0]; first.ID == uuid.Nil || first.RoomID != room.ID || first.SenderID != sender.ID || first.Content != "message 0" || first.CreatedAt.IsZero() {
+		t.Fatalf("create returned %+v", first)
+	}
+
+	// batches carry their own ids and timestamps, which must survive the round trip
+	now := time.Now().Add(time.Second).Truncate(time.Microsecond)
+	batch := []*model.Message{
+		{ID: uuid.New(), RoomID: room.ID, SenderID: sender.ID, SenderUsername: sender.Username, Content: "batch 0", CreatedAt: now, UpdatedAt: now},
+		{ID: uuid.New(), RoomID: room.ID, SenderUsername: "system", Content: "batch 1", CreatedAt: now.Add(time.Millisecond), UpdatedAt: now.Add(time.Millisecond)},
+	}
+	stored, err := repos.Messages.CreateBatch(ctx, batch)
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if len(stored) != len(batch) {
+		t.Fatalf("create batch returned %d messages, want %d", len(stored), len(batch))
+	}
+	for i, message := range stored {
+		sameMessage(t, message, batch[i])
+	}
+	created = append(created, stored...)
+
+	got, err := repos.Messages.GetByID(ctx, batch[1].ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	sameMessage(t, got, batch[1])
+	if _, err := repos.Messages.GetByID(ctx, uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by unknown id returned %v, want ErrNotFound", err)
+	}
+
+	messages, err := repos.Messages.GetByRoomID(ctx, room.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	newestFirst(t, "get by room id", messages, created)
+	if messages, err = repos.Messages.GetByRoomID(ctx, room.ID, 2, 1); err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	newestFirst(t, "get by room id with limit 2 and offset 1", messages, created[2:4])
+
+	if messages, err = repos.Messages.GetByRoomIDAfter(ctx, room.ID, created[0].ID, 10); err != nil {
+		t.Fatalf("get by room id after: %v", err)
+	}
+	newestFirst(t, "get by room id after the first message", messages, created[1:])
+	if messages, err = repos.Messages.GetByRoomIDAfter(ctx, room.ID, created[0].ID, 2); err != nil {
+		t.Fatalf("get by room id after: %v", err)
+	}
+	newestFirst(t, "get by room id after the first message with limit 2", messages, created[3:])
+	if _, err := repos.Messages.GetByRoomIDAfter(ctx, room.ID, uuid.New(), 10); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by room id after an unknown message returned %v, want ErrNotFound", err)
+	}
+
+	summaries, err := repos.Rooms.Search(ctx, &model.SearchRoomsReq{Query: prefix, Sort: model.RoomSortActivity}, 50, 0)
+	if err != nil {
+		t.Fatalf("search rooms: %v", err)
+	}
+	if found := findRooms(summaries, room.ID); len(found) != 1 || found[0].LastMessageAt == nil || !found[0].LastMessageAt.Equal(batch[1].CreatedAt) {
+		t.Errorf("search rooms did not report the last message at %v", batch[1].CreatedAt)
+	}
+
+	if err := repos.Messages.Delete(ctx, created[0].ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repos.Messages.Delete(ctx, created[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting a message twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Messages.GetByID(ctx, created[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted message returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkReactions(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	user := createUser(t, ctx, repos, prefix)
+	room := createRoom(t, ctx, repos, prefix, user.ID)
+	other := createRoom(t, ctx, repos, prefix+"_other", user.ID)
+	message := createMessage(t, ctx, repos, room.ID, user, "hello")
+
+	thumbs, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: message.ID, RoomID: room.ID, UserID: user.ID, Emoji: "👍"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if thumbs.MessageID != message.ID || thumbs.UserID != user.ID || thumbs.Emoji != "👍" || thumbs.CreatedAt.IsZero() {
+		t.Errorf("create returned %+v", thumbs)
+	}
+	again, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: message.ID, RoomID: room.ID, UserID: user.ID, Emoji: "👍"})
+	if err != nil {
+		t.Fatalf("create again: %v", err)
+	}
+	if !again.CreatedAt.Equal(thumbs.CreatedAt) {
+		t.Errorf("reacting again with the same emoji created a reaction at %v, want the existing one at %v", again.CreatedAt, thumbs.CreatedAt)
+	}
+	if _, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: message.ID, RoomID: room.ID, UserID: user.ID, Emoji: "🎉"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: message.ID, RoomID: other.ID, UserID: user.ID, Emoji: "👍"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("reacting to a message of another room returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: uuid.New(), RoomID: room.ID, UserID: user.ID, Emoji: "👍"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("reacting to an unknown message returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Reactions.Create(ctx, &model.Reaction{MessageID: message.ID, RoomID: room.ID, UserID: uuid.New(), Emoji: "👍"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("reacting as an unknown user returned %v, want ErrNotFound", err)
+	}
+
+	reactions, err := repos.Reactions.GetByMessageID(ctx, room.ID, message.ID)
+	if err != nil {
+		t.Fatalf("get by message id: %v", err)
+	}
+	if len(reactions) != 2 || reactions[0].Emoji != "👍" || reactions[1].Emoji != "🎉" {
+		t.Fatalf("get by message id returned %d reactions, want 👍 then 🎉", len(reactions))
+	}
+	if reactions[0].Username != user.Username || reactions[0].RoomID != room.ID {
+		t.Errorf("get by message id returned %+v", reactions[0])
+	}
+	if reactions, err = repos.Reactions.GetByMessageID(ctx, other.ID, message.ID); err != nil || len(reactions) != 0 {
+		t.Errorf("get by message id in another room returned %d reactions and %v, want none", len(reactions), err)
+	}
+}
+
+func checkWebhooks(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	user := createUser(t, ctx, repos, prefix)
+	room := createRoom(t, ctx, repos, prefix, user.ID)
+	other := createRoom(t, ctx, repos, prefix+"_other", user.ID)
+
+	incoming, err := repos.Webhooks.CreateIncoming(ctx, &model.IncomingWebhook{RoomID: room.ID, Name: "deploys", TokenHash: []byte(prefix + "_token")})
+	if err != nil {
+		t.Fatalf("create incoming: %v", err)
+	}
+	if incoming.ID == uuid.Nil || incoming.RoomID != room.ID || incoming.Name != "deploys" || !bytes.Equal(incoming.TokenHash, []byte(prefix+"_token")) {
+		t.Errorf("create incoming returned %+v", incoming)
+	}
+	if _, err := repos.Webhooks.CreateIncoming(ctx, &model.IncomingWebhook{RoomID: uuid.New(), Name: "deploys", TokenHash: []byte(uniqueName())}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create incoming in an unknown room returned %v, want ErrNotFound", err)
+	}
+	got, err := repos.Webhooks.GetIncomingByID(ctx, incoming.ID)
+	if err != nil {
+		t.Fatalf("get incoming by id: %v", err)
+	}
+	if got.RoomID != room.ID || !bytes.Equal(got.TokenHash, incoming.TokenHash) {
+		t.Errorf("get incoming by id returned %+v, want %+v", got, incoming)
+	}
+	if _, err := repos.Webhooks.GetIncomingByID(ctx, uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get incoming by unknown id returned %v, want ErrNotFound", err)
+	}
+	hooks, err := repos.Webhooks.GetIncomingByRoomID(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("get incoming by room id: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].ID != incoming.ID || len(hooks[0].TokenHash) != 0 {
+		t.Errorf("get incoming by room id returned %d webhooks, want the created one without its token digest", len(hooks))
+	}
+
+	outgoing, err := repos.Webhooks.CreateOutgoing(ctx, &model.OutgoingWebhook{RoomID: room.ID, URL: "https://example.com/hook", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("create outgoing: %v", err)
+	}
+	if outgoing.ID == uuid.Nil || outgoing.RoomID != room.ID || outgoing.URL != "https://example.com/hook" || outgoing.Secret != "secret" {
+		t.Errorf("create outgoing returned %+v", outgoing)
+	}
+	if _, err := repos.Webhooks.CreateOutgoing(ctx, &model.OutgoingWebhook{RoomID: uuid.New(), URL: "https://example.com/hook", Secret: "secret"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create outgoing in an unknown room returned %v, want ErrNotFound", err)
+	}
+	outgoingHooks, err := repos.Webhooks.GetOutgoingByRoomID(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("get outgoing by room id: %v", err)
+	}
+	if len(outgoingHooks) != 1 || outgoingHooks[0].ID != outgoing.ID || outgoingHooks[0].Secret != "secret" {
+		t.Errorf("get outgoing by room id returned %d webhooks, want the created one with its secret", len(outgoingHooks))
+	}
+	if _, err := repos.Webhooks.GetOutgoingByID(ctx, room.ID, outgoing.ID); err != nil {
+		t.Errorf("get outgoing by id: %v", err)
+	}
+	if _, err := repos.Webhooks.GetOutgoingByID(ctx, other.ID, outgoing.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get outgoing by id in another room returned %v, want ErrNotFound", err)
+	}
+
+	// deleting an outgoing webhook deletes the commands it handles
+	if _, err := repos.Commands.Create(ctx, &model.RoomCommand{RoomID: room.ID, Name: "notify", WebhookID: &outgoing.ID}); err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+	if err := repos.Webhooks.DeleteOutgoing(ctx, other.ID, outgoing.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("delete outgoing in another room returned %v, want ErrNotFound", err)
+	}
+	if err := repos.Webhooks.DeleteOutgoing(ctx, room.ID, outgoing.ID); err != nil {
+		t.Fatalf("delete outgoing: %v", err)
+	}
+	if err := repos.Webhooks.DeleteOutgoing(ctx, room.ID, outgoing.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting an outgoing webhook twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Commands.GetByName(ctx, room.ID, "notify"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get command of a deleted webhook returned %v, want ErrNotFound", err)
+	}
+
+	if err := repos.Webhooks.DeleteIncoming(ctx, other.ID, incoming.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("delete incoming in another room returned %v, want ErrNotFound", err)
+	}
+	if err := repos.Webhooks.DeleteIncoming(ctx, room.ID, incoming.ID); err != nil {
+		t.Fatalf("delete incoming: %v", err)
+	}
+	if err := repos.Webhooks.DeleteIncoming(ctx, room.ID, incoming.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting an incoming webhook twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Webhooks.GetIncomingByID(ctx, incoming.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted incoming webhook returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkBots(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	owner := createUser(t, ctx, repos, prefix)
+	bot, err := repos.Users.Create(ctx, prefix+"_bot", model.UserKindBot)
+	if err != nil {
+		t.Fatalf("create bot: %v", err)
+	}
+	first := createRoom(t, ctx, repos, prefix+"_first", owner.ID)
+	second := createRoom(t, ctx, repos, prefix+"_second", owner.ID)
+	hash := []byte(prefix + "_key")
+
+	key, err := repos.Bots.CreateKey(ctx, &model.APIKey{BotID: bot.ID, RoomIDs: []uuid.UUID{first.ID, second.ID}, KeyHash: hash})
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if key.ID == uuid.Nil || key.BotID != bot.ID || !sameIDs(key.RoomIDs, first.ID, second.ID) {
+		t.Errorf("create key returned %+v", key)
+	}
+	if _, err := repos.Bots.CreateKey(ctx, &model.APIKey{BotID: bot.ID, RoomIDs: []uuid.UUID{first.ID}, KeyHash: hash}); !errors.Is(err, repository.ErrAlreadyExist) {
+		t.Errorf("create key with a taken digest returned %v, want ErrAlreadyExist", err)
+	}
+	if _, err := repos.Bots.CreateKey(ctx, &model.APIKey{BotID: bot.ID, RoomIDs: []uuid.UUID{first.ID, uuid.New()}, KeyHash: []byte(uniqueName())}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create key scoped to an unknown room returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Bots.CreateKey(ctx, &model.APIKey{BotID: uuid.New(), RoomIDs: []uuid.UUID{first.ID}, KeyHash: []byte(uniqueName())}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create key of an unknown bot returned %v, want ErrNotFound", err)
+	}
+
+	got, err := repos.Bots.GetKeyByHash(ctx, hash)
+	if err != nil {
+		t.Fatalf("get key by hash: %v", err)
+	}
+	if got.ID != key.ID || got.Bot == nil || got.Bot.ID != bot.ID || !got.Bot.IsBot() || !sameIDs(got.RoomIDs, first.ID, second.ID) {
+		t.Errorf("get key by hash returned %+v", got)
+	}
+	if _, err := repos.Bots.GetKeyByHash(ctx, []byte(uniqueName())); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get key by unknown hash returned %v, want ErrNotFound", err)
+	}
+	keys, err := repos.Bots.GetKeysByBotID(ctx, bot.ID)
+	if err != nil {
+		t.Fatalf("get keys by bot id: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || len(keys[0].KeyHash) != 0 || !sameIDs(keys[0].RoomIDs, first.ID, second.ID) {
+		t.Errorf("get keys by bot id returned %d keys, want the created one without its digest", len(keys))
+	}
+
+	if err := repos.Bots.DeleteKey(ctx, owner.ID, key.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("delete key of another bot returned %v, want ErrNotFound", err)
+	}
+	if err := repos.Bots.DeleteKey(ctx, bot.ID, key.ID); err != nil {
+		t.Fatalf("delete key: %v", err)
+	}
+	if err := repos.Bots.DeleteKey(ctx, bot.ID, key.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting a key twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Bots.GetKeyByHash(ctx, hash); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted key returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkCommands(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	owner := createUser(t, ctx, repos, prefix)
+	bot, err := repos.Users.Create(ctx, prefix+"_bot", model.UserKindBot)
+	if err != nil {
+		t.Fatalf("create bot: %v", err)
+	}
+	room := createRoom(t, ctx, repos, prefix, owner.ID)
+	hook, err := repos.Webhooks.CreateOutgoing(ctx, &model.OutgoingWebhook{RoomID: room.ID, URL: "https://example.com/hook", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	deploy, err := repos.Commands.Create(ctx, &model.RoomCommand{RoomID: room.ID, Name: "deploy", Description: "Deploy a service", BotID: &bot.ID})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if deploy.ID == uuid.Nil || deploy.Name != "deploy" || deploy.Description != "Deploy a service" || deploy.BotID == nil || *deploy.BotID != bot.ID || deploy.WebhookID != nil {
+		t.Errorf("create returned %+v", deploy)
+	}
+	if _, err := repos.Commands.Create(ctx, &model.RoomCommand{RoomID: room.ID, Name: "alert", WebhookID: &hook.ID}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := repos.Commands.Create(ctx, &model.RoomCommand{RoomID: room.ID, Name: "deploy", BotID: &bot.ID}); !errors.Is(err, repository.ErrAlreadyExist) {
+		t.Errorf("create with a taken name returned %v, want ErrAlreadyExist", err)
+	}
+	unknown := uuid.New()
+	for name, command := range map[string]*model.RoomCommand{
+		"room":    {RoomID: uuid.New(), Name: "other", BotID: &bot.ID},
+		"bot":     {RoomID: room.ID, Name: "other", BotID: &unknown},
+		"webhook": {RoomID: room.ID, Name: "other", WebhookID: &unknown},
+	} {
+		if _, err := repos.Commands.Create(ctx, command); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("create with an unknown %s returned %v, want ErrNotFound", name, err)
+		}
+	}
+
+	alert, err := repos.Commands.GetByName(ctx, room.ID, "alert")
+	if err != nil {
+		t.Fatalf("get by name: %v", err)
+	}
+	if alert.WebhookID == nil || *alert.WebhookID != hook.ID || alert.Webhook == nil || alert.Webhook.URL != hook.URL || alert.Webhook.Secret != hook.Secret {
+		t.Errorf("get by name returned %+v without its webhook", alert)
+	}
+	if _, err := repos.Commands.GetByName(ctx, room.ID, "unknown"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by unknown name returned %v, want ErrNotFound", err)
+	}
+	commands, err := repos.Commands.GetByRoomID(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if len(commands) != 2 || commands[0].Name != "alert" || commands[1].Name != "deploy" {
+		t.Errorf("get by room id returned %d commands, want alert then deploy", len(commands))
+	}
+
+	if err := repos.Commands.Delete(ctx, deploy.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := repos.Commands.Delete(ctx, deploy.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting a command twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Commands.GetByName(ctx, room.ID, "deploy"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted command returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkSanctions(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	admin := createUser(t, ctx, repos, prefix+"_admin")
+	user := createUser(t, ctx, repos, prefix+"_user")
+	room := createRoom(t, ctx, repos, prefix, admin.ID)
+	silences := []model.SanctionKind{model.SanctionMute, model.SanctionTimeout}
+
+	mute, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: room.ID, UserID: user.ID, Kind: model.SanctionMute, Reason: "spam", IssuedBy: &admin.ID}, silences)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if mute.ID == uuid.Nil || mute.Kind != model.SanctionMute || mute.Reason != "spam" || mute.IssuedBy == nil || *mute.IssuedBy != admin.ID || mute.ExpiresAt != nil || mute.RevokedAt != nil {
+		t.Errorf("create returned %+v", mute)
+	}
+	if _, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: uuid.New(), UserID: user.ID, Kind: model.SanctionBan}, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create in an unknown room returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: room.ID, UserID: uuid.New(), Kind: model.SanctionBan}, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("create for an unknown user returned %v, want ErrNotFound", err)
+	}
+
+	// a timeout replaces the mute
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+	timeout, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: room.ID, UserID: user.ID, Kind: model.SanctionTimeout, IssuedBy: &admin.ID, ExpiresAt: &expiresAt}, silences)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if timeout.ExpiresAt == nil || !timeout.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("create returned a sanction expiring at %v, want %v", timeout.ExpiresAt, expiresAt)
+	}
+	active, err := repos.Sanctions.GetActiveByUserID(ctx, room.ID, user.ID)
+	if err != nil {
+		t.Fatalf("get active by user id: %v", err)
+	}
+	if ids := sanctionIDs(active); !slices.Equal(ids, []uuid.UUID{timeout.ID}) {
+		t.Errorf("get active by user id returned %v, want the timeout %v replacing the mute", ids, timeout.ID)
+	}
+
+	// expired sanctions are kept but no longer in effect
+	expired := time.Now().Add(-time.Minute).UTC().Truncate(time.Microsecond)
+	ban, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: room.ID, UserID: user.ID, Kind: model.SanctionBan, IssuedBy: &admin.ID, ExpiresAt: &expired}, []model.SanctionKind{model.SanctionBan})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	all, err := repos.Sanctions.GetByRoomID(ctx, room.ID, false, 10, 0)
+	if err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if ids := sanctionIDs(all); !slices.Equal(ids, []uuid.UUID{ban.ID, timeout.ID, mute.ID}) {
+		t.Fatalf("get by room id returned %v, want %v newest first", ids, []uuid.UUID{ban.ID, timeout.ID, mute.ID})
+	}
+	if replaced := all[2]; replaced.RevokedAt == nil || replaced.RevokedBy == nil || *replaced.RevokedBy != admin.ID {
+		t.Errorf("replaced mute was not revoked by the issuer of the timeout: %+v", replaced)
+	}
+	if active, err = repos.Sanctions.GetByRoomID(ctx, room.ID, true, 10, 0); err != nil {
+		t.Fatalf("get active by room id: %v", err)
+	}
+	if ids := sanctionIDs(active); !slices.Equal(ids, []uuid.UUID{timeout.ID}) {
+		t.Errorf("get active by room id returned %v, want %v", ids, []uuid.UUID{timeout.ID})
+	}
+	if all, err = repos.Sanctions.GetByRoomID(ctx, room.ID, false, 1, 1); err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if ids := sanctionIDs(all); !slices.Equal(ids, []uuid.UUID{timeout.ID}) {
+		t.Errorf("get by room id with limit 1 and offset 1 returned %v, want %v", ids, []uuid.UUID{timeout.ID})
+	}
+
+	revoked, err := repos.Sanctions.Revoke(ctx, room.ID, timeout.ID, admin.ID)
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if revoked.ID != timeout.ID || revoked.RevokedAt == nil || revoked.RevokedBy == nil || *revoked.RevokedBy != admin.ID {
+		t.Errorf("revoke returned %+v", revoked)
+	}
+	if _, err := repos.Sanctions.Revoke(ctx, room.ID, timeout.ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("revoking a sanction twice returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Sanctions.Revoke(ctx, uuid.New(), mute.ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("revoking a sanction of another room returned %v, want ErrNotFound", err)
+	}
+
+	if _, err := repos.Sanctions.Create(ctx, &model.Sanction{RoomID: room.ID, UserID: user.ID, Kind: model.SanctionBan, IssuedBy: &admin.ID}, nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lifted, err := repos.Sanctions.RevokeActive(ctx, room.ID, user.ID, []model.SanctionKind{model.SanctionBan}, admin.ID)
+	if err != nil {
+		t.Fatalf("revoke active: %v", err)
+	}
+	if len(lifted) != 1 || lifted[0].Kind != model.SanctionBan || lifted[0].RevokedAt == nil {
+		t.Errorf("revoke active returned %d sanctions, want the active ban", len(lifted))
+	}
+	if lifted, err = repos.Sanctions.RevokeActive(ctx, room.ID, user.ID, []model.SanctionKind{model.SanctionBan}, admin.ID); err != nil || len(lifted) != 0 {
+		t.Errorf("revoke active without active sanctions returned %d sanctions and %v, want none", len(lifted), err)
+	}
+	if active, err = repos.Sanctions.GetActiveByUserID(ctx, room.ID, user.ID); err != nil || len(active) != 0 {
+		t.Errorf("get active by user id returned %d sanctions and %v after lifting them all, want none", len(active), err)
+	}
+}
+
+func checkFilters(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	admin := createUser(t, ctx, repos, prefix)
+	room := createRoom(t, ctx, repos, prefix, admin.ID)
+
+	if _, err := repos.Filters.GetByRoomID(ctx, room.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by room id without settings returned %v, want ErrNotFound", err)
+	}
+	settings := &model.RoomFilter{
+		RoomID:         room.ID,
+		BlockedWords:   []string{"spam", "scam"},
+		WordAction:     model.FilterMask,
+		AllowedDomains: []string{"example.com"},
+		LinkAction:     model.FilterFlag,
+		SpamAction:     model.FilterReject,
+		UpdatedBy:      &admin.ID,
+	}
+	if _, err := repos.Filters.Upsert(ctx, settings); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	got, err := repos.Filters.GetByRoomID(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if !slices.Equal(got.BlockedWords, settings.BlockedWords) || got.WordAction != model.FilterMask || !slices.Equal(got.AllowedDomains, settings.AllowedDomains) ||
+		got.LinkAction != model.FilterFlag || got.SpamAction != model.FilterReject || got.UpdatedBy == nil || *got.UpdatedBy != admin.ID || got.UpdatedAt.IsZero() {
+		t.Errorf("get by room id returned %+v, want %+v", got, settings)
+	}
+
+	// the settings are replaced as a whole
+	if _, err := repos.Filters.Upsert(ctx, &model.RoomFilter{RoomID: room.ID, WordAction: model.FilterReject, LinkAction: model.FilterAllow, SpamAction: model.FilterAllow}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if got, err = repos.Filters.GetByRoomID(ctx, room.ID); err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if got.BlockedWords == nil || len(got.BlockedWords) != 0 || got.AllowedDomains == nil || len(got.AllowedDomains) != 0 || got.WordAction != model.FilterReject || got.UpdatedBy != nil {
+		t.Errorf("get by room id returned %+v after replacing the settings", got)
+	}
+	if _, err := repos.Filters.Upsert(ctx, &model.RoomFilter{RoomID: uuid.New(), WordAction: model.FilterMask, LinkAction: model.FilterAllow, SpamAction: model.FilterAllow}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("upsert for an unknown room returned %v, want ErrNotFound", err)
+	}
+}
+
+func checkFlagged(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	admin := createUser(t, ctx, repos, prefix+"_admin")
+	sender := createUser(t, ctx, repos, prefix+"_sender")
+	room := createRoom(t, ctx, repos, prefix, admin.ID)
+	other := createRoom(t, ctx, repos, prefix+"_other", admin.ID)
+
+	var flagged []*model.FlaggedMessage
+	for i := range 3 {
+		message, err := repos.Filters.CreateFlagged(ctx, &model.FlaggedMessage{
+			RoomID:         room.ID,
+			SenderID:       sender.ID,
+			SenderUsername: sender.Username,
+			Content:        fmt.Sprintf("flagged %d", i),
+			Reasons:        []string{"blocked word", "link"},
+		})
+		if err != nil {
+			t.Fatalf("create flagged: %v", err)
+		}
+		flagged = append(flagged, message)
+	}
+	if first := flagged[0]; first.ID == uuid.Nil || first.Status != model.FlaggedPending || !slices.Equal(first.Reasons, []string{"blocked word", "link"}) || first.ReviewedBy != nil || first.MessageID != nil {
+		t.Errorf("create flagged returned %+v", first)
+	}
+	pending, err := repos.Filters.GetFlaggedByRoomID(ctx, room.ID, model.FlaggedPending, 10, 0)
+	if err != nil {
+		t.Fatalf("get flagged by room id: %v", err)
+	}
+	if ids := flaggedIDs(pending); !slices.Equal(ids, flaggedIDs(flagged)) {
+		t.Errorf("get flagged by room id returned %v, want %v oldest first", ids, flaggedIDs(flagged))
+	}
+
+	rejected, err := repos.Filters.Reject(ctx, room.ID, flagged[0].ID, admin.ID)
+	if err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if rejected.Status != model.FlaggedRejected || rejected.ReviewedBy == nil || *rejected.ReviewedBy != admin.ID || rejected.ReviewedAt == nil {
+		t.Errorf("reject returned %+v", rejected)
+	}
+	if _, err := repos.Filters.Reject(ctx, room.ID, flagged[0].ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("rejecting a reviewed message returned %v, want ErrNotFound", err)
+	}
+
+	approved, message, err := repos.Filters.Approve(ctx, room.ID, flagged[1].ID, admin.ID)
+	if err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if approved.Status != model.FlaggedApproved || approved.MessageID == nil || *approved.MessageID != message.ID {
+		t.Errorf("approve returned %+v for message %s", approved, message.ID)
+	}
+	if message.RoomID != room.ID || message.SenderID != sender.ID || message.Content != "flagged 1" {
+		t.Errorf("approve sent %+v", message)
+	}
+	if _, err := repos.Messages.GetByID(ctx, message.ID); err != nil {
+		t.Errorf("get approved message: %v", err)
+	}
+	if _, _, err := repos.Filters.Approve(ctx, room.ID, flagged[1].ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("approving a reviewed message returned %v, want ErrNotFound", err)
+	}
+	if _, _, err := repos.Filters.Approve(ctx, other.ID, flagged[2].ID, admin.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("approving a message of another room returned %v, want ErrNotFound", err)
+	}
+
+	for status, want := range map[model.FlaggedStatus][]uuid.UUID{
+		model.FlaggedPending:  {flagged[2].ID},
+		model.FlaggedApproved: {flagged[1].ID},
+		model.FlaggedRejected: {flagged[0].ID},
+		"":                    flaggedIDs(flagged),
+	} {
+		messages, err := repos.Filters.GetFlaggedByRoomID(ctx, room.ID, status, 10, 0)
+		if err != nil {
+			t.Fatalf("get flagged by room id: %v", err)
+		}
+		if ids := flaggedIDs(messages); !slices.Equal(ids, want) {
+			t.Errorf("get flagged by room id in status %q returned %v, want %v", status, ids, want)
+		}
+	}
+	page, err := repos.Filters.GetFlaggedByRoomID(ctx, room.ID, "", 1, 1)
+	if err != nil {
+		t.Fatalf("get flagged by room id: %v", err)
+	}
+	if ids := flaggedIDs(page); !slices.Equal(ids, []uuid.UUID{flagged[1].ID}) {
+		t.Errorf("get flagged by room id with limit 1 and offset 1 returned %v, want %v", ids, []uuid.UUID{flagged[1].ID})
+	}
+}
+
+func checkReports(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	admin := createUser(t, ctx, repos, prefix+"_admin")
+	sender := createUser(t, ctx, repos, prefix+"_sender")
+	reporters := []*model.User{createUser(t, ctx, repos, prefix+"_first"), createUser(t, ctx, repos, prefix+"_second")}
+	room := createRoom(t, ctx, repos, prefix, admin.ID)
+	abusive := createMessage(t, ctx, repos, room.ID, sender, "abusive")
+	rude := createMessage(t, ctx, repos, room.ID, sender, "rude")
+
+	report := func(message *model.Message, reporter *model.User) (*model.Report, error) {
+		return repos.Reports.Create(ctx, &model.Report{
+			RoomID:         room.ID,
+			MessageID:      &message.ID,
+			SenderID:       sender.ID,
+			SenderUsername: sender.Username,
+			Content:        message.Content,
+			ReporterID:     reporter.ID,
+			Category:       model.ReportHarassment,
+			Details:        "details",
+		})
+	}
+	var reports []*model.Report
+	for _, args := range []struct {
+		message  *model.Message
+		reporter *model.User
+	}{{abusive, reporters[0]}, {abusive, reporters[1]}, {rude, reporters[0]}} {
+		created, err := report(args.message, args.reporter)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		reports = append(reports, created)
+	}
+	if first := reports[0]; first.ID == uuid.Nil || first.Status != model.ReportOpen || first.MessageID == nil || *first.MessageID != abusive.ID ||
+		first.Content != "abusive" || first.Category != model.ReportHarassment || first.ResolvedAt != nil {
+		t.Errorf("create returned %+v", first)
+	}
+	if _, err := report(abusive, reporters[0]); !errors.Is(err, repository.ErrAlreadyExist) {
+		t.Errorf("reporting a message twice returned %v, want ErrAlreadyExist", err)
+	}
+	if _, err := report(&model.Message{ID: uuid.New()}, reporters[0]); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("reporting an unknown message returned %v, want ErrNotFound", err)
+	}
+
+	got, err := repos.Reports.GetByID(ctx, room.ID, reports[0].ID)
+	if err != nil {
+		t.Fatalf("get by id: %v", err)
+	}
+	if got.ID != reports[0].ID || got.ReporterID != reporters[0].ID || got.Details != "details" {
+		t.Errorf("get by id returned %+v, want %+v", got, reports[0])
+	}
+	if _, err := repos.Reports.GetByID(ctx, uuid.New(), reports[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get by id in another room returned %v, want ErrNotFound", err)
+	}
+	open, err := repos.Reports.GetByRoomID(ctx, room.ID, model.ReportOpen, 10, 0)
+	if err != nil {
+		t.Fatalf("get by room id: %v", err)
+	}
+	if ids := reportIDs(open); !slices.Equal(ids, reportIDs(reports)) {
+		t.Errorf("get by room id returned %v, want %v oldest first", ids, reportIDs(reports))
+	}
+
+	// resolving a report resolves the other open reports of its message
+	resolution := *reports[0]
+	resolution.Status, resolution.ResolvedBy = model.ReportResolved, &admin.ID
+	resolved, err := repos.Reports.Resolve(ctx, &resolution, true)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if ids := reportIDs(resolved); len(ids) != 2 || !slices.Contains(ids, reports[0].ID) || !slices.Contains(ids, reports[1].ID) {
+		t.Fatalf("resolve returned %v, want both reports of the message", ids)
+	}
+	for _, closed := range resolved {
+		if closed.Status != model.ReportResolved || !closed.MessageDeleted || closed.MessageID != nil || closed.ResolvedBy == nil || *closed.ResolvedBy != admin.ID || closed.ResolvedAt == nil {
+			t.Errorf("resolve returned %+v", closed)
+		}
+	}
+	if _, err := repos.Messages.GetByID(ctx, abusive.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get message deleted on resolving its report returned %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Reports.Resolve(ctx, &resolution, true); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("resolving a report twice returned %v, want ErrNotFound", err)
+	}
+
+	dismissal := *reports[2]
+	dismissal.Status, dismissal.ResolvedBy = model.ReportDismissed, &admin.ID
+	if resolved, err = repos.Reports.Resolve(ctx, &dismissal, false); err != nil {
+		t.Fatalf("dismiss: %v", err)
+	}
+	if len(resolved) != 1 || resolved[0].Status != model.ReportDismissed || resolved[0].MessageDeleted || resolved[0].MessageID == nil {
+		t.Errorf("dismiss returned %d reports, want the dismissed report still referencing its message", len(resolved))
+	}
+	if _, err := repos.Messages.GetByID(ctx, rude.ID); err != nil {
+		t.Errorf("get message of a dismissed report: %v", err)
+	}
+
+	for status, want := range map[model.ReportStatus][]uuid.UUID{
+		model.ReportOpen:      nil,
+		model.ReportResolved:  reportIDs(reports[:2]),
+		model.ReportDismissed: {reports[2].ID},
+		"":                    reportIDs(reports),
+	} {
+		found, err := repos.Reports.GetByRoomID(ctx, room.ID, status, 10, 0)
+		if err != nil {
+			t.Fatalf("get by room id: %v", err)
+		}
+		if ids := reportIDs(found); !slices.Equal(ids, want) {
+			t.Errorf("get by room id in status %q returned %v, want %v", status, ids, want)
+		}
+	}
+}
+
+func checkAudit(t *testing.T, ctx context.Context, repos *repository.Repositories) {
+	prefix := uniqueName()
+	actor := createUser(t, ctx, repos, prefix)
+	room := createRoom(t, ctx, repos, prefix, actor.ID)
+	start := time.Now().Add(-time.Minute)
+
+	events := []*model.AuditEvent{
+		{ActorID: &actor.ID, Action: model.AuditUserCreate, TargetID: actor.ID, After: json.RawMessage(`{"username":"` + actor.Username + `"}`)},
+		{ActorID: &actor.ID, RoomID: &room.ID, Action: model.AuditRoomSetTopic, TargetID: room.ID, Before: json.RawMessage(`{"topic":""}`), After: json.RawMessage(`{"topic":"news"}`)},
+		{ActorID: &actor.ID, RoomID: &room.ID, Action: model.AuditMemberAdd, TargetID: actor.ID, After: json.RawMessage(`{"role":"admin"}`)},
+	}
+	for _, event := range events {
+		if err := repos.Audit.Create(ctx, event); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	found, err := repos.Audit.Query(ctx, &model.AuditQuery{RoomID: &room.ID}, 10, 0)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if actions := auditActions(found); !slices.Equal(actions, []model.AuditAction{model.AuditMemberAdd, model.AuditRoomSetTopic}) {
+		t.Fatalf("query by room returned %v, want the room's events newest first", actions)
+	}
+	topic := found[1]
+	if topic.ID == uuid.Nil || topic.TargetID != room.ID || topic.ActorID == nil || *topic.ActorID != actor.ID || topic.CreatedAt.IsZero() ||
+		!sameJSON(topic.Before, events[1].Before) || !sameJSON(topic.After, events[1].After) {
+		t.Errorf("query returned %+v, want %+v", topic, events[1])
+	}
+	if found[0].Before != nil {
+		t.Errorf("query returned %s as the state before adding a member, want null", found[0].Before)
+	}
+
+	later, earlier := time.Now().Add(time.Minute), start.Add(-time.Minute)
+	for _, q := range []struct {
+		name  string
+		query *model.AuditQuery
+		want  []model.AuditAction
+	}{
+		{"actor", &model.AuditQuery{ActorID: &actor.ID}, []model.AuditAction{model.AuditMemberAdd, model.AuditRoomSetTopic, model.AuditUserCreate}},
+		{"action", &model.AuditQuery{ActorID: &actor.ID, Action: string(model.AuditRoomSetTopic)}, []model.AuditAction{model.AuditRoomSetTopic}},
+		{"target kind", &model.AuditQuery{ActorID: &actor.ID, Action: "member"}, []model.AuditAction{model.AuditMemberAdd}},
+		{"partial action", &model.AuditQuery{ActorID: &actor.ID, Action: "room.set"}, nil},
+		{"since", &model.AuditQuery{ActorID: &actor.ID, Since: &later}, nil},
+		{"until", &model.AuditQuery{ActorID: &actor.ID, Since: &earlier, Until: &start}, nil},
+		{"range", &model.AuditQuery{ActorID: &actor.ID, Action: "user", Since: &start, Until: &later}, []model.AuditAction{model.AuditUserCreate}},
+	} {
+		found, err := repos.Audit.Query(ctx, q.query, 10, 0)
+		if err != nil {
+			t.Fatalf("query by %s: %v", q.name, err)
+		}
+		if actions := auditActions(found); !slices.Equal(actions, q.want) {
+			t.Errorf("query by %s returned %v, want %v", q.name, actions, q.want)
+		}
+	}
+	if found, err = repos.Audit.Query(ctx, &model.AuditQuery{ActorID: &actor.ID}, 1, 1); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if actions := auditActions(found); !slices.Equal(actions, []model.AuditAction{model.AuditRoomSetTopic}) {
+		t.Errorf("query with limit 1 and offset 1 returned %v, want %v", actions, []model.AuditAction{model.AuditRoomSetTopic})
+	}
+}
+
+// uniqueName returns a name no other check uses, for the users and rooms of a check
+func uniqueName() string {
+	return "repotest_" + uuid.NewString()[:8]
+}
+
+func createUser(t *testing.T, ctx context.Context, repos *repository.Repositories, name string) *model.User {
+	t.Helper()
+	user, err := repos.Users.Create(ctx, name, model.UserKindHuman)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func createRoom(t *testing.T, ctx context.Context, repos *repository.Repositories, name string, creatorID uuid.UUID) *model.Room {
+	t.Helper()
+	room, err := repos.Rooms.Create(ctx, &model.Room{Name: name, CreatorID: creatorID})
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	return room
+}
+
+func createMessage(t *testing.T, ctx context.Context, repos *repository.Repositories, roomID uuid.UUID, sender *model.User, content string) *model.Message {
+	t.Helper()
+	message, err := repos.Messages.Create(ctx, &model.Message{RoomID: roomID, SenderID: sender.ID, SenderUsername: sender.Username, Content: content})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	return message
+}
+
+func sameUser(t *testing.T, got, want *model.User) {
+	t.Helper()
+	if got.ID != want.ID || got.Username != want.Username || got.Kind != want.Kind || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("got user %+v, want %+v", got, want)
+	}
+}
+
+func sameMessage(t *testing.T, got, want *model.Message) {
+	t.Helper()
+	if got.ID != want.ID || got.RoomID != want.RoomID || got.SenderID != want.SenderID || got.SenderUsername != want.SenderUsername ||
+		got.Content != want.Content || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("got message %+v, want %+v", got, want)
+	}
+}
+
+// newestFirst checks that the messages are the given ones, which are sorted oldest first, in reverse
+func newestFirst(t *testing.T, op string, got, oldestFirst []*model.Message) {
+	t.Helper()
+	if len(got) != len(oldestFirst) {
+		t.Errorf("%s: got %d messages, want %d", op, len(got), len(oldestFirst))
+		return
+	}
+	for i, message := range got {
+		if want := oldestFirst[len(oldestFirst)-1-i]; message.ID != want.ID {
+			t.Errorf("%s: got %q at position %d, want %q", op, message.Content, i, want.Content)
+			return
+		}
+	}
+}
+
+// sameIDs reports whether the ids are the wanted ones in any order
+func sameIDs(ids []uuid.UUID, want ...uuid.UUID) bool {
+	return len(ids) == len(want) && !slices.ContainsFunc(want, func(id uuid.UUID) bool { return !slices.Contains(ids, id) })
+}
+
+// sameJSON reports whether the documents are equal once decoded, since postgres reformats stored json
+func sameJSON(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return fmt.Sprint(x) == fmt.Sprint(y)
+}
+
+func userIDs(users []*model.User) []uuid.UUID {
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func roomIDs(rooms []*model.Room) []uuid.UUID {
+	ids := make([]uuid.UUID, len(rooms))
+	for i, room := range rooms {
+		ids[i] = room.ID
+	}
+	return ids
+}
+
+func sanctionIDs(sanctions model.Sanctions) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, sanction := range sanctions {
+		ids = append(ids, sanction.ID)
+	}
+	return ids
+}
+
+func flaggedIDs(messages []*model.FlaggedMessage) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func reportIDs(reports []*model.Report) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, report := range reports {
+		ids = append(ids, report.ID)
+	}
+	return ids
+}
+
+func auditActions(events []*model.AuditEvent) []model.AuditAction {
+	var actions []model.AuditAction
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+// findRooms returns the summaries of the given rooms in the order they were found
+func findRooms(summaries []*model.RoomSummary, ids ...uuid.UUID) []*model.RoomSummary {
+	var found []*model.RoomSummary
+	for _, summary := range summaries {
+		if slices.Contains(ids, summary.ID) {
+			found = append(found, summary)
+		}
+	}
+	return found
+}
@@ -3,35 +3,48 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/mrshabel/chat/internal/model"
 )
 
-type RoomRepository struct {
+// order by clauses for the supported room search sorts
+var roomSortClauses = map[model.RoomSort]string{
+	model.RoomSortRelevance: "(r.name ILIKE $2) DESC, similarity(r.name, $1) DESC, r.created_at DESC",
+	model.RoomSortMembers:   "member_count DESC, r.created_at DESC",
+	model.RoomSortActivity:  "last_message_at DESC NULLS LAST, r.created_at DESC",
+	model.RoomSortCreated:   "r.created_at DESC",
+}
+
+type PGRoomRepository struct {
 	db *sql.DB
 }
 
-func NewRoomRepository(db *sql.DB) *RoomRepository {
-	return &RoomRepository{db: db}
+func NewPGRoomRepository(db *sql.DB) *PGRoomRepository {
+	return &PGRoomRepository{db: db}
 }
 
-func (r *RoomRepository) Create(ctx context.Context, data *model.Room) (*model.Room, error) {
+// Create returns ErrNotFound when the creator does not exist
+func (r *PGRoomRepository) Create(ctx context.Context, data *model.Room) (*model.Room, error) {
 	query := `
         INSERT INTO rooms (name, creator_id)
         VALUES ($1, $2)
-		RETURNING id, name, creator_id, created_at, updated_at
+		RETURNING id, name, topic, slow_mode_seconds, creator_id, created_at, updated_at
     `
 	var room model.Room
-	if err := r.db.QueryRowContext(ctx, query, data.Name, data.CreatorID).Scan(&room.ID, &room.Name, &room.CreatorID, &room.CreatedAt, &room.UpdatedAt); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, data.Name, data.CreatorID).Scan(&room.ID, &room.Name, &room.Topic, &room.SlowModeSeconds, &room.CreatorID, &room.CreatedAt, &room.UpdatedAt); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return &room, nil
 }
 
-func (r *RoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
+func (r *PGRoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
 	query := `
-        SELECT id, name, creator_id, created_at, updated_at 
+        SELECT id, name, topic, slow_mode_seconds, creator_id, created_at, updated_at 
         FROM rooms 
         WHERE id = $1
     `
@@ -39,6 +52,8 @@ func (r *RoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&room.ID,
 		&room.Name,
+		&room.Topic,
+		&room.SlowModeSeconds,
 		&room.CreatorID,
 		&room.CreatedAt,
 		&room.UpdatedAt,
@@ -49,9 +64,9 @@ func (r *RoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room
 	return &room, err
 }
 
-func (r *RoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*model.Room, error) {
+func (r *PGRoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*model.Room, error) {
 	query := `
-        SELECT id, name, creator_id, created_at, updated_at 
+        SELECT id, name, topic, slow_mode_seconds, creator_id, created_at, updated_at 
         FROM rooms 
         ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -68,6 +83,8 @@ func (r *RoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*mode
 		if err := rows.Scan(
 			&room.ID,
 			&room.Name,
+			&room.Topic,
+			&room.SlowModeSeconds,
 			&room.CreatorID,
 			&room.CreatedAt,
 			&room.UpdatedAt,
@@ -82,9 +99,54 @@ func (r *RoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*mode
 	return rooms, nil
 }
 
-func (r *RoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*model.Room, error) {
+// Search retrieves rooms whose names start with or are similar to the query. An empty query matches all rooms
+func (r *PGRoomRepository) Search(ctx context.Context, req *model.SearchRoomsReq, limit, offset int) ([]*model.RoomSummary, error) {
+	orderBy, ok := roomSortClauses[req.Sort]
+	if !ok {
+		orderBy = roomSortClauses[model.RoomSortCreated]
+	}
+	query := fmt.Sprintf(`
+        SELECT r.id, r.name, r.topic, r.slow_mode_seconds, r.creator_id, r.created_at, r.updated_at,
+			(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id) AS member_count,
+			(SELECT MAX(m.created_at) FROM messages m WHERE m.room_id = r.id) AS last_message_at
+        FROM rooms r
+		WHERE $1 = '' OR r.name ILIKE $2 OR r.name %% $1
+        ORDER BY %s
+		LIMIT $3 OFFSET $4
+    `, orderBy)
+	rows, err := r.db.QueryContext(ctx, query, req.Query, prefixPattern(req.Query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*model.RoomSummary
+	for rows.Next() {
+		var room model.RoomSummary
+		if err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Topic,
+			&room.SlowModeSeconds,
+			&room.CreatorID,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.MemberCount,
+			&room.LastMessageAt,
+		); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func (r *PGRoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*model.Room, error) {
 	query := `
-        SELECT r.id, r.name, r.creator_id, r.created_at, r.updated_at 
+        SELECT r.id, r.name, r.topic, r.slow_mode_seconds, r.creator_id, r.created_at, r.updated_at 
         FROM rooms r
 		LEFT JOIN room_members rm
 		ON rm.room_id = r.id
@@ -104,6 +166,8 @@ func (r *RoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, l
 		if err := rows.Scan(
 			&room.ID,
 			&room.Name,
+			&room.Topic,
+			&room.SlowModeSeconds,
 			&room.CreatorID,
 			&room.CreatedAt,
 			&room.UpdatedAt,
@@ -118,7 +182,9 @@ func (r *RoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, l
 	return rooms, nil
 }
 
-func (r *RoomRepository) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error) {
+// AddMember returns ErrAlreadyExist when the user is already a member, and ErrNotFound when the room or user does not
+// exist
+func (r *PGRoomRepository) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error) {
 	query := `
         INSERT INTO room_members (room_id, user_id, role)
         VALUES ($1, $2, $3)
@@ -126,12 +192,73 @@ func (r *RoomRepository) AddMember(ctx context.Context, roomID, userID uuid.UUID
     `
 	var member model.RoomMember
 	if err := r.db.QueryRowContext(ctx, query, roomID, userID, role).Scan(&member.ID, &member.RoomID, &member.UserID, &member.Role, &member.CreatedAt, &member.UpdatedAt); err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return nil, ErrAlreadyExist
+		case isForeignKeyViolation(err):
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 	return &member, nil
 }
 
-func (r *RoomRepository) GetAllMembers(ctx context.Context, roomID string, limit, offset int) ([]*model.RoomMember, error) {
+func (r *PGRoomRepository) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	query := `
+        SELECT id, room_id, user_id, role, created_at, updated_at
+        FROM room_members
+        WHERE room_id = $1 AND user_id = $2
+    `
+	var member model.RoomMember
+	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(&member.ID, &member.RoomID, &member.UserID, &member.Role, &member.CreatedAt, &member.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &member, err
+}
+
+func (r *PGRoomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM room_members WHERE room_id = $1 AND user_id = $2", roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PGRoomRepository) UpdateTopic(ctx context.Context, id uuid.UUID, topic string) error {
+	return r.update(ctx, "UPDATE rooms SET topic = $2, updated_at = NOW() WHERE id = $1", id, topic)
+}
+
+func (r *PGRoomRepository) UpdateSlowMode(ctx context.Context, id uuid.UUID, seconds int) error {
+	return r.update(ctx, "UPDATE rooms SET slow_mode_seconds = $2, updated_at = NOW() WHERE id = $1", id, seconds)
+}
+
+// update runs an update of a single room, returning ErrNotFound when the room does not exist
+func (r *PGRoomRepository) update(ctx context.Context, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PGRoomRepository) GetAllMembers(ctx context.Context, roomID string, limit, offset int) ([]*model.RoomMember, error) {
 	query := `
         SELECT id, room_id, user_id, role, created_at, updated_at
         FROM room_members
@@ -165,3 +292,25 @@ func (r *RoomRepository) GetAllMembers(ctx context.Context, roomID string, limit
 	}
 	return members, nil
 }
+
+// GetAdminIDs retrieves the ids of the room's admins
+func (r *PGRoomRepository) GetAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id FROM room_members WHERE room_id = $1 AND role = $2", roomID, model.AdminRole)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const sanctionColumns = "id, room_id, user_id, kind, reason, issued_by, expires_at, revoked_by, revoked_at, created_at, updated_at"
+
+// condition matching the sanctions in effect
+const activeSanction = "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())"
+
+type PGSanctionRepository struct {
+	db *sql.DB
+}
+
+func NewPGSanctionRepository(db *sql.DB) *PGSanctionRepository {
+	return &PGSanctionRepository{db: db}
+}
+
+// Create stores the sanction, lifting the user's active sanctions of the replaced kinds on behalf of its issuer.
+// ErrNotFound is returned when the room or user does not exist
+func (r *PGSanctionRepository) Create(ctx context.Context, data *model.Sanction, replaces []model.SanctionKind) (*model.Sanction, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = NOW(), updated_at = NOW()
+        WHERE room_id = $1 AND user_id = $2 AND kind = ANY($4::text[]) AND %s
+    `, activeSanction)
+	if _, err := tx.ExecContext(ctx, query, data.RoomID, data.UserID, data.IssuedBy, kindNames(replaces)); err != nil {
+		return nil, err
+	}
+
+	query = `
+        INSERT INTO room_sanctions (room_id, user_id, kind, reason, issued_by, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + sanctionColumns
+	sanction, err := scanSanction(tx.QueryRowContext(ctx, query, data.RoomID, data.UserID, data.Kind, data.Reason, data.IssuedBy, data.ExpiresAt))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sanction, nil
+}
+
+// GetActiveByUserID retrieves the sanctions of the user in effect in the room
+func (r *PGSanctionRepository) GetActiveByUserID(ctx context.Context, roomID, userID uuid.UUID) (model.Sanctions, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM room_sanctions
+        WHERE room_id = $1 AND user_id = $2 AND %s
+    `, sanctionColumns, activeSanction)
+	return r.query(ctx, query, roomID, userID)
+}
+
+// GetByRoomID retrieves the sanctions of the room, newest first, optionally only those in effect
+func (r *PGSanctionRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, activeOnly bool, limit, offset int) (model.Sanctions, error) {
+	filter := "TRUE"
+	if activeOnly {
+		filter = activeSanction
+	}
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM room_sanctions
+        WHERE room_id = $1 AND %s
+        ORDER BY created_at DESC
+        LIMIT $2 OFFSET $3
+    `, sanctionColumns, filter)
+	return r.query(ctx, query, roomID, limit, offset)
+}
+
+// Revoke lifts the sanction of the room on behalf of the actor. ErrNotFound is returned when there is no such
+// sanction or it was already lifted
+func (r *PGSanctionRepository) Revoke(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.Sanction, error) {
+	query := `
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = NOW(), updated_at = NOW()
+        WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL
+		RETURNING ` + sanctionColumns
+	sanction, err := scanSanction(r.db.QueryRowContext(ctx, query, id, roomID, actorID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return sanction, err
+}
+
+// RevokeActive lifts the user's sanctions of the given kinds in effect in the room on behalf of the actor
+func (r *PGSanctionRepository) RevokeActive(ctx context.Context, roomID, userID uuid.UUID, kinds []model.SanctionKind, actorID uuid.UUID) (model.Sanctions, error) {
+	query := fmt.Sprintf(`
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = NOW(), updated_at = NOW()
+        WHERE room_id = $1 AND user_id = $2 AND kind = ANY($4::text[]) AND %s
+		RETURNING %s
+    `, activeSanction, sanctionColumns)
+	return r.query(ctx, query, roomID, userID, actorID, kindNames(kinds))
+}
+
+func (r *PGSanctionRepository) query(ctx context.Context, query string, args ...any) (model.Sanctions, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sanctions model.Sanctions
+	for rows.Next() {
+		sanction, err := scanSanction(rows)
+		if err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sanctions, nil
+}
+
+func scanSanction(row interface{ Scan(...any) error }) (*model.Sanction, error) {
+	var (
+		sanction             model.Sanction
+		issuedBy, revokedBy  uuid.NullUUID
+		expiresAt, revokedAt sql.NullTime
+	)
+	if err := row.Scan(
+		&sanction.ID,
+		&sanction.RoomID,
+		&sanction.UserID,
+		&sanction.Kind,
+		&sanction.Reason,
+		&issuedBy,
+		&expiresAt,
+		&revokedBy,
+		&revokedAt,
+		&sanction.CreatedAt,
+		&sanction.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	sanction.IssuedBy, sanction.RevokedBy = nullUUIDPtr(issuedBy), nullUUIDPtr(revokedBy)
+	sanction.ExpiresAt, sanction.RevokedAt = nullTimePtr(expiresAt), nullTimePtr(revokedAt)
+	return &sanction, nil
+}
+
+func kindNames(kinds []model.SanctionKind) []string {
+	names := make([]string, len(kinds))
+	for i, kind := range kinds {
+		names[i] = string(kind)
+	}
+	return names
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// sqlite has no timestamp type, so timestamps are stored as utc text with a fixed number of fractional digits, which
+// compares in time order. sqliteTimeFormat is the layout of that text and sqliteNow the expression of the current time.
+// sqliteNow only has millisecond precision, so rows are sorted by rowid, their insertion order, when created together
+const (
+	sqliteTimeFormat = "2006-01-02 15:04:05.000000000-07:00"
+	sqliteNow        = "strftime('%Y-%m-%d %H:%M:%f000000+00:00', 'now')"
+)
+
+// NewSQLiteRepositories creates the repositories storing data in the sqlite database
+func NewSQLiteRepositories(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:     NewSQLiteUserRepository(db),
+		Rooms:     NewSQLiteRoomRepository(db),
+		Messages:  NewSQLiteMessageRepository(db),
+		Webhooks:  NewSQLiteWebhookRepository(db),
+		Bots:      NewSQLiteBotRepository(db),
+		Reactions: NewSQLiteReactionRepository(db),
+		Commands:  NewSQLiteCommandRepository(db),
+		Sanctions: NewSQLiteSanctionRepository(db),
+		Filters:   NewSQLiteFilterRepository(db),
+		Reports:   NewSQLiteReportRepository(db),
+		Audit:     NewSQLiteAuditRepository(db),
+	}
+}
+
+// sqliteTime formats the time as stored in sqlite
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteNullTime formats the time as stored in sqlite, mapping nil to NULL
+func sqliteNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// sqliteTimestamp scans a computed timestamp, which sqlite returns as text rather than a time since it has no
+// declared type. NULL is scanned as a nil time
+type sqliteTimestamp struct {
+	dst **time.Time
+}
+
+func (s sqliteTimestamp) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s.dst = nil
+	case time.Time:
+		*s.dst = &v
+	case string:
+		t, err := time.Parse(sqliteTimeFormat, v)
+		if err != nil {
+			return err
+		}
+		*s.dst = &t
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	return nil
+}
+
+// jsonList scans a json array column into the slice
+func jsonList(dst *[]string) sql.Scanner {
+	return jsonListScanner{dst: dst}
+}
+
+type jsonListScanner struct {
+	dst *[]string
+}
+
+func (s jsonListScanner) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into a list", src)
+	}
+	list := make([]string, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s.dst = list
+	return nil
+}
+
+// jsonListValue encodes the list as a json array, mapping nil to an empty array
+func jsonListValue[T any](list []T) string {
+	if len(list) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+// affectedOne checks the result of a statement changing a single row, returning ErrNotFound when it changed none
+func affectedOne(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// SQLiteCommandRepository stores the custom commands of rooms in SQLite
+type SQLiteCommandRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteCommandRepository(db *sql.DB) *SQLiteCommandRepository {
+	return &SQLiteCommandRepository{db: db}
+}
+
+// Create stores the command. ErrAlreadyExist is returned when the room has a command with the same name and
+// ErrNotFound when the room, bot or webhook does not exist
+func (r *SQLiteCommandRepository) Create(ctx context.Context, data *model.RoomCommand) (*model.RoomCommand, error) {
+	query := `
+        INSERT INTO room_commands (room_id, name, description, bot_id, webhook_id)
+        VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, room_id, name, description, bot_id, webhook_id, created_at, updated_at
+    `
+	command, err := scanCommand(r.db.QueryRowContext(ctx, query, data.RoomID, data.Name, data.Description, data.BotID, data.WebhookID))
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return nil, ErrAlreadyExist
+		case isForeignKeyViolation(err):
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return command, nil
+}
+
+// GetByName retrieves the command of the room along with its webhook, if any
+func (r *SQLiteCommandRepository) GetByName(ctx context.Context, roomID uuid.UUID, name string) (*model.RoomCommand, error) {
+	query := `
+        SELECT c.id, c.room_id, c.name, c.description, c.bot_id, c.webhook_id, c.created_at, c.updated_at,
+            w.url, w.secret
+        FROM room_commands c
+        LEFT JOIN outgoing_webhooks w ON w.id = c.webhook_id
+        WHERE c.room_id = $1 AND c.name = $2
+    `
+	var (
+		command            model.RoomCommand
+		botID, webhookID   uuid.NullUUID
+		webhookURL, secret sql.NullString
+	)
+	err := r.db.QueryRowContext(ctx, query, roomID, name).Scan(
+		&command.ID,
+		&command.RoomID,
+		&command.Name,
+		&command.Description,
+		&botID,
+		&webhookID,
+		&command.CreatedAt,
+		&command.UpdatedAt,
+		&webhookURL,
+		&secret,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	command.BotID, command.WebhookID = nullUUIDPtr(botID), nullUUIDPtr(webhookID)
+	if command.WebhookID != nil {
+		command.Webhook = &model.OutgoingWebhook{ID: *command.WebhookID, RoomID: roomID, URL: webhookURL.String, Secret: secret.String}
+	}
+	return &command, nil
+}
+
+// GetByRoomID retrieves the commands of the room sorted by name
+func (r *SQLiteCommandRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.RoomCommand, error) {
+	query := `
+        SELECT id, room_id, name, description, bot_id, webhook_id, created_at, updated_at
+        FROM room_commands
+        WHERE room_id = $1
+        ORDER BY name
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []*model.RoomCommand
+	for rows.Next() {
+		command, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+func (r *SQLiteCommandRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return affectedOne(r.db.ExecContext(ctx, "DELETE FROM room_commands WHERE id = $1", id))
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// SQLiteFilterRepository stores the content filter settings of rooms and their flagged messages in SQLite. Lists are
+// stored as json arrays
+type SQLiteFilterRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteFilterRepository(db *sql.DB) *SQLiteFilterRepository {
+	return &SQLiteFilterRepository{db: db}
+}
+
+// GetByRoomID retrieves the content filter settings of the room. ErrNotFound is returned when the room has none
+func (r *SQLiteFilterRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID) (*model.RoomFilter, error) {
+	query := `
+        SELECT room_id, blocked_words, word_action, allowed_domains, link_action, spam_action, updated_by, updated_at
+        FROM room_filters
+        WHERE room_id = $1
+    `
+	var (
+		filter    model.RoomFilter
+		updatedBy uuid.NullUUID
+	)
+	err := r.db.QueryRowContext(ctx, query, roomID).Scan(
+		&filter.RoomID,
+		jsonList(&filter.BlockedWords),
+		&filter.WordAction,
+		jsonList(&filter.AllowedDomains),
+		&filter.LinkAction,
+		&filter.SpamAction,
+		&updatedBy,
+		&filter.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	filter.UpdatedBy = nullUUIDPtr(updatedBy)
+	return &filter, nil
+}
+
+// Upsert replaces the content filter settings of the room. ErrNotFound is returned when the room does not exist
+func (r *SQLiteFilterRepository) Upsert(ctx context.Context, data *model.RoomFilter) (*model.RoomFilter, error) {
+	query := `
+        INSERT INTO room_filters (room_id, blocked_words, word_action, allowed_domains, link_action, spam_action, updated_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (room_id) DO UPDATE SET
+            blocked_words = excluded.blocked_words,
+            word_action = excluded.word_action,
+            allowed_domains = excluded.allowed_domains,
+            link_action = excluded.link_action,
+            spam_action = excluded.spam_action,
+            updated_by = excluded.updated_by,
+            updated_at = ` + sqliteNow + `
+		RETURNING updated_at
+    `
+	filter := *data
+	err := r.db.QueryRowContext(ctx, query, data.RoomID, jsonListValue(data.BlockedWords), data.WordAction, jsonListValue(data.AllowedDomains), data.LinkAction, data.SpamAction, data.UpdatedBy).Scan(&filter.UpdatedAt)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// CreateFlagged queues the message for review
+func (r *SQLiteFilterRepository) CreateFlagged(ctx context.Context, data *model.FlaggedMessage) (*model.FlaggedMessage, error) {
+	query := `
+        INSERT INTO flagged_messages (room_id, sender_id, sender_username, content, reasons)
+        VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + flaggedColumns
+	return scanFlagged(r.db.QueryRowContext(ctx, query, data.RoomID, nullableUUID(data.SenderID), data.SenderUsername, data.Content, jsonListValue(data.Reasons)), jsonList)
+}
+
+// GetFlaggedByRoomID retrieves the flagged messages of the room, oldest first, optionally only those in the given status
+func (r *SQLiteFilterRepository) GetFlaggedByRoomID(ctx context.Context, roomID uuid.UUID, status model.FlaggedStatus, limit, offset int) ([]*model.FlaggedMessage, error) {
+	query := `
+        SELECT ` + flaggedColumns + `
+        FROM flagged_messages
+        WHERE room_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY created_at ASC, rowid ASC
+        LIMIT $3 OFFSET $4
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID, string(status), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*model.FlaggedMessage
+	for rows.Next() {
+		message, err := scanFlagged(rows, jsonList)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Reject marks the pending flagged message of the room as rejected on behalf of the actor. ErrNotFound is returned
+// when there is no such message or it was already reviewed
+func (r *SQLiteFilterRepository) Reject(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, error) {
+	flagged, err := r.review(ctx, r.db, roomID, id, actorID, model.FlaggedRejected)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return flagged, err
+}
+
+// Approve marks the pending flagged message of the room as approved on behalf of the actor and sends it as a message
+// of the room. ErrNotFound is returned when there is no such message or it was already reviewed
+func (r *SQLiteFilterRepository) Approve(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.FlaggedMessage, *model.Message, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	flagged, err := r.review(ctx, tx, roomID, id, actorID, model.FlaggedApproved)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+
+	query := `
+        INSERT INTO messages (room_id, sender_id, sender_username, content)
+        VALUES ($1, $2, $3, $4)
+		RETURNING ` + messageColumns
+	message, err := scanMessage(tx.QueryRowContext(ctx, query, flagged.RoomID, nullableUUID(flagged.SenderID), flagged.SenderUsername, flagged.Content))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE flagged_messages SET message_id = $2 WHERE id = $1`, flagged.ID, message.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	flagged.MessageID = &message.ID
+	return flagged, message, nil
+}
+
+// review sets the status of the pending flagged message, returning sql.ErrNoRows when there is none
+func (r *SQLiteFilterRepository) review(ctx context.Context, db queryRower, roomID, id, actorID uuid.UUID, status model.FlaggedStatus) (*model.FlaggedMessage, error) {
+	query := fmt.Sprintf(`
+        UPDATE flagged_messages
+        SET status = $4, reviewed_by = $3, reviewed_at = %[1]s, updated_at = %[1]s
+        WHERE id = $1 AND room_id = $2 AND status = 'pending'
+		RETURNING %[2]s
+    `, sqliteNow, flaggedColumns)
+	return scanFlagged(db.QueryRowContext(ctx, query, id, roomID, actorID, status), jsonList)
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const messageColumns = "id, room_id, sender_id, sender_username, content, created_at, updated_at"
+
+// SQLiteMessageRepository stores the messages of rooms in SQLite
+type SQLiteMessageRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteMessageRepository(db *sql.DB) *SQLiteMessageRepository {
+	return &SQLiteMessageRepository{db: db}
+}
+
+func (r *SQLiteMessageRepository) Create(ctx context.Context, data *model.Message) (*model.Message, error) {
+	query := `
+        INSERT INTO messages (room_id, sender_id, sender_username, content)
+        VALUES ($1, $2, $3, $4)
+		RETURNING ` + messageColumns
+	return scanMessage(r.db.QueryRowContext(ctx, query, data.RoomID, nullableUUID(data.SenderID), data.SenderUsername, data.Content))
+}
+
+// CreateBatch inserts all messages with a single statement. The messages must have their ids and timestamps set and
+// are returned in the order given
+func (r *SQLiteMessageRepository) CreateBatch(ctx context.Context, data []*model.Message) ([]*model.Message, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	const columns = 7
+	values := make([]string, 0, len(data))
+	args := make([]any, 0, len(data)*columns)
+	for i, msg := range data {
+		n := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		args = append(args, msg.ID, msg.RoomID, nullableUUID(msg.SenderID), msg.SenderUsername, msg.Content, sqliteTime(msg.CreatedAt), sqliteTime(msg.UpdatedAt))
+	}
+	query := `
+        INSERT INTO messages (id, room_id, sender_id, sender_username, content, created_at, updated_at)
+        VALUES ` + strings.Join(values, ", ") + `
+		RETURNING ` + messageColumns
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// returned rows are matched by id since their order is not guaranteed
+	created := make(map[uuid.UUID]*model.Message, len(data))
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		created[msg.ID] = msg
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*model.Message, len(data))
+	for i, msg := range data {
+		if messages[i] = created[msg.ID]; messages[i] == nil {
+			return nil, fmt.Errorf("message (%s) missing from batch insert result", msg.ID)
+		}
+	}
+	return messages, nil
+}
+
+func (r *SQLiteMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error) {
+	msg, err := scanMessage(r.db.QueryRowContext(ctx, "SELECT "+messageColumns+" FROM messages WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return msg, err
+}
+
+// GetByRoomID retrieves the messages of the room, newest first
+func (r *SQLiteMessageRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.Message, error) {
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages
+        WHERE room_id = $1
+        ORDER BY created_at DESC, rowid DESC
+        LIMIT $2 OFFSET $3
+    `
+	return r.query(ctx, query, roomID, limit, offset)
+}
+
+// GetByRoomIDAfter retrieves the most recent messages of the room created after the given message, newest first
+func (r *SQLiteMessageRepository) GetByRoomIDAfter(ctx context.Context, roomID, afterID uuid.UUID, limit int) ([]*model.Message, error) {
+	var (
+		after    time.Time
+		afterRow int64
+	)
+	err := r.db.QueryRowContext(ctx, "SELECT created_at, rowid FROM messages WHERE id = $1 AND room_id = $2", afterID, roomID).Scan(&after, &afterRow)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// messages created in the same millisecond are told apart by insertion order
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages
+        WHERE room_id = $1 AND (created_at, rowid) > ($2, $3)
+        ORDER BY created_at DESC, rowid DESC
+        LIMIT $4
+    `
+	return r.query(ctx, query, roomID, sqliteTime(after), afterRow, limit)
+}
+
+func (r *SQLiteMessageRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return affectedOne(r.db.ExecContext(ctx, "DELETE FROM messages WHERE id = $1", id))
+}
+
+func (r *SQLiteMessageRepository) query(ctx context.Context, query string, args ...any) ([]*model.Message, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*model.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// scanMessage scans a message row, mapping a NULL sender to the nil uuid
+func scanMessage(row interface{ Scan(...any) error }) (*model.Message, error) {
+	var (
+		msg      model.Message
+		senderID uuid.NullUUID
+	)
+	if err := row.Scan(&msg.ID, &msg.RoomID, &senderID, &msg.SenderUsername, &msg.Content, &msg.CreatedAt, &msg.UpdatedAt); err != nil {
+		return nil, err
+	}
+	msg.SenderID = senderID.UUID
+	return &msg, nil
+}
+
+// SQLiteReactionRepository stores the reactions left on messages in SQLite
+type SQLiteReactionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteReactionRepository(db *sql.DB) *SQLiteReactionRepository {
+	return &SQLiteReactionRepository{db: db}
+}
+
+// Create stores the reaction, leaving it unchanged when the user already reacted with the same emoji. ErrNotFound is
+// returned when the message does not exist in the room
+func (r *SQLiteReactionRepository) Create(ctx context.Context, data *model.Reaction) (*model.Reaction, error) {
+	// the no-op update returns the existing reaction on conflict
+	query := `
+        INSERT INTO message_reactions (message_id, user_id, emoji)
+        SELECT id, $2, $3 FROM messages WHERE id = $1 AND room_id = $4
+        ON CONFLICT (message_id, user_id, emoji) DO UPDATE SET emoji = excluded.emoji
+		RETURNING created_at
+    `
+	reaction := *data
+	err := r.db.QueryRowContext(ctx, query, data.MessageID, data.UserID, data.Emoji, data.RoomID).Scan(&reaction.CreatedAt)
+	if err == sql.ErrNoRows || isForeignKeyViolation(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
+// GetByMessageID retrieves the reactions on the message in the order they were left
+func (r *SQLiteReactionRepository) GetByMessageID(ctx context.Context, roomID, messageID uuid.UUID) ([]*model.Reaction, error) {
+	query := `
+        SELECT mr.message_id, m.room_id, mr.user_id, u.username, mr.emoji, mr.created_at
+        FROM message_reactions mr
+        JOIN messages m ON m.id = mr.message_id
+        JOIN users u ON u.id = mr.user_id
+        WHERE mr.message_id = $1 AND m.room_id = $2
+        ORDER BY mr.created_at, mr.rowid
+    `
+	rows, err := r.db.QueryContext(ctx, query, messageID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*model.Reaction
+	for rows.Next() {
+		var reaction model.Reaction
+		if err := rows.Scan(
+			&reaction.MessageID,
+			&reaction.RoomID,
+			&reaction.UserID,
+			&reaction.Username,
+			&reaction.Emoji,
+			&reaction.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, &reaction)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const roomColumns = "id, name, topic, slow_mode_seconds, creator_id, created_at, updated_at"
+
+const memberColumns = "id, room_id, user_id, role, created_at, updated_at"
+
+// order by clauses for the supported room search sorts in sqlite
+var sqliteRoomSortClauses = map[model.RoomSort]string{
+	model.RoomSortRelevance: `(r.name LIKE $2 ESCAPE '\') DESC, r.created_at DESC, r.rowid DESC`,
+	model.RoomSortMembers:   "member_count DESC, r.created_at DESC, r.rowid DESC",
+	model.RoomSortActivity:  "last_message_at DESC NULLS LAST, r.created_at DESC, r.rowid DESC",
+	model.RoomSortCreated:   "r.created_at DESC, r.rowid DESC",
+}
+
+// SQLiteRoomRepository stores rooms and their members in SQLite
+type SQLiteRoomRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRoomRepository(db *sql.DB) *SQLiteRoomRepository {
+	return &SQLiteRoomRepository{db: db}
+}
+
+// Create returns ErrNotFound when the creator does not exist
+func (r *SQLiteRoomRepository) Create(ctx context.Context, data *model.Room) (*model.Room, error) {
+	query := `
+        INSERT INTO rooms (name, creator_id)
+        VALUES ($1, $2)
+		RETURNING ` + roomColumns
+	room, err := scanRoom(r.db.QueryRowContext(ctx, query, data.Name, data.CreatorID))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return room, nil
+}
+
+func (r *SQLiteRoomRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Room, error) {
+	room, err := scanRoom(r.db.QueryRowContext(ctx, "SELECT "+roomColumns+" FROM rooms WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return room, err
+}
+
+// GetAll retrieves rooms, newest first
+func (r *SQLiteRoomRepository) GetAll(ctx context.Context, limit, offset int) ([]*model.Room, error) {
+	query := `
+        SELECT ` + roomColumns + `
+        FROM rooms
+        ORDER BY created_at DESC, rowid DESC
+		LIMIT $1 OFFSET $2
+    `
+	return r.query(ctx, query, limit, offset)
+}
+
+// Search retrieves rooms whose names contain the query. An empty query matches all rooms. sqlite has no trigram
+// similarity, so relevance only ranks prefix matches first
+func (r *SQLiteRoomRepository) Search(ctx context.Context, req *model.SearchRoomsReq, limit, offset int) ([]*model.RoomSummary, error) {
+	orderBy, ok := sqliteRoomSortClauses[req.Sort]
+	if !ok {
+		orderBy = sqliteRoomSortClauses[model.RoomSortCreated]
+	}
+	query := fmt.Sprintf(`
+        SELECT r.id, r.name, r.topic, r.slow_mode_seconds, r.creator_id, r.created_at, r.updated_at,
+			(SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = r.id) AS member_count,
+			(SELECT MAX(m.created_at) FROM messages m WHERE m.room_id = r.id) AS last_message_at
+        FROM rooms r
+		WHERE instr(lower(r.name), lower($1)) > 0
+        ORDER BY %s
+		LIMIT $3 OFFSET $4
+    `, orderBy)
+	rows, err := r.db.QueryContext(ctx, query, req.Query, prefixPattern(req.Query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*model.RoomSummary
+	for rows.Next() {
+		var room model.RoomSummary
+		if err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Topic,
+			&room.SlowModeSeconds,
+			&room.CreatorID,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.MemberCount,
+			sqliteTimestamp{&room.LastMessageAt},
+		); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// GetAllByUserID retrieves the rooms the user is a member of, newest first
+func (r *SQLiteRoomRepository) GetAllByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*model.Room, error) {
+	query := `
+        SELECT r.id, r.name, r.topic, r.slow_mode_seconds, r.creator_id, r.created_at, r.updated_at
+        FROM rooms r
+		JOIN room_members rm ON rm.room_id = r.id
+		WHERE rm.user_id = $1
+        ORDER BY r.created_at DESC, r.rowid DESC
+		LIMIT $2 OFFSET $3
+    `
+	return r.query(ctx, query, userID, limit, offset)
+}
+
+// AddMember returns ErrAlreadyExist when the user is already a member, and ErrNotFound when the room or user does not
+// exist
+func (r *SQLiteRoomRepository) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error) {
+	query := `
+        INSERT INTO room_members (room_id, user_id, role)
+        VALUES ($1, $2, $3)
+		RETURNING ` + memberColumns
+	member, err := scanMember(r.db.QueryRowContext(ctx, query, roomID, userID, role))
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return nil, ErrAlreadyExist
+		case isForeignKeyViolation(err):
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+func (r *SQLiteRoomRepository) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	query := "SELECT " + memberColumns + " FROM room_members WHERE room_id = $1 AND user_id = $2"
+	member, err := scanMember(r.db.QueryRowContext(ctx, query, roomID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return member, err
+}
+
+func (r *SQLiteRoomRepository) RemoveMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	return affectedOne(r.db.ExecContext(ctx, "DELETE FROM room_members WHERE room_id = $1 AND user_id = $2", roomID, userID))
+}
+
+func (r *SQLiteRoomRepository) UpdateTopic(ctx context.Context, id uuid.UUID, topic string) error {
+	query := "UPDATE rooms SET topic = $2, updated_at = " + sqliteNow + " WHERE id = $1"
+	return affectedOne(r.db.ExecContext(ctx, query, id, topic))
+}
+
+func (r *SQLiteRoomRepository) UpdateSlowMode(ctx context.Context, id uuid.UUID, seconds int) error {
+	query := "UPDATE rooms SET slow_mode_seconds = $2, updated_at = " + sqliteNow + " WHERE id = $1"
+	return affectedOne(r.db.ExecContext(ctx, query, id, seconds))
+}
+
+// GetAllMembers retrieves the members of the room, newest first
+func (r *SQLiteRoomRepository) GetAllMembers(ctx context.Context, roomID string, limit, offset int) ([]*model.RoomMember, error) {
+	query := `
+        SELECT ` + memberColumns + `
+        FROM room_members
+        WHERE room_id = $1
+		ORDER BY created_at DESC, rowid DESC
+		LIMIT $2 OFFSET $3
+    `
+	// ids are stored in their canonical text form, which the parameter may not be in
+	id, err := uuid.Parse(roomID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*model.RoomMember
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetAdminIDs retrieves the ids of the room's admins
+func (r *SQLiteRoomRepository) GetAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id FROM room_members WHERE room_id = $1 AND role = $2", roomID, model.AdminRole)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *SQLiteRoomRepository) query(ctx context.Context, query string, args ...any) ([]*model.Room, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*model.Room
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+func scanRoom(row interface{ Scan(...any) error }) (*model.Room, error) {
+	var room model.Room
+	if err := row.Scan(&room.ID, &room.Name, &room.Topic, &room.SlowModeSeconds, &room.CreatorID, &room.CreatedAt, &room.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func scanMember(row interface{ Scan(...any) error }) (*model.RoomMember, error) {
+	var member model.RoomMember
+	if err := row.Scan(&member.ID, &member.RoomID, &member.UserID, &member.Role, &member.CreatedAt, &member.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
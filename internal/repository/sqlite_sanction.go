@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// condition matching the sanctions in effect
+const sqliteActiveSanction = "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > " + sqliteNow + ")"
+
+// SQLiteSanctionRepository stores the sanctions of room members in SQLite
+type SQLiteSanctionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteSanctionRepository(db *sql.DB) *SQLiteSanctionRepository {
+	return &SQLiteSanctionRepository{db: db}
+}
+
+// Create stores the sanction, lifting the user's active sanctions of the replaced kinds on behalf of its issuer.
+// ErrNotFound is returned when the room or user does not exist
+func (r *SQLiteSanctionRepository) Create(ctx context.Context, data *model.Sanction, replaces []model.SanctionKind) (*model.Sanction, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = %[1]s, updated_at = %[1]s
+        WHERE room_id = $1 AND user_id = $2 AND kind IN (SELECT value FROM json_each($4)) AND %[2]s
+    `, sqliteNow, sqliteActiveSanction)
+	if _, err := tx.ExecContext(ctx, query, data.RoomID, data.UserID, data.IssuedBy, jsonListValue(kindNames(replaces))); err != nil {
+		return nil, err
+	}
+
+	query = `
+        INSERT INTO room_sanctions (room_id, user_id, kind, reason, issued_by, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + sanctionColumns
+	sanction, err := scanSanction(tx.QueryRowContext(ctx, query, data.RoomID, data.UserID, data.Kind, data.Reason, data.IssuedBy, sqliteNullTime(data.ExpiresAt)))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sanction, nil
+}
+
+// GetActiveByUserID retrieves the sanctions of the user in effect in the room
+func (r *SQLiteSanctionRepository) GetActiveByUserID(ctx context.Context, roomID, userID uuid.UUID) (model.Sanctions, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM room_sanctions
+        WHERE room_id = $1 AND user_id = $2 AND %s
+    `, sanctionColumns, sqliteActiveSanction)
+	return r.query(ctx, query, roomID, userID)
+}
+
+// GetByRoomID retrieves the sanctions of the room, newest first, optionally only those in effect
+func (r *SQLiteSanctionRepository) GetByRoomID(ctx context.Context, roomID uuid.UUID, activeOnly bool, limit, offset int) (model.Sanctions, error) {
+	filter := "TRUE"
+	if activeOnly {
+		filter = sqliteActiveSanction
+	}
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM room_sanctions
+        WHERE room_id = $1 AND %s
+        ORDER BY created_at DESC, rowid DESC
+        LIMIT $2 OFFSET $3
+    `, sanctionColumns, filter)
+	return r.query(ctx, query, roomID, limit, offset)
+}
+
+// Revoke lifts the sanction of the room on behalf of the actor. ErrNotFound is returned when there is no such
+// sanction or it was already lifted
+func (r *SQLiteSanctionRepository) Revoke(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.Sanction, error) {
+	query := fmt.Sprintf(`
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = %[1]s, updated_at = %[1]s
+        WHERE id = $1 AND room_id = $2 AND revoked_at IS NULL
+		RETURNING %[2]s
+    `, sqliteNow, sanctionColumns)
+	sanction, err := scanSanction(r.db.QueryRowContext(ctx, query, id, roomID, actorID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return sanction, err
+}
+
+// RevokeActive lifts the user's sanctions of the given kinds in effect in the room on behalf of the actor
+func (r *SQLiteSanctionRepository) RevokeActive(ctx context.Context, roomID, userID uuid.UUID, kinds []model.SanctionKind, actorID uuid.UUID) (model.Sanctions, error) {
+	query := fmt.Sprintf(`
+        UPDATE room_sanctions
+        SET revoked_by = $3, revoked_at = %[1]s, updated_at = %[1]s
+        WHERE room_id = $1 AND user_id = $2 AND kind IN (SELECT value FROM json_each($4)) AND %[2]s
+		RETURNING %[3]s
+    `, sqliteNow, sqliteActiveSanction, sanctionColumns)
+	return r.query(ctx, query, roomID, userID, actorID, jsonListValue(kindNames(kinds)))
+}
+
+func (r *SQLiteSanctionRepository) query(ctx context.Context, query string, args ...any) (model.Sanctions, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sanctions model.Sanctions
+	for rows.Next() {
+		sanction, err := scanSanction(rows)
+		if err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sanctions, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// SQLiteUserRepository stores users in SQLite
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+// Create returns ErrAlreadyExist when the username is taken
+func (r *SQLiteUserRepository) Create(ctx context.Context, username string, kind model.UserKind) (*model.User, error) {
+	query := `
+        INSERT INTO users (username, kind)
+        VALUES ($1, $2)
+		RETURNING id, username, kind, created_at, updated_at
+    `
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username, kind))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAlreadyExist
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *SQLiteUserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+	query := "SELECT id, username, kind, created_at, updated_at FROM users WHERE username = $1"
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *SQLiteUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	query := "SELECT id, username, kind, created_at, updated_at FROM users WHERE id = $1"
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+// Search retrieves users whose usernames contain the query, with prefix matches ranked first. sqlite has no trigram
+// similarity, so usernames are otherwise sorted alphabetically
+func (r *SQLiteUserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*model.User, error) {
+	stmt := `
+		SELECT id, username, kind, created_at, updated_at
+		FROM users
+		WHERE instr(lower(username), lower($1)) > 0
+		ORDER BY (username LIKE $2 ESCAPE '\') DESC, username
+		LIMIT $3 OFFSET $4
+		`
+	rows, err := r.db.QueryContext(ctx, stmt, query, prefixPattern(query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func scanUser(row interface{ Scan(...any) error }) (*model.User, error) {
+	var user model.User
+	if err := row.Scan(&user.ID, &user.Username, &user.Kind, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// SQLiteWebhookRepository stores the incoming and outgoing webhooks of rooms in SQLite
+type SQLiteWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteWebhookRepository(db *sql.DB) *SQLiteWebhookRepository {
+	return &SQLiteWebhookRepository{db: db}
+}
+
+// CreateIncoming returns ErrNotFound when the room does not exist
+func (r *SQLiteWebhookRepository) CreateIncoming(ctx context.Context, data *model.IncomingWebhook) (*model.IncomingWebhook, error) {
+	query := `
+        INSERT INTO incoming_webhooks (room_id, name, token_hash)
+        VALUES ($1, $2, $3)
+		RETURNING id, room_id, name, token_hash, created_at, updated_at
+    `
+	var hook model.IncomingWebhook
+	if err := r.db.QueryRowContext(ctx, query, data.RoomID, data.Name, data.TokenHash).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.Name,
+		&hook.TokenHash,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (r *SQLiteWebhookRepository) GetIncomingByID(ctx context.Context, id uuid.UUID) (*model.IncomingWebhook, error) {
+	query := `
+        SELECT id, room_id, name, token_hash, created_at, updated_at
+        FROM incoming_webhooks
+        WHERE id = $1
+    `
+	var hook model.IncomingWebhook
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.Name,
+		&hook.TokenHash,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &hook, err
+}
+
+// GetIncomingByRoomID retrieves the incoming webhooks of the room without their token digests
+func (r *SQLiteWebhookRepository) GetIncomingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.IncomingWebhook, error) {
+	query := `
+        SELECT id, room_id, name, created_at, updated_at
+        FROM incoming_webhooks
+        WHERE room_id = $1
+        ORDER BY created_at, rowid
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*model.IncomingWebhook
+	for rows.Next() {
+		var hook model.IncomingWebhook
+		if err := rows.Scan(
+			&hook.ID,
+			&hook.RoomID,
+			&hook.Name,
+			&hook.CreatedAt,
+			&hook.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (r *SQLiteWebhookRepository) DeleteIncoming(ctx context.Context, roomID, id uuid.UUID) error {
+	return affectedOne(r.db.ExecContext(ctx, "DELETE FROM incoming_webhooks WHERE id = $1 AND room_id = $2", id, roomID))
+}
+
+// CreateOutgoing returns ErrNotFound when the room does not exist
+func (r *SQLiteWebhookRepository) CreateOutgoing(ctx context.Context, data *model.OutgoingWebhook) (*model.OutgoingWebhook, error) {
+	query := `
+        INSERT INTO outgoing_webhooks (room_id, url, secret)
+        VALUES ($1, $2, $3)
+		RETURNING id, room_id, url, secret, created_at, updated_at
+    `
+	hook, err := scanOutgoingWebhook(r.db.QueryRowContext(ctx, query, data.RoomID, data.URL, data.Secret))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return hook, nil
+}
+
+// GetOutgoingByRoomID retrieves the outgoing webhooks of the room, including their secrets
+func (r *SQLiteWebhookRepository) GetOutgoingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.OutgoingWebhook, error) {
+	query := `
+        SELECT id, room_id, url, secret, created_at, updated_at
+        FROM outgoing_webhooks
+        WHERE room_id = $1
+        ORDER BY created_at, rowid
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*model.OutgoingWebhook
+	for rows.Next() {
+		hook, err := scanOutgoingWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (r *SQLiteWebhookRepository) GetOutgoingByID(ctx context.Context, roomID, id uuid.UUID) (*model.OutgoingWebhook, error) {
+	query := `
+        SELECT id, room_id, url, secret, created_at, updated_at
+        FROM outgoing_webhooks
+        WHERE id = $1 AND room_id = $2
+    `
+	hook, err := scanOutgoingWebhook(r.db.QueryRowContext(ctx, query, id, roomID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return hook, err
+}
+
+// DeleteOutgoing deletes the webhook along with the commands it handles
+func (r *SQLiteWebhookRepository) DeleteOutgoing(ctx context.Context, roomID, id uuid.UUID) error {
+	return affectedOne(r.db.ExecContext(ctx, "DELETE FROM outgoing_webhooks WHERE id = $1 AND room_id = $2", id, roomID))
+}
+
+func scanOutgoingWebhook(row interface{ Scan(...any) error }) (*model.OutgoingWebhook, error) {
+	var hook model.OutgoingWebhook
+	if err := row.Scan(&hook.ID, &hook.RoomID, &hook.URL, &hook.Secret, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
@@ -8,32 +8,36 @@ import (
 	"github.com/mrshabel/chat/internal/model"
 )
 
-// UserRepository handles database operations for users
-type UserRepository struct {
+// PGUserRepository stores users in Postgres
+type PGUserRepository struct {
 	db *sql.DB
 }
 
-// NewUserRepository creates a new user repository
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// NewPGUserRepository creates a new postgres user repository
+func NewPGUserRepository(db *sql.DB) *PGUserRepository {
+	return &PGUserRepository{db: db}
 }
 
-func (r *UserRepository) Create(ctx context.Context, username string) (*model.User, error) {
+// Create returns ErrAlreadyExist when the username is taken
+func (r *PGUserRepository) Create(ctx context.Context, username string, kind model.UserKind) (*model.User, error) {
 	var user model.User
 	query := `
-        INSERT INTO users(username)
-        VALUES ($1)
-		RETURNING id, username, created_at, updated_at
+        INSERT INTO users(username, kind)
+        VALUES ($1, $2)
+		RETURNING id, username, kind, created_at, updated_at
     `
-	if err := r.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	if err := r.db.QueryRowContext(ctx, query, username, kind).Scan(&user.ID, &user.Username, &user.Kind, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAlreadyExist
+		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
+func (r *PGUserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
 	query := `
-		SELECT id, username, created_at, updated_at 
+		SELECT id, username, kind, created_at, updated_at 
 		FROM users 
 		WHERE username = $1
 		`
@@ -41,6 +45,7 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 	err := r.db.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
+		&user.Kind,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -53,9 +58,9 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 	return &user, nil
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+func (r *PGUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	query := `
-		SELECT id, username, created_at, updated_at 
+		SELECT id, username, kind, created_at, updated_at 
 		FROM users 
 		WHERE id = $1
 		`
@@ -63,6 +68,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 	err := r.db.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Username,
+		&user.Kind,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -74,3 +80,38 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User
 	}
 	return &user, nil
 }
+
+// Search retrieves users whose usernames start with or are similar to the query, with prefix matches ranked first
+func (r *PGUserRepository) Search(ctx context.Context, query string, limit, offset int) ([]*model.User, error) {
+	stmt := `
+		SELECT id, username, kind, created_at, updated_at
+		FROM users
+		WHERE $1 = '' OR username ILIKE $2 OR username % $1
+		ORDER BY (username ILIKE $2) DESC, similarity(username, $1) DESC, username
+		LIMIT $3 OFFSET $4
+		`
+	rows, err := r.db.QueryContext(ctx, stmt, query, prefixPattern(query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Kind,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+type PGWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewPGWebhookRepository(db *sql.DB) *PGWebhookRepository {
+	return &PGWebhookRepository{db: db}
+}
+
+// CreateIncoming returns ErrNotFound when the room does not exist
+func (r *PGWebhookRepository) CreateIncoming(ctx context.Context, data *model.IncomingWebhook) (*model.IncomingWebhook, error) {
+	query := `
+        INSERT INTO incoming_webhooks (room_id, name, token_hash)
+        VALUES ($1, $2, $3)
+		RETURNING id, room_id, name, token_hash, created_at, updated_at
+    `
+	var hook model.IncomingWebhook
+	if err := r.db.QueryRowContext(ctx, query, data.RoomID, data.Name, data.TokenHash).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.Name,
+		&hook.TokenHash,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (r *PGWebhookRepository) GetIncomingByID(ctx context.Context, id uuid.UUID) (*model.IncomingWebhook, error) {
+	query := `
+        SELECT id, room_id, name, token_hash, created_at, updated_at
+        FROM incoming_webhooks
+        WHERE id = $1
+    `
+	var hook model.IncomingWebhook
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.Name,
+		&hook.TokenHash,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &hook, err
+}
+
+func (r *PGWebhookRepository) GetIncomingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.IncomingWebhook, error) {
+	query := `
+        SELECT id, room_id, name, created_at, updated_at
+        FROM incoming_webhooks
+        WHERE room_id = $1
+        ORDER BY created_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*model.IncomingWebhook
+	for rows.Next() {
+		var hook model.IncomingWebhook
+		if err := rows.Scan(
+			&hook.ID,
+			&hook.RoomID,
+			&hook.Name,
+			&hook.CreatedAt,
+			&hook.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (r *PGWebhookRepository) DeleteIncoming(ctx context.Context, roomID, id uuid.UUID) error {
+	return r.delete(ctx, "DELETE FROM incoming_webhooks WHERE id = $1 AND room_id = $2", id, roomID)
+}
+
+// CreateOutgoing returns ErrNotFound when the room does not exist
+func (r *PGWebhookRepository) CreateOutgoing(ctx context.Context, data *model.OutgoingWebhook) (*model.OutgoingWebhook, error) {
+	query := `
+        INSERT INTO outgoing_webhooks (room_id, url, secret)
+        VALUES ($1, $2, $3)
+		RETURNING id, room_id, url, secret, created_at, updated_at
+    `
+	var hook model.OutgoingWebhook
+	if err := r.db.QueryRowContext(ctx, query, data.RoomID, data.URL, data.Secret).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.URL,
+		&hook.Secret,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// GetOutgoingByRoomID retrieves the outgoing webhooks of the room, including their secrets
+func (r *PGWebhookRepository) GetOutgoingByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.OutgoingWebhook, error) {
+	query := `
+        SELECT id, room_id, url, secret, created_at, updated_at
+        FROM outgoing_webhooks
+        WHERE room_id = $1
+        ORDER BY created_at
+    `
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*model.OutgoingWebhook
+	for rows.Next() {
+		var hook model.OutgoingWebhook
+		if err := rows.Scan(
+			&hook.ID,
+			&hook.RoomID,
+			&hook.URL,
+			&hook.Secret,
+			&hook.CreatedAt,
+			&hook.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &hook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (r *PGWebhookRepository) GetOutgoingByID(ctx context.Context, roomID, id uuid.UUID) (*model.OutgoingWebhook, error) {
+	query := `
+        SELECT id, room_id, url, secret, created_at, updated_at
+        FROM outgoing_webhooks
+        WHERE id = $1 AND room_id = $2
+    `
+	var hook model.OutgoingWebhook
+	err := r.db.QueryRowContext(ctx, query, id, roomID).Scan(
+		&hook.ID,
+		&hook.RoomID,
+		&hook.URL,
+		&hook.Secret,
+		&hook.CreatedAt,
+		&hook.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &hook, err
+}
+
+func (r *PGWebhookRepository) DeleteOutgoing(ctx context.Context, roomID, id uuid.UUID) error {
+	return r.delete(ctx, "DELETE FROM outgoing_webhooks WHERE id = $1 AND room_id = $2", id, roomID)
+}
+
+func (r *PGWebhookRepository) delete(ctx context.Context, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
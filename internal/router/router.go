@@ -1,28 +1,52 @@
 package router
 
 import (
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/mrshabel/chat/internal/handler"
+	"github.com/mrshabel/chat/internal/logging"
 	"github.com/mrshabel/chat/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// register all the handlers with their appropriate routes
-func RegisterRoutes(roomHandler *handler.RoomHandler, userHandler *handler.UserHandler) http.Handler {
+const (
+	// header carrying the id of a request
+	requestIDHeader = "X-Request-ID"
+	// longest request id accepted from clients
+	maxRequestIDLength = 128
+)
+
+// register all the handlers with their appropriate routes. Request durations are recorded in the registry, which is
+// served on /metrics. Requests are rate limited per client ip, as forwarded by the trusted proxies
+func RegisterRoutes(roomHandler *handler.RoomHandler, userHandler *handler.UserHandler, webhookHandler *handler.WebhookHandler, botHandler *handler.BotHandler, commandHandler *handler.CommandHandler, sanctionHandler *handler.SanctionHandler, filterHandler *handler.FilterHandler, reportHandler *handler.ReportHandler, auditHandler *handler.AuditHandler, limiter *util.RateLimiter, trustedProxies []netip.Prefix, metrics *prometheus.Registry) http.Handler {
 	router := mux.NewRouter()
 
 	// health check
 	router.HandleFunc("/health", healthCheck)
 
+	// record the duration of every matched request
+	router.Use(instrument)
+
+	// prometheus metrics
+	metrics.MustRegister(httpRequestDuration)
+	router.Handle("/metrics", promhttp.HandlerFor(metrics, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+
 	// websocket
-	router.HandleFunc("/ws/{userId}", roomHandler.JoinRoom).Methods(http.MethodGet)
+	router.Handle("/ws/{userId}", rateLimit(limiter, trustedProxies)(http.HandlerFunc(roomHandler.JoinRoom))).Methods(http.MethodGet)
 
 	api := router.PathPrefix("/api").Subrouter()
+	api.Use(rateLimit(limiter, trustedProxies))
 
 	// users
 	users := api.PathPrefix("/users").Subrouter()
 	users.HandleFunc("", userHandler.CreateUser).Methods(http.MethodPost)
+	users.HandleFunc("", userHandler.SearchUsers).Methods(http.MethodGet)
 	users.HandleFunc("/{id}", userHandler.GetByUserByID).Methods(http.MethodGet)
 
 	// rooms
@@ -34,17 +58,74 @@ func RegisterRoutes(roomHandler *handler.RoomHandler, userHandler *handler.UserH
 	rooms.HandleFunc("/{id}/members", roomHandler.GetMembers).Methods(http.MethodGet)
 	rooms.HandleFunc("/{id}/members/active", roomHandler.GetActiveRoomMembers).Methods(http.MethodGet)
 	rooms.HandleFunc("/{id}/messages", roomHandler.GetAllRoomMessages).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/messages", roomHandler.SendRoomMessage).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/messages/{messageId}/reactions", roomHandler.AddReaction).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/messages/{messageId}/reactions", roomHandler.GetReactions).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/events", roomHandler.StreamRoomEvents).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/slow-mode", roomHandler.SetSlowMode).Methods(http.MethodPut)
+	rooms.HandleFunc("/{id}/commands", commandHandler.GetCommands).Methods(http.MethodGet)
+
+	// room moderation
+	rooms.HandleFunc("/{id}/sanctions", sanctionHandler.CreateSanction).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/sanctions", sanctionHandler.GetSanctions).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/sanctions/{sanctionId}", sanctionHandler.RevokeSanction).Methods(http.MethodDelete)
+	rooms.HandleFunc("/{id}/filters", filterHandler.GetFilters).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/filters", filterHandler.UpdateFilters).Methods(http.MethodPut)
+	rooms.HandleFunc("/{id}/flagged", filterHandler.GetFlaggedMessages).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/flagged/{flaggedId}", filterHandler.ReviewFlaggedMessage).Methods(http.MethodPut)
+	rooms.HandleFunc("/{id}/reports", reportHandler.GetReports).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/reports/{reportId}", reportHandler.ResolveReport).Methods(http.MethodPut)
+	rooms.HandleFunc("/{id}/audit", auditHandler.GetRoomAudit).Methods(http.MethodGet)
+
+	// global audit log, authenticated by the operator token
+	api.HandleFunc("/audit", auditHandler.GetAudit).Methods(http.MethodGet)
+
+	// messages
+	messages := api.PathPrefix("/messages").Subrouter()
+	messages.HandleFunc("/{id}/report", reportHandler.CreateReport).Methods(http.MethodPost)
 
-	// finally apply cors middleware on the router. this should be the last action performed on the router instance
-	return setupCors(router)
+	// room webhooks
+	rooms.HandleFunc("/{id}/webhooks/incoming", webhookHandler.CreateIncoming).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/webhooks/incoming", webhookHandler.GetIncoming).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/webhooks/incoming/{webhookId}", webhookHandler.DeleteIncoming).Methods(http.MethodDelete)
+	rooms.HandleFunc("/{id}/webhooks/outgoing", webhookHandler.CreateOutgoing).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/webhooks/outgoing", webhookHandler.GetOutgoing).Methods(http.MethodGet)
+	rooms.HandleFunc("/{id}/webhooks/outgoing/{webhookId}", webhookHandler.DeleteOutgoing).Methods(http.MethodDelete)
+	rooms.HandleFunc("/{id}/webhooks/outgoing/{webhookId}/commands", commandHandler.CreateWebhookCommand).Methods(http.MethodPost)
+	rooms.HandleFunc("/{id}/webhooks/outgoing/{webhookId}/commands/{name}", commandHandler.DeleteWebhookCommand).Methods(http.MethodDelete)
+
+	// bot accounts and their api keys
+	bots := api.PathPrefix("/bots").Subrouter()
+	bots.HandleFunc("", botHandler.CreateBot).Methods(http.MethodPost)
+	bots.HandleFunc("/{id}/keys", botHandler.CreateKey).Methods(http.MethodPost)
+	bots.HandleFunc("/{id}/keys", botHandler.GetKeys).Methods(http.MethodGet)
+	bots.HandleFunc("/{id}/keys/{keyId}", botHandler.DeleteKey).Methods(http.MethodDelete)
+
+	// bot api, authenticated by api key
+	bot := api.PathPrefix("/bot").Subrouter()
+	bot.HandleFunc("/ws", botHandler.JoinRoom).Methods(http.MethodGet)
+	bot.HandleFunc("/rooms/{id}/events", botHandler.StreamRoomEvents).Methods(http.MethodGet)
+	bot.HandleFunc("/rooms/{id}/messages", botHandler.SendMessage).Methods(http.MethodPost)
+	bot.HandleFunc("/rooms/{id}/messages/{messageId}/reactions", botHandler.AddReaction).Methods(http.MethodPost)
+	bot.HandleFunc("/rooms/{id}/ephemeral", botHandler.SendEphemeral).Methods(http.MethodPost)
+	bot.HandleFunc("/rooms/{id}/commands", commandHandler.CreateBotCommand).Methods(http.MethodPost)
+	bot.HandleFunc("/rooms/{id}/commands/{name}", commandHandler.DeleteBotCommand).Methods(http.MethodDelete)
+
+	// incoming webhook deliveries, authenticated by the token in the url
+	api.HandleFunc("/hooks/{id}/{token}", webhookHandler.PostMessage).Methods(http.MethodPost)
+
+	// finally apply cors middleware on the router, tagging every request with an id first. this should be the last
+	// action performed on the router instance
+	return setupCors(requestID(router))
 }
 
 func setupCors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-API-KEY, X-CSRF-Token")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-API-KEY, X-CSRF-Token, X-Operator-Token, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "300")
 
@@ -59,6 +140,83 @@ func setupCors(next http.Handler) http.Handler {
 	})
 }
 
+// requestID tags the request with the id sent by the client in the X-Request-ID header, or a new one, and returns it
+// in the response. Records logged while serving the request carry the id
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether a client supplied id is short and made of characters safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// rateLimit limits the requests of each client ip address, responding with too many requests once the limit is hit
+func rateLimit(limiter *util.RateLimiter, trustedProxies []netip.Prefix) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := limiter.Allow(clientIP(r, trustedProxies)); !ok {
+				util.WriteRateLimited(w, "Too many requests", retryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the ip address of the client that sent the request. Requests from trusted proxies are attributed to
+// the address they forwarded them for, walking the X-Forwarded-For header from the closest hop until an address that is
+// not a trusted proxy. Earlier entries may be forged by the client and are never used
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && trusted(ip, trustedProxies); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop
+	}
+	return ip.Unmap().String()
+}
+
+// trusted reports whether the address belongs to a trusted proxy
+func trusted(ip netip.Addr, trustedProxies []netip.Prefix) bool {
+	ip = ip.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	util.WriteJSON(w, "OK", 200)
 }
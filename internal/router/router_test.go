@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/mrshabel/chat/internal/util"
+)
+
+var testProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.10/32")}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted peer", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:4000", []string{"198.51.100.1, 192.168.1.10"}, "198.51.100.1"},
+		{"forged hops", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"several headers", "10.1.2.3:4000", []string{"1.1.1.1", "198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"malformed hop", "10.1.2.3:4000", []string{"198.51.100.1, bogus"}, "10.1.2.3"},
+		{"no header", "10.1.2.3:4000", nil, "10.1.2.3"},
+		{"only proxies", "10.1.2.3:4000", []string{"10.4.4.4"}, "10.4.4.4"},
+		{"ipv6", "[2001:db8::1]:4000", []string{"198.51.100.1"}, "2001:db8::1"},
+		{"mapped ipv4", "[::ffff:10.1.2.3]:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := clientIP(r, testProxies); got != tt.want {
+				t.Fatalf("client ip is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRateLimitPerForwardedClient checks that clients behind a trusted proxy are limited separately, and that
+// clients cannot escape their limit by forging the header
+func TestRateLimitPerForwardedClient(t *testing.T) {
+	handler := rateLimit(util.NewRateLimiter(1, 1), testProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func(remoteAddr, forwarded string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := call("10.1.2.3:4000", client); code != http.StatusOK {
+			t.Fatalf("first request of %s returned %d", client, code)
+		}
+	}
+	if code := call("10.1.2.3:4000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request of the same client returned %d", code)
+	}
+
+	if code := call("203.0.113.7:4000", "198.51.100.3"); code != http.StatusOK {
+		t.Fatalf("first direct request returned %d", code)
+	}
+	if code := call("203.0.113.7:4000", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Fatalf("direct request with a forged header returned %d", code)
+	}
+}
@@ -0,0 +1,90 @@
+// Package server wires the repositories, services, hub and handlers into the chat server
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/handler"
+	"github.com/mrshabel/chat/internal/repository"
+	"github.com/mrshabel/chat/internal/router"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/service/ws"
+	"github.com/mrshabel/chat/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Server is the http handler of the chat server along with the hub serving its websockets
+type Server struct {
+	Handler http.Handler
+	Hub     *ws.Hub
+	// registry served on /metrics, which other collectors such as the db pool stats can be added to
+	Metrics *prometheus.Registry
+}
+
+// New creates the services over the repositories, starts the broker, the background workers and the hub, and
+// registers all routes. The broker, workers and hub stop when the context is done. Every server has its own metrics
+// registry, so several servers can run in one process
+func New(ctx context.Context, cfg *config.Config, repos *repository.Repositories, broker ws.Broker) (*Server, error) {
+	// initialize services
+	auditService := service.NewAuditService(repos.Audit, repos.Rooms)
+	userService := service.NewUserService(repos.Users, auditService)
+	roomService := service.NewRoomService(repos.Rooms, auditService)
+	messageService := service.NewMessageService(repos.Messages, auditService)
+	webhookService := service.NewWebhookService(repos.Webhooks, repos.Rooms)
+	botService := service.NewBotService(repos.Bots, repos.Users, repos.Rooms)
+	reactionService := service.NewReactionService(repos.Reactions)
+	commandService := service.NewCommandService(repos.Commands)
+	sanctionService := service.NewSanctionService(repos.Sanctions, repos.Rooms, auditService)
+	filterService := service.NewFilterService(repos.Filters, repos.Rooms, auditService)
+	reportService := service.NewReportService(repos.Reports, repos.Rooms, repos.Messages, sanctionService, auditService)
+
+	// relay hub events between server instances
+	if err := broker.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	// persist client messages in batches
+	messageWriter := service.NewMessageWriter(messageService, cfg.MessageBatchSize, time.Duration(cfg.MessageBatchWindowMs)*time.Millisecond)
+	messageWriter.Start(ctx)
+
+	// deliver new messages to outgoing webhooks
+	webhookDispatcher := service.NewWebhookDispatcher(webhookService, cfg.WebhookMaxAttempts, time.Duration(cfg.WebhookRetryDelayMs)*time.Millisecond)
+	webhookDispatcher.Start(ctx)
+
+	// start ws hub
+	hub := ws.NewHub(roomService, messageService, messageWriter, webhookDispatcher, broker, ws.ClientOptions{
+		QueueSize:    cfg.ClientQueueSize,
+		Overflow:     ws.OverflowPolicy(cfg.ClientOverflow),
+		MaxOverflows: cfg.ClientMaxOverflows,
+	})
+	hub.Commands = ws.NewCommandRegistry(hub, roomService, userService, commandService, sanctionService, webhookDispatcher)
+	hub.Limiter = ws.NewMessageLimiter(roomService, cfg.MessageRateLimit, cfg.MessageRateBurst, cfg.RoomMessageRateLimit, cfg.RoomMessageRateBurst)
+	hub.Filters = filterService
+	go hub.Run(ctx)
+
+	// metrics of the server along with the go runtime and process stats
+	metrics := prometheus.NewRegistry()
+	metrics.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}), ws.NewHubCollector(hub))
+	metrics.MustRegister(messageService.Collectors()...)
+
+	// create handlers
+	roomHandler := handler.NewRoomHandler(hub, roomService, userService, messageService, reactionService, sanctionService)
+	userHandler := handler.NewUserHandler(userService)
+	webhookHandler := handler.NewWebhookHandler(hub, webhookService, roomService, messageService)
+	botHandler := handler.NewBotHandler(hub, botService, messageService, reactionService, sanctionService)
+	commandHandler := handler.NewCommandHandler(hub, commandService, webhookService, botService)
+	sanctionHandler := handler.NewSanctionHandler(hub, sanctionService)
+	filterHandler := handler.NewFilterHandler(hub, filterService)
+	reportHandler := handler.NewReportHandler(hub, reportService)
+	auditHandler := handler.NewAuditHandler(auditService, cfg.OperatorToken)
+
+	// register all routes
+	r := router.RegisterRoutes(roomHandler, userHandler, webhookHandler, botHandler, commandHandler, sanctionHandler, filterHandler, reportHandler, auditHandler,
+		util.NewRateLimiter(cfg.HTTPRateLimit, cfg.HTTPRateBurst), cfg.TrustedProxies, metrics)
+
+	return &Server{Handler: r, Hub: hub, Metrics: metrics}, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// AuditService records mutating operations in the audit log and serves it to room admins and operators
+type AuditService struct {
+	repo     repository.AuditRepository
+	roomRepo repository.RoomRepository
+}
+
+func NewAuditService(repo repository.AuditRepository, roomRepo repository.RoomRepository) *AuditService {
+	return &AuditService{repo: repo, roomRepo: roomRepo}
+}
+
+// Record writes an audit event of an operation performed by the actor, along with the state of its target before and
+// after it. Nil ids and states are stored as null. The operation was already performed, so failures are logged rather
+// than returned. A nil service records nothing
+func (s *AuditService) Record(ctx context.Context, action model.AuditAction, actorID, roomID, targetID uuid.UUID, before, after any) {
+	if s == nil {
+		return
+	}
+	event := &model.AuditEvent{
+		ActorID:  uuidPtr(actorID),
+		RoomID:   uuidPtr(roomID),
+		Action:   action,
+		TargetID: targetID,
+		Before:   auditState(before),
+		After:    auditState(after),
+	}
+	// the operation is recorded even when its request was cancelled in the meantime
+	if err := s.repo.Create(context.WithoutCancel(ctx), event); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event", "action", action, "target_id", targetID, "actor_id", actorID, "error", err)
+	}
+}
+
+// GetByRoomID retrieves the audit events of the room matching the query, newest first, on behalf of a room admin
+func (s *AuditService) GetByRoomID(ctx context.Context, roomID, actorID uuid.UUID, q *model.AuditQuery, limit, offset int) ([]*model.AuditEvent, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	q.RoomID = &roomID
+	return s.repo.Query(ctx, q, limit, offset)
+}
+
+// GetAll retrieves the audit events of all rooms and users matching the query, newest first
+func (s *AuditService) GetAll(ctx context.Context, q *model.AuditQuery, limit, offset int) ([]*model.AuditEvent, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.Query(ctx, q, limit, offset)
+}
+
+// auditState encodes the state of an audit target, mapping nil values to null
+func auditState(state any) json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+func uuidPtr(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrBotNotFound    = errors.New("bot not found")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// BotService manages bot accounts and their api keys. A key is managed by the admins of all the rooms it is scoped to
+type BotService struct {
+	repo     repository.BotRepository
+	userRepo repository.UserRepository
+	roomRepo repository.RoomRepository
+}
+
+func NewBotService(repo repository.BotRepository, userRepo repository.UserRepository, roomRepo repository.RoomRepository) *BotService {
+	return &BotService{repo: repo, userRepo: userRepo, roomRepo: roomRepo}
+}
+
+// Create creates a bot account
+func (s *BotService) Create(ctx context.Context, req *model.CreateUserReq) (*model.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByUsername(ctx, req.Username); err == nil {
+		return nil, ErrUserAlreadyExist
+	}
+	return s.userRepo.Create(ctx, req.Username, model.UserKindBot)
+}
+
+// CreateKey creates an api key for the bot scoped to the given rooms, on behalf of an admin of all of them. The returned
+// key carries its secret, which is not retrievable afterwards. ErrRoomNotFound is returned when a room does not exist
+func (s *BotService) CreateKey(ctx context.Context, botID uuid.UUID, req *model.CreateAPIKeyReq) (*model.APIKey, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.getBot(ctx, botID); err != nil {
+		return nil, err
+	}
+	for _, roomID := range req.RoomIDs {
+		if _, err := s.roomRepo.GetByID(ctx, roomID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				err = ErrRoomNotFound
+			}
+			return nil, err
+		}
+	}
+	if err := s.verifyKeyAdmin(ctx, req.RoomIDs, req.ActorID); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(secret))
+
+	key, err := s.repo.CreateKey(ctx, &model.APIKey{BotID: botID, RoomIDs: req.RoomIDs, KeyHash: hash[:]})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrRoomNotFound
+		}
+		return nil, err
+	}
+	key.Key = secret
+	return key, nil
+}
+
+// Authenticate retrieves the api key matching the secret along with its bot
+func (s *BotService) Authenticate(ctx context.Context, secret string) (*model.APIKey, error) {
+	hash := sha256.Sum256([]byte(secret))
+	key, err := s.repo.GetKeyByHash(ctx, hash[:])
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetKeys retrieves the keys of the bot that the actor manages, being an admin of all their rooms
+func (s *BotService) GetKeys(ctx context.Context, botID, actorID uuid.UUID) ([]*model.APIKey, error) {
+	if _, err := s.getBot(ctx, botID); err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.GetKeysByBotID(ctx, botID)
+	if err != nil {
+		return nil, err
+	}
+	managed := make([]*model.APIKey, 0, len(keys))
+	for _, key := range keys {
+		err := s.verifyKeyAdmin(ctx, key.RoomIDs, actorID)
+		if errors.Is(err, ErrNotRoomAdmin) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		managed = append(managed, key)
+	}
+	return managed, nil
+}
+
+// DeleteKey revokes the key of the bot on behalf of an admin of all the rooms it is scoped to
+func (s *BotService) DeleteKey(ctx context.Context, botID, id, actorID uuid.UUID) error {
+	keys, err := s.repo.GetKeysByBotID(ctx, botID)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(keys, func(key *model.APIKey) bool { return key.ID == id })
+	if i == -1 {
+		return ErrAPIKeyNotFound
+	}
+	if err := s.verifyKeyAdmin(ctx, keys[i].RoomIDs, actorID); err != nil {
+		return err
+	}
+
+	err = s.repo.DeleteKey(ctx, botID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+// verifyKeyAdmin fails with ErrNotRoomAdmin unless the user is an admin of all the rooms
+func (s *BotService) verifyKeyAdmin(ctx context.Context, roomIDs []uuid.UUID, userID uuid.UUID) error {
+	for _, roomID := range roomIDs {
+		if err := verifyAdmin(ctx, s.roomRepo, roomID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getBot retrieves the user, failing with ErrBotNotFound when it is not a bot
+func (s *BotService) getBot(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrBotNotFound
+		}
+		return nil, err
+	}
+	if !user.IsBot() {
+		return nil, ErrBotNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrCommandNotFound     = errors.New("command not found")
+	ErrCommandAlreadyExist = errors.New("command already exist")
+)
+
+// CommandService manages the custom slash commands of rooms
+type CommandService struct {
+	repo repository.CommandRepository
+}
+
+func NewCommandService(repo repository.CommandRepository) *CommandService {
+	return &CommandService{repo: repo}
+}
+
+// CreateForBot registers a command of the room handled by the bot
+func (s *CommandService) CreateForBot(ctx context.Context, roomID, botID uuid.UUID, req *model.CreateCommandReq) (*model.RoomCommand, error) {
+	return s.create(ctx, &model.RoomCommand{RoomID: roomID, BotID: &botID}, req)
+}
+
+// CreateForWebhook registers a command of the room handled by the outgoing webhook
+func (s *CommandService) CreateForWebhook(ctx context.Context, roomID, webhookID uuid.UUID, req *model.CreateCommandReq) (*model.RoomCommand, error) {
+	return s.create(ctx, &model.RoomCommand{RoomID: roomID, WebhookID: &webhookID}, req)
+}
+
+func (s *CommandService) create(ctx context.Context, command *model.RoomCommand, req *model.CreateCommandReq) (*model.RoomCommand, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	command.Name, command.Description = req.Name, req.Description
+
+	command, err := s.repo.Create(ctx, command)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAlreadyExist):
+			err = ErrCommandAlreadyExist
+		case errors.Is(err, repository.ErrNotFound):
+			err = ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return command, nil
+}
+
+// GetByName retrieves the command of the room along with its webhook, if any
+func (s *CommandService) GetByName(ctx context.Context, roomID uuid.UUID, name string) (*model.RoomCommand, error) {
+	command, err := s.repo.GetByName(ctx, roomID, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrCommandNotFound
+		}
+		return nil, err
+	}
+	return command, nil
+}
+
+func (s *CommandService) GetByRoomID(ctx context.Context, roomID uuid.UUID) ([]*model.RoomCommand, error) {
+	return s.repo.GetByRoomID(ctx, roomID)
+}
+
+// DeleteForBot removes a command of the room registered by the bot
+func (s *CommandService) DeleteForBot(ctx context.Context, roomID, botID uuid.UUID, name string) error {
+	return s.delete(ctx, roomID, name, func(command *model.RoomCommand) bool {
+		return command.BotID != nil && *command.BotID == botID
+	})
+}
+
+// DeleteForWebhook removes a command of the room registered for the outgoing webhook
+func (s *CommandService) DeleteForWebhook(ctx context.Context, roomID, webhookID uuid.UUID, name string) error {
+	return s.delete(ctx, roomID, name, func(command *model.RoomCommand) bool {
+		return command.WebhookID != nil && *command.WebhookID == webhookID
+	})
+}
+
+// delete removes the command when it belongs to the caller, as decided by owns
+func (s *CommandService) delete(ctx context.Context, roomID uuid.UUID, name string, owns func(*model.RoomCommand) bool) error {
+	command, err := s.GetByName(ctx, roomID, name)
+	if err != nil {
+		return err
+	}
+	if !owns(command) {
+		return ErrCommandNotFound
+	}
+	err = s.repo.Delete(ctx, command.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrCommandNotFound
+	}
+	return err
+}
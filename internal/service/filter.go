@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrFlaggedMessageNotFound = errors.New("flagged message not found")
+)
+
+// FilterService runs messages through the content filters of their room and keeps the queue of flagged messages
+type FilterService struct {
+	repo     repository.FilterRepository
+	roomRepo repository.RoomRepository
+	audit    *AuditService
+	filters  []MessageFilter
+
+	mu sync.Mutex
+	// settings of rooms, loaded on first use
+	settings map[uuid.UUID]*FilterSettings
+	// bumped whenever the settings of a room, or of all rooms, are invalidated, so that settings loaded before are
+	// not cached
+	generations map[uuid.UUID]uint64
+	generation  uint64
+}
+
+// NewFilterService creates a service running the built-in word, link and spam filters, in that order
+func NewFilterService(repo repository.FilterRepository, roomRepo repository.RoomRepository, audit *AuditService) *FilterService {
+	return &FilterService{
+		repo:        repo,
+		roomRepo:    roomRepo,
+		audit:       audit,
+		filters:     []MessageFilter{WordFilter{}, LinkFilter{}, NewRepeatFilter(), CapsFilter{}},
+		settings:    make(map[uuid.UUID]*FilterSettings),
+		generations: make(map[uuid.UUID]uint64),
+	}
+}
+
+// Register appends a filter to the chain. It must be called before any message is filtered
+func (s *FilterService) Register(filter MessageFilter) {
+	s.filters = append(s.filters, filter)
+}
+
+// Apply runs the message through the filters of its room before it is persisted, masking its content in place. The
+// chain stops at the first filter rejecting the message, while flagged messages are queued for review instead of
+// being sent. A nil service lets every message through
+func (s *FilterService) Apply(ctx context.Context, message *model.Message) (*model.FilterVerdict, error) {
+	verdict := &model.FilterVerdict{Action: model.FilterAllow}
+	if s == nil {
+		return verdict, nil
+	}
+
+	settings := s.load(ctx, message.RoomID)
+	for _, filter := range s.filters {
+		action, reason := filter.Apply(message, settings)
+		switch action {
+		case model.FilterReject:
+			return &model.FilterVerdict{Action: model.FilterReject, Reasons: []string{reason}}, nil
+		case model.FilterFlag:
+			verdict.Action = model.FilterFlag
+			verdict.Reasons = append(verdict.Reasons, reason)
+		}
+	}
+	if verdict.Action != model.FilterFlag {
+		return verdict, nil
+	}
+
+	flagged, err := s.repo.CreateFlagged(ctx, &model.FlaggedMessage{
+		RoomID:         message.RoomID,
+		SenderID:       message.SenderID,
+		SenderUsername: message.SenderUsername,
+		Content:        message.Content,
+		Reasons:        verdict.Reasons,
+	})
+	if err != nil {
+		return nil, err
+	}
+	verdict.Flagged = flagged
+	return verdict, nil
+}
+
+// load returns the filter settings of the room, loading them on first use. Rooms whose settings cannot be loaded are
+// not filtered
+func (s *FilterService) load(ctx context.Context, roomID uuid.UUID) *FilterSettings {
+	s.mu.Lock()
+	settings, ok := s.settings[roomID]
+	generation, roomGeneration := s.generation, s.generations[roomID]
+	s.mu.Unlock()
+	if ok {
+		return settings
+	}
+
+	filter, err := s.repo.GetByRoomID(ctx, roomID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.ErrorContext(ctx, "failed to load filters of room", "room_id", roomID, "error", err)
+			return newFilterSettings(model.DefaultRoomFilter(roomID))
+		}
+		filter = model.DefaultRoomFilter(roomID)
+	}
+	settings = newFilterSettings(filter)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// settings invalidated while they were loading may be stale, so they are only used for this message
+	if generation != s.generation || roomGeneration != s.generations[roomID] {
+		return settings
+	}
+	// another message may have loaded them in the meantime
+	if current, ok := s.settings[roomID]; ok {
+		return current
+	}
+	s.settings[roomID] = settings
+	return settings
+}
+
+// Invalidate forgets the filter settings of the room so that they are loaded again on next use
+func (s *FilterService) Invalidate(roomID uuid.UUID) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.settings, roomID)
+	s.generations[roomID]++
+}
+
+// InvalidateAll forgets the filter settings of all rooms, such as when updates may have been missed
+func (s *FilterService) InvalidateAll() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.settings)
+	s.generation++
+}
+
+// GetSettings retrieves the filter settings of the room on behalf of a room admin
+func (s *FilterService) GetSettings(ctx context.Context, roomID, actorID uuid.UUID) (*model.RoomFilter, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	filter, err := s.repo.GetByRoomID(ctx, roomID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return model.DefaultRoomFilter(roomID), nil
+	}
+	return filter, err
+}
+
+// UpdateSettings replaces the filter settings of the room on behalf of a room admin
+func (s *FilterService) UpdateSettings(ctx context.Context, roomID uuid.UUID, req *model.UpdateRoomFilterReq) (*model.RoomFilter, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	previous, err := s.GetSettings(ctx, roomID, req.ActorID)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := s.repo.Upsert(ctx, &model.RoomFilter{
+		RoomID:         roomID,
+		BlockedWords:   req.BlockedWords,
+		WordAction:     req.WordAction,
+		AllowedDomains: req.AllowedDomains,
+		LinkAction:     req.LinkAction,
+		SpamAction:     req.SpamAction,
+		UpdatedBy:      &req.ActorID,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrRoomNotFound
+		}
+		return nil, err
+	}
+	s.Invalidate(roomID)
+	s.audit.Record(ctx, model.AuditFiltersUpdate, req.ActorID, roomID, roomID, previous, filter)
+	return filter, nil
+}
+
+// GetFlagged retrieves the flagged messages of the room, oldest first, on behalf of a room admin. All messages are
+// returned when the status is empty
+func (s *FilterService) GetFlagged(ctx context.Context, roomID, actorID uuid.UUID, status model.FlaggedStatus, limit, offset int) ([]*model.FlaggedMessage, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetFlaggedByRoomID(ctx, roomID, status, limit, offset)
+}
+
+// Review approves or rejects the pending flagged message on behalf of a room admin. Approved messages are sent to the
+// room and returned along with the flagged message
+func (s *FilterService) Review(ctx context.Context, roomID, id uuid.UUID, req *model.ReviewFlaggedReq) (*model.FlaggedMessage, *model.Message, error) {
+	if err := req.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, req.ActorID); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		flagged *model.FlaggedMessage
+		message *model.Message
+		err     error
+	)
+	if req.Status == model.FlaggedApproved {
+		flagged, message, err = s.repo.Approve(ctx, roomID, id, req.ActorID)
+	} else {
+		flagged, err = s.repo.Reject(ctx, roomID, id, req.ActorID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrFlaggedMessageNotFound
+		}
+		return nil, nil, err
+	}
+	s.audit.Record(ctx, model.AuditFlaggedReview, req.ActorID, roomID, flagged.ID, nil, flagged)
+	return flagged, message, nil
+}
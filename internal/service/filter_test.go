@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// pausedFilters holds the first settings it loads back until resumed, as a slow database would
+type pausedFilters struct {
+	repository.FilterRepository
+	once    sync.Once
+	loaded  chan struct{}
+	resumed chan struct{}
+}
+
+func (r *pausedFilters) GetByRoomID(ctx context.Context, roomID uuid.UUID) (*model.RoomFilter, error) {
+	filter, err := r.FilterRepository.GetByRoomID(ctx, roomID)
+	r.once.Do(func() {
+		close(r.loaded)
+		<-r.resumed
+	})
+	return filter, err
+}
+
+// TestFilterSettingsInvalidatedWhileLoading checks that settings loaded before the room's filters are updated are not
+// kept once the update is done, whether the room's settings or those of all rooms are invalidated
+func TestFilterSettingsInvalidatedWhileLoading(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		invalidate func(s *FilterService, roomID uuid.UUID)
+	}{
+		{"room", (*FilterService).Invalidate},
+		{"all rooms", func(s *FilterService, _ uuid.UUID) { s.InvalidateAll() }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := repository.NewMemoryRepositories()
+			admin, err := repos.Users.Create(ctx, "admin", model.UserKindHuman)
+			if err != nil {
+				t.Fatal(err)
+			}
+			room, err := repos.Rooms.Create(ctx, &model.Room{Name: "room", CreatorID: admin.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter := model.DefaultRoomFilter(room.ID)
+			filter.BlockedWords, filter.WordAction = []string{"darn"}, model.FilterReject
+			if _, err := repos.Filters.Upsert(ctx, filter); err != nil {
+				t.Fatal(err)
+			}
+
+			filters := &pausedFilters{FilterRepository: repos.Filters, loaded: make(chan struct{}), resumed: make(chan struct{})}
+			s := NewFilterService(filters, repos.Rooms, NewAuditService(repos.Audit, repos.Rooms))
+			apply := func() model.FilterAction {
+				verdict, err := s.Apply(ctx, &model.Message{RoomID: room.ID, SenderID: admin.ID, Content: "darn"})
+				if err != nil {
+					t.Error(err)
+					return ""
+				}
+				return verdict.Action
+			}
+
+			// the first message loads the settings blocking the word, which are lifted before they are cached
+			first := make(chan model.FilterAction, 1)
+			go func() { first <- apply() }()
+			<-filters.loaded
+			if _, err := repos.Filters.Upsert(ctx, model.DefaultRoomFilter(room.ID)); err != nil {
+				t.Fatal(err)
+			}
+			tt.invalidate(s, room.ID)
+			close(filters.resumed)
+
+			if action := <-first; action != model.FilterReject {
+				t.Fatalf("message filtered while loading with %s, want %s", action, model.FilterReject)
+			}
+			if action := apply(); action != model.FilterAllow {
+				t.Fatalf("message filtered after the update with %s, want %s", action, model.FilterAllow)
+			}
+		})
+	}
+}
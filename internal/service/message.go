@@ -2,22 +2,100 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mrshabel/chat/internal/model"
 	"github.com/mrshabel/chat/internal/repository"
 )
 
+// errors
+var (
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+const (
+	// attempts made to persist a message when the db fails transiently
+	maxCreateAttempts = 4
+	// delay before the first retry, doubled on every subsequent one
+	createRetryDelay = 100 * time.Millisecond
+)
+
 type MessageService struct {
-	repo *repository.MessageRepository
+	repo    repository.MessageRepository
+	audit   *AuditService
+	metrics *messageMetrics
 }
 
-func NewMessageService(repo *repository.MessageRepository) *MessageService {
-	return &MessageService{repo: repo}
+func NewMessageService(repo repository.MessageRepository, audit *AuditService) *MessageService {
+	return &MessageService{repo: repo, audit: audit, metrics: newMessageMetrics()}
 }
 
+// Create persists the message, retrying with backoff on transient db errors. The message is given its id and
+// timestamps up front so that retries never store it twice
 func (s *MessageService) Create(ctx context.Context, msg *model.Message) (*model.Message, error) {
-	return s.repo.Create(ctx, msg)
+	// postgres stores timestamps with microsecond precision
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	stamped := *msg
+	stamped.ID, stamped.CreatedAt, stamped.UpdatedAt = uuid.New(), now, now
+
+	created, err := s.CreateBatch(ctx, []*model.Message{&stamped})
+	if err != nil {
+		s.metrics.persistErrors.Inc()
+		return nil, err
+	}
+	return created[0], nil
+}
+
+// CreateBatch persists all messages in a single statement, retrying with backoff on transient db errors. The
+// messages must have their ids and timestamps set. An attempt that fails may still have been committed, such as when
+// the connection dropped before the reply, so the messages are looked up by id after every failure and returned
+// when found rather than stored again
+func (s *MessageService) CreateBatch(ctx context.Context, msgs []*model.Message) ([]*model.Message, error) {
+	var created []*model.Message
+	err := withRetry(ctx, func() (err error) {
+		if created, err = s.repo.CreateBatch(ctx, msgs); err == nil {
+			return nil
+		}
+		if stored := s.stored(ctx, msgs); stored != nil {
+			created = stored
+			return nil
+		}
+		return err
+	})
+	return created, err
+}
+
+// stored retrieves the messages when they were already committed, or returns nil. Batches are stored all at once or
+// not at all, so the messages are only looked for when the first one is found
+func (s *MessageService) stored(ctx context.Context, msgs []*model.Message) []*model.Message {
+	stored := make([]*model.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		message, err := s.repo.GetByID(ctx, msg.ID)
+		if err != nil {
+			return nil
+		}
+		stored = append(stored, message)
+	}
+	return stored
+}
+
+// withRetry runs the operation until it succeeds, fails with a non-transient error or runs out of attempts
+func withRetry(ctx context.Context, op func() error) error {
+	delay := createRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt == maxCreateAttempts || !repository.IsTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
 }
 
 // GetByRoomID retrieves all messages for a given room
@@ -25,6 +103,33 @@ func (s *MessageService) GetByRoomID(ctx context.Context, roomID uuid.UUID, limi
 	return s.repo.GetByRoomID(ctx, roomID, limit, offset)
 }
 
-func (s *MessageService) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+// GetByRoomIDAfter retrieves the most recent messages of the room sent after the given message, newest first
+func (s *MessageService) GetByRoomIDAfter(ctx context.Context, roomID, afterID uuid.UUID, limit int) ([]*model.Message, error) {
+	messages, err := s.repo.GetByRoomIDAfter(ctx, roomID, afterID, limit)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Delete deletes the message on behalf of the actor
+func (s *MessageService) Delete(ctx context.Context, id, actorID uuid.UUID) error {
+	message, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrMessageNotFound
+		}
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrMessageNotFound
+		}
+		return err
+	}
+	s.audit.Record(ctx, model.AuditMessageDelete, actorID, message.RoomID, id, message, nil)
+	return nil
 }
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// MessageFilter is a moderation rule applied to messages before they are persisted
+type MessageFilter interface {
+	// Apply checks the message against the settings of its room, returning the action to take and why. Filters
+	// masking parts of the message update its content in place
+	Apply(message *model.Message, settings *FilterSettings) (model.FilterAction, string)
+}
+
+// FilterSettings are the content filter settings of a room, prepared for the filters
+type FilterSettings struct {
+	*model.RoomFilter
+	// matches the blocked words along with the characters around them, nil when there are none
+	WordPattern *regexp.Regexp
+}
+
+// characters that are not part of words in any script. \b only knows ascii letters, so words in other scripts are
+// delimited by hand
+const nonWordChar = `[^\p{L}\p{M}\p{N}_]`
+
+func newFilterSettings(filter *model.RoomFilter) *FilterSettings {
+	settings := &FilterSettings{RoomFilter: filter}
+	if len(filter.BlockedWords) > 0 {
+		words := make([]string, len(filter.BlockedWords))
+		for i, word := range filter.BlockedWords {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		settings.WordPattern = regexp.MustCompile(`(?i)(?:^|` + nonWordChar + `)(` + strings.Join(words, "|") + `)(?:$|` + nonWordChar + `)`)
+	}
+	return settings
+}
+
+// FindWords returns the start and end offsets of the blocked words in the content
+func (s *FilterSettings) FindWords(content string) [][2]int {
+	if s.WordPattern == nil {
+		return nil
+	}
+	var found [][2]int
+	for offset := 0; offset < len(content); {
+		loc := s.WordPattern.FindStringSubmatchIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+		found = append(found, [2]int{offset + loc[2], offset + loc[3]})
+		// resume at the end of the word rather than of the match, so that the character after it can delimit the
+		// next word as well
+		offset += max(loc[3], loc[2]+1)
+	}
+	return found
+}
+
+// WordFilter masks, rejects or flags messages containing the blocked words of the room, matched as whole words
+// regardless of case
+type WordFilter struct{}
+
+func (WordFilter) Apply(message *model.Message, settings *FilterSettings) (model.FilterAction, string) {
+	words := settings.FindWords(message.Content)
+	if len(words) == 0 {
+		return model.FilterAllow, ""
+	}
+	if settings.WordAction == model.FilterMask {
+		var masked strings.Builder
+		last := 0
+		for _, word := range words {
+			masked.WriteString(message.Content[last:word[0]])
+			masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(message.Content[word[0]:word[1]])))
+			last = word[1]
+		}
+		masked.WriteString(message.Content[last:])
+		message.Content = masked.String()
+	}
+	return settings.WordAction, "contains blocked words"
+}
+
+// urls with a scheme or starting with www
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+
+// LinkFilter rejects or flags messages linking to domains outside the allowlist of the room. Subdomains of allowed
+// domains are allowed as well
+type LinkFilter struct{}
+
+func (LinkFilter) Apply(message *model.Message, settings *FilterSettings) (model.FilterAction, string) {
+	if settings.LinkAction == model.FilterAllow {
+		return model.FilterAllow, ""
+	}
+	for _, link := range linkPattern.FindAllString(message.Content, -1) {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		host := ""
+		if u, err := url.Parse(link); err == nil {
+			host = strings.ToLower(u.Hostname())
+		}
+		if !domainAllowed(host, settings.AllowedDomains) {
+			return settings.LinkAction, fmt.Sprintf("links to %s are not allowed", host)
+		}
+	}
+	return model.FilterAllow, ""
+}
+
+func domainAllowed(host string, domains []string) bool {
+	host = strings.TrimPrefix(host, "www.")
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// messages with fewer letters are never considered to be in capitals
+	minCapsLetters = 12
+	// share of capital letters above which a message is spam
+	maxCapsRatio = 0.7
+)
+
+// CapsFilter treats messages written mostly in capitals as spam
+type CapsFilter struct{}
+
+func (CapsFilter) Apply(message *model.Message, settings *FilterSettings) (model.FilterAction, string) {
+	if settings.SpamAction == model.FilterAllow {
+		return model.FilterAllow, ""
+	}
+	letters, upper := 0, 0
+	for _, r := range message.Content {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= minCapsLetters && float64(upper) > maxCapsRatio*float64(letters) {
+		return settings.SpamAction, "excessive capitals"
+	}
+	return model.FilterAllow, ""
+}
+
+const (
+	// messages repeated within the window count towards the sender's repeats
+	repeatWindow = 30 * time.Second
+	// the same message sent this many times in a row is spam
+	maxRepeats = 3
+)
+
+// repeatKey identifies the messages of a sender in a room. Senders without an id, such as webhooks, are told apart by
+// name
+type repeatKey struct {
+	roomID   uuid.UUID
+	senderID uuid.UUID
+	sender   string
+}
+
+type repeat struct {
+	hash  uint64
+	count int
+	last  time.Time
+}
+
+// RepeatFilter treats senders repeating the same message in a room as spam. Messages are tracked per node
+type RepeatFilter struct {
+	mu      sync.Mutex
+	repeats map[repeatKey]*repeat
+	swept   time.Time
+}
+
+func NewRepeatFilter() *RepeatFilter {
+	return &RepeatFilter{repeats: make(map[repeatKey]*repeat), swept: time.Now()}
+}
+
+func (f *RepeatFilter) Apply(message *model.Message, settings *FilterSettings) (model.FilterAction, string) {
+	if settings.SpamAction == model.FilterAllow {
+		return model.FilterAllow, ""
+	}
+	// repeats are compared regardless of case and spacing
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(message.Content), " "))))
+	hash := h.Sum64()
+	key := repeatKey{roomID: message.RoomID, senderID: message.SenderID, sender: message.SenderUsername}
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sweep(now)
+	r, ok := f.repeats[key]
+	if !ok || r.hash != hash || now.Sub(r.last) > repeatWindow {
+		r = &repeat{hash: hash}
+		f.repeats[key] = r
+	}
+	r.count++
+	r.last = now
+	if r.count >= maxRepeats {
+		return settings.SpamAction, "repeated message"
+	}
+	return model.FilterAllow, ""
+}
+
+// sweep drops the messages sent too long ago to be repeated
+func (f *RepeatFilter) sweep(now time.Time) {
+	if now.Sub(f.swept) < time.Minute {
+		return
+	}
+	f.swept = now
+	for key, r := range f.repeats {
+		if now.Sub(r.last) > repeatWindow {
+			delete(f.repeats, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// TestWordFilterMatchesWholeWords checks that blocked words are matched as whole words in any script, regardless of
+// case, and masked without the characters around them
+func TestWordFilterMatchesWholeWords(t *testing.T) {
+	filter := model.DefaultRoomFilter(uuid.New())
+	filter.BlockedWords = []string{"darn", "сука", "café"}
+	settings := newFilterSettings(filter)
+
+	tests := []struct {
+		content string
+		masked  string
+	}{
+		{"well darn it", "well **** it"},
+		{"DARN!", "****!"},
+		{"darn darn,darn", "**** ****,****"},
+		{"ты сука", "ты ****"},
+		{"Сука.", "****."},
+		{"the café_au_lait", "the café_au_lait"},
+		{"un café noir", "un **** noir"},
+		{"darned", "darned"},
+		{"сукаблин", "сукаблин"},
+		{"исука", "исука"},
+	}
+	for _, tt := range tests {
+		message := &model.Message{Content: tt.content}
+		action, _ := WordFilter{}.Apply(message, settings)
+		want := model.FilterMask
+		if tt.masked == tt.content {
+			want = model.FilterAllow
+		}
+		if action != want || message.Content != tt.masked {
+			t.Errorf("%q filtered with %s to %q, want %s to %q", tt.content, action, message.Content, want, tt.masked)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// committedThenFailing stores batches but fails the first writes with a transient error, as when the connection drops
+// after the db committed
+type committedThenFailing struct {
+	repository.MessageRepository
+	failures int
+}
+
+func (r *committedThenFailing) CreateBatch(ctx context.Context, data []*model.Message) ([]*model.Message, error) {
+	created, err := r.MessageRepository.CreateBatch(ctx, data)
+	if err != nil || r.failures == 0 {
+		return created, err
+	}
+	r.failures--
+	return nil, driver.ErrBadConn
+}
+
+// TestMessageCreateRetriesOnce checks that a message whose write was committed before failing transiently is stored
+// and reported once, with the id it was stored under
+func TestMessageCreateRetriesOnce(t *testing.T) {
+	f := newMessageFixture(t, config.DriverMemory)
+	f.service.repo = &committedThenFailing{MessageRepository: f.service.repo, failures: 1}
+
+	created, err := f.service.Create(context.Background(), f.message("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := f.service.GetByRoomID(context.Background(), f.room.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].ID != created.ID {
+		t.Fatalf("%d messages stored, want only the created message", len(stored))
+	}
+}
+
+// TestMessageWriterReportsCommittedBatch checks that a batch committed before failing transiently is reported as
+// written rather than failed, each message being stored once
+func TestMessageWriterReportsCommittedBatch(t *testing.T) {
+	f := newMessageFixture(t, config.DriverMemory)
+	f.service.repo = &committedThenFailing{MessageRepository: f.service.repo, failures: 1}
+	writer := f.startWriter(t, 10, 10*time.Millisecond)
+
+	const messages = 5
+	results := make(chan WriteResult, messages)
+	for i := range messages {
+		writer.Write(f.message(strconv.Itoa(i)), results)
+	}
+	ids := make(map[uuid.UUID]bool, messages)
+	for range messages {
+		result := <-results
+		if result.Err != nil {
+			t.Fatalf("message %q reported failed: %v", result.Message.Content, result.Err)
+		}
+		ids[result.Message.ID] = true
+	}
+
+	stored, err := f.service.GetByRoomID(context.Background(), f.room.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != messages {
+		t.Fatalf("%d messages stored, want %d", len(stored), messages)
+	}
+	for _, message := range stored {
+		if !ids[message.ID] {
+			t.Fatalf("message %q stored under an id that was not reported", message.Content)
+		}
+	}
+}
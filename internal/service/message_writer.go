@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// WriteResult is the outcome of persisting a single message through the MessageWriter
+type WriteResult struct {
+	// the stored message, nil when persisting failed
+	Message *model.Message
+	Err     error
+}
+
+type writeRequest struct {
+	message *model.Message
+	result  chan<- WriteResult
+}
+
+// MessageWriter persists messages in batches. Messages queued within a time window, up to a maximum batch size, are
+// written with a single insert. Batches are written one after the other, so messages are stored and their results
+// reported in the order they were queued
+type MessageWriter struct {
+	service  *MessageService
+	maxBatch int
+	window   time.Duration
+
+	mu sync.Mutex
+	// messages waiting to be written. the queue is unbounded so that callers are never blocked by the db
+	queue []*writeRequest
+	// signals that the queue is no longer empty
+	ready chan struct{}
+
+	// timestamp of the last stamped message. only accessed by the writer goroutine
+	lastCreatedAt time.Time
+}
+
+// NewMessageWriter creates a writer that groups up to maxBatch messages queued within the window into a batch
+func NewMessageWriter(service *MessageService, maxBatch int, window time.Duration) *MessageWriter {
+	return &MessageWriter{
+		service:  service,
+		maxBatch: maxBatch,
+		window:   window,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// Start begins writing queued messages in the background until the context is cancelled
+func (w *MessageWriter) Start(ctx context.Context) {
+	go w.run(ctx)
+}
+
+// Write queues the message for persistence. Its result is sent on the given channel once its batch is written. The
+// writer never blocks on the channel, so it must have room for the results of all messages the caller has queued,
+// with results being dropped otherwise
+func (w *MessageWriter) Write(message *model.Message, result chan<- WriteResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queue = append(w.queue, &writeRequest{message: message, result: result})
+
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (w *MessageWriter) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.ready:
+		}
+
+		// give more messages the chance to join the batch unless it is already full
+		if w.Queued() < w.maxBatch {
+			window := time.NewTimer(w.window)
+		wait:
+			for w.Queued() < w.maxBatch {
+				select {
+				case <-ctx.Done():
+					window.Stop()
+					return
+				case <-window.C:
+					break wait
+				case <-w.ready:
+				}
+			}
+			window.Stop()
+		}
+
+		// drain the queue in batches
+		for batch := w.take(); len(batch) > 0; batch = w.take() {
+			w.flush(ctx, batch)
+		}
+	}
+}
+
+// Queued returns the number of messages waiting to be written
+func (w *MessageWriter) Queued() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queue)
+}
+
+// take removes up to a batch of requests from the queue
+func (w *MessageWriter) take() []*writeRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := min(len(w.queue), w.maxBatch)
+	batch := w.queue[:n:n]
+	w.queue = w.queue[n:]
+	return batch
+}
+
+// flush writes the batch and reports the result of every message in it
+func (w *MessageWriter) flush(ctx context.Context, batch []*writeRequest) {
+	messages := make([]*model.Message, len(batch))
+	for i, req := range batch {
+		messages[i] = w.stamp(req.message)
+	}
+
+	created, err := w.service.CreateBatch(ctx, messages)
+	if err == nil {
+		for i, req := range batch {
+			w.report(req, WriteResult{Message: created[i]})
+		}
+		return
+	}
+
+	// a single bad message fails the whole batch, so messages are retried on their own to isolate failures
+	slog.Error("failed to write message batch, retrying messages one by one", "messages", len(batch), "error", err)
+	for i, req := range batch {
+		if len(batch) == 1 {
+			w.service.metrics.persistErrors.Inc()
+			w.report(req, WriteResult{Err: err})
+			continue
+		}
+		created, err := w.service.CreateBatch(ctx, messages[i:i+1])
+		if err != nil {
+			w.service.metrics.persistErrors.Inc()
+			w.report(req, WriteResult{Err: err})
+			continue
+		}
+		w.report(req, WriteResult{Message: created[0]})
+	}
+}
+
+// report sends the result to the caller without blocking the writer, dropping it when the caller has no room for it
+func (w *MessageWriter) report(req *writeRequest, result WriteResult) {
+	select {
+	case req.result <- result:
+	default:
+		w.service.metrics.droppedWriteResults.Inc()
+		slog.Error("dropping message write result, the result channel is full", "room_id", req.message.RoomID)
+	}
+}
+
+// stamp assigns the message its id and timestamps. Creation times are strictly increasing so that messages written
+// in the same batch keep their order
+func (w *MessageWriter) stamp(message *model.Message) *model.Message {
+	// postgres stores timestamps with microsecond precision
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(w.lastCreatedAt) {
+		now = w.lastCreatedAt.Add(time.Microsecond)
+	}
+	w.lastCreatedAt = now
+
+	stamped := *message
+	stamped.ID = uuid.New()
+	stamped.CreatedAt = now
+	stamped.UpdatedAt = now
+	return &stamped
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/database"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// messageFixture is a message service along with a room and a user to send messages to it
+type messageFixture struct {
+	service *MessageService
+	room    *model.Room
+	sender  *model.User
+}
+
+// newMessageFixture creates the fixture over the repositories of the driver, sqlite databases being created in a
+// temporary file
+func newMessageFixture(tb testing.TB, driver string) *messageFixture {
+	tb.Helper()
+	repos := repository.NewMemoryRepositories()
+	if driver == config.DriverSQLite {
+		db, err := sql.Open("sqlite", database.SQLiteConnString(&config.Config{DbPath: filepath.Join(tb.TempDir(), "chat.db")}))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { db.Close() })
+		// like the server, statements share a single connection
+		db.SetMaxOpenConns(1)
+		migrator, err := database.NewMigrator(&database.DB{DB: db, Driver: driver})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background(), 0); err != nil {
+			tb.Fatal(err)
+		}
+		repos = repository.NewSQLiteRepositories(db)
+	}
+
+	ctx := context.Background()
+	sender, err := repos.Users.Create(ctx, "sender", model.UserKindHuman)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	room, err := repos.Rooms.Create(ctx, &model.Room{Name: "room", CreatorID: sender.ID})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &messageFixture{service: NewMessageService(repos.Messages, NewAuditService(repos.Audit, repos.Rooms)), room: room, sender: sender}
+}
+
+func (f *messageFixture) message(content string) *model.Message {
+	return &model.Message{RoomID: f.room.ID, SenderID: f.sender.ID, SenderUsername: f.sender.Username, Content: content}
+}
+
+// startWriter starts a writer over the fixture's service, stopping it once the test is done
+func (f *messageFixture) startWriter(tb testing.TB, maxBatch int, window time.Duration) *MessageWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+	writer := NewMessageWriter(f.service, maxBatch, window)
+	writer.Start(ctx)
+	return writer
+}
+
+// TestMessageWriterKeepsOrder checks that messages are stored and reported in the order they were queued
+func TestMessageWriterKeepsOrder(t *testing.T) {
+	f := newMessageFixture(t, config.DriverMemory)
+	writer := f.startWriter(t, 10, time.Millisecond)
+
+	const messages = 95
+	results := make(chan WriteResult, messages)
+	for i := range messages {
+		writer.Write(f.message(strconv.Itoa(i)), results)
+	}
+	for i := range messages {
+		result := <-results
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if result.Message.Content != strconv.Itoa(i) || result.Message.ID == uuid.Nil {
+			t.Fatalf("result %d is for %q with id %s", i, result.Message.Content, result.Message.ID)
+		}
+	}
+
+	stored, err := f.service.GetByRoomID(context.Background(), f.room.ID, messages, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, message := range stored {
+		if want := strconv.Itoa(messages - 1 - i); message.Content != want {
+			t.Fatalf("message %d stored as %q, want %q", i, message.Content, want)
+		}
+	}
+}
+
+// TestMessageWriterDoesNotBlockOnResults checks that a caller with no room for its result does not hold up the
+// messages of other callers, its result being dropped instead
+func TestMessageWriterDoesNotBlockOnResults(t *testing.T) {
+	f := newMessageFixture(t, config.DriverMemory)
+	writer := f.startWriter(t, 10, time.Millisecond)
+
+	// never received from
+	writer.Write(f.message("unread"), make(chan WriteResult))
+	results := make(chan WriteResult, 1)
+	writer.Write(f.message("read"), results)
+	select {
+	case result := <-results:
+		if result.Err != nil || result.Message.Content != "read" {
+			t.Fatalf("got result %+v, want the message %q", result, "read")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer blocked on a full result channel")
+	}
+
+	if got := testutil.ToFloat64(f.service.metrics.droppedWriteResults); got != 1 {
+		t.Fatalf("%v results dropped, want 1", got)
+	}
+	// the message is stored even though its result was dropped
+	stored, err := f.service.GetByRoomID(context.Background(), f.room.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("%d messages stored, want 2", len(stored))
+	}
+}
+
+// BenchmarkMessageWrites compares writing messages through the batching writer with storing each message with its
+// own insert, as messages were before the writer. Both keep the same number of messages in flight, as rooms do
+func BenchmarkMessageWrites(b *testing.B) {
+	const inFlight = 1000
+	for _, driver := range []string{config.DriverMemory, config.DriverSQLite} {
+		b.Run(driver+"/single", func(b *testing.B) {
+			f := newMessageFixture(b, driver)
+			slots := make(chan struct{}, inFlight)
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for i := range b.N {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-slots }()
+					if _, err := f.service.Create(context.Background(), f.message(strconv.Itoa(i))); err != nil {
+						b.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+
+		b.Run(driver+"/batched", func(b *testing.B) {
+			f := newMessageFixture(b, driver)
+			// the default batch settings
+			writer := f.startWriter(b, 100, 10*time.Millisecond)
+			results := make(chan WriteResult, inFlight)
+			receive := func() {
+				if result := <-results; result.Err != nil {
+					b.Error(result.Err)
+				}
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				if i >= inFlight {
+					receive()
+				}
+				writer.Write(f.message(strconv.Itoa(i)), results)
+			}
+			for range min(b.N, inFlight) {
+				receive()
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// messageMetrics are the metrics of a message service and the writers persisting through it
+type messageMetrics struct {
+	// messages sent over websockets or the rest api that could not be stored
+	persistErrors prometheus.Counter
+	// results of persisted messages that could not be handed back to the caller
+	droppedWriteResults prometheus.Counter
+}
+
+func newMessageMetrics() *messageMetrics {
+	return &messageMetrics{
+		persistErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_message_persist_errors_total",
+			Help: "Messages that could not be stored and were rejected.",
+		}),
+		droppedWriteResults: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_message_writer_dropped_results_total",
+			Help: "Message write results dropped because the caller had no room for them.",
+		}),
+	}
+}
+
+// Collectors returns the metrics of the service and of the writers persisting through it, to be registered with the
+// registry of the server
+func (s *MessageService) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{s.metrics.persistErrors, s.metrics.droppedWriteResults}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+type ReactionService struct {
+	repo repository.ReactionRepository
+}
+
+func NewReactionService(repo repository.ReactionRepository) *ReactionService {
+	return &ReactionService{repo: repo}
+}
+
+// Create leaves the user's reaction on a message of the room. ErrMessageNotFound is returned when the message is not
+// in the room
+func (s *ReactionService) Create(ctx context.Context, roomID, messageID uuid.UUID, user *model.User, req *model.CreateReactionReq) (*model.Reaction, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	reaction, err := s.repo.Create(ctx, &model.Reaction{
+		MessageID: messageID,
+		RoomID:    roomID,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Emoji:     req.Emoji,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return reaction, nil
+}
+
+func (s *ReactionService) GetByMessageID(ctx context.Context, roomID, messageID uuid.UUID) ([]*model.Reaction, error) {
+	return s.repo.GetByMessageID(ctx, roomID, messageID)
+}
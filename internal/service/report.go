@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrReportClosed    = errors.New("report is no longer open")
+	ErrAlreadyReported = errors.New("message already reported by the user")
+	ErrCannotReport    = errors.New("users cannot report their own messages")
+)
+
+// ReportService keeps the queue of messages reported by room members and the outcome of each report
+type ReportService struct {
+	repo            repository.ReportRepository
+	roomRepo        repository.RoomRepository
+	messageRepo     repository.MessageRepository
+	sanctionService *SanctionService
+	audit           *AuditService
+}
+
+func NewReportService(repo repository.ReportRepository, roomRepo repository.RoomRepository, messageRepo repository.MessageRepository, sanctionService *SanctionService, audit *AuditService) *ReportService {
+	return &ReportService{repo: repo, roomRepo: roomRepo, messageRepo: messageRepo, sanctionService: sanctionService, audit: audit}
+}
+
+// Create reports the message on behalf of a member of its room
+func (s *ReportService) Create(ctx context.Context, messageID uuid.UUID, req *model.CreateReportReq) (*model.Report, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+	if message.SenderID == req.UserID {
+		return nil, ErrCannotReport
+	}
+	if _, err := s.roomRepo.GetMember(ctx, message.RoomID, req.UserID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrNotRoomMember
+		}
+		return nil, err
+	}
+
+	report, err := s.repo.Create(ctx, &model.Report{
+		RoomID:         message.RoomID,
+		MessageID:      &message.ID,
+		SenderID:       message.SenderID,
+		SenderUsername: message.SenderUsername,
+		Content:        message.Content,
+		ReporterID:     req.UserID,
+		Category:       req.Category,
+		Details:        req.Details,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAlreadyExist):
+			err = ErrAlreadyReported
+		case errors.Is(err, repository.ErrNotFound):
+			err = ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetAdminIDs retrieves the ids of the admins of the room, who are notified of new reports
+func (s *ReportService) GetAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	return s.roomRepo.GetAdminIDs(ctx, roomID)
+}
+
+// GetByRoomID retrieves the reports of the room, oldest first, on behalf of a room admin. All reports are returned
+// when the status is empty
+func (s *ReportService) GetByRoomID(ctx context.Context, roomID, actorID uuid.UUID, status model.ReportStatus, limit, offset int) ([]*model.Report, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByRoomID(ctx, roomID, status, limit, offset)
+}
+
+// Resolve resolves or dismisses the open report on behalf of a room admin, along with the other open reports of the
+// same message. Resolving a report can delete the message and sanction its sender. ErrCannotSanction is returned for
+// messages without a sending user. The sanction is returned along with the error when the reports could not be closed
+// once it was applied
+func (s *ReportService) Resolve(ctx context.Context, roomID, id uuid.UUID, req *model.ResolveReportReq) (*model.ReportResolution, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, req.ActorID); err != nil {
+		return nil, err
+	}
+	report, err := s.repo.GetByID(ctx, roomID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrReportNotFound
+		}
+		return nil, err
+	}
+	if report.Status != model.ReportOpen {
+		return nil, ErrReportClosed
+	}
+
+	resolution := &model.ReportResolution{}
+	if req.Sanction != nil {
+		if report.SenderID == uuid.Nil {
+			return nil, ErrCannotSanction
+		}
+		req.Sanction.UserID = report.SenderID
+		if resolution.Sanction, err = s.sanctionService.Create(ctx, roomID, req.Sanction); err != nil {
+			return nil, err
+		}
+		report.SanctionID = &resolution.Sanction.ID
+	}
+	if req.DeleteMessage {
+		resolution.DeletedMessageID = report.MessageID
+	}
+
+	report.Status = req.Status
+	report.ResolvedBy = &req.ActorID
+	if resolution.Reports, err = s.repo.Resolve(ctx, report, req.DeleteMessage); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrReportClosed
+		}
+		resolution.DeletedMessageID = nil
+		return resolution, err
+	}
+
+	for _, closed := range resolution.Reports {
+		s.audit.Record(ctx, model.AuditReportResolve, req.ActorID, roomID, closed.ID, nil, closed)
+	}
+	if resolution.DeletedMessageID != nil {
+		// the message is gone, so its state is taken from the report
+		deleted := &model.Message{
+			ID:             *resolution.DeletedMessageID,
+			RoomID:         roomID,
+			SenderID:       report.SenderID,
+			SenderUsername: report.SenderUsername,
+			Content:        report.Content,
+		}
+		s.audit.Record(ctx, model.AuditMessageDelete, req.ActorID, roomID, deleted.ID, deleted, nil)
+	}
+	return resolution, nil
+}
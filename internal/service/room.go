@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/mrshabel/chat/internal/model"
@@ -13,14 +14,18 @@ import (
 var (
 	ErrRoomAlreadyExist = errors.New("room already exist")
 	ErrRoomNotFound     = errors.New("room not found")
+	ErrNotRoomMember    = errors.New("user is not a member of the room")
+	ErrAlreadyMember    = errors.New("user is already a member of the room")
+	ErrNotRoomAdmin     = errors.New("user is not an admin of the room")
 )
 
 type RoomService struct {
-	repo *repository.RoomRepository
+	repo  repository.RoomRepository
+	audit *AuditService
 }
 
-func NewRoomService(repo *repository.RoomRepository) *RoomService {
-	return &RoomService{repo: repo}
+func NewRoomService(repo repository.RoomRepository, audit *AuditService) *RoomService {
+	return &RoomService{repo: repo, audit: audit}
 }
 
 func (s *RoomService) Create(ctx context.Context, req *model.CreateRoomReq) (*model.Room, error) {
@@ -43,6 +48,7 @@ func (s *RoomService) Create(ctx context.Context, req *model.CreateRoomReq) (*mo
 		return nil, err
 	}
 
+	s.audit.Record(ctx, model.AuditRoomCreate, req.UserID, room.ID, room.ID, nil, room)
 	return room, nil
 }
 
@@ -65,8 +71,108 @@ func (s *RoomService) GetAll(ctx context.Context, limit, offset int) ([]*model.R
 	return s.repo.GetAll(ctx, limit, offset)
 }
 
-func (s *RoomService) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string) (*model.RoomMember, error) {
-	return s.repo.AddMember(ctx, roomID, userID, role)
+// Search retrieves rooms matching the search query in the requested order
+func (s *RoomService) Search(ctx context.Context, req *model.SearchRoomsReq, limit, offset int) ([]*model.RoomSummary, error) {
+	return s.repo.Search(ctx, req, limit, offset)
+}
+
+// AddMember adds the user to the room on behalf of the actor
+func (s *RoomService) AddMember(ctx context.Context, roomID, userID uuid.UUID, role string, actorID uuid.UUID) (*model.RoomMember, error) {
+	member, err := s.repo.AddMember(ctx, roomID, userID, role)
+	if err != nil {
+		if errors.Is(err, repository.ErrAlreadyExist) {
+			err = ErrAlreadyMember
+		}
+		return nil, err
+	}
+	s.audit.Record(ctx, model.AuditMemberAdd, actorID, roomID, userID, nil, member)
+	return member, nil
+}
+
+func (s *RoomService) GetMember(ctx context.Context, roomID, userID uuid.UUID) (*model.RoomMember, error) {
+	member, err := s.repo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrNotRoomMember
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember removes the user from the room on behalf of the actor
+func (s *RoomService) RemoveMember(ctx context.Context, roomID, userID, actorID uuid.UUID) error {
+	member, err := s.GetMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	err = s.repo.RemoveMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrNotRoomMember
+		}
+		return err
+	}
+	s.audit.Record(ctx, model.AuditMemberRemove, actorID, roomID, userID, member, nil)
+	return nil
+}
+
+// SetTopic replaces the topic of the room on behalf of the actor
+func (s *RoomService) SetTopic(ctx context.Context, roomID uuid.UUID, topic string, actorID uuid.UUID) error {
+	if len(topic) > model.MaxRoomTopicLength {
+		return fmt.Errorf("topic cannot exceed %d characters", model.MaxRoomTopicLength)
+	}
+	room, err := s.GetByID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	err = s.repo.UpdateTopic(ctx, roomID, topic)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrRoomNotFound
+		}
+		return err
+	}
+	s.audit.Record(ctx, model.AuditRoomSetTopic, actorID, roomID, roomID, map[string]string{"topic": room.Topic}, map[string]string{"topic": topic})
+	return nil
+}
+
+// SetSlowMode sets the minimum interval between messages of a user in the room on behalf of a room admin
+func (s *RoomService) SetSlowMode(ctx context.Context, roomID uuid.UUID, req *model.SetSlowModeReq) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if err := verifyAdmin(ctx, s.repo, roomID, req.ActorID); err != nil {
+		return err
+	}
+	room, err := s.GetByID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	err = s.repo.UpdateSlowMode(ctx, roomID, req.Seconds)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrRoomNotFound
+		}
+		return err
+	}
+	s.audit.Record(ctx, model.AuditRoomSetSlowMode, req.ActorID, roomID, roomID, map[string]int{"slowModeSeconds": room.SlowModeSeconds}, map[string]int{"slowModeSeconds": req.Seconds})
+	return nil
+}
+
+// verifyAdmin returns ErrNotRoomAdmin unless the user is an admin of the room
+func verifyAdmin(ctx context.Context, repo repository.RoomRepository, roomID, userID uuid.UUID) error {
+	member, err := repo.GetMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrNotRoomAdmin
+		}
+		return err
+	}
+	if model.RoomMemberRole(member.Role) != model.AdminRole {
+		return ErrNotRoomAdmin
+	}
+	return nil
 }
 
 func (s *RoomService) GetAllMembers(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*model.RoomMember, error) {
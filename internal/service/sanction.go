@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrSanctionNotFound = errors.New("sanction not found")
+	ErrCannotSanction   = errors.New("user cannot be sanctioned")
+)
+
+// SanctionService applies and lifts the bans, mutes and timeouts of room members
+type SanctionService struct {
+	repo     repository.SanctionRepository
+	roomRepo repository.RoomRepository
+	audit    *AuditService
+}
+
+func NewSanctionService(repo repository.SanctionRepository, roomRepo repository.RoomRepository, audit *AuditService) *SanctionService {
+	return &SanctionService{repo: repo, roomRepo: roomRepo, audit: audit}
+}
+
+// Create applies a sanction on behalf of a room admin, replacing the user's active sanction of the same kind. Admins
+// cannot be sanctioned, and banned users are removed from the room's members
+func (s *SanctionService) Create(ctx context.Context, roomID uuid.UUID, req *model.CreateSanctionReq) (*model.Sanction, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, req.ActorID); err != nil {
+		return nil, err
+	}
+	if req.UserID == req.ActorID {
+		return nil, ErrCannotSanction
+	}
+	member, err := s.roomRepo.GetMember(ctx, roomID, req.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if member != nil && model.RoomMemberRole(member.Role) == model.AdminRole {
+		return nil, ErrCannotSanction
+	}
+
+	sanction, err := s.repo.Create(ctx, &model.Sanction{
+		RoomID:    roomID,
+		UserID:    req.UserID,
+		Kind:      req.Kind,
+		Reason:    req.Reason,
+		IssuedBy:  &req.ActorID,
+		ExpiresAt: req.ExpiresAt(time.Now()),
+	}, req.Kind.Replaces())
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrUserNotFound
+		}
+		return nil, err
+	}
+	s.audit.Record(ctx, model.AuditSanctionCreate, req.ActorID, roomID, sanction.ID, nil, sanction)
+
+	if sanction.Kind == model.SanctionBan && member != nil {
+		err := s.roomRepo.RemoveMember(ctx, roomID, req.UserID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			s.audit.Record(ctx, model.AuditMemberRemove, req.ActorID, roomID, req.UserID, member, nil)
+		}
+	}
+	return sanction, nil
+}
+
+// Revoke lifts the sanction on behalf of a room admin
+func (s *SanctionService) Revoke(ctx context.Context, roomID, id, actorID uuid.UUID) (*model.Sanction, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	sanction, err := s.repo.Revoke(ctx, roomID, id, actorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrSanctionNotFound
+		}
+		return nil, err
+	}
+	s.audit.Record(ctx, model.AuditSanctionRevoke, actorID, roomID, sanction.ID, nil, sanction)
+	return sanction, nil
+}
+
+// Lift lifts the user's active sanctions replaced by the given kind on behalf of a room admin, such as both mutes
+// and timeouts for mutes
+func (s *SanctionService) Lift(ctx context.Context, roomID, userID uuid.UUID, kind model.SanctionKind, actorID uuid.UUID) (model.Sanctions, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	sanctions, err := s.repo.RevokeActive(ctx, roomID, userID, kind.Replaces(), actorID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sanctions) == 0 {
+		return nil, ErrSanctionNotFound
+	}
+	for _, sanction := range sanctions {
+		s.audit.Record(ctx, model.AuditSanctionRevoke, actorID, roomID, sanction.ID, nil, sanction)
+	}
+	return sanctions, nil
+}
+
+// GetByRoomID retrieves the sanctions of the room for a room admin, including lifted and expired ones unless
+// activeOnly is set
+func (s *SanctionService) GetByRoomID(ctx context.Context, roomID, actorID uuid.UUID, activeOnly bool, limit, offset int) (model.Sanctions, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByRoomID(ctx, roomID, activeOnly, limit, offset)
+}
+
+// GetActive retrieves the sanctions of the user in effect in the room
+func (s *SanctionService) GetActive(ctx context.Context, roomID, userID uuid.UUID) (model.Sanctions, error) {
+	return s.repo.GetActiveByUserID(ctx, roomID, userID)
+}
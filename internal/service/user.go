@@ -16,11 +16,12 @@ var (
 )
 
 type UserService struct {
-	repo *repository.UserRepository
+	repo  repository.UserRepository
+	audit *AuditService
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserRepository, audit *AuditService) *UserService {
+	return &UserService{repo: repo, audit: audit}
 }
 
 func (s *UserService) Create(ctx context.Context, req *model.CreateUserReq) (*model.User, error) {
@@ -33,7 +34,13 @@ func (s *UserService) Create(ctx context.Context, req *model.CreateUserReq) (*mo
 		return nil, err
 	}
 
-	return s.repo.Create(ctx, req.Username)
+	user, err := s.repo.Create(ctx, req.Username, model.UserKindHuman)
+	if err != nil {
+		return nil, err
+	}
+	// users sign themselves up
+	s.audit.Record(ctx, model.AuditUserCreate, user.ID, uuid.Nil, user.ID, nil, user)
+	return user, nil
 }
 
 func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
@@ -57,3 +64,8 @@ func (s *UserService) GetByUsername(ctx context.Context, username string) (*mode
 	}
 	return user, nil
 }
+
+// Search retrieves users whose usernames match the search query
+func (s *UserService) Search(ctx context.Context, req *model.SearchUsersReq, limit, offset int) ([]*model.User, error) {
+	return s.repo.Search(ctx, req.Query, limit, offset)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// errors
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrInvalidWebhookToken = errors.New("invalid webhook token")
+)
+
+// number of random bytes in generated tokens, secrets and keys
+const secretSize = 32
+
+type WebhookService struct {
+	repo     repository.WebhookRepository
+	roomRepo repository.RoomRepository
+}
+
+func NewWebhookService(repo repository.WebhookRepository, roomRepo repository.RoomRepository) *WebhookService {
+	return &WebhookService{repo: repo, roomRepo: roomRepo}
+}
+
+// CreateIncoming creates an incoming webhook for the room on behalf of a room admin. The returned webhook carries its
+// token, which is not retrievable afterwards
+func (s *WebhookService) CreateIncoming(ctx context.Context, roomID uuid.UUID, req *model.CreateIncomingWebhookReq) (*model.IncomingWebhook, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, req.ActorID); err != nil {
+		return nil, err
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(token))
+
+	hook, err := s.repo.CreateIncoming(ctx, &model.IncomingWebhook{RoomID: roomID, Name: req.Name, TokenHash: hash[:]})
+	if err != nil {
+		return nil, err
+	}
+	hook.Token = token
+	return hook, nil
+}
+
+// VerifyIncoming retrieves the incoming webhook when the token matches it
+func (s *WebhookService) VerifyIncoming(ctx context.Context, id uuid.UUID, token string) (*model.IncomingWebhook, error) {
+	hook, err := s.repo.GetIncomingByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(hash[:], hook.TokenHash) != 1 {
+		return nil, ErrInvalidWebhookToken
+	}
+	return hook, nil
+}
+
+// GetIncomingByRoomID retrieves the incoming webhooks of the room for a room admin, without their tokens
+func (s *WebhookService) GetIncomingByRoomID(ctx context.Context, roomID, actorID uuid.UUID) ([]*model.IncomingWebhook, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetIncomingByRoomID(ctx, roomID)
+}
+
+// DeleteIncoming deletes an incoming webhook of the room on behalf of a room admin
+func (s *WebhookService) DeleteIncoming(ctx context.Context, roomID, id, actorID uuid.UUID) error {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return err
+	}
+	err := s.repo.DeleteIncoming(ctx, roomID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// CreateOutgoing creates an outgoing webhook for the room on behalf of a room admin. The returned webhook carries the
+// secret its deliveries are signed with
+func (s *WebhookService) CreateOutgoing(ctx context.Context, roomID uuid.UUID, req *model.CreateOutgoingWebhookReq) (*model.OutgoingWebhook, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, req.ActorID); err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CreateOutgoing(ctx, &model.OutgoingWebhook{RoomID: roomID, URL: req.URL, Secret: secret})
+}
+
+// GetOutgoingByRoomID retrieves the outgoing webhooks of the room for a room admin, without their secrets
+func (s *WebhookService) GetOutgoingByRoomID(ctx context.Context, roomID, actorID uuid.UUID) ([]*model.OutgoingWebhook, error) {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return nil, err
+	}
+	hooks, err := s.repo.GetOutgoingByRoomID(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+// GetOutgoingByID retrieves an outgoing webhook of the room without its secret
+func (s *WebhookService) GetOutgoingByID(ctx context.Context, roomID, id uuid.UUID) (*model.OutgoingWebhook, error) {
+	hook, err := s.repo.GetOutgoingByID(ctx, roomID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	hook.Secret = ""
+	return hook, nil
+}
+
+// DeleteOutgoing deletes an outgoing webhook of the room along with its commands on behalf of a room admin
+func (s *WebhookService) DeleteOutgoing(ctx context.Context, roomID, id, actorID uuid.UUID) error {
+	if err := verifyAdmin(ctx, s.roomRepo, roomID, actorID); err != nil {
+		return err
+	}
+	err := s.repo.DeleteOutgoing(ctx, roomID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// newSecret generates a random hex encoded secret
+func newSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const (
+	// number of deliveries made concurrently
+	webhookWorkers = 4
+	// number of messages and deliveries that can wait before new ones are dropped
+	webhookQueueSize = 1024
+	// time allowed for a webhook endpoint to respond
+	webhookTimeout = 10 * time.Second
+	// time allowed for a webhook endpoint to answer a call, such as a command invocation, which someone waits on
+	webhookCallTimeout = 3 * time.Second
+	// maximum size of a webhook's answer to a call
+	maxWebhookResponseSize = 64 << 10
+)
+
+// headers sent with every delivery. the delivery id is kept across retries so receivers can discard duplicates
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookDelivery is a payload on its way to a single outgoing webhook
+type webhookDelivery struct {
+	id      uuid.UUID
+	hook    *model.OutgoingWebhook
+	body    []byte
+	attempt int
+}
+
+// WebhookDispatcher delivers new messages to the outgoing webhooks of their room. Failed deliveries are retried with
+// exponential backoff without holding up other deliveries
+type WebhookDispatcher struct {
+	service     *WebhookService
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+
+	messages   chan *model.Message
+	deliveries chan *webhookDelivery
+}
+
+// NewWebhookDispatcher creates a dispatcher that makes up to maxAttempts per delivery, waiting retryDelay before the
+// first retry and doubling it after every subsequent one
+func NewWebhookDispatcher(service *WebhookService, maxAttempts int, retryDelay time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		service:     service,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		messages:    make(chan *model.Message, webhookQueueSize),
+		deliveries:  make(chan *webhookDelivery, webhookQueueSize),
+	}
+}
+
+// Start begins delivering messages in the background until the context is cancelled
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	for range webhookWorkers {
+		go d.run(ctx)
+	}
+}
+
+// Notify queues a persisted message for delivery without blocking. The message is dropped when the queue is full
+func (d *WebhookDispatcher) Notify(message *model.Message) {
+	select {
+	case d.messages <- message:
+	default:
+		slog.Warn("dropping webhook notification, queue is full", "message_id", message.ID)
+	}
+}
+
+func (d *WebhookDispatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-d.messages:
+			d.dispatch(ctx, message)
+		case delivery := <-d.deliveries:
+			d.deliver(ctx, delivery)
+		}
+	}
+}
+
+// dispatch queues a delivery of the message for every outgoing webhook of its room
+func (d *WebhookDispatcher) dispatch(ctx context.Context, message *model.Message) {
+	hooks, err := d.service.repo.GetOutgoingByRoomID(ctx, message.RoomID)
+	if err != nil {
+		slog.Error("failed to get outgoing webhooks", "room_id", message.RoomID, "error", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(&model.WebhookPayload{Event: model.WebhookEventMessageCreated, Message: message})
+	if err != nil {
+		slog.Error("failed to encode webhook payload", "message_id", message.ID, "error", err)
+		return
+	}
+	for _, hook := range hooks {
+		d.enqueue(&webhookDelivery{id: uuid.New(), hook: hook, body: body, attempt: 1})
+	}
+}
+
+func (d *WebhookDispatcher) enqueue(delivery *webhookDelivery) {
+	select {
+	case d.deliveries <- delivery:
+	default:
+		slog.Warn("dropping webhook delivery, queue is full", "delivery_id", delivery.id, "webhook_id", delivery.hook.ID)
+	}
+}
+
+// deliver makes a delivery attempt, scheduling a retry when it fails with a retryable error
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *webhookDelivery) {
+	retry, err := d.send(ctx, delivery)
+	if err == nil {
+		return
+	}
+	if !retry || delivery.attempt >= d.maxAttempts {
+		slog.Warn("webhook delivery failed", "delivery_id", delivery.id, "webhook_id", delivery.hook.ID, "attempts", delivery.attempt, "error", err)
+		return
+	}
+
+	delay := d.retryDelay << (delivery.attempt - 1)
+	delivery.attempt++
+	time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			d.enqueue(delivery)
+		}
+	})
+}
+
+// Call posts the signed payload to the webhook once and returns the body of its answer. It is meant for requests
+// someone is waiting on, so failures are not retried
+func (d *WebhookDispatcher) Call(ctx context.Context, hook *model.OutgoingWebhook, payload *model.WebhookPayload) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookCallTimeout)
+	defer cancel()
+	req, err := newWebhookRequest(ctx, hook, uuid.New(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxWebhookResponseSize))
+}
+
+// send posts the signed payload to the webhook. It reports whether a failed delivery may succeed when retried
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *webhookDelivery) (bool, error) {
+	req, err := newWebhookRequest(ctx, delivery.hook, delivery.id, delivery.body)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status: %s", res.Status)
+	default:
+		return false, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+}
+
+// newWebhookRequest composes the signed request delivering the body to the webhook
+func newWebhookRequest(ctx context.Context, hook *model.OutgoingWebhook, id uuid.UUID, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, id.String())
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, timestamp, body))
+	return req, nil
+}
+
+// SignWebhook computes the signature header of a delivery, an HMAC-SHA256 of the timestamp and body joined by a dot
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
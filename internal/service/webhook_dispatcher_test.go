@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// webhookAttempt is a delivery attempt as seen by the receiver
+type webhookAttempt struct {
+	at       time.Time
+	id       string
+	verified bool
+}
+
+// webhookReceiver is an endpoint verifying deliveries the way receivers are documented to, answering every attempt
+// that passes with the status of the receiver
+type webhookReceiver struct {
+	*httptest.Server
+	status int
+
+	mu       sync.Mutex
+	attempts []webhookAttempt
+	received chan struct{}
+}
+
+func newWebhookReceiver(tb testing.TB, status int) *webhookReceiver {
+	tb.Helper()
+	r := &webhookReceiver{status: status, received: make(chan struct{}, 16)}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	tb.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(req.Header.Get(WebhookTimestampHeader) + "." + string(body)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	verified := hmac.Equal([]byte(expected), []byte(req.Header.Get(WebhookSignatureHeader)))
+
+	r.mu.Lock()
+	r.attempts = append(r.attempts, webhookAttempt{at: time.Now(), id: req.Header.Get(WebhookIDHeader), verified: verified})
+	r.mu.Unlock()
+	r.received <- struct{}{}
+
+	if !verified {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(r.status)
+}
+
+// wait waits for n more attempts
+func (r *webhookReceiver) wait(tb testing.TB, n int) {
+	tb.Helper()
+	timeout := time.After(5 * time.Second)
+	for range n {
+		select {
+		case <-r.received:
+		case <-timeout:
+			tb.Fatalf("receiver got %d attempts, want %d more", len(r.recorded()), n)
+		}
+	}
+}
+
+func (r *webhookReceiver) recorded() []webhookAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookAttempt(nil), r.attempts...)
+}
+
+// startDispatcher starts a dispatcher retrying every delivery up to maxAttempts, and queues a delivery to the receiver
+func startDispatcher(ctx context.Context, receiver *webhookReceiver, maxAttempts int, retryDelay time.Duration) *WebhookDispatcher {
+	// deliveries queued directly never look the webhooks of a room up
+	d := NewWebhookDispatcher(nil, maxAttempts, retryDelay)
+	d.Start(ctx)
+	hook := &model.OutgoingWebhook{ID: uuid.New(), URL: receiver.URL, Secret: testWebhookSecret}
+	d.enqueue(&webhookDelivery{id: uuid.New(), hook: hook, body: []byte(`{"event":"message.created"}`), attempt: 1})
+	return d
+}
+
+func TestSignWebhook(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	startDispatcher(t.Context(), receiver, 3, time.Millisecond)
+	receiver.wait(t, 1)
+	if attempt := receiver.recorded()[0]; !attempt.verified {
+		t.Fatal("receiver could not verify the signature")
+	}
+
+	// a signature made with another secret or over another body does not verify
+	signature := SignWebhook(testWebhookSecret, "1700000000", []byte("body"))
+	if signature == SignWebhook("other", "1700000000", []byte("body")) || signature == SignWebhook(testWebhookSecret, "1700000000", []byte("other")) {
+		t.Fatal("signature does not depend on the secret and body")
+	}
+}
+
+// TestWebhookDeliveryRetries checks that deliveries are retried with doubling delays up to the maximum attempts when
+// the receiver is unavailable or rate limits them, and never when it refuses them
+func TestWebhookDeliveryRetries(t *testing.T) {
+	const (
+		maxAttempts = 4
+		retryDelay  = 10 * time.Millisecond
+	)
+	for _, tt := range []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusInternalServerError, maxAttempts},
+		{http.StatusServiceUnavailable, maxAttempts},
+		{http.StatusTooManyRequests, maxAttempts},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusGone, 1},
+	} {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			receiver := newWebhookReceiver(t, tt.status)
+			startDispatcher(t.Context(), receiver, maxAttempts, retryDelay)
+			receiver.wait(t, tt.attempts)
+			// well past the delay a further retry would have
+			time.Sleep(retryDelay << maxAttempts)
+
+			attempts := receiver.recorded()
+			if len(attempts) != tt.attempts {
+				t.Fatalf("receiver got %d attempts, want %d", len(attempts), tt.attempts)
+			}
+			for i := 1; i < len(attempts); i++ {
+				if attempts[i].id != attempts[0].id {
+					t.Fatalf("attempt %d has delivery id %s, want %s", i+1, attempts[i].id, attempts[0].id)
+				}
+				if gap, delay := attempts[i].at.Sub(attempts[i-1].at), retryDelay<<(i-1); gap < delay {
+					t.Fatalf("attempt %d came %v after the previous one, want at least %v", i+1, gap, delay)
+				}
+			}
+		})
+	}
+}
+
+// TestWebhookRetriesStopOnCancel checks that retries scheduled before the dispatcher is stopped are not queued
+func TestWebhookRetriesStopOnCancel(t *testing.T) {
+	const retryDelay = 20 * time.Millisecond
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable)
+	ctx, cancel := context.WithCancel(t.Context())
+	d := startDispatcher(ctx, receiver, 4, retryDelay)
+	receiver.wait(t, 1)
+	cancel()
+
+	time.Sleep(4 * retryDelay)
+	if attempts := len(receiver.recorded()); attempts != 1 {
+		t.Fatalf("receiver got %d attempts, want 1", attempts)
+	}
+	// the stopped workers would leave a queued retry behind
+	if queued := len(d.deliveries); queued != 0 {
+		t.Fatalf("%d deliveries queued after the dispatcher stopped", queued)
+	}
+}
@@ -0,0 +1,32 @@
+package ws
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrBrokerQueueFull is returned when a broker cannot accept more events for publishing
+var ErrBrokerQueueFull = errors.New("broker queue full")
+
+// Broker relays hub events between server instances. Events are published per room and only delivered to brokers
+// subscribed to that room. The nil room id is reserved for node-wide events which every broker receives
+type Broker interface {
+	// Start connects the broker and begins delivering events until the context is cancelled
+	Start(ctx context.Context) error
+	// Publish sends the event to all brokers subscribed to the room, including the current one
+	Publish(ctx context.Context, roomID uuid.UUID, evt *Event) error
+	Subscribe(ctx context.Context, roomID uuid.UUID) error
+	Unsubscribe(ctx context.Context, roomID uuid.UUID) error
+	// Events returns the channel of received events
+	Events() <-chan *Event
+}
+
+// topic returns the channel name used for the room's events
+func topic(roomID uuid.UUID) string {
+	if roomID == uuid.Nil {
+		return "chat:node"
+	}
+	return "chat:room:" + roomID.String()
+}
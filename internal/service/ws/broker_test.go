@@ -0,0 +1,345 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// redisStandIn is a local stand-in for a redis server, implementing the PUBLISH/SUBSCRIBE subset used by the redis
+// broker
+type redisStandIn struct {
+	net.Listener
+
+	mu          sync.Mutex
+	subscribers map[string]map[*standInConn]bool
+
+	// room subscriptions are only confirmed once released when held, as by a slow server. the node channel is
+	// always confirmed right away
+	held    chan struct{}
+	release func()
+}
+
+// standInConn is a connection to the stand-in, written to by its own commands and by publishers
+type standInConn struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// newRedisStandIn starts a stand-in listening on a local port, holding room subscriptions until released if asked to
+func newRedisStandIn(tb testing.TB, hold bool) *redisStandIn {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := &redisStandIn{Listener: ln, subscribers: make(map[string]map[*standInConn]bool), release: func() {}}
+	if hold {
+		s.held = make(chan struct{})
+		s.release = sync.OnceFunc(func() { close(s.held) })
+	}
+	tb.Cleanup(func() {
+		s.release()
+		ln.Close()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	c := &standInConn{w: bufio.NewWriter(conn)}
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		for _, conns := range s.subscribers {
+			delete(conns, c)
+		}
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "SUBSCRIBE":
+			for _, channel := range args[1:] {
+				if s.held == nil || channel == topic(uuid.Nil) {
+					s.subscribe(c, channel)
+					continue
+				}
+				go func() {
+					<-s.held
+					s.subscribe(c, channel)
+				}()
+			}
+		case "UNSUBSCRIBE":
+			for _, channel := range args[1:] {
+				s.mu.Lock()
+				delete(s.subscribers[channel], c)
+				s.mu.Unlock()
+				c.write("unsubscribe", channel, "0")
+			}
+		case "PUBLISH":
+			s.mu.Lock()
+			conns := make([]*standInConn, 0, len(s.subscribers[args[1]]))
+			for sub := range s.subscribers[args[1]] {
+				conns = append(conns, sub)
+			}
+			s.mu.Unlock()
+			for _, sub := range conns {
+				sub.write("message", args[1], args[2])
+			}
+			c.mu.Lock()
+			fmt.Fprintf(c.w, ":%d\r\n", len(conns))
+			c.w.Flush()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// subscribe adds the connection to the channel's subscribers, then confirms it
+func (s *redisStandIn) subscribe(c *standInConn, channel string) {
+	s.mu.Lock()
+	if s.subscribers[channel] == nil {
+		s.subscribers[channel] = make(map[*standInConn]bool)
+	}
+	s.subscribers[channel][c] = true
+	s.mu.Unlock()
+	c.write("subscribe", channel, "1")
+}
+
+// waitSubscribers waits until n connections are subscribed to the channel
+func (s *redisStandIn) waitSubscribers(tb testing.TB, channel string, n int) {
+	tb.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		s.mu.Lock()
+		subscribed := len(s.subscribers[channel])
+		s.mu.Unlock()
+		if subscribed == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("%d connections subscribed to %s, want %d", subscribed, channel, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// write sends an array reply, like the pushed messages of redis pub/sub
+func (c *standInConn) write(items ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeCommand(c.w, items...)
+	c.w.Flush()
+}
+
+// nextEvent waits for the next event of the broker that is not a reset
+func nextEvent(tb testing.TB, broker Broker) *Event {
+	tb.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case evt := <-broker.Events():
+			if evt.Type != EventReset {
+				return evt
+			}
+		case <-timeout:
+			tb.Fatal("no event received")
+			return nil
+		}
+	}
+}
+
+// TestRedisBrokerRelaysEvents checks that events published through the stand-in reach the brokers subscribed to
+// their room, and node-wide events every broker
+func TestRedisBrokerRelaysEvents(t *testing.T) {
+	standIn := newRedisStandIn(t, false)
+	ctx := t.Context()
+	subscriber, publisher := NewRedisBroker(standIn.Addr().String()), NewRedisBroker(standIn.Addr().String())
+	for _, broker := range []*RedisBroker{subscriber, publisher} {
+		if err := broker.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	standIn.waitSubscribers(t, topic(uuid.Nil), 2)
+
+	roomID := uuid.New()
+	if err := subscriber.Subscribe(ctx, roomID); err != nil {
+		t.Fatal(err)
+	}
+	// events are told apart by their slow mode interval
+	publish := func(roomID uuid.UUID, n int) {
+		t.Helper()
+		if err := publisher.Publish(ctx, roomID, &Event{Type: EventSlowMode, RoomID: roomID, SlowModeSeconds: n}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(uuid.New(), 1)
+	publish(roomID, 2)
+	if evt := nextEvent(t, subscriber); evt.RoomID != roomID || evt.SlowModeSeconds != 2 {
+		t.Fatalf("received event %d of room %s, want event 2 of the subscribed room", evt.SlowModeSeconds, evt.RoomID)
+	}
+
+	if err := subscriber.Unsubscribe(ctx, roomID); err != nil {
+		t.Fatal(err)
+	}
+	publish(roomID, 3)
+	publish(uuid.Nil, 4)
+	if evt := nextEvent(t, subscriber); evt.SlowModeSeconds != 4 {
+		t.Fatalf("received event %d, want the node-wide event 4", evt.SlowModeSeconds)
+	}
+}
+
+// TestRedisBrokerConcurrentSubscribes checks that subscriptions to a room made while another is being confirmed each
+// wait for a confirmation of their own rather than replacing the other's
+func TestRedisBrokerConcurrentSubscribes(t *testing.T) {
+	const subscribes = 3
+	standIn := newRedisStandIn(t, true)
+	ctx := t.Context()
+	broker := NewRedisBroker(standIn.Addr().String())
+	if err := broker.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	standIn.waitSubscribers(t, topic(uuid.Nil), 1)
+
+	roomID := uuid.New()
+	errs := make(chan error, subscribes)
+	for range subscribes {
+		go func() { errs <- broker.Subscribe(ctx, roomID) }()
+	}
+	// every subscription is sent before the stand-in confirms any
+	deadline := time.Now().Add(testTimeout)
+	for {
+		broker.mu.Lock()
+		waiting := len(broker.pending[topic(roomID)])
+		broker.mu.Unlock()
+		if waiting == subscribes {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscriptions waiting for confirmation, want %d", waiting, subscribes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	standIn.release()
+	for range subscribes {
+		if err := <-errs; err != nil {
+			t.Fatalf("subscription failed with %v", err)
+		}
+	}
+}
+
+// TestRoomJoinDoesNotWaitForSubscription checks that a room keeps handling operations while its broker subscription
+// is being confirmed, and that clients joining in the meantime catch up once it is
+func TestRoomJoinDoesNotWaitForSubscription(t *testing.T) {
+	standIn := newRedisStandIn(t, true)
+	h := startTestHub(t, repository.NewMemoryRepositories(), NewRedisBroker(standIn.Addr().String()))
+	standIn.waitSubscribers(t, topic(uuid.Nil), 1)
+	room, users := h.createRoom(t, 2)
+	sender, reader := users[0], users[1]
+
+	h.join(sender, room.ID)
+	client := h.join(reader, room.ID)
+	// well within the time the broker waits for the confirmation
+	ctx, cancel := context.WithTimeout(context.Background(), redisSubscribeTimeout/5)
+	defer cancel()
+	for {
+		members, err := h.ActiveMembers(ctx, room.ID)
+		if err != nil {
+			t.Fatalf("room blocked while subscribing: %v", err)
+		}
+		if len(members) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	h.send(sender, room.ID, "before")
+	standIn.release()
+	h.send(sender, room.ID, "after")
+	received, err := receive(client, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received[0].Content != "before" || received[1].Content != "after" {
+		t.Fatalf("received %q and %q, want the messages in order", received[0].Content, received[1].Content)
+	}
+}
+
+// TestHubsShareRooms connects the users of a room to two hubs acting as the nodes of one deployment, checking that
+// each node sees the members of the other and relays their messages
+func TestHubsShareRooms(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// starts two hubs over the repositories with connected brokers
+		nodes func(tb testing.TB, repos *repository.Repositories) (*testHub, *testHub)
+	}{
+		{"memory", func(tb testing.TB, repos *repository.Repositories) (*testHub, *testHub) {
+			bus := NewMemoryBus()
+			return startTestHub(tb, repos, bus.NewBroker()), startTestHub(tb, repos, bus.NewBroker())
+		}},
+		{"redis", func(tb testing.TB, repos *repository.Repositories) (*testHub, *testHub) {
+			standIn := newRedisStandIn(tb, false)
+			a := startTestHub(tb, repos, NewRedisBroker(standIn.Addr().String()))
+			b := startTestHub(tb, repos, NewRedisBroker(standIn.Addr().String()))
+			// presence is only relayed once both nodes are connected
+			standIn.waitSubscribers(tb, topic(uuid.Nil), 2)
+			return a, b
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := repository.NewMemoryRepositories()
+			a, b := tt.nodes(t, repos)
+			room, users := a.createRoom(t, 2)
+			alice, bob := users[0], users[1]
+
+			aliceClient, bobClient := a.join(alice, room.ID), b.join(bob, room.ID)
+			a.waitMembers(t, room.ID, 2)
+			b.waitMembers(t, room.ID, 2)
+
+			a.send(alice, room.ID, "hello")
+			if received, err := receive(bobClient, 1); err != nil || received[0].Content != "hello" {
+				t.Fatalf("bob received %v, %v, want the message of alice", received, err)
+			}
+			b.send(bob, room.ID, "hi")
+			if received, err := receive(aliceClient, 1); err != nil || received[0].Content != "hi" {
+				t.Fatalf("alice received %v, %v, want the message of bob", received, err)
+			}
+
+			bobClient.leave()
+			a.waitMembers(t, room.ID, 1)
+		})
+	}
+}
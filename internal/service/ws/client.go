@@ -1,8 +1,13 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"math"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,6 +28,27 @@ const (
 	maxMessageSize = 512
 )
 
+// OverflowPolicy decides what happens when a message is sent to a client whose queue is full
+type OverflowPolicy string
+
+const (
+	// discard the oldest queued message to make room for the new one
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// discard the new message
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// discard the new message and disconnect the client once it has overflowed too many times
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// ClientOptions configures the send queue of every client
+type ClientOptions struct {
+	// number of messages buffered for a client's writer
+	QueueSize int
+	Overflow  OverflowPolicy
+	// overflows tolerated before disconnecting a client under the disconnect policy
+	MaxOverflows int
+}
+
 // websocket connection
 var Upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -39,21 +65,136 @@ type Client struct {
 	// communication channel with central hub
 	Hub  *Hub
 	Conn *websocket.Conn
-	// channel to receive messages
-	Inbox chan *model.Message
+	// channel to receive frames
+	Inbox chan *Frame
+	// closed by the hub to stop the writer. the inbox itself is never closed since other goroutines may still send on it
+	done      chan struct{}
+	closeOnce sync.Once
+	// close frame sent to the peer once done is closed
+	closeCode   int
+	closeReason string
+
+	// send queue policy and the number of times the queue overflowed. only accessed by the room goroutine
+	opts      ClientOptions
+	overflows int
+
+	// unix nanoseconds until which the client's messages are rejected, math.MaxInt64 when muted until unmuted. set by
+	// the room goroutine and read by the reader
+	mutedUntil atomic.Int64
+
+	// id of the last message received on a previous connection. when set, the messages missed since are replayed
+	// instead of the recent history
+	ResumeAfter uuid.UUID
+	// live frames held back while the client receives the messages it missed. only accessed by the room goroutine
+	catchingUp bool
+	held       []*Frame
 
 	// currently joined room
 	RoomID uuid.UUID
 	// client information
 	ID       uuid.UUID
 	Username string
+
+	// unique id of the connection, attached to every record logged about the client
+	ConnID string
+	logger *slog.Logger
+}
+
+// NewClient creates a client for the user's connection to the given room. The connection is nil for clients
+// streaming over server-sent events
+func NewClient(hub *Hub, conn *websocket.Conn, user *model.User, roomID uuid.UUID) *Client {
+	connID := uuid.NewString()
+	return &Client{
+		Hub:      hub,
+		Conn:     conn,
+		Inbox:    make(chan *Frame, hub.clientOptions.QueueSize),
+		done:     make(chan struct{}),
+		opts:     hub.clientOptions,
+		RoomID:   roomID,
+		ID:       user.ID,
+		Username: user.Username,
+		ConnID:   connID,
+		logger:   slog.With("conn_id", connID, "user_id", user.ID, "room_id", roomID),
+	}
+}
+
+// enqueue queues the frame for the writer, applying the overflow policy when the queue is full. It reports
+// whether the client should stay connected
+func (c *Client) enqueue(frame *Frame) bool {
+	select {
+	case c.Inbox <- frame:
+		return true
+	default:
+	}
+
+	c.overflows++
+	c.Hub.metrics.droppedMessages.WithLabelValues(string(c.opts.Overflow)).Inc()
+	switch c.opts.Overflow {
+	case OverflowDropOldest:
+		// the writer may drain the queue in the meantime so neither operation is allowed to block
+		select {
+		case <-c.Inbox:
+		default:
+		}
+		select {
+		case c.Inbox <- frame:
+		default:
+		}
+		return true
+	case OverflowDropNewest:
+		return true
+	default:
+		return c.overflows < c.opts.MaxOverflows
+	}
+}
+
+// Mute rejects the client's messages until the given time, or until unmuted when nil
+func (c *Client) Mute(until *time.Time) {
+	if until == nil {
+		c.mutedUntil.Store(math.MaxInt64)
+		return
+	}
+	c.mutedUntil.Store(until.UnixNano())
+}
+
+func (c *Client) Unmute() {
+	c.mutedUntil.Store(0)
+}
+
+func (c *Client) muted() bool {
+	return time.Now().UnixNano() < c.mutedUntil.Load()
+}
+
+// reject tells the client its message was not sent. The error is dropped when the client's queue is full
+func (c *Client) reject(payload *FrameErrorPayload) {
+	select {
+	case c.Inbox <- &Frame{Type: FrameError, Error: payload}:
+	default:
+	}
+}
+
+// close signals the writer to close the connection with the given close frame. It is safe to call more than once,
+// with only the first close frame being sent
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode, c.closeReason = code, reason
+		close(c.done)
+	})
+}
+
+// leave unregisters the client from the hub, unless the hub has stopped
+func (c *Client) leave() {
+	select {
+	case c.Hub.Unregister <- c:
+	case <-c.Hub.done:
+	}
 }
 
 // ReadPump sends message from the websocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
 		// unregister the client and close the websocket connection
-		c.Hub.Unregister <- c
+		c.leave()
 		c.Conn.Close()
 	}()
 
@@ -70,20 +211,61 @@ func (c *Client) ReadPump() {
 	for {
 		_, msg, err := c.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				c.logger.Warn("connection closed unexpectedly", "error", err)
 			}
 			break
 		}
 
-		// clean message and broadcast it
+		// muted users can still read the room but nothing they send goes through
+		if c.muted() {
+			c.reject(&FrameErrorPayload{Code: "muted", Message: "You are muted in this room"})
+			continue
+		}
+		if err := c.Hub.Limiter.Check(context.Background(), c.RoomID, c.ID); err != nil {
+			c.reject(&FrameErrorPayload{Code: err.Code, Message: err.Error(), RetryAfterMs: err.RetryAfter.Milliseconds()})
+			continue
+		}
+
+		// clean message, run its command if any and broadcast it
+		content := util.SanitizeWSMessage(msg)
+		if c.Hub.Commands != nil {
+			result := c.Hub.Commands.Execute(context.Background(), c.RoomID, &model.User{ID: c.ID, Username: c.Username}, content)
+			if result != nil {
+				if result.Reply != "" {
+					c.Hub.SendEphemeral(c.ID, NewNotice(c.RoomID, result.Reply))
+				}
+				if result.Broadcast == "" {
+					continue
+				}
+				content = result.Broadcast
+			}
+		}
 		message := &model.Message{
-			Content:        util.SanitizeWSMessage(msg),
+			Content:        content,
 			RoomID:         c.RoomID,
 			SenderID:       c.ID,
 			SenderUsername: c.Username,
 		}
-		c.Hub.Broadcast <- message
+		verdict, err := c.Hub.Filters.Apply(context.Background(), message)
+		if err != nil {
+			c.logger.Error("failed to filter message", "error", err)
+			c.reject(&FrameErrorPayload{Code: "failed", Message: "Failed to send message"})
+			continue
+		}
+		switch verdict.Action {
+		case model.FilterReject:
+			c.reject(&FrameErrorPayload{Code: "rejected", Message: "Message rejected: " + strings.Join(verdict.Reasons, ", ")})
+			continue
+		case model.FilterFlag:
+			c.Hub.SendEphemeral(c.ID, NewNotice(c.RoomID, "Your message was held for review by the room admins"))
+			continue
+		}
+		select {
+		case c.Hub.Broadcast <- message:
+		case <-c.Hub.done:
+			return
+		}
 	}
 }
 
@@ -97,16 +279,17 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		// message received on client's channel
-		case message, ok := <-c.Inbox:
+		// frame received on client's channel
+		case frame := <-c.Inbox:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
-			// channel closed by hub so we close the connection
-			if !ok {
-				// c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+			if err := c.Conn.WriteJSON(frame.payload()); err != nil {
 				return
 			}
-
-			c.Conn.WriteJSON(message)
+		// client closed by hub so we close the connection, explaining why
+		case <-c.done:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeReason))
+			return
 		case <-ticker.C:
 			// ping client
 			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
@@ -122,18 +305,11 @@ func ServeWS(hub *Hub, c *Client, w http.ResponseWriter, r *http.Request) {
 	// upgrade client http connection to websocket
 	Conn, err := Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("failed to upgrade connection %v\n", err)
+		slog.WarnContext(r.Context(), "failed to upgrade connection", "error", err)
 		return
 	}
 
-	client := &Client{
-		Hub:      hub,
-		Conn:     Conn,
-		Inbox:    make(chan *model.Message),
-		RoomID:   c.RoomID,
-		ID:       c.ID,
-		Username: c.Username,
-	}
+	client := NewClient(hub, Conn, &model.User{ID: c.ID, Username: c.Username}, c.RoomID)
 	client.Hub.Register <- client
 
 	// handle connection reads and writes
@@ -0,0 +1,408 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+)
+
+// CommandRequest is a slash command sent by a user to a room
+type CommandRequest struct {
+	RoomID uuid.UUID
+	User   *model.User
+	// room role of the caller, empty when the caller is not a member
+	Role model.RoomMemberRole
+	Name string
+	Args string
+}
+
+// CommandResult is the outcome of a command. Either part may be empty
+type CommandResult struct {
+	// content sent to the room as a message from the caller
+	Broadcast string
+	// content shown only to the caller
+	Reply string
+}
+
+type CommandFunc func(ctx context.Context, req *CommandRequest) (*CommandResult, error)
+
+// Command is a built-in slash command
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	// minimum room role required to run the command. empty when anyone in the room can run it
+	Role model.RoomMemberRole
+	Run  CommandFunc
+}
+
+// roleRanks orders room roles by the commands they are allowed to run
+var roleRanks = map[model.RoomMemberRole]int{
+	"":              0,
+	model.Member:    1,
+	model.AdminRole: 2,
+}
+
+// CommandRegistry parses and runs the slash commands of messages before they are broadcast. Built-in commands are
+// registered in code while custom commands are registered per room by bots and webhooks
+type CommandRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]*Command
+
+	hub             *Hub
+	roomService     *service.RoomService
+	userService     *service.UserService
+	commandService  *service.CommandService
+	sanctionService *service.SanctionService
+	// calls the webhooks handling custom commands
+	webhooks *service.WebhookDispatcher
+}
+
+// NewCommandRegistry creates a registry with the built-in commands
+func NewCommandRegistry(hub *Hub, roomService *service.RoomService, userService *service.UserService, commandService *service.CommandService, sanctionService *service.SanctionService, webhooks *service.WebhookDispatcher) *CommandRegistry {
+	r := &CommandRegistry{
+		commands:        make(map[string]*Command),
+		hub:             hub,
+		roomService:     roomService,
+		userService:     userService,
+		commandService:  commandService,
+		sanctionService: sanctionService,
+		webhooks:        webhooks,
+	}
+	r.Register(&Command{Name: "help", Usage: "/help", Description: "List the available commands", Run: r.help})
+	r.Register(&Command{Name: "me", Usage: "/me <action>", Description: "Describe what you are doing", Run: r.me})
+	r.Register(&Command{Name: "topic", Usage: "/topic [topic]", Description: "Show the room topic, or set it as an admin", Run: r.topic})
+	r.Register(&Command{Name: "invite", Usage: "/invite @user", Description: "Add a user to the room", Role: model.Member, Run: r.invite})
+	r.Register(&Command{Name: "kick", Usage: "/kick @user", Description: "Remove a user from the room", Role: model.AdminRole, Run: r.kick})
+	r.Register(&Command{Name: "mute", Usage: "/mute @user [duration]", Description: "Stop a user from sending messages, such as for 10m", Role: model.AdminRole, Run: r.mute})
+	r.Register(&Command{Name: "slowmode", Usage: "/slowmode [seconds|off]", Description: "Show or set the minimum time between messages of each user", Role: model.Member, Run: r.slowMode})
+	r.Register(&Command{Name: "unmute", Usage: "/unmute @user", Description: "Let a muted user send messages again", Role: model.AdminRole, Run: r.unmute})
+	return r
+}
+
+// Register adds a built-in command, replacing any command with the same name
+func (r *CommandRegistry) Register(command *Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[command.Name] = command
+}
+
+// IsBuiltin reports whether the name is taken by a built-in command
+func (r *CommandRegistry) IsBuiltin(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.commands[name]
+	return ok
+}
+
+func (r *CommandRegistry) builtin(name string) (*Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	command, ok := r.commands[name]
+	return command, ok
+}
+
+// ParseCommand splits a message into a command name and its arguments. Messages starting with "//" are not
+// commands, allowing messages to start with a slash
+func ParseCommand(content string) (string, string, bool) {
+	if !strings.HasPrefix(content, "/") || strings.HasPrefix(content, "//") {
+		return "", "", false
+	}
+	name, args, _ := strings.Cut(content[1:], " ")
+	if name == "" {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+// Execute runs the command of a message sent by the user to the room. A nil result is returned when the message is
+// not a command and should be sent as is. Escaped messages are returned as a broadcast without their escape slash
+func (r *CommandRegistry) Execute(ctx context.Context, roomID uuid.UUID, user *model.User, content string) *CommandResult {
+	if strings.HasPrefix(content, "//") {
+		return &CommandResult{Broadcast: content[1:]}
+	}
+	name, args, ok := ParseCommand(content)
+	if !ok {
+		return nil
+	}
+
+	req := &CommandRequest{RoomID: roomID, User: user, Name: name, Args: args}
+	member, err := r.roomService.GetMember(ctx, roomID, user.ID)
+	switch {
+	case err == nil:
+		req.Role = model.RoomMemberRole(member.Role)
+	case !errors.Is(err, service.ErrNotRoomMember):
+		slog.ErrorContext(ctx, "failed to get role of user", "user_id", user.ID, "room_id", roomID, "error", err)
+		return &CommandResult{Reply: fmt.Sprintf("Failed to run /%s", name)}
+	}
+
+	var result *CommandResult
+	if command, ok := r.builtin(name); ok {
+		if roleRanks[req.Role] < roleRanks[command.Role] {
+			return &CommandResult{Reply: fmt.Sprintf("You are not allowed to use /%s", name)}
+		}
+		result, err = command.Run(ctx, req)
+	} else {
+		result, err = r.runCustom(ctx, req)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to run command", "command", name, "room_id", roomID, "error", err)
+		return &CommandResult{Reply: fmt.Sprintf("Failed to run /%s", name)}
+	}
+	return result
+}
+
+// runCustom hands the command to the bot or webhook that registered it in the room
+func (r *CommandRegistry) runCustom(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	command, err := r.commandService.GetByName(ctx, req.RoomID, req.Name)
+	if err != nil {
+		if errors.Is(err, service.ErrCommandNotFound) {
+			return &CommandResult{Reply: fmt.Sprintf("Unknown command /%s. Type /help to see the available commands", req.Name)}, nil
+		}
+		return nil, err
+	}
+
+	invocation := &model.CommandInvocation{
+		ID:        uuid.New(),
+		RoomID:    req.RoomID,
+		Command:   req.Name,
+		Args:      req.Args,
+		UserID:    req.User.ID,
+		Username:  req.User.Username,
+		CreatedAt: time.Now().UTC(),
+	}
+	// bots answer through their own api, such as with an ephemeral message to the caller
+	if command.BotID != nil {
+		r.hub.SendCommand(*command.BotID, invocation)
+		return &CommandResult{}, nil
+	}
+
+	body, err := r.webhooks.Call(ctx, command.Webhook, &model.WebhookPayload{Event: model.WebhookEventCommandInvoked, Command: invocation})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to call webhook for command", "webhook_id", command.Webhook.ID, "command", req.Name, "error", err)
+		return &CommandResult{Reply: fmt.Sprintf("/%s did not respond", req.Name)}, nil
+	}
+	var res model.CommandResponse
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &res); err != nil {
+			slog.WarnContext(ctx, "invalid response from webhook for command", "webhook_id", command.Webhook.ID, "command", req.Name, "error", err)
+		}
+	}
+	return &CommandResult{Reply: strings.TrimSpace(res.Content)}, nil
+}
+
+func (r *CommandRegistry) help(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	r.mu.RLock()
+	lines := make([]string, 0, len(r.commands))
+	for _, command := range r.commands {
+		if roleRanks[req.Role] >= roleRanks[command.Role] {
+			lines = append(lines, fmt.Sprintf("%s - %s", command.Usage, command.Description))
+		}
+	}
+	r.mu.RUnlock()
+	slices.Sort(lines)
+
+	custom, err := r.commandService.GetByRoomID(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	for _, command := range custom {
+		lines = append(lines, fmt.Sprintf("/%s - %s", command.Name, command.Description))
+	}
+	return &CommandResult{Reply: "Available commands:\n" + strings.Join(lines, "\n")}, nil
+}
+
+func (r *CommandRegistry) me(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	if req.Args == "" {
+		return &CommandResult{Reply: "Usage: /me <action>"}, nil
+	}
+	return &CommandResult{Broadcast: fmt.Sprintf("* %s %s", req.User.Username, req.Args)}, nil
+}
+
+// topic shows the room topic, or sets it when given one
+func (r *CommandRegistry) topic(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	if req.Args == "" {
+		room, err := r.roomService.GetByID(ctx, req.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		if room.Topic == "" {
+			return &CommandResult{Reply: "This room has no topic"}, nil
+		}
+		return &CommandResult{Reply: "Topic: " + room.Topic}, nil
+	}
+
+	if req.Role != model.AdminRole {
+		return &CommandResult{Reply: "Only admins can set the topic"}, nil
+	}
+	if len(req.Args) > model.MaxRoomTopicLength {
+		return &CommandResult{Reply: fmt.Sprintf("Topic cannot exceed %d characters", model.MaxRoomTopicLength)}, nil
+	}
+	if err := r.roomService.SetTopic(ctx, req.RoomID, req.Args, req.User.ID); err != nil {
+		return nil, err
+	}
+	return &CommandResult{Broadcast: fmt.Sprintf("* %s set the topic to: %s", req.User.Username, req.Args)}, nil
+}
+
+func (r *CommandRegistry) invite(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	user, reply, err := r.mentionedUser(ctx, req, req.Args)
+	if user == nil {
+		return reply, err
+	}
+
+	if _, err := r.roomService.AddMember(ctx, req.RoomID, user.ID, string(model.Member), req.User.ID); err != nil {
+		if errors.Is(err, service.ErrAlreadyMember) {
+			return &CommandResult{Reply: fmt.Sprintf("@%s is already a member", user.Username)}, nil
+		}
+		return nil, err
+	}
+	return &CommandResult{Reply: fmt.Sprintf("Added @%s to the room", user.Username)}, nil
+}
+
+// kick removes the user's membership and disconnects them from the room
+func (r *CommandRegistry) kick(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	user, reply, err := r.mentionedUser(ctx, req, req.Args)
+	if user == nil {
+		return reply, err
+	}
+	if user.ID == req.User.ID {
+		return &CommandResult{Reply: "You cannot kick yourself"}, nil
+	}
+
+	member, err := r.roomService.GetMember(ctx, req.RoomID, user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotRoomMember) {
+			return &CommandResult{Reply: fmt.Sprintf("@%s is not a member", user.Username)}, nil
+		}
+		return nil, err
+	}
+	if model.RoomMemberRole(member.Role) == model.AdminRole {
+		return &CommandResult{Reply: "Admins cannot be kicked"}, nil
+	}
+	if err := r.roomService.RemoveMember(ctx, req.RoomID, user.ID, req.User.ID); err != nil && !errors.Is(err, service.ErrNotRoomMember) {
+		return nil, err
+	}
+	r.hub.Kick(req.RoomID, user.ID, "removed from the room")
+	return &CommandResult{Reply: fmt.Sprintf("Removed @%s from the room", user.Username)}, nil
+}
+
+// mentionedUser retrieves the user mentioned in the command's arguments. The reply to send instead is returned when
+// there is no such user
+func (r *CommandRegistry) mentionedUser(ctx context.Context, req *CommandRequest, mention string) (*model.User, *CommandResult, error) {
+	username := strings.TrimPrefix(mention, "@")
+	if username == "" || strings.ContainsAny(username, " \t") {
+		usage := "/" + req.Name + " @user"
+		if command, ok := r.builtin(req.Name); ok {
+			usage = command.Usage
+		}
+		return nil, &CommandResult{Reply: "Usage: " + usage}, nil
+	}
+	user, err := r.userService.GetByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, &CommandResult{Reply: fmt.Sprintf("User @%s not found", username)}, nil
+		}
+		return nil, nil, err
+	}
+	return user, nil, nil
+}
+
+// mute stops the user from sending messages to the room, until unmuted or for the given duration
+func (r *CommandRegistry) mute(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	mention, duration, _ := strings.Cut(req.Args, " ")
+	user, reply, err := r.mentionedUser(ctx, req, mention)
+	if user == nil {
+		return reply, err
+	}
+
+	duration = strings.TrimSpace(duration)
+	sanctionReq := &model.CreateSanctionReq{ActorID: req.User.ID, UserID: user.ID, Kind: model.SanctionMute, Duration: duration}
+	if err := sanctionReq.Validate(); err != nil {
+		return &CommandResult{Reply: "Usage: /mute @user [duration], " + err.Error()}, nil
+	}
+	sanction, err := r.sanctionService.Create(ctx, req.RoomID, sanctionReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCannotSanction):
+			return &CommandResult{Reply: fmt.Sprintf("@%s cannot be muted", user.Username)}, nil
+		case errors.Is(err, service.ErrNotRoomAdmin):
+			return &CommandResult{Reply: "You are not allowed to use /mute"}, nil
+		}
+		return nil, err
+	}
+
+	r.hub.ApplySanction(sanction)
+	if sanction.ExpiresAt != nil {
+		return &CommandResult{Reply: fmt.Sprintf("Muted @%s for %s", user.Username, duration)}, nil
+	}
+	return &CommandResult{Reply: fmt.Sprintf("Muted @%s", user.Username)}, nil
+}
+
+// slowMode shows the slow mode of the room, or sets it as an admin
+func (r *CommandRegistry) slowMode(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	if req.Args == "" {
+		room, err := r.roomService.GetByID(ctx, req.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		if room.SlowModeSeconds == 0 {
+			return &CommandResult{Reply: "Slow mode is off"}, nil
+		}
+		return &CommandResult{Reply: fmt.Sprintf("Slow mode is on, users can send a message every %d seconds", room.SlowModeSeconds)}, nil
+	}
+
+	if req.Role != model.AdminRole {
+		return &CommandResult{Reply: "Only admins can change slow mode"}, nil
+	}
+	seconds := 0
+	if req.Args != "off" {
+		var err error
+		if seconds, err = strconv.Atoi(req.Args); err != nil {
+			return &CommandResult{Reply: "Usage: /slowmode [seconds|off]"}, nil
+		}
+	}
+	setReq := &model.SetSlowModeReq{ActorID: req.User.ID, Seconds: seconds}
+	if err := setReq.Validate(); err != nil {
+		return &CommandResult{Reply: "Usage: /slowmode [seconds|off], " + err.Error()}, nil
+	}
+	if err := r.roomService.SetSlowMode(ctx, req.RoomID, setReq); err != nil {
+		return nil, err
+	}
+
+	r.hub.SetSlowMode(req.RoomID, seconds)
+	if seconds == 0 {
+		return &CommandResult{Broadcast: fmt.Sprintf("* %s turned slow mode off", req.User.Username)}, nil
+	}
+	return &CommandResult{Broadcast: fmt.Sprintf("* %s turned slow mode on, one message every %d seconds", req.User.Username, seconds)}, nil
+}
+
+// unmute lifts the user's mute or timeout
+func (r *CommandRegistry) unmute(ctx context.Context, req *CommandRequest) (*CommandResult, error) {
+	user, reply, err := r.mentionedUser(ctx, req, req.Args)
+	if user == nil {
+		return reply, err
+	}
+
+	sanctions, err := r.sanctionService.Lift(ctx, req.RoomID, user.ID, model.SanctionMute, req.User.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrSanctionNotFound) {
+			return &CommandResult{Reply: fmt.Sprintf("@%s is not muted", user.Username)}, nil
+		}
+		return nil, err
+	}
+	for _, sanction := range sanctions {
+		r.hub.ApplySanction(sanction)
+	}
+	return &CommandResult{Reply: fmt.Sprintf("Unmuted @%s", user.Username)}, nil
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// hub event types exchanged between server instances
+type EventType string
+
+const (
+	// message broadcast in a room
+	EventMessage EventType = "message"
+	// reaction left on a message
+	EventReaction EventType = "reaction"
+	// message for a single user in a room, which is never stored
+	EventEphemeral EventType = "ephemeral"
+	// custom command invoked by a user, for the bot handling it
+	EventCommand EventType = "command"
+	// user removed from a room, whose clients are disconnected
+	EventKick EventType = "kick"
+	// sanction applied or lifted, enforced on the user's clients
+	EventSanction EventType = "sanction"
+	// message reported by a member, for an admin of the room
+	EventReport EventType = "report"
+	// message removed from the room
+	EventDelete EventType = "delete"
+	// slow mode of a room changed, sent to all nodes
+	EventSlowMode EventType = "slow_mode"
+	// content filters of a room changed, sent to all nodes
+	EventFilters EventType = "filters"
+	// client joined or left a room
+	EventJoin  EventType = "join"
+	EventLeave EventType = "leave"
+	// request for all nodes to announce their connected clients
+	EventSync EventType = "sync"
+	// periodic liveness signal of a node
+	EventHeartbeat EventType = "heartbeat"
+	// local only event emitted by the fanout when its subscription was (re)established and missed events may have been lost
+	EventReset EventType = "reset"
+)
+
+// Event is the envelope used to relay hub activity to other nodes
+type Event struct {
+	Type     EventType                `json:"type"`
+	NodeID   uuid.UUID                `json:"nodeId"`
+	RoomID   uuid.UUID                `json:"roomId"`
+	Message  *model.Message           `json:"message,omitempty"`
+	Reaction *model.Reaction          `json:"reaction,omitempty"`
+	Command  *model.CommandInvocation `json:"command,omitempty"`
+	Sanction *model.Sanction          `json:"sanction,omitempty"`
+	Report   *model.Report            `json:"report,omitempty"`
+	// id of the deleted message, or of a message relayed by reference
+	MessageID *uuid.UUID `json:"messageId,omitempty"`
+	// joining or leaving user, the recipient of an ephemeral message, command or report, or the kicked user
+	User *model.User `json:"user,omitempty"`
+	// why the user was kicked
+	Reason string `json:"reason,omitempty"`
+	// new slow mode interval of the room
+	SlowModeSeconds int `json:"slowModeSeconds,omitempty"`
+}
+
+// valid reports whether the room event carries its payload
+func (e *Event) valid() bool {
+	switch e.Type {
+	case EventMessage:
+		return e.Message != nil
+	case EventReaction:
+		return e.Reaction != nil
+	case EventEphemeral:
+		return e.Message != nil && e.User != nil
+	case EventCommand:
+		return e.Command != nil && e.User != nil
+	case EventKick:
+		return e.User != nil
+	case EventSanction:
+		return e.Sanction != nil
+	case EventReport:
+		return e.Report != nil && e.User != nil
+	case EventDelete:
+		return e.MessageID != nil
+	}
+	return true
+}
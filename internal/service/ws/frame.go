@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// name shown as the sender of notices, such as command replies
+const NoticeSender = "system"
+
+// types of payloads sent to clients
+type FrameType string
+
+const (
+	// message sent to the room
+	FrameMessage FrameType = "message"
+	// reaction left on a message of the room
+	FrameReaction FrameType = "reaction"
+	// message shown only to the receiving client and never stored
+	FrameEphemeral FrameType = "ephemeral"
+	// custom command invoked by a user, sent to the bot handling it
+	FrameCommand FrameType = "command"
+	// message of the receiving client that was rejected
+	FrameError FrameType = "error"
+	// message reported by a member, sent to the room's admins
+	FrameReport FrameType = "report"
+	// message removed from the room
+	FrameMessageDeleted FrameType = "message_deleted"
+)
+
+// Frame is a payload queued for a client
+type Frame struct {
+	Type     FrameType                `json:"type"`
+	Message  *model.Message           `json:"message,omitempty"`
+	Reaction *model.Reaction          `json:"reaction,omitempty"`
+	Command  *model.CommandInvocation `json:"command,omitempty"`
+	Error    *FrameErrorPayload       `json:"error,omitempty"`
+	Report   *model.Report            `json:"report,omitempty"`
+	// id of the deleted message
+	MessageID *uuid.UUID `json:"messageId,omitempty"`
+}
+
+// FrameErrorPayload describes why a client's message was rejected
+type FrameErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// milliseconds to wait before sending again, when the message was sent too soon
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+}
+
+// payload returns what is written to the client. Room messages are written on their own as they always have been,
+// while other frames are written with their type
+func (f *Frame) payload() any {
+	if f.Type == FrameMessage {
+		return f.Message
+	}
+	return f
+}
+
+// NewNotice composes an ephemeral message from the server to a user of the room, such as a command's reply
+func NewNotice(roomID uuid.UUID, content string) *model.Message {
+	now := time.Now().UTC()
+	return &model.Message{
+		ID:             uuid.New(),
+		RoomID:         roomID,
+		SenderUsername: NoticeSender,
+		Content:        content,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
@@ -2,130 +2,378 @@ package ws
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/mrshabel/chat/internal/model"
 	"github.com/mrshabel/chat/internal/service"
 )
 
 const (
 	MaxMessageLimit = 20
+
+	// interval at which the node announces its liveness to other nodes
+	heartbeatInterval = 15 * time.Second
+	// remote nodes are considered gone after missing this many heartbeats
+	missedHeartbeats = 3
 )
 
-// Room holds all connected clients
-type Room struct {
-	// client id to connection mapping
-	Clients  map[string]*Client
-	ID       uuid.UUID
-	Name     string
-	Messages []*model.Message
+// snapshotRequest asks the hub for the users connected to a room
+type snapshotRequest struct {
+	roomID uuid.UUID
+	users  chan []model.User
 }
 
-// Hub holds the set of active clients and broadcasts messages to them
+// Hub routes client and broker events to the goroutines of the active rooms
 type Hub struct {
-	// room id to room mapping
-	Rooms map[string]*Room
+	// room id to active room mapping
+	rooms map[uuid.UUID]*Room
 
 	// inbound messages from clients
 	Broadcast chan *model.Message
 
+	// messages already persisted elsewhere, such as through the rest api, to be fanned out
+	persisted chan *model.Message
+	// reactions and ephemeral messages to be fanned out
+	relays chan *Event
+
 	// register/enter requests from client
 	Register chan *Client
 
 	// unregister/leave request from client
 	Unregister chan *Client
 
+	// requests served by the hub goroutine on behalf of other goroutines
+	snapshotRequests chan *snapshotRequest
+	statsRequests    chan chan []roomStats
+	// rooms without clients asking to be reaped
+	idle chan *Room
+	// closed once the hub has stopped, which stops the rooms and releases goroutines waiting on the hub
+	done chan struct{}
+
+	// unique id of the current server instance
+	NodeID uuid.UUID
+
+	// send queue settings applied to new clients
+	clientOptions ClientOptions
+	// delivery metrics of the hub's rooms and clients
+	metrics *deliveryMetrics
+
+	// relays events between server instances. all room traffic flows through the broker, including local messages
+	broker Broker
+	// clients connected to other server instances
+	remote *presence
+
 	roomService    *service.RoomService
 	messageService *service.MessageService
+	// persists client messages in batches before they are fanned out
+	writer *service.MessageWriter
+	// delivers messages persisted by this node to outgoing webhooks
+	webhooks *service.WebhookDispatcher
+
+	// runs the slash commands of client messages. commands are sent as plain messages when nil
+	Commands *CommandRegistry
+	// limits how often messages are sent. messages are not limited when nil
+	Limiter *MessageLimiter
+	// content filters applied to messages before they are persisted. messages are not filtered when nil
+	Filters *service.FilterService
 }
 
-func NewHub(roomService *service.RoomService, messageService *service.MessageService) *Hub {
+// NewHub creates a hub that exchanges room events through the given broker
+func NewHub(roomService *service.RoomService, messageService *service.MessageService, writer *service.MessageWriter, webhooks *service.WebhookDispatcher, broker Broker, clientOptions ClientOptions) *Hub {
 	return &Hub{
-		Rooms:          make(map[string]*Room),
-		Broadcast:      make(chan *model.Message),
-		Register:       make(chan *Client),
-		Unregister:     make(chan *Client),
-		roomService:    roomService,
-		messageService: messageService,
+		rooms:            make(map[uuid.UUID]*Room),
+		Broadcast:        make(chan *model.Message),
+		persisted:        make(chan *model.Message),
+		relays:           make(chan *Event),
+		Register:         make(chan *Client),
+		Unregister:       make(chan *Client),
+		snapshotRequests: make(chan *snapshotRequest),
+		statsRequests:    make(chan chan []roomStats),
+		idle:             make(chan *Room),
+		done:             make(chan struct{}),
+		NodeID:           uuid.New(),
+		clientOptions:    clientOptions,
+		metrics:          newDeliveryMetrics(),
+		broker:           broker,
+		remote:           newPresence(),
+		roomService:      roomService,
+		messageService:   messageService,
+		writer:           writer,
+		webhooks:         webhooks,
 	}
 }
 
-// run starts the hub and handles all related events
-func (h *Hub) Run() {
+// Run handles all hub events until the context is done. The rooms then stop, closing the connections of their
+// clients
+func (h *Hub) Run(ctx context.Context) {
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	defer close(h.done)
+
 	for {
 		select {
-		case client := <-h.Register:
-			// joined specified room and inform members
-			room := h.GetRoom(client.RoomID)
-			if room == nil {
-				continue
-			}
-			room.Clients[client.ID.String()] = client
-
-			// load recent messages from db and replay to client
-			messages, err := h.messageService.GetByRoomID(context.Background(), room.ID, MaxMessageLimit, 0)
-			if err != nil {
-				log.Printf("failed to load recent messages for room (%s) from db\n", client.RoomID)
-			} else {
-				room.Messages = messages
-			}
+		case <-ctx.Done():
+			return
 
-			// replay messages history to client
-			go func() {
-				for _, message := range room.Messages {
-					client.Inbox <- message
-				}
-			}()
+		case client := <-h.Register:
+			h.room(client.RoomID).register <- client
 
 		case client := <-h.Unregister:
-			// remove client from room and close inbox channel
-			room := h.GetRoom(client.RoomID)
-			if room == nil {
-				continue
+			// stop the client's writer and remove it from its room
+			client.close(websocket.CloseNormalClosure, "")
+			if room, ok := h.rooms[client.RoomID]; ok {
+				room.unregister <- client
 			}
-			delete(room.Clients, client.ID.String())
-			close(client.Inbox)
 
 		case message := <-h.Broadcast:
-			// fanout messages to all connected clients
-			room := h.GetRoom(message.RoomID)
-			if room == nil {
+			// messages may be sent to rooms without local clients, such as through the rest api
+			h.room(message.RoomID).broadcast <- message
+
+		case message := <-h.persisted:
+			h.webhooks.Notify(message)
+			h.relay(&Event{Type: EventMessage, RoomID: message.RoomID, Message: message})
+
+		case evt := <-h.relays:
+			h.relay(evt)
+
+		case room := <-h.idle:
+			// the room is only reaped when nothing has been routed to it since it became idle. the hub is the only
+			// sender on the room's queues so the check cannot race with new operations
+			reap := room.queued() == 0
+			if reap {
+				delete(h.rooms, room.ID)
+			}
+			room.reaped <- reap
+
+		case req := <-h.snapshotRequests:
+			room, ok := h.rooms[req.roomID]
+			if !ok {
+				req.users <- nil
 				continue
 			}
+			room.snapshots <- req.users
 
-			// persist message in the background and update inmem messages
-			go func() {
-				message, err := h.messageService.Create(context.Background(), message)
-				if err != nil {
-					log.Printf("failed to persist client message: %v\n", err)
-					return
-				}
-				room.Messages = append(room.Messages, message)
-			}()
-
-			for _, client := range room.Clients {
-				if client.ID == message.SenderID {
-					continue
-				}
-				select {
-				case client.Inbox <- message:
-				// close connection if inbox channel is full
-				default:
-					close(client.Inbox)
-					delete(room.Clients, client.ID.String())
-				}
+		case stats := <-h.statsRequests:
+			rooms := make([]roomStats, 0, len(h.rooms))
+			for _, room := range h.rooms {
+				rooms = append(rooms, roomStats{id: room.ID, clients: room.connected.Load(), queued: room.queued()})
 			}
+			stats <- rooms
+
+		case evt := <-h.broker.Events():
+			h.handleEvent(evt)
+
+		case <-heartbeat.C:
+			h.publish(uuid.Nil, &Event{Type: EventHeartbeat})
+			h.remote.expire(time.Now().Add(-missedHeartbeats * heartbeatInterval))
 		}
 	}
 }
 
-// GetRoom retrieves a room if present
-func (h *Hub) GetRoom(id uuid.UUID) *Room {
-
-	room, ok := h.Rooms[id.String()]
+// room retrieves the active room, starting it if necessary
+func (h *Hub) room(id uuid.UUID) *Room {
+	room, ok := h.rooms[id]
 	if !ok {
-		return nil
+		room = newRoom(h, id)
+		h.rooms[id] = room
+		go room.run()
 	}
 	return room
 }
+
+// handleEvent applies an event received from the broker
+func (h *Hub) handleEvent(evt *Event) {
+	switch evt.Type {
+	case EventReset:
+		// rebuild the view of other nodes since events may have been missed
+		h.remote.reset()
+		h.Limiter.reset()
+		h.Filters.InvalidateAll()
+		h.publish(uuid.Nil, &Event{Type: EventSync})
+		return
+	case EventSlowMode:
+		// applied again on the node that changed it, which is harmless
+		h.Limiter.SetSlowMode(evt.RoomID, evt.SlowModeSeconds)
+		return
+	case EventFilters:
+		h.Filters.Invalidate(evt.RoomID)
+		return
+	case EventMessage, EventReaction, EventEphemeral, EventCommand, EventKick, EventSanction, EventReport, EventDelete:
+		// only nodes with clients in the room have it active
+		if room, ok := h.rooms[evt.RoomID]; ok && evt.valid() {
+			room.events <- evt
+		}
+		return
+	}
+
+	// presence published by this node is already known locally
+	if evt.NodeID == h.NodeID {
+		return
+	}
+
+	switch evt.Type {
+	case EventJoin:
+		if evt.User != nil {
+			h.remote.join(evt.NodeID, evt.RoomID, evt.User)
+		}
+	case EventLeave:
+		if evt.User != nil {
+			h.remote.leave(evt.NodeID, evt.RoomID, evt.User.ID)
+		}
+	case EventSync:
+		// rooms announce their clients to the requesting node
+		h.remote.touch(evt.NodeID)
+		for _, room := range h.rooms {
+			room.syncs <- struct{}{}
+		}
+	case EventHeartbeat:
+		h.remote.touch(evt.NodeID)
+	}
+}
+
+// relay publishes a room event, with local clients receiving it once it comes back from the broker. The event is
+// delivered to local clients directly when it cannot be published
+func (h *Hub) relay(evt *Event) {
+	// room settings concern every node, since messages can be sent to a room through any of them
+	if evt.Type == EventSlowMode || evt.Type == EventFilters {
+		h.publish(uuid.Nil, evt)
+		return
+	}
+	if err := h.publish(evt.RoomID, evt); err != nil {
+		slog.Error("failed to publish event", "event", evt.Type, "room_id", evt.RoomID, "error", err)
+		if room, ok := h.rooms[evt.RoomID]; ok {
+			room.events <- evt
+		}
+	}
+}
+
+// SendPersisted hands a message persisted elsewhere, such as through the rest api, to the outgoing webhooks of its
+// room and its clients on every node. The message is dropped once the hub has stopped
+func (h *Hub) SendPersisted(message *model.Message) {
+	select {
+	case h.persisted <- message:
+	case <-h.done:
+	}
+}
+
+// SendReaction fans the reaction out to the clients of its room
+func (h *Hub) SendReaction(reaction *model.Reaction) {
+	h.submit(&Event{Type: EventReaction, RoomID: reaction.RoomID, Reaction: reaction})
+}
+
+// SendEphemeral delivers the message to the user's clients in the message's room only
+func (h *Hub) SendEphemeral(userID uuid.UUID, message *model.Message) {
+	h.submit(&Event{Type: EventEphemeral, RoomID: message.RoomID, Message: message, User: &model.User{ID: userID}})
+}
+
+// SendCommand delivers the invocation of a custom command to the bot handling it, if connected to the room
+func (h *Hub) SendCommand(botID uuid.UUID, invocation *model.CommandInvocation) {
+	h.submit(&Event{Type: EventCommand, RoomID: invocation.RoomID, Command: invocation, User: &model.User{ID: botID}})
+}
+
+// Kick disconnects the user's clients from the room on every node
+func (h *Hub) Kick(roomID, userID uuid.UUID, reason string) {
+	h.submit(&Event{Type: EventKick, RoomID: roomID, User: &model.User{ID: userID}, Reason: reason})
+}
+
+// ApplySanction enforces a sanction applied or lifted in its room on the user's clients on every node. Banned users
+// are disconnected and muted ones have their messages rejected
+func (h *Hub) ApplySanction(sanction *model.Sanction) {
+	h.submit(&Event{Type: EventSanction, RoomID: sanction.RoomID, Sanction: sanction})
+}
+
+// SendReport notifies the admin's clients in the room of a reported message
+func (h *Hub) SendReport(adminID uuid.UUID, report *model.Report) {
+	h.submit(&Event{Type: EventReport, RoomID: report.RoomID, Report: report, User: &model.User{ID: adminID}})
+}
+
+// DeleteMessage removes the message from the clients of its room
+func (h *Hub) DeleteMessage(roomID, messageID uuid.UUID) {
+	h.submit(&Event{Type: EventDelete, RoomID: roomID, MessageID: &messageID})
+}
+
+// SetSlowMode applies the new slow mode interval of the room on every node
+func (h *Hub) SetSlowMode(roomID uuid.UUID, seconds int) {
+	h.Limiter.SetSlowMode(roomID, seconds)
+	h.submit(&Event{Type: EventSlowMode, RoomID: roomID, SlowModeSeconds: seconds})
+}
+
+// InvalidateFilters reloads the content filters of the room on every node
+func (h *Hub) InvalidateFilters(roomID uuid.UUID) {
+	h.Filters.Invalidate(roomID)
+	h.submit(&Event{Type: EventFilters, RoomID: roomID})
+}
+
+// submit hands the event to the hub goroutine to be relayed, dropping it once the hub has stopped
+func (h *Hub) submit(evt *Event) {
+	select {
+	case h.relays <- evt:
+	case <-h.done:
+	}
+}
+
+// publish sends an event through the broker to the given room, or to all nodes when the room id is nil
+func (h *Hub) publish(roomID uuid.UUID, evt *Event) error {
+	evt.NodeID = h.NodeID
+	err := h.broker.Publish(context.Background(), roomID, evt)
+	if err != nil && roomID == uuid.Nil {
+		slog.Error("failed to publish event", "event", evt.Type, "error", err)
+	}
+	return err
+}
+
+// ActiveMembers retrieves the users connected to the room on this and every other node
+func (h *Hub) ActiveMembers(ctx context.Context, roomID uuid.UUID) ([]model.User, error) {
+	req := &snapshotRequest{roomID: roomID, users: make(chan []model.User, 1)}
+	select {
+	case h.snapshotRequests <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-h.done:
+		return nil, nil
+	}
+
+	var users []model.User
+	select {
+	case users = <-req.users:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-h.done:
+		return nil, nil
+	}
+
+	// a user may be connected through several nodes
+	seen := make(map[uuid.UUID]bool, len(users))
+	for _, user := range users {
+		seen[user.ID] = true
+	}
+	for _, user := range h.remote.members(roomID) {
+		if !seen[user.ID] {
+			seen[user.ID] = true
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// stats retrieves the state of the active rooms, reporting false when the hub does not answer within the timeout
+func (h *Hub) stats(timeout time.Duration) ([]roomStats, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	stats := make(chan []roomStats, 1)
+	select {
+	case h.statsRequests <- stats:
+	case <-timer.C:
+		return nil, false
+	}
+	select {
+	case rooms := <-stats:
+		return rooms, true
+	case <-timer.C:
+		return nil, false
+	}
+}
@@ -0,0 +1,422 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+	"github.com/mrshabel/chat/internal/service"
+)
+
+// time allowed for frames and state changes the tests wait for
+const testTimeout = 10 * time.Second
+
+// testHub is a hub over memory repositories
+type testHub struct {
+	*Hub
+	repos *repository.Repositories
+	stop  context.CancelFunc
+}
+
+// newTestHub starts a hub over a memory broker of its own
+func newTestHub(tb testing.TB) *testHub {
+	tb.Helper()
+	return startTestHub(tb, repository.NewMemoryRepositories(), NewMemoryBroker())
+}
+
+// startTestHub starts a hub along with its broker and background workers, stopping them once the test is done. Hubs
+// sharing the repositories and connected brokers act as the nodes of a single deployment
+func startTestHub(tb testing.TB, repos *repository.Repositories, broker Broker) *testHub {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	audit := service.NewAuditService(repos.Audit, repos.Rooms)
+	messageService := service.NewMessageService(repos.Messages, audit)
+
+	if err := broker.Start(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	writer := service.NewMessageWriter(messageService, 100, time.Millisecond)
+	writer.Start(ctx)
+	webhooks := service.NewWebhookDispatcher(service.NewWebhookService(repos.Webhooks, repos.Rooms), 1, time.Millisecond)
+	webhooks.Start(ctx)
+
+	hub := NewHub(service.NewRoomService(repos.Rooms, audit), messageService, writer, webhooks, broker, ClientOptions{
+		QueueSize:    1024,
+		Overflow:     OverflowDisconnect,
+		MaxOverflows: 1,
+	})
+	go hub.Run(ctx)
+
+	h := &testHub{Hub: hub, repos: repos, stop: cancel}
+	tb.Cleanup(h.close)
+	return h
+}
+
+// close stops the hub and waits for it to return. It is safe to call more than once
+func (h *testHub) close() {
+	h.stop()
+	<-h.done
+}
+
+// createRoom stores a room along with users to send messages to it
+func (h *testHub) createRoom(tb testing.TB, users int) (*model.Room, []*model.User) {
+	tb.Helper()
+	ctx := context.Background()
+	members := make([]*model.User, 0, users)
+	for range users {
+		user, err := h.repos.Users.Create(ctx, "user_"+uuid.NewString(), model.UserKindHuman)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		members = append(members, user)
+	}
+	room, err := h.repos.Rooms.Create(ctx, &model.Room{Name: "room", CreatorID: members[0].ID})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return room, members
+}
+
+// join connects a client of the user to the room without waiting for the room to add it
+func (h *testHub) join(user *model.User, roomID uuid.UUID) *Client {
+	client := NewClient(h.Hub, nil, user, roomID)
+	h.Register <- client
+	return client
+}
+
+// send hands a message from the user to the hub as a client would, reporting false once the hub has stopped
+func (h *testHub) send(user *model.User, roomID uuid.UUID, content string) bool {
+	select {
+	case h.Broadcast <- &model.Message{RoomID: roomID, SenderID: user.ID, SenderUsername: user.Username, Content: content}:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// waitMembers waits until the given number of users are connected to the room
+func (h *testHub) waitMembers(tb testing.TB, roomID uuid.UUID, n int) {
+	tb.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		users, err := h.ActiveMembers(context.Background(), roomID)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if len(users) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("room %s has %d connected users, want %d", roomID, len(users), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// history returns the stored messages of the room, oldest first
+func (h *testHub) history(tb testing.TB, roomID uuid.UUID) []*model.Message {
+	tb.Helper()
+	messages, err := h.repos.Messages.GetByRoomID(context.Background(), roomID, 10000, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	slices.Reverse(messages)
+	return messages
+}
+
+// receive waits for n room messages queued for the client, skipping other frames
+func receive(client *Client, n int) ([]*model.Message, error) {
+	messages := make([]*model.Message, 0, n)
+	timeout := time.NewTimer(testTimeout)
+	defer timeout.Stop()
+	for len(messages) < n {
+		select {
+		case frame := <-client.Inbox:
+			if frame.Type == FrameMessage {
+				messages = append(messages, frame.Message)
+			}
+		case <-client.done:
+			return nil, fmt.Errorf("%s: closed with %d %q after %d of %d messages", client.Username, client.closeCode, client.closeReason, len(messages), n)
+		case <-timeout.C:
+			return nil, fmt.Errorf("%s: received %d of %d messages", client.Username, len(messages), n)
+		}
+	}
+	return messages, nil
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n, failing with their stacks when it does not
+func waitGoroutines(tb testing.TB, n int) {
+	tb.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			tb.Fatalf("%d goroutines running, want at most %d:\n%s", runtime.NumGoroutine(), n, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHubConcurrentRooms sends messages to many rooms at once while other clients keep joining and leaving them,
+// checking that every member receives the messages of the others in the order they were stored
+func TestHubConcurrentRooms(t *testing.T) {
+	const (
+		rooms    = 50
+		members  = 4
+		messages = 25
+		churners = 2
+	)
+	h := newTestHub(t)
+
+	type roomState struct {
+		room     *model.Room
+		users    []*model.User
+		clients  []*Client
+		received [][]*model.Message
+	}
+	states := make([]*roomState, rooms)
+	for i := range states {
+		room, users := h.createRoom(t, members)
+		state := &roomState{room: room, users: users, received: make([][]*model.Message, members)}
+		for _, user := range users {
+			state.clients = append(state.clients, h.join(user, room.ID))
+		}
+		states[i] = state
+	}
+	for _, state := range states {
+		h.waitMembers(t, state.room.ID, members)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, rooms*members)
+	for _, state := range states {
+		for i, user := range state.users {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := range messages {
+					h.send(user, state.room.ID, strconv.Itoa(j))
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				received, err := receive(state.clients[i], (members-1)*messages)
+				if err != nil {
+					errs <- err
+					return
+				}
+				state.received[i] = received
+			}()
+		}
+		// clients joining and leaving must not disturb the members
+		for range churners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 10 {
+					h.join(&model.User{ID: uuid.New(), Username: "churner"}, state.room.ID).leave()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	for _, state := range states {
+		stored := h.history(t, state.room.ID)
+		if len(stored) != members*messages {
+			t.Fatalf("room %s stored %d messages, want %d", state.room.ID, len(stored), members*messages)
+		}
+		// the messages of every sender are stored in the order they were sent
+		next := make(map[uuid.UUID]int, members)
+		for _, message := range stored {
+			if message.Content != strconv.Itoa(next[message.SenderID]) {
+				t.Fatalf("room %s stored %q from %s, want %q", state.room.ID, message.Content, message.SenderID, strconv.Itoa(next[message.SenderID]))
+			}
+			next[message.SenderID]++
+		}
+		// and every member receives the messages of the others in that order
+		for i, client := range state.clients {
+			want := slices.DeleteFunc(slices.Clone(stored), func(message *model.Message) bool { return message.SenderID == client.ID })
+			if !slices.EqualFunc(state.received[i], want, func(a, b *model.Message) bool { return a.ID == b.ID }) {
+				t.Fatalf("%s did not receive the messages of room %s in the order they were stored", client.Username, state.room.ID)
+			}
+		}
+		h.waitMembers(t, state.room.ID, members)
+	}
+}
+
+// TestHubStopReleasesGoroutines stops the hub while clients are sending to many rooms, checking that every client
+// is closed and that no goroutine outlives the hub
+func TestHubStopReleasesGoroutines(t *testing.T) {
+	const (
+		rooms   = 20
+		members = 3
+	)
+	running := runtime.NumGoroutine()
+	h := newTestHub(t)
+
+	var (
+		wg      sync.WaitGroup
+		clients []*Client
+	)
+	for range rooms {
+		room, users := h.createRoom(t, members)
+		for _, user := range users {
+			client := h.join(user, room.ID)
+			clients = append(clients, client)
+			wg.Add(2)
+			// send until the hub stops
+			go func() {
+				defer wg.Done()
+				for i := 0; h.send(user, room.ID, strconv.Itoa(i)); i++ {
+				}
+			}()
+			// read until the client is closed, as its writer would
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-client.Inbox:
+					case <-client.done:
+						return
+					}
+				}
+			}()
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	h.close()
+	wg.Wait()
+	for _, client := range clients {
+		if client.closeCode != websocket.CloseGoingAway {
+			t.Fatalf("%s closed with %d %q, want %d", client.Username, client.closeCode, client.closeReason, websocket.CloseGoingAway)
+		}
+	}
+	// messages persisted through the rest api once the hub stopped are dropped rather than holding their request up
+	sent := make(chan struct{})
+	go func() {
+		h.SendPersisted(&model.Message{ID: uuid.New(), RoomID: uuid.New()})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(testTimeout):
+		t.Fatal("sending a persisted message blocked once the hub stopped")
+	}
+	waitGoroutines(t, running)
+}
+
+// BenchmarkHubBroadcast measures message throughput with thousands of rooms receiving messages at once. Every
+// message is persisted and delivered to the other member of its room, with a bounded number of messages in flight
+// per room so that none are dropped for waiting too long on persistence
+func BenchmarkHubBroadcast(b *testing.B) {
+	const inFlight = 64
+	// the webhook queue overflows at these rates, which is logged for every message
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	for _, rooms := range []int{10, 1000, 5000} {
+		b.Run(fmt.Sprintf("rooms=%d", rooms), func(b *testing.B) {
+			h := newTestHub(b)
+			type benchRoom struct {
+				id       uuid.UUID
+				sender   *model.User
+				receiver *Client
+			}
+			benchRooms := make([]benchRoom, rooms)
+			for i := range benchRooms {
+				room, users := h.createRoom(b, 2)
+				benchRooms[i] = benchRoom{id: room.ID, sender: users[0], receiver: h.join(users[1], room.ID)}
+			}
+			for _, room := range benchRooms {
+				h.waitMembers(b, room.id, 1)
+			}
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i, room := range benchRooms {
+				n := b.N / rooms
+				if i < b.N%rooms {
+					n++
+				}
+				if n == 0 {
+					continue
+				}
+				// credits are taken by the sender and returned once the message is received
+				credits := make(chan struct{}, inFlight)
+				failed := make(chan struct{})
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for j := range n {
+						select {
+						case credits <- struct{}{}:
+						case <-failed:
+							return
+						}
+						h.send(room.sender, room.id, strconv.Itoa(j))
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for range n {
+						if _, err := receive(room.receiver, 1); err != nil {
+							b.Error(err)
+							close(failed)
+							return
+						}
+						<-credits
+					}
+				}()
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
+
+// BenchmarkHubJoinLeave measures how fast clients join and leave rooms when thousands of rooms are active
+func BenchmarkHubJoinLeave(b *testing.B) {
+	for _, rooms := range []int{10, 1000, 5000} {
+		b.Run(fmt.Sprintf("rooms=%d", rooms), func(b *testing.B) {
+			h := newTestHub(b)
+			roomIDs := make([]uuid.UUID, rooms)
+			for i := range roomIDs {
+				room, users := h.createRoom(b, 1)
+				roomIDs[i] = room.ID
+				// a member keeps every room active
+				h.join(users[0], room.ID)
+			}
+			for _, roomID := range roomIDs {
+				h.waitMembers(b, roomID, 1)
+			}
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					roomID := roomIDs[next.Add(1)%int64(rooms)]
+					h.join(&model.User{ID: uuid.New(), Username: "bench"}, roomID).leave()
+				}
+			})
+		})
+	}
+}
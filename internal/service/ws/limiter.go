@@ -0,0 +1,168 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/service"
+	"github.com/mrshabel/chat/internal/util"
+)
+
+// reasons messages are rejected by the limiter
+const (
+	LimitRateLimited = "rate_limited"
+	LimitSlowMode    = "slow_mode"
+)
+
+// LimitError is returned for a message sent too soon, along with how long to wait before sending again
+type LimitError struct {
+	Code       string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	if e.Code == LimitSlowMode {
+		return fmt.Sprintf("Slow mode is on, wait %s before sending another message", e.RetryAfter.Round(time.Second))
+	}
+	return "You are sending messages too fast"
+}
+
+// slowModeKey identifies the messages of a user in a room
+type slowModeKey struct {
+	roomID uuid.UUID
+	userID uuid.UUID
+}
+
+// MessageLimiter limits how often messages are sent to rooms, per user, per room and by the slow mode of each room.
+// Limits are tracked per node
+type MessageLimiter struct {
+	users *util.RateLimiter
+	rooms *util.RateLimiter
+
+	roomService *service.RoomService
+
+	mu sync.Mutex
+	// slow mode interval of rooms, loaded on first use and kept up to date through the hub
+	slowModes map[uuid.UUID]time.Duration
+	// when users last sent a message to a room in slow mode
+	lastSent map[slowModeKey]time.Time
+	swept    time.Time
+}
+
+// NewMessageLimiter creates a limiter allowing each user and each room the given number of messages per minute, with
+// bursts of up to the given sizes. Limits that are not positive are disabled
+func NewMessageLimiter(roomService *service.RoomService, userPerMinute, userBurst, roomPerMinute, roomBurst int) *MessageLimiter {
+	return &MessageLimiter{
+		users:       util.NewRateLimiter(userPerMinute, userBurst),
+		rooms:       util.NewRateLimiter(roomPerMinute, roomBurst),
+		roomService: roomService,
+		slowModes:   make(map[uuid.UUID]time.Duration),
+		lastSent:    make(map[slowModeKey]time.Time),
+		swept:       time.Now(),
+	}
+}
+
+// Check takes a message of the user sent to the room into account, returning an error when it is sent too soon. The
+// user id is nil for messages not sent by users, such as those posted through webhooks, which are only limited per
+// room. A nil limiter allows every message
+func (l *MessageLimiter) Check(ctx context.Context, roomID, userID uuid.UUID) *LimitError {
+	if l == nil {
+		return nil
+	}
+	if userID != uuid.Nil {
+		if err := l.checkSlowMode(ctx, roomID, userID); err != nil {
+			return err
+		}
+		if ok, retryAfter := l.users.Allow(userID.String()); !ok {
+			return &LimitError{Code: LimitRateLimited, RetryAfter: retryAfter}
+		}
+	}
+	if ok, retryAfter := l.rooms.Allow(roomID.String()); !ok {
+		return &LimitError{Code: LimitRateLimited, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// checkSlowMode records the user's message when the room is in slow mode, unless the user's previous message was sent
+// too recently
+func (l *MessageLimiter) checkSlowMode(ctx context.Context, roomID, userID uuid.UUID) *LimitError {
+	interval := l.slowMode(ctx, roomID)
+	if interval == 0 {
+		return nil
+	}
+	now := time.Now()
+	key := slowModeKey{roomID: roomID, userID: userID}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	if last, ok := l.lastSent[key]; ok && now.Sub(last) < interval {
+		return &LimitError{Code: LimitSlowMode, RetryAfter: interval - now.Sub(last)}
+	}
+	l.lastSent[key] = now
+	return nil
+}
+
+// slowMode returns the slow mode interval of the room, loading it on first use. Rooms whose setting cannot be loaded
+// are treated as not being in slow mode
+func (l *MessageLimiter) slowMode(ctx context.Context, roomID uuid.UUID) time.Duration {
+	l.mu.Lock()
+	interval, ok := l.slowModes[roomID]
+	l.mu.Unlock()
+	if ok {
+		return interval
+	}
+
+	room, err := l.roomService.GetByID(ctx, roomID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load slow mode of room", "room_id", roomID, "error", err)
+		return 0
+	}
+	interval = time.Duration(room.SlowModeSeconds) * time.Second
+	l.mu.Lock()
+	// the setting may have been updated while it was loading
+	if current, ok := l.slowModes[roomID]; ok {
+		interval = current
+	} else {
+		l.slowModes[roomID] = interval
+	}
+	l.mu.Unlock()
+	return interval
+}
+
+// SetSlowMode updates the slow mode interval of the room
+func (l *MessageLimiter) SetSlowMode(roomID uuid.UUID, seconds int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.slowModes[roomID] = time.Duration(seconds) * time.Second
+}
+
+// reset forgets the slow mode of all rooms so that it is loaded again, such as when updates may have been missed
+func (l *MessageLimiter) reset() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.slowModes)
+}
+
+// sweep drops the messages sent long enough ago that they no longer hold back their senders
+func (l *MessageLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, last := range l.lastSent {
+		if now.Sub(last) >= l.slowModes[key.roomID] {
+			delete(l.lastSent, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ws
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MemoryBus connects in-memory brokers so that several hubs in one process can exchange events
+type MemoryBus struct {
+	mu      sync.RWMutex
+	brokers []*MemoryBroker
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// NewBroker creates a broker attached to the bus
+func (b *MemoryBus) NewBroker() *MemoryBroker {
+	broker := &MemoryBroker{
+		bus:    b,
+		rooms:  make(map[uuid.UUID]bool),
+		ready:  make(chan struct{}, 1),
+		events: make(chan *Event),
+	}
+	b.mu.Lock()
+	b.brokers = append(b.brokers, broker)
+	b.mu.Unlock()
+	return broker
+}
+
+// MemoryBroker is an in-process broker for single node deployments and tests
+type MemoryBroker struct {
+	bus *MemoryBus
+
+	mu sync.Mutex
+	// subscribed rooms
+	rooms map[uuid.UUID]bool
+	// events waiting to be consumed. the queue is unbounded so publishers are never blocked by slow consumers
+	queue []*Event
+	// signals that the queue is no longer empty
+	ready chan struct{}
+
+	events chan *Event
+}
+
+// NewMemoryBroker creates a broker on its own bus
+func NewMemoryBroker() *MemoryBroker {
+	return NewMemoryBus().NewBroker()
+}
+
+func (b *MemoryBroker) Start(ctx context.Context) error {
+	go b.pump(ctx)
+	return nil
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, roomID uuid.UUID, evt *Event) error {
+	b.bus.mu.RLock()
+	defer b.bus.mu.RUnlock()
+	for _, broker := range b.bus.brokers {
+		broker.enqueue(roomID, evt)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rooms[roomID] = true
+	return nil
+}
+
+func (b *MemoryBroker) Unsubscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.rooms, roomID)
+	return nil
+}
+
+func (b *MemoryBroker) Events() <-chan *Event {
+	return b.events
+}
+
+func (b *MemoryBroker) enqueue(roomID uuid.UUID, evt *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if roomID != uuid.Nil && !b.rooms[roomID] {
+		return
+	}
+	b.queue = append(b.queue, evt)
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pump moves queued events onto the events channel in publish order
+func (b *MemoryBroker) pump(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.ready:
+			}
+			continue
+		}
+		evt := b.queue[0]
+		b.queue[0] = nil
+		b.queue = b.queue[1:]
+		b.mu.Unlock()
+
+		select {
+		case b.events <- evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
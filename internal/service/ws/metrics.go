@@ -0,0 +1,106 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// time a scrape waits for the hub to report the state of its rooms
+const statsTimeout = time.Second
+
+// deliveryMetrics are the websocket delivery metrics of a hub, exposed through its collector
+type deliveryMetrics struct {
+	// messages dropped because a client's send queue was full, keyed by overflow policy
+	droppedMessages *prometheus.CounterVec
+	// clients disconnected for not keeping up with their send queue
+	slowConsumerDisconnects prometheus.Counter
+	// time taken to queue a room message for all local clients of the room
+	fanoutDuration prometheus.Histogram
+}
+
+func newDeliveryMetrics() *deliveryMetrics {
+	return &deliveryMetrics{
+		droppedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chat_ws_dropped_messages_total",
+			Help: "Messages dropped because a client's send queue was full, by overflow policy.",
+		}, []string{"policy"}),
+		slowConsumerDisconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_ws_slow_consumer_disconnects_total",
+			Help: "Clients disconnected for not keeping up with their send queue.",
+		}),
+		fanoutDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "chat_ws_fanout_duration_seconds",
+			Help:    "Time taken to queue a room message for every local client of the room.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+	}
+}
+
+// roomStats is the state of an active room when the hub was asked for it
+type roomStats struct {
+	id      uuid.UUID
+	clients int64
+	queued  int
+}
+
+// hubCollector reports the state of the hub's rooms and of the message writer at scrape time
+type hubCollector struct {
+	hub *Hub
+
+	rooms         *prometheus.Desc
+	clients       *prometheus.Desc
+	roomQueue     *prometheus.Desc
+	writerQueue   *prometheus.Desc
+	statsTimeouts prometheus.Counter
+}
+
+// NewHubCollector creates a collector of the active rooms, the clients connected to them and the operations queued
+// for them, along with the delivery metrics of the hub
+func NewHubCollector(hub *Hub) prometheus.Collector {
+	// report no drops under the configured policy rather than no series until the first drop
+	hub.metrics.droppedMessages.WithLabelValues(string(hub.clientOptions.Overflow))
+	return &hubCollector{
+		hub:         hub,
+		rooms:       prometheus.NewDesc("chat_ws_active_rooms", "Rooms active on this node.", nil, nil),
+		clients:     prometheus.NewDesc("chat_ws_clients", "Clients connected to the room on this node.", []string{"room"}, nil),
+		roomQueue:   prometheus.NewDesc("chat_ws_room_queue_depth", "Operations routed to the room by the hub but not yet handled.", []string{"room"}, nil),
+		writerQueue: prometheus.NewDesc("chat_message_writer_queue_depth", "Messages waiting to be written in a batch.", nil, nil),
+		statsTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_ws_stats_timeouts_total",
+			Help: "Scrapes for which the hub was too busy to report the state of its rooms.",
+		}),
+	}
+}
+
+func (c *hubCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rooms
+	ch <- c.clients
+	ch <- c.roomQueue
+	ch <- c.writerQueue
+	c.statsTimeouts.Describe(ch)
+	c.hub.metrics.droppedMessages.Describe(ch)
+	c.hub.metrics.slowConsumerDisconnects.Describe(ch)
+	c.hub.metrics.fanoutDuration.Describe(ch)
+}
+
+func (c *hubCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.writerQueue, prometheus.GaugeValue, float64(c.hub.writer.Queued()))
+
+	// a stuck hub is reported through the timeouts rather than by hanging the scrape
+	if stats, ok := c.hub.stats(statsTimeout); ok {
+		ch <- prometheus.MustNewConstMetric(c.rooms, prometheus.GaugeValue, float64(len(stats)))
+		for _, room := range stats {
+			id := room.id.String()
+			ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(room.clients), id)
+			ch <- prometheus.MustNewConstMetric(c.roomQueue, prometheus.GaugeValue, float64(room.queued), id)
+		}
+	} else {
+		c.statsTimeouts.Inc()
+	}
+	c.statsTimeouts.Collect(ch)
+	c.hub.metrics.droppedMessages.Collect(ch)
+	c.hub.metrics.slowConsumerDisconnects.Collect(ch)
+	c.hub.metrics.fanoutDuration.Collect(ch)
+}
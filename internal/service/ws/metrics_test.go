@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fanouts returns the number of fan-outs observed by the hub collector registered with the registry
+func fanouts(tb testing.TB, registry *prometheus.Registry) uint64 {
+	tb.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "chat_ws_fanout_duration_seconds" {
+			return family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	tb.Fatal("fan-out duration not collected")
+	return 0
+}
+
+// TestHubCollectorsAreIndependent checks that the delivery metrics of hubs running in one process, each registered
+// with the registry of its server, only count the traffic of their own hub
+func TestHubCollectorsAreIndependent(t *testing.T) {
+	a, b := newTestHub(t), newTestHub(t)
+	registryA, registryB := prometheus.NewRegistry(), prometheus.NewRegistry()
+	registryA.MustRegister(NewHubCollector(a.Hub))
+	registryB.MustRegister(NewHubCollector(b.Hub))
+
+	room, users := a.createRoom(t, 2)
+	a.join(users[0], room.ID)
+	client := a.join(users[1], room.ID)
+	a.send(users[0], room.ID, "hello")
+	if _, err := receive(client, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := fanouts(t, registryA); n != 1 {
+		t.Fatalf("hub a reported %d fan-outs, want 1", n)
+	}
+	if n := fanouts(t, registryB); n != 0 {
+		t.Fatalf("hub b reported %d fan-outs, want 0", n)
+	}
+}
@@ -0,0 +1,231 @@
+package ws
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+const (
+	// postgres channel on which all hub events are relayed
+	notifyChannel = "chat_events"
+
+	// postgres rejects notification payloads of 8000 bytes or more
+	maxNotifyPayload = 7999
+
+	// delay before re-establishing a dropped subscriber connection
+	reconnectDelay = 2 * time.Second
+
+	// number of events that can be queued for publishing or consumption
+	brokerQueueSize = 256
+
+	// time allowed to load a message relayed by reference
+	messageLoadTimeout = 5 * time.Second
+)
+
+// ErrEventTooLarge is returned when an event cannot be published because it exceeds the broker's payload limit
+var ErrEventTooLarge = errors.New("event too large for broker")
+
+// MessageStore retrieves stored messages, for the brokers relaying messages by reference
+type MessageStore interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Message, error)
+}
+
+// envelope wraps an event with the room it was published to
+type envelope struct {
+	RoomID uuid.UUID `json:"roomId"`
+	Event  *Event    `json:"event"`
+}
+
+// PGBroker relays hub events between server instances through postgres LISTEN/NOTIFY. All rooms share a single
+// notification channel and events for rooms without a subscription are discarded on receipt. Messages too large for
+// a notification are relayed by id and loaded from the database by the receivers
+type PGBroker struct {
+	db       *sql.DB
+	connStr  string
+	messages MessageStore
+
+	mu    sync.RWMutex
+	rooms map[uuid.UUID]bool
+
+	// encoded events waiting to be published to other nodes
+	outbox chan *notification
+	// events received from all nodes
+	events chan *Event
+}
+
+// notification is an encoded event waiting to be published
+type notification struct {
+	event   EventType
+	payload string
+}
+
+// NewPGBroker creates a broker that publishes with the given pool and listens on a dedicated connection opened with
+// connStr. Messages relayed by reference are loaded from the store
+func NewPGBroker(db *sql.DB, connStr string, messages MessageStore) *PGBroker {
+	return &PGBroker{
+		db:       db,
+		connStr:  connStr,
+		messages: messages,
+		rooms:    make(map[uuid.UUID]bool),
+		outbox:   make(chan *notification, brokerQueueSize),
+		events:   make(chan *Event, brokerQueueSize),
+	}
+}
+
+func (b *PGBroker) Start(ctx context.Context) error {
+	go b.publish(ctx)
+	go b.listen(ctx)
+	return nil
+}
+
+// Publish queues the event for delivery. Stored messages too large for a notification are sent by id, while other
+// events exceeding the limit fail with ErrEventTooLarge. ErrBrokerQueueFull is returned when the queue is full
+func (b *PGBroker) Publish(ctx context.Context, roomID uuid.UUID, evt *Event) error {
+	payload, err := json.Marshal(&envelope{RoomID: roomID, Event: evt})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload && evt.Type == EventMessage && evt.Message != nil && evt.Message.ID != uuid.Nil {
+		ref := *evt
+		ref.Message, ref.MessageID = nil, &evt.Message.ID
+		if payload, err = json.Marshal(&envelope{RoomID: roomID, Event: &ref}); err != nil {
+			return err
+		}
+	}
+	if len(payload) > maxNotifyPayload {
+		return ErrEventTooLarge
+	}
+
+	select {
+	case b.outbox <- &notification{event: evt.Type, payload: string(payload)}:
+		return nil
+	default:
+		return ErrBrokerQueueFull
+	}
+}
+
+func (b *PGBroker) Subscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rooms[roomID] = true
+	return nil
+}
+
+func (b *PGBroker) Unsubscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.rooms, roomID)
+	return nil
+}
+
+func (b *PGBroker) Events() <-chan *Event {
+	return b.events
+}
+
+func (b *PGBroker) subscribed(roomID uuid.UUID) bool {
+	if roomID == uuid.Nil {
+		return true
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.rooms[roomID]
+}
+
+func (b *PGBroker) publish(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-b.outbox:
+			if _, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", notifyChannel, n.payload); err != nil {
+				slog.Error("failed to publish broker event", "event", n.event, "error", err)
+			}
+		}
+	}
+}
+
+// listen keeps a listener connection open, reconnecting whenever it drops
+func (b *PGBroker) listen(ctx context.Context) {
+	for {
+		conn, err := pgx.Connect(ctx, b.connStr)
+		if err == nil {
+			err = b.receive(ctx, conn)
+			conn.Close(context.Background())
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("broker listener disconnected", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *PGBroker) receive(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	// events may have been missed while the subscription was down
+	if !emit(ctx, b.events, &Event{Type: EventReset}) {
+		return ctx.Err()
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var env envelope
+		if err := json.Unmarshal([]byte(notification.Payload), &env); err != nil || env.Event == nil {
+			slog.Error("failed to decode broker event", "error", err)
+			continue
+		}
+		if !b.subscribed(env.RoomID) {
+			continue
+		}
+		if env.Event.Type == EventMessage && env.Event.Message == nil && env.Event.MessageID != nil {
+			if env.Event.Message = b.loadMessage(ctx, *env.Event.MessageID); env.Event.Message == nil {
+				continue
+			}
+		}
+		if !emit(ctx, b.events, env.Event) {
+			return ctx.Err()
+		}
+	}
+}
+
+// loadMessage retrieves a message relayed by reference, returning nil when it cannot be loaded, such as when it was
+// deleted in the meantime
+func (b *PGBroker) loadMessage(ctx context.Context, id uuid.UUID) *model.Message {
+	ctx, cancel := context.WithTimeout(ctx, messageLoadTimeout)
+	defer cancel()
+	message, err := b.messages.GetByID(ctx, id)
+	if err != nil {
+		slog.Error("failed to load relayed message", "message_id", id, "error", err)
+		return nil
+	}
+	return message
+}
+
+// emit delivers the event to the consumer, giving up when the context is cancelled
+func emit(ctx context.Context, events chan<- *Event, evt *Event) bool {
+	select {
+	case events <- evt:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/config"
+	"github.com/mrshabel/chat/internal/database"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/repository"
+)
+
+// env var holding the url of a postgres database the postgres broker is checked against, in a schema dropped
+// afterwards. The postgres checks are skipped when it is not set
+const postgresURLEnv = "TEST_POSTGRES_URL"
+
+// openPostgres migrates a throwaway schema of the test database, returning its repositories along with the pool and
+// url the brokers connect with
+func openPostgres(t *testing.T) (*repository.Repositories, *sql.DB, string) {
+	t.Helper()
+	dbURL := os.Getenv(postgresURLEnv)
+	if dbURL == "" {
+		t.Skipf("%s is not set", postgresURLEnv)
+	}
+	admin, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "brokertest_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema+",public")
+	u.RawQuery = query.Encode()
+	db, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closed before the schema is dropped, since cleanups run last in first out
+	t.Cleanup(func() { db.Close() })
+	migrator, err := database.NewMigrator(&database.DB{DB: db, Driver: config.DriverPostgres})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context(), 0); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return repository.NewPGRepositories(db), db, u.String()
+}
+
+// TestPGBrokerHubsShareRooms connects the users of a room to two hubs sharing one postgres database, checking that
+// messages reach the clients of both nodes, including messages too large for a notification
+func TestPGBrokerHubsShareRooms(t *testing.T) {
+	repos, db, connStr := openPostgres(t)
+	a := startTestHub(t, repos, NewPGBroker(db, connStr, repos.Messages))
+	b := startTestHub(t, repos, NewPGBroker(db, connStr, repos.Messages))
+	room, users := a.createRoom(t, 3)
+	alice, carol, bob := users[0], users[1], users[2]
+
+	a.join(alice, room.ID)
+	carolClient, bobClient := a.join(carol, room.ID), b.join(bob, room.ID)
+	// each node sees the clients of the other once its listener is up
+	a.waitMembers(t, room.ID, 3)
+	b.waitMembers(t, room.ID, 3)
+
+	// escaped in json, the large message is several times the notification limit
+	large := strings.Repeat("<", model.MaxMessageContentLength)
+	for _, content := range []string{"hello", large} {
+		a.send(alice, room.ID, content)
+		for _, client := range []*Client{carolClient, bobClient} {
+			received, err := receive(client, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if received[0].Content != content {
+				t.Fatalf("%s received a message of %d bytes, want %d", client.Username, len(received[0].Content), len(content))
+			}
+		}
+	}
+}
+
+// TestPGBrokerPublishLimit checks that stored messages too large for a notification are queued by id, and that other
+// large events are refused for the hub to deliver them locally
+func TestPGBrokerPublishLimit(t *testing.T) {
+	// never started, so that queued notifications stay in the outbox
+	broker := NewPGBroker(nil, "", nil)
+	roomID := uuid.New()
+	large := strings.Repeat("<", model.MaxMessageContentLength)
+
+	message := &model.Message{ID: uuid.New(), RoomID: roomID, Content: large}
+	if err := broker.Publish(t.Context(), roomID, &Event{Type: EventMessage, RoomID: roomID, Message: message}); err != nil {
+		t.Fatalf("published a large stored message with %v", err)
+	}
+	var env envelope
+	if err := json.Unmarshal([]byte((<-broker.outbox).payload), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Event.Message != nil || env.Event.MessageID == nil || *env.Event.MessageID != message.ID {
+		t.Fatalf("large message queued as %+v, want a reference to %s", env.Event, message.ID)
+	}
+
+	small := &model.Message{ID: uuid.New(), RoomID: roomID, Content: "hello"}
+	if err := broker.Publish(t.Context(), roomID, &Event{Type: EventMessage, RoomID: roomID, Message: small}); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte((<-broker.outbox).payload), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Event.Message == nil || env.Event.Message.Content != "hello" {
+		t.Fatalf("small message queued as %+v, want the message itself", env.Event)
+	}
+
+	evt := &Event{Type: EventEphemeral, RoomID: roomID, Message: &model.Message{Content: large}, User: &model.User{ID: uuid.New()}}
+	if err := broker.Publish(t.Context(), roomID, evt); !errors.Is(err, ErrEventTooLarge) {
+		t.Fatalf("published a large ephemeral message with %v, want %v", err, ErrEventTooLarge)
+	}
+}
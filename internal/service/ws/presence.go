@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mrshabel/chat/internal/model"
+)
+
+// presence tracks the clients connected to rooms on other nodes
+type presence struct {
+	mu sync.RWMutex
+	// node id -> room id -> user id -> username
+	nodes    map[uuid.UUID]map[uuid.UUID]map[uuid.UUID]string
+	lastSeen map[uuid.UUID]time.Time
+}
+
+func newPresence() *presence {
+	return &presence{
+		nodes:    make(map[uuid.UUID]map[uuid.UUID]map[uuid.UUID]string),
+		lastSeen: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// touch records that the node is alive
+func (p *presence) touch(nodeID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSeen[nodeID] = time.Now()
+}
+
+func (p *presence) join(nodeID, roomID uuid.UUID, user *model.User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSeen[nodeID] = time.Now()
+
+	rooms, ok := p.nodes[nodeID]
+	if !ok {
+		rooms = make(map[uuid.UUID]map[uuid.UUID]string)
+		p.nodes[nodeID] = rooms
+	}
+	members, ok := rooms[roomID]
+	if !ok {
+		members = make(map[uuid.UUID]string)
+		rooms[roomID] = members
+	}
+	members[user.ID] = user.Username
+}
+
+func (p *presence) leave(nodeID, roomID, userID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSeen[nodeID] = time.Now()
+
+	members := p.nodes[nodeID][roomID]
+	delete(members, userID)
+	if len(members) == 0 {
+		delete(p.nodes[nodeID], roomID)
+	}
+}
+
+// expire drops the state of nodes that have not been heard from since the given time
+func (p *presence) expire(since time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for nodeID, seen := range p.lastSeen {
+		if seen.Before(since) {
+			delete(p.lastSeen, nodeID)
+			delete(p.nodes, nodeID)
+		}
+	}
+}
+
+// reset drops all known remote state
+func (p *presence) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.nodes)
+	clear(p.lastSeen)
+}
+
+// members returns the users connected to the room across all remote nodes
+func (p *presence) members(roomID uuid.UUID) []model.User {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var users []model.User
+	for _, rooms := range p.nodes {
+		for id, username := range rooms[roomID] {
+			users = append(users, model.User{ID: id, Username: username})
+		}
+	}
+	return users
+}
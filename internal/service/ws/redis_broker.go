@@ -0,0 +1,276 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// time allowed to establish a connection to the redis server
+	redisDialTimeout = 5 * time.Second
+	// time allowed for the server to confirm a subscription
+	redisSubscribeTimeout = 5 * time.Second
+)
+
+// RedisBroker relays hub events between server instances through redis PUBLISH/SUBSCRIBE, with a channel per room.
+// It speaks the redis protocol directly so any compatible server can be used
+type RedisBroker struct {
+	addr string
+
+	// guards the subscriber connection and the subscription state
+	mu    sync.Mutex
+	rooms map[uuid.UUID]bool
+	sub   net.Conn
+	subW  *bufio.Writer
+	// subscriptions awaiting confirmation from the server, by channel. the server confirms every SUBSCRIBE in the
+	// order it was sent, so concurrent subscriptions to a channel are confirmed first come first served
+	pending map[string][]chan struct{}
+
+	// events waiting to be published to other nodes
+	outbox chan *envelope
+	// events received from all nodes
+	events chan *Event
+}
+
+// NewRedisBroker creates a broker for the redis server listening on addr
+func NewRedisBroker(addr string) *RedisBroker {
+	return &RedisBroker{
+		addr:    addr,
+		rooms:   make(map[uuid.UUID]bool),
+		pending: make(map[string][]chan struct{}),
+		outbox:  make(chan *envelope, brokerQueueSize),
+		events:  make(chan *Event, brokerQueueSize),
+	}
+}
+
+func (b *RedisBroker) Start(ctx context.Context) error {
+	go b.publish(ctx)
+	go b.listen(ctx)
+	return nil
+}
+
+// Publish queues the event for delivery. ErrBrokerQueueFull is returned when the queue is full
+func (b *RedisBroker) Publish(ctx context.Context, roomID uuid.UUID, evt *Event) error {
+	select {
+	case b.outbox <- &envelope{RoomID: roomID, Event: evt}:
+		return nil
+	default:
+		return ErrBrokerQueueFull
+	}
+}
+
+// Subscribe subscribes to the room's channel and waits for the server to confirm it. When disconnected the
+// subscription is recorded and established on reconnect
+func (b *RedisBroker) Subscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	b.rooms[roomID] = true
+	if b.sub == nil {
+		b.mu.Unlock()
+		return nil
+	}
+	channel := topic(roomID)
+	ack := make(chan struct{})
+	b.pending[channel] = append(b.pending[channel], ack)
+	err := b.send("SUBSCRIBE", channel)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, redisSubscribeTimeout)
+	defer cancel()
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *RedisBroker) Unsubscribe(ctx context.Context, roomID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.rooms, roomID)
+	if b.sub == nil {
+		return nil
+	}
+	return b.send("UNSUBSCRIBE", topic(roomID))
+}
+
+func (b *RedisBroker) Events() <-chan *Event {
+	return b.events
+}
+
+// send writes a command on the subscriber connection. The caller must hold the lock
+func (b *RedisBroker) send(args ...string) error {
+	b.sub.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := writeCommand(b.subW, args...); err != nil {
+		return err
+	}
+	return b.subW.Flush()
+}
+
+func (b *RedisBroker) subscribed(roomID uuid.UUID) bool {
+	if roomID == uuid.Nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rooms[roomID]
+}
+
+func (b *RedisBroker) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	return dialer.DialContext(ctx, "tcp", b.addr)
+}
+
+func (b *RedisBroker) publish(ctx context.Context) {
+	var (
+		conn net.Conn
+		r    *bufio.Reader
+		w    *bufio.Writer
+	)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case env := <-b.outbox:
+			payload, err := json.Marshal(env)
+			if err != nil {
+				slog.Error("failed to encode broker event", "event", env.Event.Type, "error", err)
+				continue
+			}
+			// connect lazily and drop the connection on failure so the next event reconnects
+			if conn == nil {
+				if conn, err = b.dial(ctx); err != nil {
+					slog.Error("failed to connect to redis", "error", err)
+					conn = nil
+					continue
+				}
+				r, w = bufio.NewReader(conn), bufio.NewWriter(conn)
+			}
+			conn.SetDeadline(time.Now().Add(writeTimeout))
+			if err = writeCommand(w, "PUBLISH", topic(env.RoomID), string(payload)); err == nil {
+				if err = w.Flush(); err == nil {
+					_, err = readReply(r)
+				}
+			}
+			if err != nil {
+				slog.Error("failed to publish broker event", "event", env.Event.Type, "error", err)
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					conn.Close()
+					conn = nil
+				}
+			}
+		}
+	}
+}
+
+// listen keeps a subscriber connection open, reconnecting and restoring subscriptions whenever it drops
+func (b *RedisBroker) listen(ctx context.Context) {
+	for {
+		conn, err := b.dial(ctx)
+		if err == nil {
+			err = b.receive(ctx, conn)
+			b.mu.Lock()
+			b.sub, b.subW = nil, nil
+			// confirmations will not come on this connection. the rooms are subscribed again on reconnect
+			for _, waiters := range b.pending {
+				for _, ack := range waiters {
+					close(ack)
+				}
+			}
+			clear(b.pending)
+			b.mu.Unlock()
+			conn.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("broker subscriber disconnected", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *RedisBroker) receive(ctx context.Context, conn net.Conn) error {
+	// unblock the read loop on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	b.mu.Lock()
+	b.sub, b.subW = conn, bufio.NewWriter(conn)
+	channels := []string{topic(uuid.Nil)}
+	for roomID := range b.rooms {
+		channels = append(channels, topic(roomID))
+	}
+	err := b.send(append([]string{"SUBSCRIBE"}, channels...)...)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// events may have been missed while the subscription was down
+	if !emit(ctx, b.events, &Event{Type: EventReset}) {
+		return ctx.Err()
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return err
+		}
+		items, ok := reply.([]any)
+		if !ok || len(items) < 3 {
+			continue
+		}
+		kind, _ := items[0].(string)
+		channel, _ := items[1].(string)
+
+		switch kind {
+		case "subscribe":
+			b.mu.Lock()
+			if waiters := b.pending[channel]; len(waiters) > 0 {
+				close(waiters[0])
+				if len(waiters) == 1 {
+					delete(b.pending, channel)
+				} else {
+					b.pending[channel] = waiters[1:]
+				}
+			}
+			b.mu.Unlock()
+		case "message":
+			payload, _ := items[2].(string)
+			var env envelope
+			if err := json.Unmarshal([]byte(payload), &env); err != nil || env.Event == nil {
+				slog.Error("failed to decode broker event", "error", err)
+				continue
+			}
+			if !b.subscribed(env.RoomID) {
+				continue
+			}
+			if !emit(ctx, b.events, env.Event) {
+				return ctx.Err()
+			}
+		}
+	}
+}
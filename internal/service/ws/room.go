@@ -0,0 +1,516 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/mrshabel/chat/internal/model"
+	"github.com/mrshabel/chat/internal/service"
+)
+
+// time a room without clients or pending work stays loaded before its goroutine is stopped. tests shorten it
+var roomIdleTimeout = 2 * time.Minute
+
+const (
+	// number of operations that can be queued for a room before routing to it blocks
+	roomQueueSize = 256
+
+	// number of messages that can wait for persistence before new ones are rejected
+	maxOutgoingMessages = 1000
+
+	// maximum number of missed messages replayed to a resuming client
+	maxBacklogMessages = 500
+)
+
+// Room holds all connected clients of a room. Each active room runs its own goroutine which owns all of its state,
+// with the hub only routing operations to it
+type Room struct {
+	// client id to connection mapping
+	Clients map[string]*Client
+	// number of clients, read by the hub when reporting metrics
+	connected atomic.Int64
+	ID        uuid.UUID
+	// most recent messages in chronological order, replayed to joining clients
+	Messages []*model.Message
+
+	// history is loaded from the db once, with clients joining in the meantime waiting for it
+	historyLoaded  bool
+	historyWaiters []*Client
+
+	// the room subscribes to its broker events in the background once it has a local client, since brokers may wait
+	// on the network. clients joining in the meantime wait for the subscription before catching up, so that no
+	// message is missed between their catch-up and the live messages
+	subscribed       bool
+	subscribing      bool
+	subscribeWaiters []*Client
+
+	hub *Hub
+
+	// operations routed by the hub
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan *model.Message
+	events     chan *Event
+	snapshots  chan chan []model.User
+	syncs      chan struct{}
+
+	// number of messages from clients waiting to be persisted
+	unpersisted int
+
+	// results of background work. pending counts the results not yet received. persistence results are received in
+	// the order the messages were sent, with room for the result of every message that can wait for persistence
+	// since the writer drops results it cannot hand back
+	histories     chan []*model.Message
+	backlogs      chan *clientBacklog
+	persisted     chan service.WriteResult
+	subscriptions chan error
+	pending       int
+
+	// the hub's answer to an idle room asking to be reaped
+	reaped chan bool
+}
+
+func newRoom(hub *Hub, id uuid.UUID) *Room {
+	return &Room{
+		Clients:       make(map[string]*Client),
+		ID:            id,
+		Messages:      make([]*model.Message, 0, MaxMessageLimit),
+		hub:           hub,
+		register:      make(chan *Client, roomQueueSize),
+		unregister:    make(chan *Client, roomQueueSize),
+		broadcast:     make(chan *model.Message, roomQueueSize),
+		events:        make(chan *Event, roomQueueSize),
+		snapshots:     make(chan chan []model.User, roomQueueSize),
+		syncs:         make(chan struct{}, roomQueueSize),
+		histories:     make(chan []*model.Message),
+		backlogs:      make(chan *clientBacklog),
+		persisted:     make(chan service.WriteResult, maxOutgoingMessages),
+		subscriptions: make(chan error),
+		reaped:        make(chan bool, 1),
+	}
+}
+
+// queued returns the number of operations routed to the room but not yet handled
+func (r *Room) queued() int {
+	return len(r.register) + len(r.unregister) + len(r.broadcast) + len(r.events) + len(r.snapshots) + len(r.syncs)
+}
+
+// run handles the room's operations until the hub reaps it after being idle, or stops
+func (r *Room) run() {
+	idle := time.NewTimer(roomIdleTimeout)
+	defer idle.Stop()
+	// set once the idle timeout fires to offer the room for reaping
+	var reap chan<- *Room
+
+	for {
+		select {
+		case client := <-r.register:
+			r.addClient(client)
+
+		case client := <-r.unregister:
+			// the client may have already been replaced or dropped
+			if r.Clients[client.ID.String()] == client {
+				r.removeClient(client)
+			}
+
+		case message := <-r.broadcast:
+			// messages are only fanned out once persisted
+			if r.unpersisted >= maxOutgoingMessages {
+				slog.Warn("dropping message, too many messages waiting for persistence", "room_id", r.ID, "user_id", message.SenderID)
+				continue
+			}
+			r.unpersisted++
+			r.pending++
+			r.hub.writer.Write(message, r.persisted)
+
+		case evt := <-r.events:
+			switch evt.Type {
+			case EventMessage:
+				r.deliver(evt.Message)
+			case EventReaction:
+				r.react(evt.Reaction)
+			case EventEphemeral:
+				r.whisper(evt.User.ID, evt.Message)
+			case EventCommand:
+				if client, ok := r.Clients[evt.User.ID.String()]; ok {
+					r.sendLive(client, &Frame{Type: FrameCommand, Command: evt.Command})
+				}
+			case EventKick:
+				if client, ok := r.Clients[evt.User.ID.String()]; ok {
+					client.close(websocket.ClosePolicyViolation, evt.Reason)
+					r.removeClient(client)
+				}
+			case EventSanction:
+				r.sanction(evt.Sanction)
+			case EventReport:
+				if client, ok := r.Clients[evt.User.ID.String()]; ok {
+					r.sendLive(client, &Frame{Type: FrameReport, Report: evt.Report})
+				}
+			case EventDelete:
+				r.remove(*evt.MessageID)
+			}
+
+		case users := <-r.snapshots:
+			users <- r.members()
+
+		case <-r.syncs:
+			// announce all clients to the requesting node
+			for _, client := range r.Clients {
+				r.hub.publish(uuid.Nil, &Event{Type: EventJoin, RoomID: r.ID, User: &model.User{ID: client.ID, Username: client.Username}})
+			}
+
+		case result := <-r.persisted:
+			r.unpersisted--
+			r.pending--
+			// messages that failed to persist are never fanned out
+			if result.Err != nil {
+				slog.Error("failed to persist client message", "room_id", r.ID, "error", result.Err)
+				continue
+			}
+			// local clients receive the message once it comes back from the broker
+			message := result.Message
+			r.hub.webhooks.Notify(message)
+			if err := r.hub.publish(r.ID, &Event{Type: EventMessage, RoomID: r.ID, Message: message}); err != nil {
+				slog.Error("failed to publish message", "room_id", r.ID, "error", err)
+				r.deliver(message)
+			}
+
+		case err := <-r.subscriptions:
+			r.pending--
+			r.subscribing = false
+			// brokers restore failed subscriptions once reconnected
+			if err != nil {
+				slog.Error("failed to subscribe to room", "room_id", r.ID, "error", err)
+			}
+			r.subscribed = true
+			waiters := r.subscribeWaiters
+			r.subscribeWaiters = nil
+			// every client may have left while subscribing
+			if len(r.Clients) == 0 {
+				r.unsubscribe()
+				break
+			}
+			for _, client := range waiters {
+				if r.Clients[client.ID.String()] == client {
+					r.startCatchUp(client)
+				}
+			}
+
+		case messages := <-r.histories:
+			r.pending--
+			r.Messages = messages
+			r.historyLoaded = messages != nil
+			for _, client := range r.historyWaiters {
+				// skip clients that left while the history was loading
+				if r.Clients[client.ID.String()] == client {
+					r.catchUp(client, messages)
+				}
+			}
+			r.historyWaiters = nil
+
+		case backlog := <-r.backlogs:
+			r.pending--
+			if r.Clients[backlog.client.ID.String()] != backlog.client {
+				continue
+			}
+			// clients that cannot be resumed receive the recent history instead
+			if backlog.messages == nil {
+				r.feedHistory(backlog.client)
+				continue
+			}
+			r.catchUp(backlog.client, backlog.messages)
+
+		case <-r.hub.done:
+			// the server is shutting down. clients still waiting to be added are closed as well, since the hub no
+			// longer routes anything to the room
+			for _, client := range r.Clients {
+				client.close(websocket.CloseGoingAway, "server shutting down")
+			}
+			for len(r.register) > 0 {
+				(<-r.register).close(websocket.CloseGoingAway, "server shutting down")
+			}
+			return
+
+		case <-idle.C:
+			reap = r.hub.idle
+			continue
+
+		case reap <- r:
+			// the hub declines when operations were routed to the room in the meantime
+			if <-r.reaped {
+				return
+			}
+			reap = nil
+		}
+
+		// restart the idle countdown after every operation
+		reap = nil
+		if len(r.Clients) == 0 && r.pending == 0 {
+			idle.Reset(roomIdleTimeout)
+		} else {
+			idle.Stop()
+		}
+	}
+}
+
+func (r *Room) addClient(client *Client) {
+	// the client may have left before the room got to its registration, in which case its unregistration was ignored
+	select {
+	case <-client.done:
+		return
+	default:
+	}
+	// a user joining again replaces their previous connection
+	if existing, ok := r.Clients[client.ID.String()]; ok {
+		existing.close(websocket.CloseNormalClosure, "connection replaced by a new session")
+	}
+	r.Clients[client.ID.String()] = client
+	r.connected.Store(int64(len(r.Clients)))
+	client.logger.Debug("client joined room")
+	r.hub.publish(uuid.Nil, &Event{Type: EventJoin, RoomID: r.ID, User: &model.User{ID: client.ID, Username: client.Username}})
+
+	// the client is held back from live messages until it has received the messages it missed
+	client.catchingUp = true
+	// receive the room's events from the broker once it has a local client
+	if !r.subscribed && !r.subscribing {
+		r.subscribing = true
+		r.pending++
+		go r.subscribe()
+	}
+	if r.subscribing {
+		r.subscribeWaiters = append(r.subscribeWaiters, client)
+		return
+	}
+	r.startCatchUp(client)
+}
+
+// startCatchUp retrieves the messages the client missed, either since its last message or the recent history
+func (r *Room) startCatchUp(client *Client) {
+	if client.ResumeAfter != uuid.Nil {
+		r.pending++
+		go r.loadBacklog(client)
+		return
+	}
+	r.feedHistory(client)
+}
+
+// feedHistory replays the recent history to the client, loading it from the db on first join
+func (r *Room) feedHistory(client *Client) {
+	if r.historyLoaded {
+		r.catchUp(client, r.Messages)
+		return
+	}
+	r.historyWaiters = append(r.historyWaiters, client)
+	if len(r.historyWaiters) == 1 {
+		r.pending++
+		go r.loadHistory()
+	}
+}
+
+// removeClient drops the client from the room and informs other nodes
+func (r *Room) removeClient(client *Client) {
+	delete(r.Clients, client.ID.String())
+	r.connected.Store(int64(len(r.Clients)))
+	client.logger.Debug("client left room")
+	// a subscription in progress is undone once established
+	if len(r.Clients) == 0 && r.subscribed {
+		r.unsubscribe()
+	}
+	r.hub.publish(uuid.Nil, &Event{Type: EventLeave, RoomID: r.ID, User: &model.User{ID: client.ID, Username: client.Username}})
+}
+
+// subscribe subscribes to the room's broker events and hands the outcome back to the room
+func (r *Room) subscribe() {
+	err := r.hub.broker.Subscribe(context.Background(), r.ID)
+	select {
+	case r.subscriptions <- err:
+	case <-r.hub.done:
+	}
+}
+
+func (r *Room) unsubscribe() {
+	r.subscribed = false
+	if err := r.hub.broker.Unsubscribe(context.Background(), r.ID); err != nil {
+		slog.Error("failed to unsubscribe from room", "room_id", r.ID, "error", err)
+	}
+}
+
+// deliver fans a message out to all clients in the room except its sender. The message is added to the history at
+// the same time so that joining clients never receive it twice
+func (r *Room) deliver(message *model.Message) {
+	if r.historyLoaded {
+		r.Messages = appendRecent(r.Messages, message)
+	}
+	start := time.Now()
+	frame := &Frame{Type: FrameMessage, Message: message}
+	for _, client := range r.Clients {
+		if client.ID == message.SenderID {
+			continue
+		}
+		r.sendLive(client, frame)
+	}
+	r.hub.metrics.fanoutDuration.Observe(time.Since(start).Seconds())
+}
+
+// remove drops a deleted message from the history, so that joining clients are no longer replayed it, then tells
+// the clients in the room to remove it
+func (r *Room) remove(messageID uuid.UUID) {
+	r.Messages = slices.DeleteFunc(r.Messages, func(message *model.Message) bool { return message.ID == messageID })
+	frame := &Frame{Type: FrameMessageDeleted, MessageID: &messageID}
+	for _, client := range r.Clients {
+		r.sendLive(client, frame)
+	}
+}
+
+// react fans a reaction out to all clients in the room except the reacting user
+func (r *Room) react(reaction *model.Reaction) {
+	frame := &Frame{Type: FrameReaction, Reaction: reaction}
+	for _, client := range r.Clients {
+		if client.ID == reaction.UserID {
+			continue
+		}
+		r.sendLive(client, frame)
+	}
+}
+
+// whisper sends an ephemeral message to the user's client, if connected to this node
+func (r *Room) whisper(userID uuid.UUID, message *model.Message) {
+	if client, ok := r.Clients[userID.String()]; ok {
+		r.sendLive(client, &Frame{Type: FrameEphemeral, Message: message})
+	}
+}
+
+// sanction enforces a sanction on the user's client, if connected to this node
+func (r *Room) sanction(sanction *model.Sanction) {
+	client, ok := r.Clients[sanction.UserID.String()]
+	if !ok {
+		return
+	}
+	active := sanction.Active(time.Now())
+	switch {
+	case sanction.Kind == model.SanctionBan && active:
+		client.close(websocket.ClosePolicyViolation, "banned from the room")
+		r.removeClient(client)
+	case sanction.Silences() && active:
+		client.Mute(sanction.ExpiresAt)
+	case sanction.Silences():
+		client.Unmute()
+	}
+}
+
+// sendLive sends a live frame to the client, holding it back while the client is catching up
+func (r *Room) sendLive(client *Client, frame *Frame) {
+	if client.catchingUp {
+		client.held = append(client.held, frame)
+		return
+	}
+	r.send(client, frame)
+}
+
+// catchUp sends the client the messages it missed followed by the live frames held back in the meantime, skipping
+// messages it has already received
+func (r *Room) catchUp(client *Client, messages []*model.Message) {
+	held := client.held
+	client.catchingUp, client.held = false, nil
+
+	sent := make(map[uuid.UUID]bool, len(messages))
+	for _, message := range messages {
+		sent[message.ID] = true
+		if !r.send(client, &Frame{Type: FrameMessage, Message: message}) {
+			return
+		}
+	}
+	for _, frame := range held {
+		if frame.Type == FrameMessage && sent[frame.Message.ID] {
+			continue
+		}
+		if !r.send(client, frame) {
+			return
+		}
+	}
+}
+
+// send queues the frame for the client, disconnecting it when it cannot keep up. It reports whether the client is
+// still connected
+func (r *Room) send(client *Client, frame *Frame) bool {
+	if client.enqueue(frame) {
+		return true
+	}
+	client.logger.Warn("disconnecting slow client", "overflows", client.overflows)
+	r.hub.metrics.slowConsumerDisconnects.Inc()
+	client.close(websocket.ClosePolicyViolation, "slow consumer: too many messages dropped")
+	r.removeClient(client)
+	return false
+}
+
+// loadHistory retrieves the recent messages of the room and hands them back to the room. A nil history is handed
+// back on failure so that waiting clients are released
+func (r *Room) loadHistory() {
+	messages, err := r.hub.messageService.GetByRoomID(context.Background(), r.ID, MaxMessageLimit, 0)
+	if err != nil {
+		slog.Error("failed to load recent messages of room", "room_id", r.ID, "error", err)
+		messages = nil
+	} else {
+		// messages are retrieved newest first
+		slices.Reverse(messages)
+		if messages == nil {
+			messages = make([]*model.Message, 0, MaxMessageLimit)
+		}
+	}
+	select {
+	case r.histories <- messages:
+	case <-r.hub.done:
+	}
+}
+
+// clientBacklog carries the messages a resuming client missed
+type clientBacklog struct {
+	client   *Client
+	messages []*model.Message
+}
+
+// loadBacklog retrieves the messages the resuming client missed and hands them back to the room. A nil backlog is
+// handed back when they cannot be determined, such as when the client's last message is unknown
+func (r *Room) loadBacklog(client *Client) {
+	messages, err := r.hub.messageService.GetByRoomIDAfter(context.Background(), r.ID, client.ResumeAfter, maxBacklogMessages)
+	if err != nil {
+		if !errors.Is(err, service.ErrMessageNotFound) {
+			slog.Error("failed to load missed messages of room", "room_id", r.ID, "error", err)
+		}
+		messages = nil
+	} else {
+		// messages are retrieved newest first
+		slices.Reverse(messages)
+		if messages == nil {
+			messages = make([]*model.Message, 0)
+		}
+	}
+	select {
+	case r.backlogs <- &clientBacklog{client: client, messages: messages}:
+	case <-r.hub.done:
+	}
+}
+
+// members returns the users connected to the room on this node
+func (r *Room) members() []model.User {
+	users := make([]model.User, 0, len(r.Clients))
+	for _, client := range r.Clients {
+		users = append(users, model.User{ID: client.ID, Username: client.Username})
+	}
+	return users
+}
+
+// appendRecent appends the message while keeping at most MaxMessageLimit messages
+func appendRecent(messages []*model.Message, message *model.Message) []*model.Message {
+	messages = append(messages, message)
+	if len(messages) > MaxMessageLimit {
+		messages = slices.Delete(messages, 0, len(messages)-MaxMessageLimit)
+	}
+	return messages
+}
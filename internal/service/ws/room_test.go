@@ -0,0 +1,183 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestRoomCatchUpKeepsOrder connects clients to a room while messages are sent to it, checking that every client
+// receives the recent history followed by the live messages without gaps or duplicates
+func TestRoomCatchUpKeepsOrder(t *testing.T) {
+	const (
+		joiners  = 20
+		messages = 200
+	)
+	h := newTestHub(t)
+	room, users := h.createRoom(t, joiners+1)
+	sender := users[0]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, joiners)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range messages {
+			h.send(sender, room.ID, strconv.Itoa(i))
+		}
+	}()
+	for i, user := range users[1:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// joining at different points of the stream
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			client := h.join(user, room.ID)
+			for next := -1; next != messages; {
+				received, err := receive(client, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+				n, _ := strconv.Atoi(received[0].Content)
+				if next >= 0 && n != next {
+					errs <- fmt.Errorf("%s: received message %d, want %d", user.Username, n, next)
+					return
+				}
+				next = n + 1
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestRoomReapedWhenIdle has clients join and leave many rooms concurrently, checking that every room is reaped
+// once idle and that its goroutines are released
+func TestRoomReapedWhenIdle(t *testing.T) {
+	const (
+		rooms   = 100
+		members = 3
+	)
+	defer func(timeout time.Duration) { roomIdleTimeout = timeout }(roomIdleTimeout)
+	roomIdleTimeout = 20 * time.Millisecond
+
+	h := newTestHub(t)
+	running := runtime.NumGoroutine()
+
+	// all clients join at once, then the first member of every room sends a message the others wait for before
+	// they all leave
+	var (
+		joining sync.WaitGroup
+		wg      sync.WaitGroup
+	)
+	joined := make(chan struct{})
+	errs := make(chan error, rooms*members)
+	roomIDs := make([]uuid.UUID, 0, rooms)
+	for range rooms {
+		room, users := h.createRoom(t, members)
+		roomIDs = append(roomIDs, room.ID)
+		for i, user := range users {
+			joining.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				client := h.join(user, room.ID)
+				joining.Done()
+				defer client.leave()
+				<-joined
+				if i == 0 {
+					h.send(user, room.ID, "hello")
+					return
+				}
+				if _, err := receive(client, 1); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	joining.Wait()
+	for _, roomID := range roomIDs {
+		h.waitMembers(t, roomID, members)
+	}
+	close(joined)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		stats, ok := h.stats(testTimeout)
+		if !ok {
+			t.Fatal("hub did not report its rooms")
+		}
+		if len(stats) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d rooms still active", len(stats))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitGoroutines(t, running)
+}
+
+// TestRoomDeleteDropsMessageFromHistory checks that a deleted message is removed from the clients in the room and is
+// not replayed to clients joining afterwards
+func TestRoomDeleteDropsMessageFromHistory(t *testing.T) {
+	h := newTestHub(t)
+	room, users := h.createRoom(t, 3)
+	sender, reader := users[0], users[1]
+	h.join(sender, room.ID)
+	client := h.join(reader, room.ID)
+	h.waitMembers(t, room.ID, 2)
+	for i := range 3 {
+		h.send(sender, room.ID, strconv.Itoa(i))
+	}
+	sent, err := receive(client, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := sent[1]
+	if err := h.repos.Messages.Delete(context.Background(), deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	h.DeleteMessage(room.ID, deleted.ID)
+	timeout := time.After(testTimeout)
+	for removed := false; !removed; {
+		select {
+		case frame := <-client.Inbox:
+			if frame.Type != FrameMessageDeleted {
+				continue
+			}
+			if *frame.MessageID != deleted.ID {
+				t.Fatalf("deleted message %s, want %s", frame.MessageID, deleted.ID)
+			}
+			removed = true
+		case <-timeout:
+			t.Fatal("deletion not sent to the room's clients")
+		}
+	}
+
+	replayed, err := receive(h.join(users[2], room.ID), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"0", "2"} {
+		if replayed[i].Content != want {
+			t.Fatalf("replayed message %d is %q, want %q", i, replayed[i].Content, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// interval of keep-alive comments on idle event streams, preventing proxies from closing them
+	streamKeepAliveInterval = 15 * time.Second
+
+	// reconnection delay suggested to event stream clients, in milliseconds
+	streamRetryMs = 3000
+)
+
+// StreamPump sends frames from the hub to the client as server-sent events named after the frame type, until the
+// request is done or the hub closes the client. Room message ids are used as event ids so that reconnecting clients
+// can resume with Last-Event-ID
+func (c *Client) StreamPump(ctx context.Context, w http.ResponseWriter) {
+	defer c.leave()
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(streamKeepAliveInterval)
+	defer ticker.Stop()
+
+	// write sends a single event, reporting whether the stream is still usable
+	write := func(format string, args ...any) bool {
+		rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !write("retry: %d\n\n", streamRetryMs) {
+		return
+	}
+	for {
+		select {
+		// frame received on client's channel
+		case frame := <-c.Inbox:
+			data, err := json.Marshal(frame.payload())
+			if err != nil {
+				continue
+			}
+			// only stored messages can be resumed from
+			var ok bool
+			if frame.Type == FrameMessage {
+				ok = write("id: %s\nevent: %s\ndata: %s\n\n", frame.Message.ID, frame.Type, data)
+			} else {
+				ok = write("event: %s\ndata: %s\n\n", frame.Type, data)
+			}
+			if !ok {
+				return
+			}
+		// client closed by hub so we end the stream, explaining why
+		case <-c.done:
+			data, _ := json.Marshal(map[string]any{"code": c.closeCode, "reason": c.closeReason})
+			write("event: close\ndata: %s\n\n", data)
+			return
+		case <-ticker.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
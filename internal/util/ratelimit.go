@@ -0,0 +1,79 @@
+package util
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// interval at which buckets that have refilled are dropped
+const rateLimiterSweepInterval = time.Minute
+
+// RateLimiter is a set of token buckets, one per key, refilling at a fixed rate up to a burst size. A nil limiter
+// allows everything
+type RateLimiter struct {
+	mu sync.Mutex
+	// tokens added per second
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing perMinute events per key on average, with up to burst at once. It returns
+// nil, which allows everything, when perMinute is not positive
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   math.Max(float64(burst), 1),
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false along with the time until a
+// token is available
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled since they were last used, as they are identical to new ones
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimiterSweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
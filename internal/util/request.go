@@ -3,6 +3,7 @@ package util
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -31,6 +32,19 @@ func GetQueryInt(r *http.Request, query string) (int, error) {
 	return int(val), nil
 }
 
+// GetQueryTime parses the RFC 3339 timestamp in the query param, returning nil when it is not provided
+func GetQueryTime(r *http.Request, query string) (*time.Time, error) {
+	val := r.URL.Query().Get(query)
+	if val == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // GetPaginationQuery retrieves and composes the skip(offset) and limit params. It defaults to the one specified if none is provided
 func GetPaginationQuery(r *http.Request, pageDefault, pageSizeDefault int) (int, int) {
 	page, err := GetQueryInt(r, "page")
@@ -2,7 +2,11 @@ package util
 
 import (
 	"encoding/json"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func WriteJSON(w http.ResponseWriter, data any, status int) {
@@ -15,3 +19,15 @@ func WriteJSON(w http.ResponseWriter, data any, status int) {
 func WriteError(w http.ResponseWriter, message string, status int) {
 	WriteJSON(w, map[string]string{"message": message}, status)
 }
+
+// WriteServerError logs the error that failed the request and writes an internal server error with the message
+func WriteServerError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "response", message, "error", err)
+	WriteError(w, message, http.StatusInternalServerError)
+}
+
+// WriteRateLimited writes a too many requests error, telling the client how many seconds to wait before retrying
+func WriteRateLimited(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	WriteError(w, message, http.StatusTooManyRequests)
+}